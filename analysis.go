@@ -0,0 +1,569 @@
+package mapmyride
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WorkoutStepCadence is a point in time cadence derived from a
+// workout's steps, covering the period since the previous step
+// measurement.
+type WorkoutStepCadence struct {
+	Elapsed        time.Duration
+	StepsPerMinute float64
+}
+
+// StepCadences derives a cadence series from w.Steps.
+func (w Workout) StepCadences() []WorkoutStepCadence {
+	var (
+		out  []WorkoutStepCadence
+		prev time.Duration
+	)
+	for _, s := range w.Steps {
+		period := s.Elapsed - prev
+		prev = s.Elapsed
+		if period <= 0 {
+			continue
+		}
+		out = append(out, WorkoutStepCadence{
+			Elapsed:        s.Elapsed,
+			StepsPerMinute: s.StepsInPeriod / period.Minutes(),
+		})
+	}
+	return out
+}
+
+// AverageStepCadence returns the average steps per minute over w.Steps,
+// or 0 if there are none.
+func (w Workout) AverageStepCadence() float64 {
+	if len(w.Steps) == 0 {
+		return 0
+	}
+
+	var total float64
+	for _, s := range w.Steps {
+		total += s.StepsInPeriod
+	}
+
+	elapsed := w.Steps[len(w.Steps)-1].Elapsed
+	if elapsed <= 0 {
+		return 0
+	}
+	return total / elapsed.Minutes()
+}
+
+// WorkoutStride is a point in time stride length derived from a
+// workout's steps and distances, covering the period since the previous
+// step measurement.
+type WorkoutStride struct {
+	Elapsed time.Duration
+	Meters  float64
+}
+
+// Strides derives a stride length series by dividing the distance
+// covered in each step measurement's period by the steps taken in it.
+// It returns nil if w has no steps or distances.
+func (w Workout) Strides() []WorkoutStride {
+	if len(w.Distances) == 0 {
+		return nil
+	}
+
+	var (
+		out  []WorkoutStride
+		prev time.Duration
+	)
+	for _, s := range w.Steps {
+		from := prev
+		prev = s.Elapsed
+		if s.Elapsed <= from || s.StepsInPeriod <= 0 {
+			continue
+		}
+		out = append(out, WorkoutStride{
+			Elapsed: s.Elapsed,
+			Meters:  (w.distanceAt(s.Elapsed) - w.distanceAt(from)) / s.StepsInPeriod,
+		})
+	}
+	return out
+}
+
+// AverageStride returns the average stride length in meters over the
+// periods covered by w.Steps, or 0 if it can't be computed.
+func (w Workout) AverageStride() float64 {
+	if len(w.Distances) == 0 || len(w.Steps) == 0 {
+		return 0
+	}
+
+	var steps float64
+	for _, s := range w.Steps {
+		steps += s.StepsInPeriod
+	}
+	if steps <= 0 {
+		return 0
+	}
+	return w.distanceAt(w.Steps[len(w.Steps)-1].Elapsed) / steps
+}
+
+// distanceAt returns the total distance at elapsed, interpolating
+// linearly between w.Distances. The distance at zero elapsed time is
+// taken to be zero, and times after the last measurement get its total.
+func (w Workout) distanceAt(elapsed time.Duration) float64 {
+	prev := WorkoutDistance{}
+	for _, d := range w.Distances {
+		if d.Elapsed >= elapsed {
+			if d.Elapsed == prev.Elapsed {
+				return d.Total
+			}
+			frac := float64(elapsed-prev.Elapsed) / float64(d.Elapsed-prev.Elapsed)
+			return prev.Total + frac*(d.Total-prev.Total)
+		}
+		prev = d
+	}
+	return prev.Total
+}
+
+// WorkoutPause is an interval during a workout in which nothing was
+// recorded, from the elapsed time of the last measurement before it to
+// the first one after.
+type WorkoutPause struct {
+	Start, End time.Duration
+}
+
+// Duration returns the length of the pause.
+func (p WorkoutPause) Duration() time.Duration {
+	return p.End - p.Start
+}
+
+// minPauseGap is the shortest gap between measurements treated as a
+// pause, regardless of the workout's usual measurement interval.
+const minPauseGap = 10 * time.Second
+
+// Pauses locates w's pauses as gaps in its densest time series. Elapsed
+// times only count paused time if the recording kept counting through
+// pauses, which shows as the series spanning longer than Duration, the
+// time spent moving. The largest gaps of at least 10 seconds and five
+// times the median interval between measurements are taken as pauses
+// until they account for that excess, less the median interval for each.
+// Workouts whose series leave pauses out, or whose Duration isn't known,
+// have none.
+func (w Workout) Pauses() []WorkoutPause {
+	times := w.seriesTimes()
+	if len(times) < 2 || w.Duration <= 0 {
+		return nil
+	}
+	excess := times[len(times)-1] - times[0] - w.Duration
+	if excess < minPauseGap {
+		return nil
+	}
+
+	gaps := make([]int, 0, len(times)-1)
+	intervals := make([]time.Duration, 0, len(times)-1)
+	for i := 1; i < len(times); i++ {
+		gaps = append(gaps, i-1)
+		intervals = append(intervals, times[i]-times[i-1])
+	}
+	sorted := append([]time.Duration(nil), intervals...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	median := sorted[len(sorted)/2]
+	threshold := 5 * median
+	if threshold < minPauseGap {
+		threshold = minPauseGap
+	}
+	sort.SliceStable(gaps, func(i, j int) bool { return intervals[gaps[i]] > intervals[gaps[j]] })
+
+	var out []WorkoutPause
+	for _, g := range gaps {
+		if excess < minPauseGap || intervals[g] < threshold {
+			break
+		}
+		out = append(out, WorkoutPause{Start: times[g], End: times[g+1]})
+		excess -= intervals[g] - median
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	return out
+}
+
+// PausedTime returns how long w was paused for: the difference between
+// ElapsedTime and Duration if both are known, or else the total of
+// w.Pauses().
+func (w Workout) PausedTime() time.Duration {
+	if w.ElapsedTime > 0 && w.Duration > 0 {
+		if w.ElapsedTime <= w.Duration {
+			return 0
+		}
+		return w.ElapsedTime - w.Duration
+	}
+
+	var total time.Duration
+	for _, p := range w.Pauses() {
+		total += p.Duration()
+	}
+	return total
+}
+
+// seriesTimes returns the elapsed times of w's longest time series.
+func (w Workout) seriesTimes() []time.Duration {
+	var out []time.Duration
+	switch {
+	case len(w.Positions) >= len(w.Distances) && len(w.Positions) >= len(w.Speeds):
+		for _, p := range w.Positions {
+			out = append(out, p.Elapsed)
+		}
+	case len(w.Distances) >= len(w.Speeds):
+		for _, d := range w.Distances {
+			out = append(out, d.Elapsed)
+		}
+	default:
+		for _, s := range w.Speeds {
+			out = append(out, s.Elapsed)
+		}
+	}
+	return out
+}
+
+// CurvePoint is the best average of a series sustained over Duration.
+type CurvePoint struct {
+	Duration time.Duration
+	Value    float64
+}
+
+// DefaultCurveDurations are the durations commonly used for mean-maximal
+// curves.
+var DefaultCurveDurations = []time.Duration{
+	time.Second,
+	time.Minute,
+	5 * time.Minute,
+	20 * time.Minute,
+	60 * time.Minute,
+}
+
+// SpeedCurve returns the best average speed, in meters per second, that w
+// sustained for each of durations. Durations longer than w's speed series
+// are omitted.
+func (w Workout) SpeedCurve(durations ...time.Duration) []CurvePoint {
+	times := make([]time.Duration, 0, len(w.Speeds))
+	values := make([]float64, 0, len(w.Speeds))
+	for _, s := range w.Speeds {
+		times = append(times, s.Elapsed)
+		values = append(values, s.MetersPerSecond)
+	}
+	return meanMaximal(times, values, durations)
+}
+
+// speedSmoothingSpan is how far either side of a speed measurement
+// SmoothedSpeeds looks for measurements to take the median of.
+const speedSmoothingSpan = 5 * time.Second
+
+// SmoothedSpeeds returns w.Speeds with each measurement replaced by the
+// median of those within 5 seconds either side of it. A median drops the
+// one-reading jumps GPS is prone to, rather than spreading them out as an
+// average would.
+func (w Workout) SmoothedSpeeds() []WorkoutSpeed {
+	if len(w.Speeds) == 0 {
+		return nil
+	}
+
+	out := make([]WorkoutSpeed, len(w.Speeds))
+	var (
+		lo, hi int
+		window []float64
+	)
+	for i, s := range w.Speeds {
+		for w.Speeds[lo].Elapsed < s.Elapsed-speedSmoothingSpan {
+			lo++
+		}
+		for hi < len(w.Speeds) && w.Speeds[hi].Elapsed <= s.Elapsed+speedSmoothingSpan {
+			hi++
+		}
+
+		window = window[:0]
+		for _, ws := range w.Speeds[lo:hi] {
+			window = append(window, ws.MetersPerSecond)
+		}
+		sort.Float64s(window)
+		median := window[len(window)/2]
+		if len(window)%2 == 0 {
+			median = (window[len(window)/2-1] + median) / 2
+		}
+		out[i] = WorkoutSpeed{Elapsed: s.Elapsed, MetersPerSecond: median}
+	}
+	return out
+}
+
+// MaxSpeed returns the highest of w.Speeds as recorded, in meters per
+// second, or 0 if it has none. See CorrectedMaxSpeed for one less prone
+// to GPS glitches.
+func (w Workout) MaxSpeed() float64 {
+	return maxSpeed(w.Speeds)
+}
+
+// CorrectedMaxSpeed returns the highest of w.SmoothedSpeeds(), in meters
+// per second, or 0 if it has none.
+func (w Workout) CorrectedMaxSpeed() float64 {
+	return maxSpeed(w.SmoothedSpeeds())
+}
+
+func maxSpeed(speeds []WorkoutSpeed) float64 {
+	var max float64
+	for _, s := range speeds {
+		max = math.Max(max, s.MetersPerSecond)
+	}
+	return max
+}
+
+// CorrectedAverageSpeed returns the average of w.SmoothedSpeeds(), in
+// meters per second, weighted by the time each measurement covers and
+// leaving out pauses, or 0 if it has no speeds.
+func (w Workout) CorrectedAverageSpeed() float64 {
+	speeds := w.SmoothedSpeeds()
+	if len(speeds) == 0 {
+		return 0
+	}
+
+	var (
+		sum   float64
+		total time.Duration
+	)
+	pauses := w.Pauses()
+	prev := speeds[0].Elapsed
+	for _, s := range speeds[1:] {
+		from := prev
+		prev = s.Elapsed
+		if s.Elapsed <= from || inPause(pauses, from, s.Elapsed) {
+			continue
+		}
+		sum += s.MetersPerSecond * (s.Elapsed - from).Seconds()
+		total += s.Elapsed - from
+	}
+	if total <= 0 {
+		return 0
+	}
+	return sum / total.Seconds()
+}
+
+// meanMaximal computes a mean-maximal curve for a series. The series is
+// resampled to one value per second, with each measurement taken to
+// cover the time since the previous one.
+func meanMaximal(times []time.Duration, values []float64, durations []time.Duration) []CurvePoint {
+	if len(times) == 0 {
+		return nil
+	}
+
+	var (
+		perSecond []float64
+		i         int
+	)
+	for s := times[0].Truncate(time.Second) + time.Second; s <= times[len(times)-1]; s += time.Second {
+		for times[i] < s {
+			i++
+		}
+		perSecond = append(perSecond, values[i])
+	}
+
+	var out []CurvePoint
+	for _, d := range durations {
+		n := int(d / time.Second)
+		if n < 1 || n > len(perSecond) {
+			continue
+		}
+
+		var sum float64
+		for _, v := range perSecond[:n] {
+			sum += v
+		}
+		best := sum
+		for j := n; j < len(perSecond); j++ {
+			sum += perSecond[j] - perSecond[j-n]
+			if sum > best {
+				best = sum
+			}
+		}
+		out = append(out, CurvePoint{Duration: d, Value: best / float64(n)})
+	}
+	return out
+}
+
+// WorkoutClimb is a sustained climb detected in a workout's positions.
+type WorkoutClimb struct {
+	Start, End time.Duration
+	Gain       float64 // meters
+}
+
+// VAM returns the climb's vertical ascent rate in meters per hour.
+func (c WorkoutClimb) VAM() float64 {
+	if c.End <= c.Start {
+		return 0
+	}
+	return c.Gain / (c.End - c.Start).Hours()
+}
+
+const (
+	// minClimbGain is the least gain counted as a climb.
+	minClimbGain = 30 // meters
+	// minClimbDuration is the shortest climb, so GPS elevation spikes
+	// aren't taken for implausibly steep ones.
+	minClimbDuration = time.Minute
+	// climbDescentTolerance is how far elevation may fall from its
+	// high point before a climb is considered over.
+	climbDescentTolerance = 10 // meters
+)
+
+// Climbs detects climbs in w.Positions: rises of at least 30 meters over
+// at least a minute from a low point to a high point, ending once
+// elevation falls more than 10 meters below the high point.
+func (w Workout) Climbs() []WorkoutClimb {
+	if len(w.Positions) == 0 {
+		return nil
+	}
+
+	var (
+		out       []WorkoutClimb
+		low, high = w.Positions[0], w.Positions[0]
+	)
+	for _, p := range w.Positions[1:] {
+		if high.Elevation-p.Elevation > climbDescentTolerance {
+			if c, ok := climb(low, high); ok {
+				out = append(out, c)
+			}
+			low, high = p, p
+			continue
+		}
+		if p.Elevation < low.Elevation {
+			low, high = p, p
+		}
+		if p.Elevation > high.Elevation {
+			high = p
+		}
+	}
+	if c, ok := climb(low, high); ok {
+		out = append(out, c)
+	}
+	return out
+}
+
+// climb returns the climb from low to high, if it's big and long enough
+// to count as one.
+func climb(low, high WorkoutPosition) (WorkoutClimb, bool) {
+	c := WorkoutClimb{Start: low.Elapsed, End: high.Elapsed, Gain: high.Elevation - low.Elevation}
+	return c, c.Gain >= minClimbGain && c.End-c.Start >= minClimbDuration
+}
+
+// VAM returns w's overall vertical ascent rate, its gain over its
+// duration, in meters per hour, or 0 if its duration is unknown.
+func (w Workout) VAM() float64 {
+	if w.Duration <= 0 {
+		return 0
+	}
+	return w.Gain / w.Duration.Hours()
+}
+
+// Zones are training zone boundaries, such as heart rates in beats per
+// minute. Each is the lower bound of a zone after the first, in ascending
+// order, so Zones{120, 140} has three zones: below 120, 120 up to 140, and
+// 140 and above.
+type Zones []float64
+
+// ParseZones parses comma-separated zone boundaries, such as
+// "120,140,155,170".
+func ParseZones(s string) (Zones, error) {
+	var z Zones
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing zone boundary %q: %w", f, err)
+		}
+		if len(z) > 0 && v <= z[len(z)-1] {
+			return nil, fmt.Errorf("zone boundaries must be ascending, got %v after %v", v, z[len(z)-1])
+		}
+		z = append(z, v)
+	}
+	return z, nil
+}
+
+func (z Zones) String() string {
+	fs := make([]string, 0, len(z))
+	for _, v := range z {
+		fs = append(fs, strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	return strings.Join(fs, ",")
+}
+
+// Zone returns the zone, numbered from 1, that v falls in.
+func (z Zones) Zone(v float64) int {
+	return sort.Search(len(z), func(i int) bool { return z[i] > v }) + 1
+}
+
+// HeartRateZoneTimes returns how long w spent in each of the len(z)+1
+// heart rate zones, indexed from zone 1. Each measurement is taken to
+// cover the time since the previous one, except during w.Pauses(). It
+// returns nil if w has no heart rates.
+func (w Workout) HeartRateZoneTimes(z Zones) []time.Duration {
+	if len(w.HeartRates) == 0 {
+		return nil
+	}
+
+	out := make([]time.Duration, len(z)+1)
+	w.eachHeartRate(func(bpm float64, d time.Duration) {
+		out[z.Zone(bpm)-1] += d
+	})
+	return out
+}
+
+// AverageHeartRate returns w's average heart rate weighted by the time
+// each measurement covers, leaving out pauses, or 0 if it has no heart
+// rates.
+func (w Workout) AverageHeartRate() float64 {
+	var (
+		sum   float64
+		total time.Duration
+	)
+	w.eachHeartRate(func(bpm float64, d time.Duration) {
+		sum += bpm * d.Seconds()
+		total += d
+	})
+	if total <= 0 {
+		return 0
+	}
+	return sum / total.Seconds()
+}
+
+// eachHeartRate calls fn with each of w's heart rates and the time since
+// the previous measurement that it covers, skipping those in pauses.
+func (w Workout) eachHeartRate(fn func(bpm float64, d time.Duration)) {
+	if len(w.HeartRates) == 0 {
+		return
+	}
+
+	pauses := w.Pauses()
+	prev := w.HeartRates[0].Elapsed
+	for _, hr := range w.HeartRates[1:] {
+		from := prev
+		prev = hr.Elapsed
+		if hr.Elapsed <= from || inPause(pauses, from, hr.Elapsed) {
+			continue
+		}
+		fn(hr.BeatsPerMinute, hr.Elapsed-from)
+	}
+}
+
+// Effort returns a training load score for d at intensity, the ratio of
+// an effort to its threshold such as average heart rate over threshold
+// heart rate. It is hours × intensity² × 100, so an hour at threshold
+// scores 100.
+func Effort(d time.Duration, intensity float64) float64 {
+	return d.Hours() * intensity * intensity * 100
+}
+
+// inPause reports whether the period from start to end falls within one
+// of pauses.
+func inPause(pauses []WorkoutPause, start, end time.Duration) bool {
+	for _, p := range pauses {
+		if start >= p.Start && end <= p.End {
+			return true
+		}
+	}
+	return false
+}
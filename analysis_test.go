@@ -0,0 +1,302 @@
+package mapmyride
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWorkoutStepCadences(t *testing.T) {
+	w := Workout{
+		Steps: []WorkoutStep{
+			{Elapsed: 30 * time.Second, StepsInPeriod: 80},
+			{Elapsed: 30 * time.Second, StepsInPeriod: 5}, // duplicate time, skipped
+			{Elapsed: 60 * time.Second, StepsInPeriod: 85},
+			{Elapsed: 2 * time.Minute, StepsInPeriod: 170},
+		},
+	}
+
+	want := []WorkoutStepCadence{
+		{Elapsed: 30 * time.Second, StepsPerMinute: 160},
+		{Elapsed: 60 * time.Second, StepsPerMinute: 170},
+		{Elapsed: 2 * time.Minute, StepsPerMinute: 170},
+	}
+	if d := cmp.Diff(want, w.StepCadences()); d != "" {
+		t.Errorf("cadences mismatch (-want +got):\n%s", d)
+	}
+
+	if got, want := w.AverageStepCadence(), 170.0; got != want {
+		t.Errorf("got average cadence %v, want %v", got, want)
+	}
+
+	if got := (Workout{}).AverageStepCadence(); got != 0 {
+		t.Errorf("got average cadence %v for no steps, want 0", got)
+	}
+}
+
+func TestWorkoutStrides(t *testing.T) {
+	w := Workout{
+		Distances: []WorkoutDistance{
+			{Elapsed: 20 * time.Second, Total: 50},
+			{Elapsed: 60 * time.Second, Total: 170},
+			{Elapsed: 90 * time.Second, Total: 240},
+		},
+		Steps: []WorkoutStep{
+			{Elapsed: 30 * time.Second, StepsInPeriod: 80},
+			{Elapsed: 60 * time.Second, StepsInPeriod: 80},
+			{Elapsed: 2 * time.Minute, StepsInPeriod: 0}, // no steps, skipped
+		},
+	}
+
+	want := []WorkoutStride{
+		{Elapsed: 30 * time.Second, Meters: 80.0 / 80},
+		{Elapsed: 60 * time.Second, Meters: 90.0 / 80},
+	}
+	if d := cmp.Diff(want, w.Strides()); d != "" {
+		t.Errorf("strides mismatch (-want +got):\n%s", d)
+	}
+
+	if got, want := w.AverageStride(), 240.0/160; got != want {
+		t.Errorf("got average stride %v, want %v", got, want)
+	}
+
+	if got := (Workout{Steps: w.Steps}).Strides(); got != nil {
+		t.Errorf("got strides %v without distances, want nil", got)
+	}
+}
+
+func TestWorkoutPauses(t *testing.T) {
+	// 20 seconds moving over a minute of measurements, paused twice.
+	w := Workout{Duration: 20 * time.Second}
+	for _, s := range []int{0, 2, 4, 6, 8, 40, 42, 44, 46, 58, 60} {
+		w.Positions = append(w.Positions, WorkoutPosition{Elapsed: time.Duration(s) * time.Second})
+	}
+	// Sparser series are ignored.
+	w.Speeds = []WorkoutSpeed{{Elapsed: 0}, {Elapsed: 60 * time.Second}}
+
+	want := []WorkoutPause{
+		{Start: 8 * time.Second, End: 40 * time.Second},
+		{Start: 46 * time.Second, End: 58 * time.Second},
+	}
+	if d := cmp.Diff(want, w.Pauses()); d != "" {
+		t.Errorf("pauses mismatch (-want +got):\n%s", d)
+	}
+
+	if got, want := w.PausedTime(), 44*time.Second; got != want {
+		t.Errorf("got paused time %v, want %v", got, want)
+	}
+
+	// Only enough of the largest gaps to account for the time not moving
+	// are pauses.
+	short := w
+	short.Duration = 36 * time.Second
+	if d := cmp.Diff(want[:1], short.Pauses()); d != "" {
+		t.Errorf("pauses mismatch with a longer duration (-want +got):\n%s", d)
+	}
+
+	// A series that leaves out paused time has no gaps to find.
+	moving := w
+	moving.Duration = time.Minute
+	if got := moving.Pauses(); got != nil {
+		t.Errorf("got pauses %v for a series spanning its duration, want nil", got)
+	}
+	unknown := w
+	unknown.Duration = 0
+	if got := unknown.Pauses(); got != nil {
+		t.Errorf("got pauses %v without a duration, want nil", got)
+	}
+
+	// The site's elapsed time is used when it's known.
+	moving.ElapsedTime = 75 * time.Second
+	if got, want := moving.PausedTime(), 15*time.Second; got != want {
+		t.Errorf("got paused time %v with elapsed time, want %v", got, want)
+	}
+
+	if got := (Workout{}).Pauses(); got != nil {
+		t.Errorf("got pauses %v for empty workout, want nil", got)
+	}
+}
+
+func TestWorkoutSpeedCurve(t *testing.T) {
+	var w Workout
+	// 10 m/s for the first minute, 5 m/s after, with a one second
+	// spike to 20 m/s at 90s.
+	for s := 0; s <= 180; s += 2 {
+		v := 5.0
+		if s <= 60 {
+			v = 10
+		}
+		if s == 90 {
+			v = 20
+		}
+		w.Speeds = append(w.Speeds, WorkoutSpeed{Elapsed: time.Duration(s) * time.Second, MetersPerSecond: v})
+	}
+
+	got := w.SpeedCurve(time.Second, time.Minute, 2*time.Minute, time.Hour)
+	want := []CurvePoint{
+		{Duration: time.Second, Value: 20},
+		{Duration: time.Minute, Value: 10},
+		{Duration: 2 * time.Minute, Value: (60*10 + 2*20 + 58*5) / 120.0},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("curve mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestWorkoutSmoothedSpeeds(t *testing.T) {
+	var w Workout
+	// 5 m/s every second for 20 seconds with a jump to 40 m/s at 10s.
+	for s := 0; s <= 20; s++ {
+		v := 5.0
+		if s == 10 {
+			v = 40
+		}
+		w.Speeds = append(w.Speeds, WorkoutSpeed{Elapsed: time.Duration(s) * time.Second, MetersPerSecond: v})
+	}
+
+	for _, s := range w.SmoothedSpeeds() {
+		if s.MetersPerSecond != 5 {
+			t.Errorf("got smoothed speed %v at %s, want 5", s.MetersPerSecond, s.Elapsed)
+		}
+	}
+	if got := w.MaxSpeed(); got != 40 {
+		t.Errorf("got max speed %v, want 40", got)
+	}
+	if got := w.CorrectedMaxSpeed(); got != 5 {
+		t.Errorf("got corrected max speed %v, want 5", got)
+	}
+	if got := w.CorrectedAverageSpeed(); got != 5 {
+		t.Errorf("got corrected average speed %v, want 5", got)
+	}
+
+	// A sustained change survives smoothing.
+	w.Speeds = nil
+	for s := 0; s <= 20; s++ {
+		v := 5.0
+		if s >= 10 {
+			v = 10
+		}
+		w.Speeds = append(w.Speeds, WorkoutSpeed{Elapsed: time.Duration(s) * time.Second, MetersPerSecond: v})
+	}
+	if got := w.CorrectedMaxSpeed(); got != 10 {
+		t.Errorf("got corrected max speed %v after step, want 10", got)
+	}
+
+	if got := (Workout{}).SmoothedSpeeds(); got != nil {
+		t.Errorf("got smoothed speeds %v for no speeds, want nil", got)
+	}
+}
+
+func TestWorkoutClimbs(t *testing.T) {
+	var w Workout
+	for i, el := range []float64{
+		100, 95, 110, 130, 125, 150, 145, // climb 95 -> 150 at 30s..150s
+		120, 125, 140, // 30 below the high, not enough to climb again
+		100, 110, 120, 135, 132, // climb 100 -> 135 at 300s..390s
+	} {
+		w.Positions = append(w.Positions, WorkoutPosition{Elapsed: time.Duration(i*30) * time.Second, Elevation: el})
+	}
+	// An elevation spike from a GPS glitch, 80 meters up and back down
+	// within seconds, isn't a climb.
+	for _, p := range []WorkoutPosition{
+		{Elapsed: 450 * time.Second, Elevation: 100},
+		{Elapsed: 452 * time.Second, Elevation: 180},
+		{Elapsed: 454 * time.Second, Elevation: 100},
+		{Elapsed: 480 * time.Second, Elevation: 100},
+	} {
+		w.Positions = append(w.Positions, p)
+	}
+
+	want := []WorkoutClimb{
+		{Start: 30 * time.Second, End: 150 * time.Second, Gain: 55},
+		{Start: 300 * time.Second, End: 390 * time.Second, Gain: 35},
+	}
+	got := w.Climbs()
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("climbs mismatch (-want +got):\n%s", d)
+	}
+
+	if got, want := got[0].VAM(), 55.0/(120.0/3600); got != want {
+		t.Errorf("got climb VAM %v, want %v", got, want)
+	}
+
+	if got, want := (Workout{Gain: 500, Duration: 2 * time.Hour}).VAM(), 250.0; got != want {
+		t.Errorf("got workout VAM %v, want %v", got, want)
+	}
+}
+
+func TestZones(t *testing.T) {
+	z, err := ParseZones("120, 140,155")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(Zones{120, 140, 155}, z); d != "" {
+		t.Errorf("zones mismatch (-want +got):\n%s", d)
+	}
+	if got, want := z.String(), "120,140,155"; got != want {
+		t.Errorf("got string %q, want %q", got, want)
+	}
+
+	for _, tc := range []struct {
+		v    float64
+		want int
+	}{
+		{90, 1},
+		{119.9, 1},
+		{120, 2},
+		{150, 3},
+		{155, 4},
+		{200, 4},
+	} {
+		if got := z.Zone(tc.v); got != tc.want {
+			t.Errorf("Zone(%v) = %d, want %d", tc.v, got, tc.want)
+		}
+	}
+
+	for _, s := range []string{"", "120,abc", "140,120", "120,120"} {
+		if _, err := ParseZones(s); err == nil {
+			t.Errorf("ParseZones(%q) got no error, want one", s)
+		}
+	}
+}
+
+func TestWorkoutHeartRateZoneTimes(t *testing.T) {
+	w := Workout{
+		Duration: 15 * time.Second,
+		Positions: []WorkoutPosition{
+			{Elapsed: 0}, {Elapsed: 5 * time.Second}, {Elapsed: 10 * time.Second},
+			{Elapsed: 70 * time.Second}, // paused from 10s to 70s
+			{Elapsed: 75 * time.Second},
+		},
+		HeartRates: []WorkoutHeartRate{
+			{Elapsed: 0, BeatsPerMinute: 100},
+			{Elapsed: 5 * time.Second, BeatsPerMinute: 110},
+			{Elapsed: 10 * time.Second, BeatsPerMinute: 130},
+			{Elapsed: 70 * time.Second, BeatsPerMinute: 125},
+			{Elapsed: 75 * time.Second, BeatsPerMinute: 150},
+		},
+	}
+
+	want := []time.Duration{5 * time.Second, 5 * time.Second, 5 * time.Second}
+	if d := cmp.Diff(want, w.HeartRateZoneTimes(Zones{120, 140})); d != "" {
+		t.Errorf("zone times mismatch (-want +got):\n%s", d)
+	}
+
+	if got, want := w.AverageHeartRate(), (110.0*5+130*5+150*5)/15; got != want {
+		t.Errorf("got average heart rate %v, want %v", got, want)
+	}
+
+	if got := (Workout{}).HeartRateZoneTimes(Zones{120}); got != nil {
+		t.Errorf("got zone times %v for no heart rates, want nil", got)
+	}
+}
+
+func TestEffort(t *testing.T) {
+	if got, want := Effort(time.Hour, 1), 100.0; got != want {
+		t.Errorf("got effort %v for an hour at threshold, want %v", got, want)
+	}
+	if got, want := Effort(2*time.Hour, 0.5), 50.0; got != want {
+		t.Errorf("got effort %v for two hours at half threshold, want %v", got, want)
+	}
+}
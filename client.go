@@ -1,12 +1,19 @@
 package mapmyride
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"io/ioutil"
+	"math"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -62,6 +69,39 @@ type WorkoutStep struct {
 	StepsInPeriod float64
 }
 
+// WorkoutHeartRate is a point in time heart rate measurement for a
+// workout.
+//
+// Note that Elapsed may not necessarily track wall clock
+// time from the workout's start time due to pauses during
+// the workout.
+type WorkoutHeartRate struct {
+	Elapsed        time.Duration
+	BeatsPerMinute float64
+}
+
+// WorkoutCadence is a point in time cadence measurement for a workout,
+// such as from a bike's cadence sensor.
+//
+// Note that Elapsed may not necessarily track wall clock
+// time from the workout's start time due to pauses during
+// the workout.
+type WorkoutCadence struct {
+	Elapsed time.Duration
+	RPM     float64 // revolutions per minute
+}
+
+// WorkoutPower is a point in time power measurement for a workout, such
+// as from a bike's power meter.
+//
+// Note that Elapsed may not necessarily track wall clock
+// time from the workout's start time due to pauses during
+// the workout.
+type WorkoutPower struct {
+	Elapsed time.Duration
+	Watts   float64
+}
+
 // Workout is a recorded workout.
 type Workout struct {
 	ID           int
@@ -73,22 +113,148 @@ type Workout struct {
 	Speed        float64 // meters per second
 	Duration     time.Duration
 	StepCount    int
-	Gain         int // meters
+	Gain         float64 // meters
 	StartedAt    time.Time
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 
-	Distances []WorkoutDistance
-	Positions []WorkoutPosition
-	Speeds    []WorkoutSpeed
-	Steps     []WorkoutStep
+	// ElapsedTime is the wall clock time from the workout's start to its
+	// end, including pauses, where Duration is only the time spent
+	// moving. It is zero if the site didn't say.
+	ElapsedTime time.Duration
+
+	// RouteID is the saved route the workout was attached to, or zero if
+	// none. See GetRoute.
+	RouteID int
+
+	// StartElevation, MaxElevation and MinElevation are taken from the
+	// workout's page or, if it doesn't show them, from Positions.
+	StartElevation float64 // meters
+	MaxElevation   float64 // meters
+	MinElevation   float64 // meters
+
+	Distances  []WorkoutDistance
+	Positions  []WorkoutPosition
+	Speeds     []WorkoutSpeed
+	Steps      []WorkoutStep
+	HeartRates []WorkoutHeartRate
+	Cadences   []WorkoutCadence
+	Powers     []WorkoutPower
+}
+
+// Phase identifies the part of fetching workouts that failed.
+type Phase string
+
+const (
+	// PhaseDashboard is fetching a month's workout listing.
+	PhaseDashboard Phase = "dashboard"
+	// PhaseDetail is fetching a workout's details and time series.
+	PhaseDetail Phase = "detail"
+	// PhaseGain is scraping a workout's elevation gain.
+	PhaseGain Phase = "gain"
+)
+
+// FetchError is returned by GetWorkouts to identify where a failure
+// happened.
+type FetchError struct {
+	Phase Phase
+
+	// Month is set for PhaseDashboard errors. Only its year and
+	// month are meaningful.
+	Month time.Time
+
+	// WorkoutID is set for PhaseDetail and PhaseGain errors.
+	WorkoutID int
+
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	if e.Phase == PhaseDashboard {
+		return fmt.Sprintf("%s %s: %v", e.Phase, e.Month.Format("2006-01"), e.Err)
+	}
+	return fmt.Sprintf("%s workout %d: %v", e.Phase, e.WorkoutID, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Errors wrapped by the *StatusError returned for responses with these
+// statuses.
+var (
+	// ErrUnauthorized is for a rejected token, such as one that has
+	// expired. Redirects to the login page count too.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrNotFound is for a workout or page that doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrRateLimited is for too many requests in too short a time.
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// StatusError is returned for a response with an unexpected HTTP status.
+// Use errors.Is with ErrUnauthorized, ErrNotFound and ErrRateLimited to
+// check for the statuses that need handling.
+type StatusError struct {
+	StatusCode int
+
+	// RetryAfter is how long a rate limited response asked to wait
+	// before trying again, or zero if it didn't say.
+	RetryAfter time.Duration
+
+	// LoginRedirect is set when the request was redirected to the login
+	// page, which the site does for some requests with a bad token.
+	LoginRedirect bool
+}
+
+func (e *StatusError) Error() string {
+	if e.LoginRedirect {
+		return "redirected to login"
+	}
+	return fmt.Sprintf("got status %d", e.StatusCode)
+}
+
+func (e *StatusError) Unwrap() error {
+	switch {
+	case e.LoginRedirect, e.StatusCode == http.StatusUnauthorized, e.StatusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// checkResponse returns a *StatusError if resp isn't a successful
+// response to the request made, or nil.
+func checkResponse(resp *http.Response) error {
+	if resp.Request != nil && strings.HasPrefix(resp.Request.URL.Path, "/auth/login") {
+		return &StatusError{StatusCode: resp.StatusCode, LoginRedirect: true}
+	}
+	if resp.StatusCode == 200 {
+		return nil
+	}
+	return &StatusError{StatusCode: resp.StatusCode, RetryAfter: retryAfter(resp)}
 }
 
 // Token is a token used for authentication.
-//
-// In the future it may be expanded to support an expiry.
 type Token struct {
 	Token string
+
+	// Expiry is when the token expires, or zero if that isn't known.
+	Expiry time.Time
+}
+
+// tokenExpiryMargin is how long before its Expiry a Token is treated as
+// expired, so requests in flight don't use a token that expires on the
+// way.
+const tokenExpiryMargin = 5 * time.Minute
+
+// Expired reports whether t has expired at now, or is about to. A Token
+// with no Expiry never expires.
+func (t Token) Expired(now time.Time) bool {
+	return !t.Expiry.IsZero() && !now.Before(t.Expiry.Add(-tokenExpiryMargin))
 }
 
 // TokenSource provides a Token.
@@ -96,6 +262,15 @@ type TokenSource interface {
 	Token() (Token, error)
 }
 
+// InvalidatingTokenSource is a TokenSource that can be told its token was
+// rejected, so the next call to Token gets a new one rather than reusing
+// it. A Client invalidates its TokenSource once when a request is
+// unauthorized and retries the request with a new token.
+type InvalidatingTokenSource interface {
+	TokenSource
+	Invalidate()
+}
+
 // StaticTokenSource is a TokenSource which always returns
 // the underlying string.
 type StaticTokenSource string
@@ -110,11 +285,40 @@ type Client struct {
 	// Otherwise, http.DefaultClient.Do is used.
 	HTTPDo func(*http.Request) (*http.Response, error)
 
+	// Logf is used to log warnings, such as skipped workouts, if
+	// provided.
+	Logf func(format string, args ...interface{})
+
+	// SchemaDrift is what to do when responses have unknown fields or
+	// lack expected ones. The default is to not check.
+	SchemaDrift SchemaDriftPolicy
+
+	// MaxRetries is how many times a request that fails with a network
+	// error, a 5xx status or a 429 is retried. The default is not to
+	// retry.
+	MaxRetries int
+
+	// RetryBackoff is the wait before the first retry, doubling for each
+	// one after, with up to as much again added at random so clients
+	// don't retry in lockstep. A Retry-After header takes precedence.
+	// Either way, no wait is longer than a minute. The default is one
+	// second.
+	RetryBackoff time.Duration
+
+	// sleep waits for d or until ctx is done, if provided, for tests.
+	sleep func(ctx context.Context, d time.Duration) error
+
 	tokenSource TokenSource
 	baseURL     string
 
 	// ID -> name
 	activityTypes map[string]string
+
+	// userID is the logged in user's, once fetched.
+	userID string
+
+	// loggedDrift holds the schema drifts already logged.
+	loggedDrift map[string]bool
 }
 
 // NewClient returns a new Client using the given tokenSource.
@@ -122,31 +326,253 @@ func NewClient(tokenSource TokenSource) *Client {
 	return &Client{tokenSource: tokenSource, activityTypes: make(map[string]string)}
 }
 
+// GetWorkoutsOption configures a call to GetWorkouts.
+type GetWorkoutsOption func(*getWorkoutsConfig)
+
+type getWorkoutsConfig struct {
+	kinds         map[string]bool
+	summariesOnly bool
+	missingIDs    MissingIDPolicy
+	onFailed      func(Workout, error)
+	onProgress    func(Progress)
+}
+
+// WithKinds limits GetWorkouts to workouts with one of the given kinds,
+// such as "ride" or "run". Filtering happens before workouts are fetched
+// in full, saving requests for workouts that would be discarded.
+func WithKinds(kinds ...string) GetWorkoutsOption {
+	return func(cfg *getWorkoutsConfig) {
+		if cfg.kinds == nil {
+			cfg.kinds = make(map[string]bool)
+		}
+		for _, k := range kinds {
+			cfg.kinds[k] = true
+		}
+	}
+}
+
+// WithSummariesOnly makes GetWorkouts return workouts with only the
+// summary fields from the monthly listing: ID, Name, Kind, Kcal, Distance,
+// Speed, StepCount and Duration. StartedAt is set to the day the workout
+// started, at midnight UTC, and workouts are kept or dropped by that day
+// alone. It takes one request per month rather than several per workout,
+// which suits checking what exists.
+func WithSummariesOnly() GetWorkoutsOption {
+	return func(cfg *getWorkoutsConfig) {
+		cfg.summariesOnly = true
+	}
+}
+
+// WithSkipFailed makes GetWorkouts skip workouts whose details can't be
+// fetched instead of failing. fn is called for each with the workout, with
+// at least its summary fields set, and the *FetchError.
+func WithSkipFailed(fn func(w Workout, err error)) GetWorkoutsOption {
+	return func(cfg *getWorkoutsConfig) {
+		cfg.onFailed = fn
+	}
+}
+
+// Progress is how far GetWorkouts has gotten, for showing progress on
+// long ranges.
+type Progress struct {
+	Month      time.Time // the month being fetched, only its year and month are meaningful
+	Months     int       // months in the range
+	MonthsDone int       // months listed so far, including Month
+	Listed     int       // workouts listed so far, not counting ones left out
+	Fetched    int       // listed workouts fetched, failed or needing nothing more so far
+}
+
+// WithProgress makes GetWorkouts call fn after listing each month and
+// after fetching each workout.
+func WithProgress(fn func(Progress)) GetWorkoutsOption {
+	return func(cfg *getWorkoutsConfig) {
+		cfg.onProgress = fn
+	}
+}
+
+// MissingIDPolicy is what GetWorkouts does with listed workouts that have
+// no ID, such as some manually entered gym workouts whose listing lacks a
+// usable view_url.
+type MissingIDPolicy int
+
+const (
+	// MissingIDError fails GetWorkouts. It is the default.
+	MissingIDError MissingIDPolicy = iota
+	// MissingIDSkip leaves the workouts out, logging each to the
+	// Client's Logf.
+	MissingIDSkip
+	// MissingIDSynthesize gives the workouts a negative ID derived from
+	// their day, name, kind and duration, which stays the same as long
+	// as those do. Only their summary fields are set, as with
+	// WithSummariesOnly, since details can't be fetched without an ID.
+	MissingIDSynthesize
+)
+
+// WithMissingIDs sets what GetWorkouts does with listed workouts that have
+// no ID.
+func WithMissingIDs(p MissingIDPolicy) GetWorkoutsOption {
+	return func(cfg *getWorkoutsConfig) {
+		cfg.missingIDs = p
+	}
+}
+
 // GetWorkouts retrieves workouts with "started at" times between
 // begin and end, inclusive.
-func (c *Client) GetWorkouts(ctx context.Context, begin, end time.Time) ([]Workout, error) {
-	beginDate, endDate := toDate(begin), toDate(end)
-
+func (c *Client) GetWorkouts(ctx context.Context, begin, end time.Time, opts ...GetWorkoutsOption) ([]Workout, error) {
 	var workouts []Workout
+	err := c.EachWorkout(ctx, begin, end, func(wk Workout) error {
+		workouts = append(workouts, wk)
+		return nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(workouts, func(i, j int) bool {
+		if workouts[i].StartedAt.Equal(workouts[j].StartedAt) {
+			return workouts[i].ID < workouts[j].ID
+		}
+		return workouts[i].StartedAt.Before(workouts[j].StartedAt)
+	})
+
+	return workouts, nil
+}
+
+// ListWorkouts retrieves the summaries of workouts started between begin
+// and end, as GetWorkouts does with WithSummariesOnly, without fetching
+// their details. Use GetWorkoutDetail to fill in the ones needed.
+func (c *Client) ListWorkouts(ctx context.Context, begin, end time.Time, opts ...GetWorkoutsOption) ([]Workout, error) {
+	return c.GetWorkouts(ctx, begin, end, append(opts[:len(opts):len(opts)], WithSummariesOnly())...)
+}
+
+// GetWorkoutDetail returns wk, a workout from ListWorkouts, filled in with
+// its details: its exact start time, series, elevations and activity type.
+// Errors are *FetchErrors.
+func (c *Client) GetWorkoutDetail(ctx context.Context, wk Workout) (Workout, error) {
+	if wk.ID <= 0 {
+		return Workout{}, fmt.Errorf("workout %q has no id to fetch details with", wk.Name)
+	}
+	if err := c.fillWorkout(ctx, &wk); err != nil {
+		return Workout{}, err
+	}
+	return wk, nil
+}
+
+// GetWorkout retrieves the workout with the given ID in full, as
+// GetWorkouts would, without needing to know when it started. Its summary
+// fields come from the listing for the days around its start, so it takes
+// a request or two more than each workout in GetWorkouts does. If the
+// workout doesn't exist, the error wraps ErrNotFound.
+func (c *Client) GetWorkout(ctx context.Context, id int) (Workout, error) {
+	wk := Workout{ID: id}
+	if err := c.fillWorkout(ctx, &wk); err != nil {
+		return Workout{}, err
+	}
+
+	// The listing's day may not match the UTC day the workout started,
+	// so look either side of it.
+	begin, end := toDate(wk.StartedAt).AddDate(0, 0, -1), toDate(wk.StartedAt).AddDate(0, 0, 1)
 	for _, m := range months(begin, end) {
+		mwks, err := c.getMonthWorkoutsForRange(ctx, m.Year(), int(m.Month()), begin, end)
+		if err != nil {
+			return Workout{}, &FetchError{Phase: PhaseDashboard, Month: m, Err: err}
+		}
+		for _, lw := range mwks {
+			if lw.ID != id {
+				continue
+			}
+			wk.Name, wk.Kind, wk.Kcal = lw.Name, lw.Kind, lw.Kcal
+			wk.Distance, wk.Speed, wk.StepCount, wk.Duration = lw.Distance, lw.Speed, lw.StepCount, lw.Duration
+			return wk, nil
+		}
+	}
+	return Workout{}, &FetchError{Phase: PhaseDashboard, Month: begin, Err: fmt.Errorf("workout %d not listed around %s: %w", id, wk.StartedAt.Format("2006-01-02"), ErrNotFound)}
+}
+
+// EachWorkout is GetWorkouts calling fn with each workout as soon as it
+// is fetched, rather than holding them all until the end, so long ranges
+// don't need every workout's series in memory at once. Workouts come a
+// month at a time, oldest month first, but are not sorted within a
+// month. If fn returns an error, EachWorkout stops and returns it.
+func (c *Client) EachWorkout(ctx context.Context, begin, end time.Time, fn func(Workout) error, opts ...GetWorkoutsOption) error {
+	var cfg getWorkoutsConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	beginDate, endDate := toDate(begin), toDate(end)
+
+	ms := months(begin, end)
+	progress := Progress{Months: len(ms)}
+	report := func() {
+		if cfg.onProgress != nil {
+			cfg.onProgress(progress)
+		}
+	}
+	for _, m := range ms {
 		mwks, err := c.getMonthWorkoutsForRange(ctx, m.Year(), int(m.Month()), beginDate, endDate)
 		if err != nil {
-			return nil, err
+			return &FetchError{Phase: PhaseDashboard, Month: m, Err: err}
 		}
+		progress.Month = m
+		progress.MonthsDone++
+		for _, wk := range mwks {
+			if (cfg.kinds == nil || cfg.kinds[wk.Kind]) && (wk.ID != 0 || cfg.missingIDs != MissingIDSkip) {
+				progress.Listed++
+			}
+		}
+		report()
+
 		for _, wk := range mwks {
 			wk := wk
-			if err := c.fillWorkout(ctx, &wk); err != nil {
-				return nil, err
+			if cfg.kinds != nil && !cfg.kinds[wk.Kind] {
+				continue
+			}
+			if wk.ID == 0 {
+				switch cfg.missingIDs {
+				case MissingIDSkip:
+					c.logf("skipping %s workout %q on %s with no id", wk.Kind, wk.Name, wk.StartedAt.Format("2006-01-02"))
+					continue
+				case MissingIDSynthesize:
+					wk.ID = syntheticID(wk)
+					progress.Fetched++
+					report()
+					if err := fn(wk); err != nil {
+						return err
+					}
+					continue
+				default:
+					return &FetchError{Phase: PhaseDashboard, Month: m, Err: fmt.Errorf("%s workout %q on %s has no id", wk.Kind, wk.Name, wk.StartedAt.Format("2006-01-02"))}
+				}
+			}
+			if cfg.summariesOnly {
+				progress.Fetched++
+				report()
+				if err := fn(wk); err != nil {
+					return err
+				}
+				continue
+			}
+			err := c.fillWorkout(ctx, &wk)
+			progress.Fetched++
+			report()
+			if err != nil {
+				// Other workouts would fail the same way with a bad
+				// token, so don't skip ahead.
+				if cfg.onFailed == nil || ctx.Err() != nil || errors.Is(err, ErrUnauthorized) {
+					return err
+				}
+				cfg.onFailed(wk, err)
+				continue
 			}
 			if wk.StartedAt.Before(begin) || wk.StartedAt.After(end) {
 				continue
 			}
-			workouts = append(workouts, wk)
+			if err := fn(wk); err != nil {
+				return err
+			}
 		}
 	}
-	sort.Slice(workouts, func(i, j int) bool { return workouts[i].StartedAt.Before(workouts[j].StartedAt) })
-
-	return workouts, nil
+	return nil
 }
 
 func (c *Client) getMonthWorkoutsForRange(ctx context.Context, year, month int, beginDate, endDate time.Time) ([]Workout, error) {
@@ -166,10 +592,27 @@ func (c *Client) getMonthWorkoutsForRange(ctx context.Context, year, month int,
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("got status %d", resp.StatusCode)
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.checkDrift(b, dashboardDrift); err != nil {
+		return nil, err
 	}
 
+	return parseDashboard(b, year, month, beginDate, endDate)
+}
+
+// parseDashboard parses a dashboard.json response for year and month,
+// returning the partially filled workouts in it dated between beginDate
+// and endDate. Their StartedAt is only the day until details are filled
+// in.
+func parseDashboard(b []byte, year, month int, beginDate, endDate time.Time) ([]Workout, error) {
 	var rawresp struct {
 		WorkoutData struct {
 			Workouts map[string][]struct {
@@ -186,11 +629,6 @@ func (c *Client) getMonthWorkoutsForRange(ctx context.Context, year, month int,
 		} `json:"workout_data"`
 	}
 
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
 	if err := json.Unmarshal(b, &rawresp); err != nil {
 		return nil, err
 	}
@@ -213,19 +651,21 @@ func (c *Client) getMonthWorkoutsForRange(ctx context.Context, year, month int,
 				continue
 			}
 
-			viewURLParts := strings.Split(rw.ViewURL, "/")
-			id, err := strconv.Atoi(viewURLParts[2])
-			if err != nil {
-				return nil, fmt.Errorf("converting %q to id: %w", rw.ViewURL, err)
+			// Some manually entered workouts have no usable view_url,
+			// leave their ID zero for GetWorkouts to deal with.
+			var id int
+			if viewURLParts := strings.Split(rw.ViewURL, "/"); len(viewURLParts) == 3 && viewURLParts[1] == "workout" {
+				id, _ = strconv.Atoi(viewURLParts[2])
 			}
 
 			wk := Workout{
-				ID:       id,
-				Name:     rw.Name,
-				Kind:     rw.ActivityShortName,
-				Kcal:     rw.Energy,
-				Distance: rw.Distance * 1000,
-				Speed:    rw.Speed,
+				ID:        id,
+				Name:      rw.Name,
+				Kind:      rw.ActivityShortName,
+				Kcal:      rw.Energy,
+				Distance:  rw.Distance * 1000,
+				Speed:     rw.Speed,
+				StartedAt: dt,
 			}
 
 			if i, err := strconv.Atoi(string(rw.Steps)); err == nil {
@@ -242,18 +682,58 @@ func (c *Client) getMonthWorkoutsForRange(ctx context.Context, year, month int,
 	return workouts, nil
 }
 
+// syntheticID returns a negative ID for wk, which has none, derived from
+// the summary fields least likely to be edited.
+func syntheticID(wk Workout) int {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s|%s|%s|%d", wk.StartedAt.Format("2006-01-02"), wk.Name, wk.Kind, int(wk.Duration.Seconds()))
+	return -int(h.Sum32()&math.MaxInt32) - 1
+}
+
 func (c *Client) fillWorkout(ctx context.Context, wk *Workout) error {
 	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
-		return c.fillMainData(ctx, wk)
+		if err := c.fillMainData(ctx, wk); err != nil {
+			return &FetchError{Phase: PhaseDetail, WorkoutID: wk.ID, Err: err}
+		}
+		return nil
 	})
 
+	var elev pageElevation
 	g.Go(func() error {
-		return c.fillGainData(ctx, wk)
+		var err error
+		elev, err = c.fetchElevation(ctx, wk.ID)
+		if err != nil {
+			return &FetchError{Phase: PhaseGain, WorkoutID: wk.ID, Err: err}
+		}
+		return nil
 	})
 
-	return g.Wait()
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	wk.Gain = elev.Gain
+	if len(wk.Positions) > 0 {
+		wk.StartElevation = wk.Positions[0].Elevation
+		wk.MaxElevation, wk.MinElevation = wk.Positions[0].Elevation, wk.Positions[0].Elevation
+		for _, p := range wk.Positions {
+			wk.MaxElevation = math.Max(wk.MaxElevation, p.Elevation)
+			wk.MinElevation = math.Min(wk.MinElevation, p.Elevation)
+		}
+	}
+	if elev.Start != nil {
+		wk.StartElevation = *elev.Start
+	}
+	if elev.Max != nil {
+		wk.MaxElevation = *elev.Max
+	}
+	if elev.Min != nil {
+		wk.MinElevation = *elev.Min
+	}
+
+	return nil
 }
 
 func (c *Client) fillMainData(ctx context.Context, wk *Workout) error {
@@ -272,32 +752,63 @@ func (c *Client) fillMainData(ctx context.Context, wk *Workout) error {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("got status %d", resp.StatusCode)
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
 	}
 
+	if err := c.checkDrift(b, detailDrift); err != nil {
+		return err
+	}
+
+	atID, err := parseWorkoutDetail(b, wk)
+	if err != nil {
+		return err
+	}
+
+	if atID != "" {
+		name, ok := c.activityTypes[atID]
+		if !ok {
+			name, err = c.fetchActivityTypeName(ctx, atID)
+			if err != nil {
+				return fmt.Errorf("unable to fetch activity type name for %q: %w", atID, err)
+			}
+			c.activityTypes[atID] = name
+		}
+		wk.ActivityType = name
+	}
+
+	return nil
+}
+
+// parseWorkoutDetail fills wk from a workout detail response, returning
+// the ID of its activity type, if any.
+func parseWorkoutDetail(b []byte, wk *Workout) (string, error) {
 	var rawresp struct {
-		CreatedAt  time.Time                  `json:"created_datetime"`
-		StartedAt  time.Time                  `json:"start_datetime"`
-		UpdatedAt  time.Time                  `json:"updated_datetime"`
+		CreatedAt  time.Time `json:"created_datetime"`
+		StartedAt  time.Time `json:"start_datetime"`
+		UpdatedAt  time.Time `json:"updated_datetime"`
+		Aggregates struct {
+			ElapsedTime float64 `json:"elapsed_time_total"`
+		}
 		Timeseries map[string]json.RawMessage `json:"time_series"`
 		Links      map[string][]struct {
 			ID string
 		} `json:"_links"`
 	}
 
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
 	if err := json.Unmarshal(b, &rawresp); err != nil {
-		return err
+		return "", err
 	}
 
 	wk.CreatedAt = rawresp.CreatedAt
 	wk.StartedAt = rawresp.StartedAt
 	wk.UpdatedAt = rawresp.UpdatedAt
+	wk.ElapsedTime = time.Duration(rawresp.Aggregates.ElapsedTime) * time.Second
 
 	for k, v := range rawresp.Timeseries {
 		switch k {
@@ -305,7 +816,7 @@ func (c *Client) fillMainData(ctx context.Context, wk *Workout) error {
 			var rawDistances [][2]float64
 
 			if err := json.Unmarshal(v, &rawDistances); err != nil {
-				return err
+				return "", err
 			}
 
 			for _, rd := range rawDistances {
@@ -318,19 +829,19 @@ func (c *Client) fillMainData(ctx context.Context, wk *Workout) error {
 			var rawPositions [][2]json.RawMessage
 
 			if err := json.Unmarshal(v, &rawPositions); err != nil {
-				return err
+				return "", err
 			}
 
 			for _, rp := range rawPositions {
 				var pos WorkoutPosition
 
 				if err := json.Unmarshal(rp[1], &pos); err != nil {
-					return err
+					return "", err
 				}
 
 				var el float64
 				if err := json.Unmarshal(rp[0], &el); err != nil {
-					return err
+					return "", err
 				}
 				pos.Elapsed = time.Duration(el*1000) * time.Millisecond
 
@@ -340,7 +851,7 @@ func (c *Client) fillMainData(ctx context.Context, wk *Workout) error {
 			var rawSpeeds [][2]float64
 
 			if err := json.Unmarshal(v, &rawSpeeds); err != nil {
-				return err
+				return "", err
 			}
 
 			for _, rs := range rawSpeeds {
@@ -353,7 +864,7 @@ func (c *Client) fillMainData(ctx context.Context, wk *Workout) error {
 			var rawSteps [][2]float64
 
 			if err := json.Unmarshal(v, &rawSteps); err != nil {
-				return err
+				return "", err
 			}
 
 			for _, rs := range rawSteps {
@@ -362,67 +873,233 @@ func (c *Client) fillMainData(ctx context.Context, wk *Workout) error {
 					StepsInPeriod: rs[1],
 				})
 			}
+		case "heartrate":
+			var rawHeartRates [][2]float64
+
+			if err := json.Unmarshal(v, &rawHeartRates); err != nil {
+				return "", err
+			}
+
+			for _, rh := range rawHeartRates {
+				wk.HeartRates = append(wk.HeartRates, WorkoutHeartRate{
+					Elapsed:        time.Duration(rh[0]*1000) * time.Millisecond,
+					BeatsPerMinute: rh[1],
+				})
+			}
+		case "cadence":
+			var rawCadences [][2]float64
+
+			if err := json.Unmarshal(v, &rawCadences); err != nil {
+				return "", err
+			}
+
+			for _, rc := range rawCadences {
+				wk.Cadences = append(wk.Cadences, WorkoutCadence{
+					Elapsed: time.Duration(rc[0]*1000) * time.Millisecond,
+					RPM:     rc[1],
+				})
+			}
+		case "power":
+			var rawPowers [][2]float64
+
+			if err := json.Unmarshal(v, &rawPowers); err != nil {
+				return "", err
+			}
+
+			for _, rp := range rawPowers {
+				wk.Powers = append(wk.Powers, WorkoutPower{
+					Elapsed: time.Duration(rp[0]*1000) * time.Millisecond,
+					Watts:   rp[1],
+				})
+			}
 		}
 	}
 
+	if rs := rawresp.Links["route"]; len(rs) == 1 {
+		// A route that can't be read is left out rather than failing
+		// the whole workout.
+		wk.RouteID, _ = strconv.Atoi(rs[0].ID)
+	}
+
 	if ats := rawresp.Links["activity_type"]; len(ats) == 1 {
-		atID := ats[0].ID
-		name, ok := c.activityTypes[atID]
-		if !ok {
-			name, err = c.fetchActivityTypeName(ctx, atID)
-			if err != nil {
-				return fmt.Errorf("unable to fetch activity type name for %q: %w", atID, err)
-			}
-			c.activityTypes[atID] = name
-		}
-		wk.ActivityType = name
+		return ats[0].ID, nil
 	}
 
-	return nil
+	return "", nil
 }
 
-func (c *Client) fillGainData(ctx context.Context, wk *Workout) error {
-	req, err := c.newRequest(ctx, "GET", "/workout/"+strconv.Itoa(wk.ID))
+func (c *Client) fetchElevation(ctx context.Context, id int) (pageElevation, error) {
+	req, err := c.newRequest(ctx, "GET", "/workout/"+strconv.Itoa(id))
 	if err != nil {
-		return err
+		return pageElevation{}, err
 	}
 
 	resp, err := c.httpDo(req)
 	if err != nil {
-		return err
+		return pageElevation{}, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("got status %d", resp.StatusCode)
+	if err := checkResponse(resp); err != nil {
+		return pageElevation{}, err
 	}
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	return parseElevation(resp.Body)
+}
+
+// ErrGainLayoutChanged is returned, wrapped in a *FetchError, when a
+// workout page mentions elevation gain but none of the known layouts
+// could find it, which usually means the site has been redesigned.
+var ErrGainLayoutChanged = errors.New("unable to find gain, page layout may have changed")
+
+// gainFinders look for the elevation gain text on a workout page, most
+// specific first. Each reports whether it found the gain at all.
+var gainFinders = []func(doc *goquery.Document, raw []byte) (string, bool){
+	gainBySelector,
+	gainByTableHeader,
+	gainBySpanText,
+}
+
+// pageElevation is the elevation summary scraped from a workout's page.
+type pageElevation struct {
+	Gain float64
+
+	// Start, Max and Min are nil if the page doesn't show them.
+	Start, Max, Min *float64
+}
+
+// parseElevation scrapes the elevation summary from a workout's HTML
+// page. Gain is zero if the page has no gain.
+func parseElevation(r io.Reader) (pageElevation, error) {
+	raw, err := ioutil.ReadAll(r)
 	if err != nil {
-		return fmt.Errorf("creating query document: %w", err)
+		return pageElevation{}, err
 	}
 
-	elem := doc.Find("#workout_elevation_data > tbody:nth-child(2) > tr:nth-child(1)")
-	if elem.Length() == 0 {
-		return nil
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(raw))
+	if err != nil {
+		return pageElevation{}, fmt.Errorf("creating query document: %w", err)
 	}
 
-	if elem.Find("th").First().Text() != "Gain" {
-		return fmt.Errorf("unable to detect gain for workout %d", wk.ID)
+	gain, err := parseGain(doc, raw)
+	if err != nil {
+		return pageElevation{}, err
 	}
 
-	gains := strings.TrimSpace(elem.Find("td > span").Eq(0).Text())
-	if gains == "" || gains == "--" {
-		return nil
+	elev := pageElevation{Gain: gain}
+	for _, row := range []struct {
+		label string
+		v     **float64
+	}{
+		{"Start", &elev.Start},
+		{"Max", &elev.Max},
+		{"Min", &elev.Min},
+	} {
+		s, ok := elevationTableRow(doc, row.label)
+		if !ok {
+			continue
+		}
+		// These are only a convenience, so an unreadable value is
+		// treated as missing rather than failing the workout.
+		if v, err := parseNumber(s); err == nil {
+			*row.v = &v
+		}
 	}
+	return elev, nil
+}
 
-	gain, err := strconv.Atoi(gains)
-	if err != nil {
-		return err
+// parseGain finds the elevation gain on a workout page. It returns zero if
+// the page has no gain.
+func parseGain(doc *goquery.Document, raw []byte) (float64, error) {
+	for _, find := range gainFinders {
+		gains, ok := find(doc, raw)
+		if !ok {
+			continue
+		}
+		gains = strings.TrimSpace(gains)
+		if gains == "" || gains == "--" {
+			return 0, nil
+		}
+		gain, err := parseNumber(gains)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrGainLayoutChanged, err)
+		}
+		return gain, nil
 	}
 
-	wk.Gain = gain
-	return nil
+	// Pages for workouts without elevation, such as manual entries,
+	// don't mention it at all.
+	if gainMentioned.Match(raw) {
+		return 0, ErrGainLayoutChanged
+	}
+	return 0, nil
+}
+
+// gainBySelector finds the gain at its long-standing spot, the first row
+// of the workout_elevation_data table.
+func gainBySelector(doc *goquery.Document, _ []byte) (string, bool) {
+	elem := doc.Find("#workout_elevation_data > tbody:nth-child(2) > tr:nth-child(1)")
+	if elem.Length() == 0 || strings.TrimSpace(elem.Find("th").First().Text()) != "Gain" {
+		return "", false
+	}
+	return elem.Find("td > span").Eq(0).Text(), true
+}
+
+// gainByTableHeader finds a table headed Elevation anywhere on the page
+// and takes the value from its Gain row.
+func gainByTableHeader(doc *goquery.Document, _ []byte) (string, bool) {
+	return elevationTableRow(doc, "Gain")
+}
+
+// elevationTableRow finds a table headed Elevation anywhere on the page
+// and returns the value from its row labeled label.
+func elevationTableRow(doc *goquery.Document, label string) (string, bool) {
+	var (
+		value string
+		found bool
+	)
+	doc.Find("table").EachWithBreak(func(_ int, table *goquery.Selection) bool {
+		header := table.Find("thead th, caption").FilterFunction(func(_ int, s *goquery.Selection) bool {
+			return strings.EqualFold(strings.TrimSpace(s.Text()), "Elevation")
+		})
+		if header.Length() == 0 {
+			return true
+		}
+		table.Find("tr").EachWithBreak(func(_ int, tr *goquery.Selection) bool {
+			if !strings.EqualFold(strings.TrimSpace(tr.Find("th").First().Text()), label) {
+				return true
+			}
+			td := tr.Find("td").First()
+			if span := td.Find("span").First(); span.Length() > 0 {
+				value = span.Text()
+			} else {
+				value = td.Text()
+			}
+			found = true
+			return false
+		})
+		return !found
+	})
+	return value, found
+}
+
+var (
+	// gainSpan matches a Gain label closely followed by a value, as in
+	// <th>Gain</th><td><span>412</span> or <span>Gain</span><span>412</span>.
+	gainSpan = regexp.MustCompile(`(?i)>\s*(?:elevation\s+)?gain\s*</[a-z0-9]+>\s*(?:<[a-z0-9]+[^>]*>\s*){0,3}(--|[0-9][0-9.,' \x{a0}\x{202f}]*)\s*<`)
+
+	// gainMentioned matches pages that appear to show elevation gain.
+	gainMentioned = regexp.MustCompile(`(?i)workout_elevation_data|>\s*(?:elevation\s+)?gain\s*<`)
+)
+
+// gainBySpanText searches the raw page for a Gain label followed by a
+// value, regardless of the surrounding structure.
+func gainBySpanText(_ *goquery.Document, raw []byte) (string, bool) {
+	m := gainSpan.FindSubmatch(raw)
+	if m == nil {
+		return "", false
+	}
+	return string(m[1]), true
 }
 
 func (c *Client) fetchActivityTypeName(ctx context.Context, id string) (string, error) {
@@ -437,8 +1114,8 @@ func (c *Client) fetchActivityTypeName(ctx context.Context, id string) (string,
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("got status %d", resp.StatusCode)
+	if err := checkResponse(resp); err != nil {
+		return "", err
 	}
 
 	var rawresp struct {
@@ -457,6 +1134,9 @@ func (c *Client) fetchActivityTypeName(ctx context.Context, id string) (string,
 	return rawresp.Name, nil
 }
 
+// userAgent is sent with every request, as a browser would.
+const userAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 11_1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/87.0.4280.88 Safari/537.36"
+
 func (c *Client) newRequest(ctx context.Context, method, path string) (*http.Request, error) {
 	req, err := http.NewRequestWithContext(ctx, method, c.url(path), nil)
 	if err != nil {
@@ -468,12 +1148,18 @@ func (c *Client) newRequest(ctx context.Context, method, path string) (*http.Req
 		return nil, err
 	}
 
-	req.Header.Set("user-agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 11_1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/87.0.4280.88 Safari/537.36")
+	req.Header.Set("user-agent", userAgent)
 	req.Header.Set("cookie", "auth-token="+tok.Token)
 
 	return req, nil
 }
 
+// WorkoutURL returns the address of the page for workout id on the
+// MapMyRide site.
+func WorkoutURL(id int) string {
+	return "https://www.mapmyride.com/workout/" + strconv.Itoa(id)
+}
+
 func (c *Client) url(path string) string {
 	base := c.baseURL
 	if base == "" {
@@ -482,13 +1168,146 @@ func (c *Client) url(path string) string {
 	return base + path
 }
 
+func (c *Client) logf(format string, args ...interface{}) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
+
+// httpDo makes req, retrying it up to MaxRetries times after network
+// errors and statuses that might go away on their own. If req is
+// unauthorized and the TokenSource is an InvalidatingTokenSource, it is
+// also retried once with a new token.
 func (c *Client) httpDo(req *http.Request) (*http.Response, error) {
+	reauthorized := false
+	for attempt := 0; ; attempt++ {
+		if (attempt > 0 || reauthorized) && req.GetBody != nil {
+			// The last attempt read the body, so send a fresh copy.
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		resp, err := c.httpDoOnce(req)
+		if its, ok := c.tokenSource.(InvalidatingTokenSource); ok && err == nil && !reauthorized {
+			if serr := checkResponse(resp); errors.Is(serr, ErrUnauthorized) {
+				c.logf("retrying %s with a new token after error: %v", req.URL.Path, serr)
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+				its.Invalidate()
+				tok, err := its.Token()
+				if err != nil {
+					return nil, err
+				}
+				req.Header.Set("cookie", "auth-token="+tok.Token)
+				// This retry doesn't count towards MaxRetries.
+				reauthorized = true
+				attempt--
+				continue
+			}
+		}
+		if attempt >= c.MaxRetries || req.Context().Err() != nil || !retryable(resp, err) {
+			return resp, err
+		}
+
+		wait := c.retryWait(attempt, resp)
+		if err != nil {
+			c.logf("retrying %s in %s after error: %v", req.URL.Path, wait.Round(time.Millisecond), err)
+		} else {
+			c.logf("retrying %s in %s after status %d", req.URL.Path, wait.Round(time.Millisecond), resp.StatusCode)
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := c.sleepCtx(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) httpDoOnce(req *http.Request) (*http.Response, error) {
 	if c.HTTPDo != nil {
 		return c.HTTPDo(req)
 	}
 	return http.DefaultClient.Do(req)
 }
 
+// retryable reports whether a request that got resp and err is worth
+// trying again.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// maxRetryWait caps how long to wait before a retry, whether from
+// backoff or a Retry-After header.
+const maxRetryWait = time.Minute
+
+// retryWait returns how long to wait before retrying after attempt, the
+// zero-based count of retries so far, got resp. It is at most
+// maxRetryWait.
+func (c *Client) retryWait(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if d := retryAfter(resp); d > 0 {
+			if d > maxRetryWait {
+				d = maxRetryWait
+			}
+			return d
+		}
+	}
+	base := c.RetryBackoff
+	if base <= 0 {
+		base = time.Second
+	}
+	// Stop doubling once past half the cap, before it can overflow.
+	d := base
+	for i := 0; i < attempt && d < maxRetryWait/2; i++ {
+		d *= 2
+	}
+	if d > maxRetryWait/2 {
+		d = maxRetryWait / 2
+	}
+	return d + time.Duration(rand.Int63n(int64(d)+1))
+}
+
+// retryAfter returns the wait asked for by resp's Retry-After header,
+// given in seconds or as a date, or zero if there's none.
+func retryAfter(resp *http.Response) time.Duration {
+	v := resp.Header.Get("retry-after")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil && secs > 0 {
+		// Saturate rather than overflow on absurd values.
+		if max := int64(math.MaxInt64 / time.Second); secs > max {
+			secs = max
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func (c *Client) sleepCtx(ctx context.Context, d time.Duration) error {
+	if c.sleep != nil {
+		return c.sleep(ctx, d)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func months(begin, end time.Time) []time.Time {
 	norm := func(t time.Time) time.Time {
 		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
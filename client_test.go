@@ -3,9 +3,13 @@ package mapmyride
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -30,6 +34,7 @@ func TestClientGetWorkouts(t *testing.T) {
 	cases := []struct {
 		name       string
 		begin, end time.Time
+		opts       []GetWorkoutsOption
 		tws        []testWorkout
 		want       []int // indices of tws
 	}{
@@ -246,6 +251,82 @@ func TestClientGetWorkouts(t *testing.T) {
 			},
 			want: []int{0},
 		},
+		{
+			name:  "PullsHeartRates",
+			begin: refTime,
+			end:   refTime.Add(time.Hour),
+			tws: []testWorkout{
+				{
+					id:        1,
+					name:      "first ride",
+					kind:      "ride",
+					startedAt: refTime,
+					heartRates: []testWorkoutHeartRate{
+						{
+							elapsed:        1024 * time.Millisecond,
+							beatsPerMinute: 98,
+						},
+						{
+							elapsed:        8096 * time.Millisecond,
+							beatsPerMinute: 121,
+						},
+						{
+							elapsed:        16384 * time.Millisecond,
+							beatsPerMinute: 133,
+						},
+					},
+				},
+			},
+			want: []int{0},
+		},
+		{
+			name:  "PullsCadences",
+			begin: refTime,
+			end:   refTime.Add(time.Hour),
+			tws: []testWorkout{
+				{
+					id:        1,
+					name:      "first ride",
+					kind:      "ride",
+					startedAt: refTime,
+					cadences: []testWorkoutCadence{
+						{
+							elapsed: 1024 * time.Millisecond,
+							rpm:     82,
+						},
+						{
+							elapsed: 8096 * time.Millisecond,
+							rpm:     91.5,
+						},
+					},
+				},
+			},
+			want: []int{0},
+		},
+		{
+			name:  "PullsPowers",
+			begin: refTime,
+			end:   refTime.Add(time.Hour),
+			tws: []testWorkout{
+				{
+					id:        1,
+					name:      "first ride",
+					kind:      "ride",
+					startedAt: refTime,
+					powers: []testWorkoutPower{
+						{
+							elapsed: 1024 * time.Millisecond,
+							watts:   180,
+						},
+						{
+							elapsed: 8096 * time.Millisecond,
+							watts:   242.5,
+						},
+					},
+				},
+			},
+			want: []int{0},
+		},
 		{
 			name:  "PullsGain",
 			begin: refTime,
@@ -261,6 +342,21 @@ func TestClientGetWorkouts(t *testing.T) {
 			},
 			want: []int{0},
 		},
+		{
+			name:  "PullsFractionalGain",
+			begin: refTime,
+			end:   refTime.Add(time.Hour),
+			tws: []testWorkout{
+				{
+					id:        1,
+					name:      "gainful ride",
+					kind:      "ride",
+					startedAt: refTime,
+					gain:      10.4,
+				},
+			},
+			want: []int{0},
+		},
 		{
 			name:  "SkipsGainIfBlank",
 			begin: refTime,
@@ -313,6 +409,33 @@ func TestClientGetWorkouts(t *testing.T) {
 			},
 			want: []int{0, 1},
 		},
+		{
+			name:  "FiltersKinds",
+			begin: refTime,
+			end:   refTime.Add(time.Hour),
+			opts:  []GetWorkoutsOption{WithKinds("run", "walk")},
+			tws: []testWorkout{
+				{
+					id:        1,
+					name:      "ride",
+					kind:      "ride",
+					startedAt: refTime,
+				},
+				{
+					id:        2,
+					name:      "run",
+					kind:      "run",
+					startedAt: refTime.Add(time.Minute),
+				},
+				{
+					id:        3,
+					name:      "walk",
+					kind:      "walk",
+					startedAt: refTime.Add(2 * time.Minute),
+				},
+			},
+			want: []int{1, 2},
+		},
 	}
 
 	for _, tc := range cases {
@@ -331,7 +454,7 @@ func TestClientGetWorkouts(t *testing.T) {
 			c := NewClient(StaticTokenSource("secret"))
 			c.baseURL = srv.URL
 
-			got, err := c.GetWorkouts(context.Background(), tc.begin, tc.end)
+			got, err := c.GetWorkouts(context.Background(), tc.begin, tc.end, tc.opts...)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -348,6 +471,1042 @@ func TestClientGetWorkouts(t *testing.T) {
 	}
 }
 
+func TestClientGetWorkoutsErrors(t *testing.T) {
+	refTime := time.Date(2021, 7, 10, 7, 32, 56, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		failPath string
+		want     FetchError
+	}{
+		{
+			name:     "Dashboard",
+			failPath: "/workouts/dashboard.json",
+			want:     FetchError{Phase: PhaseDashboard, Month: time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:     "Detail",
+			failPath: "/vxproxy/v7.0/workout/12345/",
+			want:     FetchError{Phase: PhaseDetail, WorkoutID: 12345},
+		},
+		{
+			name:     "Gain",
+			failPath: "/workout/12345",
+			want:     FetchError{Phase: PhaseGain, WorkoutID: 12345},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			wsrv := newWorkoutServer()
+			wsrv.addWorkout(testWorkout{
+				id:        12345,
+				name:      "ride",
+				kind:      "ride",
+				startedAt: refTime,
+			})
+
+			srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == tc.failPath {
+					wr.WriteHeader(500)
+					return
+				}
+				wsrv.ServeHTTP(wr, req)
+			}))
+			defer srv.Close()
+
+			c := NewClient(StaticTokenSource("secret"))
+			c.baseURL = srv.URL
+
+			_, err := c.GetWorkouts(context.Background(), refTime, refTime.Add(time.Hour))
+
+			var fe *FetchError
+			if !errors.As(err, &fe) {
+				t.Fatalf("got error %v, want a *FetchError", err)
+			}
+			if fe.Phase != tc.want.Phase || !fe.Month.Equal(tc.want.Month) || fe.WorkoutID != tc.want.WorkoutID {
+				t.Errorf("got %s error for month %v and workout %d, want %s error for month %v and workout %d",
+					fe.Phase, fe.Month, fe.WorkoutID, tc.want.Phase, tc.want.Month, tc.want.WorkoutID)
+			}
+		})
+	}
+}
+
+func TestClientGetWorkoutsStatusErrors(t *testing.T) {
+	refTime := time.Date(2021, 7, 10, 7, 32, 56, 0, time.UTC)
+
+	cases := []struct {
+		name       string
+		handler    http.HandlerFunc
+		want       error
+		retryAfter time.Duration
+	}{
+		{
+			name:    "Unauthorized",
+			handler: func(wr http.ResponseWriter, req *http.Request) { wr.WriteHeader(401) },
+			want:    ErrUnauthorized,
+		},
+		{
+			name: "LoginRedirect",
+			handler: func(wr http.ResponseWriter, req *http.Request) {
+				http.Redirect(wr, req, "/auth/login/?next=/workouts/dashboard.json", http.StatusFound)
+			},
+			want: ErrUnauthorized,
+		},
+		{
+			name:    "NotFound",
+			handler: func(wr http.ResponseWriter, req *http.Request) { wr.WriteHeader(404) },
+			want:    ErrNotFound,
+		},
+		{
+			name: "RateLimited",
+			handler: func(wr http.ResponseWriter, req *http.Request) {
+				wr.Header().Set("retry-after", "120")
+				wr.WriteHeader(429)
+			},
+			want:       ErrRateLimited,
+			retryAfter: 2 * time.Minute,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+				if req.URL.Path == "/workouts/dashboard.json" {
+					tc.handler(wr, req)
+					return
+				}
+				wr.Write([]byte("login form"))
+			}))
+			defer srv.Close()
+
+			c := NewClient(StaticTokenSource("secret"))
+			c.baseURL = srv.URL
+
+			_, err := c.GetWorkouts(context.Background(), refTime, refTime.Add(time.Hour))
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("got error %v, want %v", err, tc.want)
+			}
+			var se *StatusError
+			if !errors.As(err, &se) {
+				t.Fatalf("got error %v, want a *StatusError", err)
+			}
+			if se.RetryAfter != tc.retryAfter {
+				t.Errorf("got retry after %v, want %v", se.RetryAfter, tc.retryAfter)
+			}
+		})
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	refTime := time.Date(2021, 7, 10, 7, 32, 56, 0, time.UTC)
+
+	wsrv := newWorkoutServer()
+	wsrv.addWorkout(testWorkout{id: 1, name: "first", kind: "ride", startedAt: refTime})
+
+	// The dashboard is rate limited once, then fails twice.
+	var dashboardCalls int
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/workouts/dashboard.json" {
+			dashboardCalls++
+			switch dashboardCalls {
+			case 1:
+				wr.Header().Set("retry-after", "7")
+				wr.WriteHeader(429)
+				return
+			case 2, 3:
+				wr.WriteHeader(503)
+				return
+			}
+		}
+		wsrv.ServeHTTP(wr, req)
+	}))
+	defer srv.Close()
+
+	var waits []time.Duration
+	newClient := func(maxRetries int) *Client {
+		c := NewClient(StaticTokenSource("secret"))
+		c.baseURL = srv.URL
+		c.MaxRetries = maxRetries
+		c.RetryBackoff = 100 * time.Millisecond
+		c.sleep = func(_ context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return nil
+		}
+		return c
+	}
+
+	_, err := newClient(2).GetWorkouts(context.Background(), refTime, refTime.Add(time.Hour))
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != 503 {
+		t.Fatalf("got error %v after running out of retries, want status 503", err)
+	}
+
+	dashboardCalls, waits = 0, nil
+	got, err := newClient(3).GetWorkouts(context.Background(), refTime, refTime.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Errorf("got %d workouts, want 1", len(got))
+	}
+	if len(waits) != 3 {
+		t.Fatalf("got waits %v, want 3", waits)
+	}
+	if waits[0] != 7*time.Second {
+		t.Errorf("got first wait %v, want Retry-After's 7s", waits[0])
+	}
+	// Backoff doubles from RetryBackoff, plus up to as much jitter.
+	for i, min := range []time.Duration{200 * time.Millisecond, 400 * time.Millisecond} {
+		if w := waits[i+1]; w < min || w > 2*min {
+			t.Errorf("got wait %d of %v, want between %v and %v", i+1, w, min, 2*min)
+		}
+	}
+}
+
+func TestClientGetWorkoutsSkipFailedUnauthorized(t *testing.T) {
+	refTime := time.Date(2021, 7, 10, 7, 32, 56, 0, time.UTC)
+
+	wsrv := newWorkoutServer()
+	wsrv.addWorkout(testWorkout{id: 1, name: "first", kind: "ride", startedAt: refTime})
+	wsrv.addWorkout(testWorkout{id: 2, name: "second", kind: "ride", startedAt: refTime.Add(time.Minute)})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, "/vxproxy/") {
+			wr.WriteHeader(401)
+			return
+		}
+		wsrv.ServeHTTP(wr, req)
+	}))
+	defer srv.Close()
+
+	c := NewClient(StaticTokenSource("secret"))
+	c.baseURL = srv.URL
+
+	var skipped int
+	_, err := c.GetWorkouts(context.Background(), refTime, refTime.Add(time.Hour), WithSkipFailed(func(Workout, error) { skipped++ }))
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("got error %v, want ErrUnauthorized", err)
+	}
+	if skipped != 0 {
+		t.Errorf("got %d workouts skipped, want none", skipped)
+	}
+}
+
+func TestClientRetryWaitCapped(t *testing.T) {
+	for _, backoff := range []time.Duration{0, 100 * time.Millisecond, time.Hour, math.MaxInt64} {
+		c := NewClient(StaticTokenSource("secret"))
+		c.RetryBackoff = backoff
+		for _, attempt := range []int{0, 10, 62, 63, 64, 1000} {
+			if d := c.retryWait(attempt, nil); d <= 0 || d > maxRetryWait {
+				t.Errorf("backoff %v attempt %d: got wait %v, want up to %v", backoff, attempt, d, maxRetryWait)
+			}
+		}
+	}
+
+	c := NewClient(StaticTokenSource("secret"))
+	for _, v := range []string{"3600", "99999999999999999", "Fri, 31 Dec 2999 23:59:59 GMT"} {
+		resp := &http.Response{Header: http.Header{"Retry-After": {v}}}
+		if d := c.retryWait(0, resp); d != maxRetryWait {
+			t.Errorf("Retry-After %q: got wait %v, want %v", v, d, maxRetryWait)
+		}
+		if d := retryAfter(resp); d <= 0 {
+			t.Errorf("Retry-After %q: got %v, want it positive", v, d)
+		}
+	}
+}
+
+func TestClientReauthorizes(t *testing.T) {
+	refTime := time.Date(2021, 7, 10, 7, 32, 56, 0, time.UTC)
+
+	wsrv := newWorkoutServer()
+	wsrv.addWorkout(testWorkout{id: 1, name: "first", kind: "ride", startedAt: refTime})
+
+	// Only accept the token named in accept.
+	accept := "token2"
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("cookie") != "auth-token="+accept {
+			wr.WriteHeader(401)
+			return
+		}
+		wsrv.ServeHTTP(wr, req)
+	}))
+	defer srv.Close()
+
+	src := &countingTokenSource{}
+	tokens := NewCachingTokenSource(src, filepath.Join(t.TempDir(), "token.json"))
+	c := NewClient(tokens)
+	c.baseURL = srv.URL
+
+	got, err := c.GetWorkouts(context.Background(), refTime, refTime.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || src.n != 2 {
+		t.Errorf("got %d workouts after %d tokens, want 1 after 2", len(got), src.n)
+	}
+
+	// A new token that is rejected too isn't replaced again.
+	accept = "none"
+	_, err = c.GetWorkouts(context.Background(), refTime, refTime.Add(time.Hour))
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("got error %v, want ErrUnauthorized", err)
+	}
+	if src.n != 3 {
+		t.Errorf("got %d tokens, want 3", src.n)
+	}
+}
+
+func TestClientGetWorkoutsSkipFailed(t *testing.T) {
+	refTime := time.Date(2021, 7, 10, 7, 32, 56, 0, time.UTC)
+
+	wsrv := newWorkoutServer()
+	ok := testWorkout{
+		id:        1,
+		name:      "ok",
+		kind:      "ride",
+		startedAt: refTime,
+	}
+	wsrv.addWorkout(ok)
+	wsrv.addWorkout(testWorkout{
+		id:        2,
+		name:      "broken",
+		kind:      "ride",
+		startedAt: refTime.Add(time.Minute),
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/vxproxy/v7.0/workout/2/" {
+			wr.WriteHeader(500)
+			return
+		}
+		wsrv.ServeHTTP(wr, req)
+	}))
+	defer srv.Close()
+
+	c := NewClient(StaticTokenSource("secret"))
+	c.baseURL = srv.URL
+
+	var failed []int
+	got, err := c.GetWorkouts(context.Background(), refTime, refTime.Add(time.Hour), WithSkipFailed(func(w Workout, err error) {
+		var fe *FetchError
+		if !errors.As(err, &fe) || fe.Phase != PhaseDetail {
+			t.Errorf("got error %v for workout %d, want a detail *FetchError", err, w.ID)
+		}
+		failed = append(failed, w.ID)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff([]Workout{ok.toWorkout()}, got); d != "" {
+		t.Errorf("workouts mismatch (-want +got):\n%s", d)
+	}
+	if d := cmp.Diff([]int{2}, failed); d != "" {
+		t.Errorf("failed mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestClientEachWorkout(t *testing.T) {
+	refTime := time.Date(2021, 6, 10, 7, 32, 56, 0, time.UTC)
+
+	wsrv := newWorkoutServer()
+	june := testWorkout{
+		id:        1,
+		name:      "june",
+		kind:      "ride",
+		startedAt: refTime,
+	}
+	wsrv.addWorkout(june)
+	wsrv.addWorkout(testWorkout{
+		id:        2,
+		name:      "july",
+		kind:      "ride",
+		startedAt: refTime.AddDate(0, 1, 0),
+	})
+
+	var dashboards []string
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/workouts/dashboard.json" {
+			dashboards = append(dashboards, req.URL.Query().Get("month"))
+		}
+		wsrv.ServeHTTP(wr, req)
+	}))
+	defer srv.Close()
+
+	c := NewClient(StaticTokenSource("secret"))
+	c.baseURL = srv.URL
+
+	// Stopping after the first workout fetches nothing more.
+	errStop := errors.New("stop")
+	var got []Workout
+	err := c.EachWorkout(context.Background(), refTime, refTime.AddDate(0, 2, 0), func(w Workout) error {
+		got = append(got, w)
+		return errStop
+	})
+	if err != errStop {
+		t.Fatalf("got error %v, want the one from fn", err)
+	}
+	if d := cmp.Diff([]Workout{june.toWorkout()}, got); d != "" {
+		t.Errorf("workouts mismatch (-want +got):\n%s", d)
+	}
+	if d := cmp.Diff([]string{"6"}, dashboards); d != "" {
+		t.Errorf("dashboard months mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestClientGetWorkoutsProgress(t *testing.T) {
+	refTime := time.Date(2021, 6, 10, 7, 32, 56, 0, time.UTC)
+
+	wsrv := newWorkoutServer()
+	for i, kind := range []string{"ride", "run", "ride"} {
+		wsrv.addWorkout(testWorkout{
+			id:        i + 1,
+			name:      kind,
+			kind:      kind,
+			startedAt: refTime.AddDate(0, i/2, i),
+		})
+	}
+	srv := httptest.NewServer(wsrv)
+	defer srv.Close()
+
+	c := NewClient(StaticTokenSource("secret"))
+	c.baseURL = srv.URL
+
+	var got []Progress
+	_, err := c.GetWorkouts(context.Background(), refTime, refTime.AddDate(0, 2, 0), WithKinds("ride"), WithProgress(func(p Progress) {
+		got = append(got, p)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	june, july, aug := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+	want := []Progress{
+		{Month: june, Months: 3, MonthsDone: 1, Listed: 1},
+		{Month: june, Months: 3, MonthsDone: 1, Listed: 1, Fetched: 1},
+		{Month: july, Months: 3, MonthsDone: 2, Listed: 2, Fetched: 1},
+		{Month: july, Months: 3, MonthsDone: 2, Listed: 2, Fetched: 2},
+		{Month: aug, Months: 3, MonthsDone: 3, Listed: 2, Fetched: 2},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("progress mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestClientGetWorkoutsGainLayoutChanged(t *testing.T) {
+	refTime := time.Date(2021, 7, 10, 7, 32, 56, 0, time.UTC)
+
+	wsrv := newWorkoutServer()
+	wsrv.addWorkout(testWorkout{
+		id:        12345,
+		name:      "ride",
+		kind:      "ride",
+		startedAt: refTime,
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/workout/12345" {
+			fmt.Fprintln(wr, `<div class="elevation"><h3>Gain</h3><canvas data-gain="10"></canvas></div>`)
+			return
+		}
+		wsrv.ServeHTTP(wr, req)
+	}))
+	defer srv.Close()
+
+	c := NewClient(StaticTokenSource("secret"))
+	c.baseURL = srv.URL
+
+	_, err := c.GetWorkouts(context.Background(), refTime, refTime.Add(time.Hour))
+	if !errors.Is(err, ErrGainLayoutChanged) {
+		t.Fatalf("got error %v, want ErrGainLayoutChanged", err)
+	}
+	var fe *FetchError
+	if !errors.As(err, &fe) || fe.Phase != PhaseGain {
+		t.Errorf("got error %v, want a gain *FetchError", err)
+	}
+}
+
+func TestClientGetWorkoutsSummariesOnly(t *testing.T) {
+	refTime := time.Date(2021, 7, 10, 7, 32, 56, 0, time.UTC)
+
+	wsrv := newWorkoutServer()
+	wsrv.addWorkout(testWorkout{
+		id:        12345,
+		name:      "ride",
+		kind:      "ride",
+		distance:  20000,
+		duration:  time.Hour,
+		startedAt: refTime,
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/workouts/dashboard.json" {
+			t.Errorf("got request for %s, want only dashboard requests", req.URL.Path)
+			wr.WriteHeader(500)
+			return
+		}
+		wsrv.ServeHTTP(wr, req)
+	}))
+	defer srv.Close()
+
+	c := NewClient(StaticTokenSource("secret"))
+	c.baseURL = srv.URL
+
+	got, err := c.GetWorkouts(context.Background(), refTime, refTime.Add(time.Hour), WithSummariesOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Workout{{
+		ID:        12345,
+		Name:      "ride",
+		Kind:      "ride",
+		Distance:  20000,
+		Duration:  time.Hour,
+		StartedAt: time.Date(2021, 7, 10, 0, 0, 0, 0, time.UTC),
+	}}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("workouts mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestClientListWorkoutsAndDetail(t *testing.T) {
+	refTime := time.Date(2021, 7, 10, 7, 32, 56, 0, time.UTC)
+
+	wsrv := newWorkoutServer()
+	tw := testWorkout{
+		id:        12345,
+		name:      "ride",
+		kind:      "ride",
+		distance:  20000,
+		duration:  time.Hour,
+		startedAt: refTime,
+	}
+	wsrv.addWorkout(tw)
+
+	var details int
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/workouts/dashboard.json" {
+			details++
+		}
+		wsrv.ServeHTTP(wr, req)
+	}))
+	defer srv.Close()
+
+	c := NewClient(StaticTokenSource("secret"))
+	c.baseURL = srv.URL
+
+	list, err := c.ListWorkouts(context.Background(), refTime, refTime.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != 12345 || details != 0 {
+		t.Fatalf("got %+v after %d detail requests, want only the summary of workout 12345", list, details)
+	}
+
+	got, err := c.GetWorkoutDetail(context.Background(), list[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(tw.toWorkout(), got); d != "" {
+		t.Errorf("workout mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestClientGetWorkout(t *testing.T) {
+	// Listed on July 31 locally, but started on August 1 UTC.
+	refTime := time.Date(2021, 7, 31, 23, 30, 0, 0, time.FixedZone("ADT", -3*60*60))
+
+	wsrv := newWorkoutServer()
+	tw := testWorkout{
+		id:        12345,
+		name:      "evening ride",
+		kind:      "ride",
+		distance:  20000,
+		duration:  time.Hour,
+		startedAt: refTime,
+	}
+	wsrv.addWorkout(tw)
+	wsrv.addWorkout(testWorkout{
+		id:        12346,
+		name:      "other ride",
+		kind:      "ride",
+		startedAt: refTime.Add(-3 * time.Hour),
+	})
+
+	srv := httptest.NewServer(wsrv)
+	defer srv.Close()
+
+	c := NewClient(StaticTokenSource("secret"))
+	c.baseURL = srv.URL
+
+	got, err := c.GetWorkout(context.Background(), 12345)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(tw.toWorkout(), got); d != "" {
+		t.Errorf("workout mismatch (-want +got):\n%s", d)
+	}
+
+	if _, err := c.GetWorkout(context.Background(), 999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v for a missing workout, want ErrNotFound", err)
+	}
+}
+
+func TestClientRoutes(t *testing.T) {
+	created := time.Date(2021, 5, 2, 18, 21, 9, 0, time.UTC)
+	route := func(id int, detailed bool) map[string]interface{} {
+		r := map[string]interface{}{
+			"name":             "route " + strconv.Itoa(id),
+			"distance":         1000.0 * float64(id),
+			"total_ascent":     10.0 * float64(id),
+			"created_datetime": created.Format(time.RFC3339),
+			"updated_datetime": created.Format(time.RFC3339),
+			"_links":           map[string]interface{}{"self": []map[string]string{{"id": strconv.Itoa(id)}}},
+		}
+		if detailed {
+			r["points"] = []map[string]float64{{"lat": 44.6, "lng": -63.5, "ele": 10, "dis": 0}, {"lat": 44.61, "lng": -63.51, "ele": 20, "dis": 1000}}
+		}
+		return r
+	}
+
+	var selfFetches int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vxproxy/v7.0/user/self/", func(w http.ResponseWriter, r *http.Request) {
+		selfFetches++
+		fmt.Fprint(w, `{"id": 77}`)
+	})
+	mux.HandleFunc("/vxproxy/v7.0/route/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/vxproxy/v7.0/route/" {
+			if got := r.URL.Query().Get("user"); got != "77" {
+				t.Errorf("got routes for user %q, want 77", got)
+			}
+			// Pages of two, regardless of the limit asked for.
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			var page []map[string]interface{}
+			for id := offset + 1; id <= 3 && id <= offset+2; id++ {
+				page = append(page, route(id, false))
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"_embedded": map[string]interface{}{"routes": page}, "total_count": 3})
+			return
+		}
+		if r.URL.Path != "/vxproxy/v7.0/route/2/" || r.URL.Query().Get("field_set") != "detailed" {
+			w.WriteHeader(404)
+			return
+		}
+		json.NewEncoder(w).Encode(route(2, true))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := NewClient(StaticTokenSource("secret"))
+	c.baseURL = srv.URL
+	ctx := context.Background()
+
+	routes, err := c.ListRoutes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, r := range routes {
+		ids = append(ids, r.ID)
+	}
+	if d := cmp.Diff([]int{1, 2, 3}, ids); d != "" {
+		t.Errorf("route ids mismatch (-want +got):\n%s", d)
+	}
+	if _, err := c.ListRoutes(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if selfFetches != 1 {
+		t.Errorf("fetched the user %d times, want once", selfFetches)
+	}
+
+	got, err := c.GetRoute(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Route{
+		ID: 2, Name: "route 2", Distance: 2000, Ascent: 20, CreatedAt: created, UpdatedAt: created,
+		Points: []RoutePoint{{Lat: 44.6, Lng: -63.5, Elevation: 10}, {Lat: 44.61, Lng: -63.51, Elevation: 20, Distance: 1000}},
+	}
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("route mismatch (-want +got):\n%s", d)
+	}
+
+	if _, err := c.GetRoute(ctx, 9); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v for a missing route, want ErrNotFound", err)
+	}
+}
+
+func TestClientCreateWorkout(t *testing.T) {
+	halifax, err := time.LoadLocation("America/Halifax")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := Workout{
+		Name:      "commute",
+		Distance:  5000,
+		Duration:  20 * time.Minute,
+		Kcal:      150,
+		StartedAt: time.Date(2021, 7, 10, 7, 32, 56, 0, halifax),
+		Positions: []WorkoutPosition{
+			{Elapsed: 0, Lat: 44.6488, Lng: -63.5752, Elevation: 10},
+			{Elapsed: 5 * time.Second, Lat: 44.6489, Lng: -63.5753, Elevation: 11},
+		},
+		HeartRates: []WorkoutHeartRate{{Elapsed: 5 * time.Second, BeatsPerMinute: 120}},
+	}
+	created := time.Date(2021, 7, 10, 12, 0, 0, 0, time.UTC)
+
+	var requests int
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Method != "POST" || req.URL.Path != "/vxproxy/v7.0/workout/" {
+			t.Errorf("got %s %s, want POST /vxproxy/v7.0/workout/", req.Method, req.URL.Path)
+		}
+		if fail {
+			wr.WriteHeader(500)
+			return
+		}
+
+		var body struct {
+			Name         string
+			ActivityType string             `json:"activity_type"`
+			StartedAt    string             `json:"start_datetime"`
+			TimeZone     string             `json:"start_locale_timezone"`
+			Aggregates   map[string]float64 `json:"aggregates"`
+			TimeSeries   json.RawMessage    `json:"time_series"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		wantAggregates := map[string]float64{"active_time_total": 1200, "elapsed_time_total": 1200, "distance_total": 5000, "metabolic_energy_total": 150 * 4184}
+		if d := cmp.Diff(wantAggregates, body.Aggregates); d != "" {
+			t.Errorf("aggregates mismatch (-want +got):\n%s", d)
+		}
+		if body.Name != "commute" || body.ActivityType != "/v7.0/activity_type/11/" || body.StartedAt != "2021-07-10T07:32:56-03:00" || body.TimeZone != "America/Halifax" {
+			t.Errorf("got workout %+v", body)
+		}
+
+		// The series sent read back the same as fetched ones.
+		var got Workout
+		if _, err := parseWorkoutDetail([]byte(`{"time_series": `+string(body.TimeSeries)+`}`), &got); err != nil {
+			t.Fatal(err)
+		}
+		if d := cmp.Diff(w.Positions, got.Positions); d != "" {
+			t.Errorf("positions mismatch (-want +got):\n%s", d)
+		}
+		if d := cmp.Diff(w.HeartRates, got.HeartRates); d != "" {
+			t.Errorf("heart rates mismatch (-want +got):\n%s", d)
+		}
+
+		wr.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(wr, `{"created_datetime": %q, "updated_datetime": %q, "_links": {"self": [{"id": "777"}]}}`, created.Format(time.RFC3339), created.Format(time.RFC3339))
+	}))
+	defer srv.Close()
+
+	c := NewClient(StaticTokenSource("secret"))
+	c.baseURL = srv.URL
+	c.MaxRetries = 3
+	c.sleep = func(context.Context, time.Duration) error { return nil }
+
+	got, err := c.CreateWorkout(context.Background(), w, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := w
+	want.ID = 777
+	want.CreatedAt, want.UpdatedAt = created, created
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("workout mismatch (-want +got):\n%s", d)
+	}
+
+	// Failures aren't retried, since the workout may have been created.
+	fail, requests = true, 0
+	if _, err := c.CreateWorkout(context.Background(), w, 11); err == nil {
+		t.Error("got no error creating a workout with a failing server")
+	}
+	if requests != 1 {
+		t.Errorf("got %d requests creating a workout with a failing server, want 1", requests)
+	}
+}
+
+func TestClientUpdateDeleteWorkout(t *testing.T) {
+	type request struct {
+		method, path string
+		body         map[string]interface{}
+	}
+	var (
+		got      []request
+		failures int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		r := request{method: req.Method, path: req.URL.Path}
+		if req.ContentLength > 0 {
+			if err := json.NewDecoder(req.Body).Decode(&r.body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got = append(got, r)
+		switch {
+		case failures > 0:
+			failures--
+			wr.WriteHeader(503)
+		case req.URL.Path != "/vxproxy/v7.0/workout/777/":
+			wr.WriteHeader(404)
+		case req.Method == "DELETE":
+			wr.WriteHeader(http.StatusNoContent)
+		default:
+			fmt.Fprint(wr, `{}`)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(StaticTokenSource("secret"))
+	c.baseURL = srv.URL
+	c.MaxRetries = 3
+	c.sleep = func(context.Context, time.Duration) error { return nil }
+	ctx := context.Background()
+
+	// Updates are retried with the same body.
+	failures = 1
+	notes := ""
+	if err := c.UpdateWorkout(ctx, 777, WorkoutUpdate{Name: "commute", ActivityTypeID: 11, Notes: &notes}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateWorkout(ctx, 777, WorkoutUpdate{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteWorkout(ctx, 777); err != nil {
+		t.Fatal(err)
+	}
+	body := map[string]interface{}{"name": "commute", "activity_type": "/v7.0/activity_type/11/", "notes": ""}
+	want := []request{
+		{method: "PUT", path: "/vxproxy/v7.0/workout/777/", body: body},
+		{method: "PUT", path: "/vxproxy/v7.0/workout/777/", body: body},
+		{method: "DELETE", path: "/vxproxy/v7.0/workout/777/"},
+	}
+	if d := cmp.Diff(want, got, cmp.AllowUnexported(request{})); d != "" {
+		t.Errorf("requests mismatch (-want +got):\n%s", d)
+	}
+
+	if err := c.UpdateWorkout(ctx, 9, WorkoutUpdate{Name: "x"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v updating a missing workout, want ErrNotFound", err)
+	}
+	if err := c.DeleteWorkout(ctx, 9); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got error %v deleting a missing workout, want ErrNotFound", err)
+	}
+}
+
+func TestClientUploadWorkoutFile(t *testing.T) {
+	const gpx = `<gpx version="1.1"><trk><trkseg><trkpt lat="44.6488" lon="-63.5752"></trkpt></trkseg></trk></gpx>`
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Method != "POST" || req.URL.Path != "/vxproxy/v7.0/file_import/" {
+			t.Errorf("got %s %s, want POST /vxproxy/v7.0/file_import/", req.Method, req.URL.Path)
+		}
+		f, fh, err := req.FormFile("file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fh.Filename != "workout.gpx" || string(b) != gpx {
+			t.Errorf("got file %q with %q, want workout.gpx with %q", fh.Filename, b, gpx)
+		}
+		wr.WriteHeader(http.StatusCreated)
+		fmt.Fprint(wr, `{"_links": {"workout": [{"id": "778"}]}}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(StaticTokenSource("secret"))
+	c.baseURL = srv.URL
+
+	id, err := c.UploadWorkoutFile(context.Background(), strings.NewReader(gpx), FormatGPX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 778 {
+		t.Errorf("got id %d, want 778", id)
+	}
+
+	if _, err := c.UploadWorkoutFile(context.Background(), strings.NewReader(gpx), "fit"); err == nil {
+		t.Error("got no error uploading an unknown format")
+	}
+	if requests != 1 {
+		t.Errorf("got %d requests, want 1", requests)
+	}
+}
+
+func TestClientGetWorkoutsMissingID(t *testing.T) {
+	refTime := time.Date(2021, 7, 10, 7, 32, 56, 0, time.UTC)
+
+	wsrv := newWorkoutServer()
+	ride := testWorkout{
+		id:        12345,
+		name:      "ride",
+		kind:      "ride",
+		startedAt: refTime,
+	}
+	wsrv.addWorkout(ride)
+	wsrv.addWorkout(testWorkout{
+		id:        99,
+		name:      "gym",
+		kind:      "weight-training",
+		kcal:      300,
+		duration:  45 * time.Minute,
+		startedAt: refTime,
+		noViewURL: true,
+	})
+
+	srv := httptest.NewServer(wsrv)
+	defer srv.Close()
+
+	getWorkouts := func(opts ...GetWorkoutsOption) ([]Workout, []string, error) {
+		var logged []string
+		c := NewClient(StaticTokenSource("secret"))
+		c.baseURL = srv.URL
+		c.Logf = func(format string, args ...interface{}) {
+			logged = append(logged, fmt.Sprintf(format, args...))
+		}
+		wks, err := c.GetWorkouts(context.Background(), refTime, refTime.Add(time.Hour), opts...)
+		return wks, logged, err
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		_, _, err := getWorkouts()
+		var fe *FetchError
+		if !errors.As(err, &fe) || fe.Phase != PhaseDashboard {
+			t.Fatalf("got error %v, want a dashboard *FetchError", err)
+		}
+	})
+
+	t.Run("Skip", func(t *testing.T) {
+		got, logged, err := getWorkouts(WithMissingIDs(MissingIDSkip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := cmp.Diff([]Workout{ride.toWorkout()}, got); d != "" {
+			t.Errorf("workouts mismatch (-want +got):\n%s", d)
+		}
+		if len(logged) != 1 {
+			t.Errorf("got log %q, want one warning", logged)
+		}
+	})
+
+	t.Run("Synthesize", func(t *testing.T) {
+		got, _, err := getWorkouts(WithMissingIDs(MissingIDSynthesize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 2 {
+			t.Fatalf("got %d workouts, want 2", len(got))
+		}
+		gym := got[0]
+		if gym.ID >= 0 {
+			t.Errorf("got synthesized ID %d, want a negative one", gym.ID)
+		}
+		want := Workout{
+			ID:        gym.ID,
+			Name:      "gym",
+			Kind:      "weight-training",
+			Kcal:      300,
+			Duration:  45 * time.Minute,
+			StartedAt: time.Date(2021, 7, 10, 0, 0, 0, 0, time.UTC),
+		}
+		if d := cmp.Diff(want, gym); d != "" {
+			t.Errorf("synthesized workout mismatch (-want +got):\n%s", d)
+		}
+
+		again, _, err := getWorkouts(WithMissingIDs(MissingIDSynthesize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again[0].ID != gym.ID {
+			t.Errorf("got ID %d on second fetch, want stable %d", again[0].ID, gym.ID)
+		}
+	})
+}
+
+func TestClientGetWorkoutsSchemaDrift(t *testing.T) {
+	refTime := time.Date(2021, 7, 10, 7, 32, 56, 0, time.UTC)
+
+	wsrv := newWorkoutServer()
+	wk := testWorkout{
+		id:        1,
+		name:      "ride",
+		kind:      "ride",
+		startedAt: refTime,
+	}
+	wsrv.addWorkout(wk)
+
+	// Add a field to detail responses.
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/vxproxy/v7.0/workout/1/" {
+			wsrv.ServeHTTP(wr, req)
+			return
+		}
+		rec := httptest.NewRecorder()
+		wsrv.ServeHTTP(rec, req)
+		var resp map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			panic(err)
+		}
+		resp["moving_time"] = 123
+		delete(resp, "_links")
+		json.NewEncoder(wr).Encode(resp)
+	}))
+	defer srv.Close()
+
+	t.Run("Ignore", func(t *testing.T) {
+		c := NewClient(StaticTokenSource("secret"))
+		c.baseURL = srv.URL
+		if _, err := c.GetWorkouts(context.Background(), refTime, refTime.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Log", func(t *testing.T) {
+		c := NewClient(StaticTokenSource("secret"))
+		c.baseURL = srv.URL
+		c.SchemaDrift = SchemaDriftLog
+		var logs []string
+		c.Logf = func(format string, args ...interface{}) {
+			logs = append(logs, fmt.Sprintf(format, args...))
+		}
+		for i := 0; i < 2; i++ {
+			got, err := c.GetWorkouts(context.Background(), refTime, refTime.Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := cmp.Diff([]Workout{wk.toWorkout()}, got); d != "" {
+				t.Errorf("workouts mismatch (-want +got):\n%s", d)
+			}
+		}
+		want := []string{"detail response schema changed: unknown fields moving_time; missing fields _links"}
+		if d := cmp.Diff(want, logs); d != "" {
+			t.Errorf("logs mismatch (-want +got):\n%s", d)
+		}
+	})
+
+	t.Run("Fail", func(t *testing.T) {
+		c := NewClient(StaticTokenSource("secret"))
+		c.baseURL = srv.URL
+		c.SchemaDrift = SchemaDriftFail
+		_, err := c.GetWorkouts(context.Background(), refTime, refTime.Add(time.Hour))
+		var de *SchemaDriftError
+		if !errors.As(err, &de) {
+			t.Fatalf("got error %v, want a *SchemaDriftError", err)
+		}
+		if d := cmp.Diff(&SchemaDriftError{Response: "detail", Unknown: []string{"moving_time"}, Missing: []string{"_links"}}, de); d != "" {
+			t.Errorf("error mismatch (-want +got):\n%s", d)
+		}
+	})
+}
+
 func TestMonths(t *testing.T) {
 	pd := func(s string) time.Time {
 		pt, err := time.Parse("2006-01-02", s)
@@ -462,6 +1621,39 @@ func (t testWorkoutStep) MarshalJSON() ([]byte, error) {
 	return json.Marshal(out)
 }
 
+type testWorkoutHeartRate struct {
+	elapsed        time.Duration
+	beatsPerMinute float64
+}
+
+// [elapsed, bpm]
+func (t testWorkoutHeartRate) MarshalJSON() ([]byte, error) {
+	out := [2]float64{t.elapsed.Seconds(), t.beatsPerMinute}
+	return json.Marshal(out)
+}
+
+type testWorkoutCadence struct {
+	elapsed time.Duration
+	rpm     float64
+}
+
+// [elapsed, rpm]
+func (t testWorkoutCadence) MarshalJSON() ([]byte, error) {
+	out := [2]float64{t.elapsed.Seconds(), t.rpm}
+	return json.Marshal(out)
+}
+
+type testWorkoutPower struct {
+	elapsed time.Duration
+	watts   float64
+}
+
+// [elapsed, watts]
+func (t testWorkoutPower) MarshalJSON() ([]byte, error) {
+	out := [2]float64{t.elapsed.Seconds(), t.watts}
+	return json.Marshal(out)
+}
+
 type testActivityType struct {
 	id   int
 	name string
@@ -472,7 +1664,7 @@ type testWorkout struct {
 	name      string
 	kind      string
 	kcal      int
-	gain      int
+	gain      float64
 	gainValue string
 	distance  float64
 	speed     float64
@@ -482,12 +1674,19 @@ type testWorkout struct {
 	createdAt time.Time
 	updatedAt time.Time
 
+	// noViewURL leaves the workout's view_url empty in the dashboard,
+	// as for some manually entered workouts.
+	noViewURL bool
+
 	activityType testActivityType
 
-	distances []testWorkoutDistance
-	positions []testWorkoutPosition
-	speeds    []testWorkoutSpeed
-	steps     []testWorkoutStep
+	distances  []testWorkoutDistance
+	positions  []testWorkoutPosition
+	speeds     []testWorkoutSpeed
+	steps      []testWorkoutStep
+	heartRates []testWorkoutHeartRate
+	cadences   []testWorkoutCadence
+	powers     []testWorkoutPower
 }
 
 func (w testWorkout) toWorkout() Workout {
@@ -506,13 +1705,27 @@ func (w testWorkout) toWorkout() Workout {
 		UpdatedAt:    w.updatedAt,
 	}
 
-	for _, p := range w.positions {
+	for i, p := range w.positions {
 		wk.Positions = append(wk.Positions, WorkoutPosition{
 			Elapsed:   p.elapsed,
 			Elevation: p.elevation,
 			Lat:       p.lat,
 			Lng:       p.lng,
 		})
+		if i == 0 {
+			wk.StartElevation, wk.MaxElevation, wk.MinElevation = p.elevation, p.elevation, p.elevation
+		}
+		if p.elevation > wk.MaxElevation {
+			wk.MaxElevation = p.elevation
+		}
+		if p.elevation < wk.MinElevation {
+			wk.MinElevation = p.elevation
+		}
+	}
+
+	// uiWorkoutHandler's elevation table shows Start and Max.
+	if w.gain != 0 {
+		wk.StartElevation, wk.MaxElevation = 61, 61
 	}
 
 	for _, d := range w.distances {
@@ -536,6 +1749,27 @@ func (w testWorkout) toWorkout() Workout {
 		})
 	}
 
+	for _, h := range w.heartRates {
+		wk.HeartRates = append(wk.HeartRates, WorkoutHeartRate{
+			Elapsed:        h.elapsed,
+			BeatsPerMinute: h.beatsPerMinute,
+		})
+	}
+
+	for _, c := range w.cadences {
+		wk.Cadences = append(wk.Cadences, WorkoutCadence{
+			Elapsed: c.elapsed,
+			RPM:     c.rpm,
+		})
+	}
+
+	for _, p := range w.powers {
+		wk.Powers = append(wk.Powers, WorkoutPower{
+			Elapsed: p.elapsed,
+			Watts:   p.watts,
+		})
+	}
+
 	return wk
 }
 
@@ -591,6 +1825,9 @@ func (w *workoutServer) dashboardHandler(wr http.ResponseWriter, req *http.Reque
 				"view_url":            "/workout/" + strconv.Itoa(wk.id),
 			}
 
+			if wk.noViewURL {
+				rwk["view_url"] = ""
+			}
 			if wk.stepCount > 0 {
 				rwk["steps"] = wk.stepCount
 			} else {
@@ -703,6 +1940,18 @@ func (w *workoutServer) apiWorkoutHandler(wr http.ResponseWriter, req *http.Requ
 		ts["steps"] = wk.steps
 	}
 
+	if len(wk.heartRates) > 0 {
+		ts["heartrate"] = wk.heartRates
+	}
+
+	if len(wk.cadences) > 0 {
+		ts["cadence"] = wk.cadences
+	}
+
+	if len(wk.powers) > 0 {
+		ts["power"] = wk.powers
+	}
+
 	if len(ts) > 0 {
 		rawresp.Timeseries = ts
 	}
@@ -744,7 +1993,7 @@ func (w *workoutServer) uiWorkoutHandler(wr http.ResponseWriter, req *http.Reque
 
 	gain := wk.gainValue
 	if gain == "" {
-		gain = strconv.Itoa(wk.gain)
+		gain = strconv.FormatFloat(wk.gain, 'f', -1, 64)
 	}
 
 	fmt.Fprintln(wr, `
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/danp/mapmyride"
+)
+
+// lateEditAge is how long after a workout was created an edit to it is
+// unusual enough to report.
+const lateEditAge = 30 * 24 * time.Hour
+
+// Monthly counts are compared against this many months before, and only
+// when those averaged at least minBaselineWorkouts, so quiet accounts
+// don't raise alarms.
+const (
+	baselineMonths      = 6
+	minBaselineWorkouts = 4
+)
+
+// anomaly is something unusual noticed during a sync that may mean
+// something is wrong with the account or mapmyride.
+type anomaly struct {
+	WorkoutID int // if about one workout
+	Message   string
+}
+
+// lateEdit returns an anomaly if w, which a sync found changed, was
+// updated long after it was created.
+func lateEdit(w mapmyride.Workout) (anomaly, bool) {
+	if w.CreatedAt.IsZero() || w.UpdatedAt.Sub(w.CreatedAt) <= lateEditAge {
+		return anomaly{}, false
+	}
+	return anomaly{
+		WorkoutID: w.ID,
+		Message:   fmt.Sprintf("workout %d named %s was edited %d days after it was created", w.ID, w.Name, int(w.UpdatedAt.Sub(w.CreatedAt).Hours()/24)),
+	}, true
+}
+
+// monthlyDrop returns an anomaly if userName had less than half as many
+// workouts in the month before the one containing now as they averaged
+// over the months before that.
+func (d *DB) monthlyDrop(ctx context.Context, userName string, now time.Time) (anomaly, bool, error) {
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	last := thisMonth.AddDate(0, -1, 0)
+	summaries, err := d.workoutSummaries(ctx, userName, last.AddDate(0, -baselineMonths, 0), thisMonth)
+	if err != nil {
+		return anomaly{}, false, err
+	}
+
+	var n, before int
+	for _, s := range summaries {
+		if s.StartedAt.Before(last) {
+			before++
+		} else {
+			n++
+		}
+	}
+	avg := float64(before) / baselineMonths
+	if avg < minBaselineWorkouts || float64(n) >= avg/2 {
+		return anomaly{}, false, nil
+	}
+	return anomaly{
+		Message: fmt.Sprintf("only %d workouts in %s, down from an average of %.1f a month over the %d months before", n, last.Format("2006-01"), avg, baselineMonths),
+	}, true, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danp/mapmyride"
+)
+
+// audit compares remote, workout summaries fetched for userName between
+// begin and end, with the stored workouts started in that range. It
+// prints workouts missing locally, stored but gone remotely, or whose
+// summary differs from what was stored, and returns how many there were.
+// Nothing is written.
+func (d *DB) audit(ctx context.Context, w io.Writer, userName string, remote []mapmyride.Workout, begin, end time.Time) (int, error) {
+	rows, err := d.db.QueryContext(ctx, "select id, coalesce(original_name, name), kind, coalesce(kcal, 0), coalesce(distance_m, 0), coalesce(duration_s, 0), started_at from workouts where user_name=$1", userName)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	stored := make(map[int]mapmyride.Workout)
+	for rows.Next() {
+		var (
+			sw        mapmyride.Workout
+			durationS int
+		)
+		if err := rows.Scan(&sw.ID, &sw.Name, &sw.Kind, &sw.Kcal, &sw.Distance, &durationS, &sw.StartedAt); err != nil {
+			return 0, err
+		}
+		sw.Duration = time.Duration(durationS) * time.Second
+		stored[sw.ID] = sw
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	trashed, err := d.store.Trashed(ctx)
+	if err != nil {
+		return 0, err
+	}
+	inTrash := make(map[int]bool)
+	for _, t := range trashed {
+		inTrash[t.ID] = true
+	}
+
+	type problem struct {
+		id      int
+		day     string
+		name    string
+		problem string
+	}
+	var problems []problem
+
+	seen := make(map[int]bool)
+	for _, rw := range remote {
+		seen[rw.ID] = true
+		day := rw.StartedAt.Format("2006-01-02")
+		sw, ok := stored[rw.ID]
+		switch {
+		case !ok && inTrash[rw.ID]:
+			problems = append(problems, problem{rw.ID, day, rw.Name, "in trash, see restore"})
+		case !ok:
+			problems = append(problems, problem{rw.ID, day, rw.Name, "missing locally"})
+		default:
+			if diffs := summaryDiffs(sw, rw); len(diffs) > 0 {
+				problems = append(problems, problem{rw.ID, day, rw.Name, "stale " + strings.Join(diffs, ", ")})
+			}
+		}
+	}
+	for _, sw := range stored {
+		if seen[sw.ID] || sw.StartedAt.Before(begin) || sw.StartedAt.After(end) {
+			continue
+		}
+		problems = append(problems, problem{sw.ID, sw.StartedAt.In(begin.Location()).Format("2006-01-02"), sw.Name, "not on mapmyride"})
+	}
+	sort.Slice(problems, func(i, j int) bool {
+		if problems[i].day == problems[j].day {
+			return problems[i].id < problems[j].id
+		}
+		return problems[i].day < problems[j].day
+	})
+
+	fmt.Fprintf(w, "checked %d workouts from %s to %s\n", len(remote), begin.Format("2006-01-02"), end.Format("2006-01-02"))
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "all workouts match")
+		return 0, nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDATE\tNAME\tPROBLEM")
+	for _, p := range problems {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", p.id, p.day, p.name, p.problem)
+	}
+	return len(problems), tw.Flush()
+}
+
+// summaryDiffs returns the names of the summary fields that differ
+// between stored and remote.
+func summaryDiffs(stored, remote mapmyride.Workout) []string {
+	var out []string
+	if stored.Name != remote.Name {
+		out = append(out, "name")
+	}
+	if stored.Kind != remote.Kind {
+		out = append(out, "kind")
+	}
+	if stored.Kcal != remote.Kcal {
+		out = append(out, "kcal")
+	}
+	if math.Abs(stored.Distance-remote.Distance) > 1 {
+		out = append(out, "distance")
+	}
+	if stored.Duration != remote.Duration {
+		out = append(out, "duration")
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/danp/mapmyride"
+	"github.com/danp/mapmyride/sync"
+)
+
+// changesetEntry is one line of a changeset file.
+type changesetEntry struct {
+	// Op is "upsert" or "remove".
+	Op        string             `json:"op"`
+	UserName  string             `json:"user_name"`
+	Workout   *mapmyride.Workout `json:"workout,omitempty"`
+	WorkoutID int                `json:"workout_id,omitempty"`
+}
+
+// changesetWriter writes the workouts a sync run changes to a JSON Lines
+// file in a directory, so replicas can apply just those changes.
+type changesetWriter struct {
+	dir      string
+	userName string
+	f        *os.File
+	enc      *json.Encoder
+	n        int
+}
+
+// newChangesetWriter starts a changeset in dir. It is written to a
+// temporary file until finish, so replicas never see partial changesets.
+func newChangesetWriter(dir, userName string) (*changesetWriter, error) {
+	f, err := os.CreateTemp(dir, ".changeset-*.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	return &changesetWriter{dir: dir, userName: userName, f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// workout records w as added or changed.
+func (c *changesetWriter) workout(w mapmyride.Workout) error {
+	c.n++
+	return c.enc.Encode(changesetEntry{Op: "upsert", UserName: c.userName, Workout: &w})
+}
+
+// finish records the workouts run removed and moves the changeset into
+// place, named for when run started. Empty changesets are discarded.
+func (c *changesetWriter) finish(run sync.Run) error {
+	var removed []int
+	for id, ch := range run.Changes {
+		if ch == sync.Removed {
+			removed = append(removed, id)
+		}
+	}
+	sort.Ints(removed)
+	for _, id := range removed {
+		c.n++
+		if err := c.enc.Encode(changesetEntry{Op: "remove", UserName: c.userName, WorkoutID: id}); err != nil {
+			c.f.Close()
+			os.Remove(c.f.Name())
+			return err
+		}
+	}
+
+	if err := c.f.Close(); err != nil {
+		os.Remove(c.f.Name())
+		return err
+	}
+	if c.n == 0 {
+		return os.Remove(c.f.Name())
+	}
+	name := filepath.Join(c.dir, "changeset-"+run.StartedAt.UTC().Format("20060102T150405.000000000Z")+".jsonl")
+	return os.Rename(c.f.Name(), name)
+}
+
+// applyChangeset applies a changeset written by changesetWriter,
+// returning the number of entries applied.
+func (d *DB) applyChangeset(ctx context.Context, r io.Reader) (int, error) {
+	var n int
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 256<<20) // workouts with long series make long lines
+	for sc.Scan() {
+		var e changesetEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return n, fmt.Errorf("entry %d: %w", n+1, err)
+		}
+		switch {
+		case e.Op == "upsert" && e.Workout != nil:
+			if _, err := d.store.Sync(ctx, e.UserName, *e.Workout); err != nil {
+				return n, err
+			}
+		case e.Op == "remove":
+			if err := d.store.Remove(ctx, e.WorkoutID); err != nil {
+				return n, err
+			}
+		default:
+			return n, fmt.Errorf("entry %d: unknown op %q", n+1, e.Op)
+		}
+		n++
+	}
+	return n, sc.Err()
+}
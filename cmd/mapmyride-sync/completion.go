@@ -0,0 +1,241 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/peterbourgon/ff/ffcli"
+)
+
+// newCompletionCommand returns the completion command, completing the
+// subcommands and flags of root.
+func newCompletionCommand(root *ffcli.Command) *ffcli.Command {
+	return &ffcli.Command{
+		Name:      "completion",
+		Usage:     "mapmyride-sync completion bash|zsh|fish",
+		ShortHelp: "print a shell completion script, such as for: source <(mapmyride-sync completion bash)",
+		Exec: func(args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			switch args[0] {
+			case "bash":
+				return writeBashCompletion(os.Stdout, root)
+			case "zsh":
+				return writeZshCompletion(os.Stdout, root)
+			case "fish":
+				return writeFishCompletion(os.Stdout, root)
+			}
+			return fmt.Errorf("unknown shell %q, want bash, zsh or fish", args[0])
+		},
+	}
+}
+
+// newManCommand returns the man command, documenting root.
+func newManCommand(root *ffcli.Command) *ffcli.Command {
+	return &ffcli.Command{
+		Name:      "man",
+		Usage:     "mapmyride-sync man",
+		ShortHelp: "print a man page, such as for: mapmyride-sync man > mapmyride-sync.1",
+		Exec: func(args []string) error {
+			if len(args) != 0 {
+				return flag.ErrHelp
+			}
+			return writeManPage(os.Stdout, root)
+		},
+	}
+}
+
+// commandPath is a command with the names of the subcommands leading to
+// it from the root, which has none.
+type commandPath struct {
+	names []string
+	cmd   *ffcli.Command
+}
+
+// commandPaths returns root and each of its subcommands, depth first.
+func commandPaths(root *ffcli.Command) []commandPath {
+	var out []commandPath
+	var walk func(names []string, c *ffcli.Command)
+	walk = func(names []string, c *ffcli.Command) {
+		out = append(out, commandPath{names, c})
+		for _, sub := range c.Subcommands {
+			walk(append(names[:len(names):len(names)], sub.Name), sub)
+		}
+	}
+	walk(nil, root)
+	return out
+}
+
+// commandFlags returns the flags of c, which may have no FlagSet.
+func commandFlags(c *ffcli.Command) []*flag.Flag {
+	var fs []*flag.Flag
+	if c.FlagSet != nil {
+		c.FlagSet.VisitAll(func(f *flag.Flag) { fs = append(fs, f) })
+	}
+	return fs
+}
+
+// writeBashCompletion writes a bash completion script for root, offering
+// the subcommands and flags of the deepest command typed so far.
+func writeBashCompletion(w io.Writer, root *ffcli.Command) error {
+	paths := commandPaths(root)
+
+	var b strings.Builder
+	b.WriteString("# bash completion for mapmyride-sync\n")
+	b.WriteString("_mapmyride_sync() {\n")
+	b.WriteString("\tlocal cur path word words\n")
+	b.WriteString("\tcur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	b.WriteString("\tpath=\"\"\n")
+	b.WriteString("\tfor word in \"${COMP_WORDS[@]:1:COMP_CWORD-1}\"; do\n")
+	b.WriteString("\t\tcase \"${path:+$path }$word\" in\n")
+	var known []string
+	for _, p := range paths[1:] {
+		known = append(known, fmt.Sprintf("%q", strings.Join(p.names, " ")))
+	}
+	fmt.Fprintf(&b, "\t\t%s) path=\"${path:+$path }$word\" ;;\n", strings.Join(known, "|"))
+	b.WriteString("\t\tesac\n")
+	b.WriteString("\tdone\n")
+	b.WriteString("\tcase \"$path\" in\n")
+	for _, p := range paths {
+		var words []string
+		for _, sub := range p.cmd.Subcommands {
+			words = append(words, sub.Name)
+		}
+		for _, f := range commandFlags(p.cmd) {
+			words = append(words, "-"+f.Name)
+		}
+		fmt.Fprintf(&b, "\t%q) words=%q ;;\n", strings.Join(p.names, " "), strings.Join(words, " "))
+	}
+	b.WriteString("\tesac\n")
+	b.WriteString("\tCOMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	b.WriteString("}\n")
+	b.WriteString("complete -o default -F _mapmyride_sync mapmyride-sync\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeZshCompletion writes a zsh completion script for root, reusing the
+// bash one through bashcompinit.
+func writeZshCompletion(w io.Writer, root *ffcli.Command) error {
+	if _, err := io.WriteString(w, "# zsh completion for mapmyride-sync\nautoload -U +X bashcompinit && bashcompinit\n"); err != nil {
+		return err
+	}
+	return writeBashCompletion(w, root)
+}
+
+// writeFishCompletion writes a fish completion script for root, with each
+// command's ShortHelp and each flag's usage as descriptions.
+func writeFishCompletion(w io.Writer, root *ffcli.Command) error {
+	var b strings.Builder
+	b.WriteString("# fish completion for mapmyride-sync\n")
+	for _, p := range commandPaths(root) {
+		// Only complete after the command's own path, and before any of
+		// its subcommands.
+		var conds []string
+		if len(p.names) == 0 {
+			conds = append(conds, "__fish_use_subcommand")
+		}
+		for _, name := range p.names {
+			conds = append(conds, "__fish_seen_subcommand_from "+name)
+		}
+		var subs []string
+		for _, sub := range p.cmd.Subcommands {
+			subs = append(subs, sub.Name)
+		}
+		subCond := strings.Join(conds, "; and ")
+		if len(p.names) > 0 && len(subs) > 0 {
+			subCond += "; and not __fish_seen_subcommand_from " + strings.Join(subs, " ")
+		}
+
+		for _, sub := range p.cmd.Subcommands {
+			fmt.Fprintf(&b, "complete -c mapmyride-sync -f -n %s -a %s -d %s\n", fishQuote(subCond), sub.Name, fishQuote(sub.ShortHelp))
+		}
+		flagCond := strings.Join(conds, "; and ")
+		if len(p.names) == 0 {
+			// Root flags can come before any subcommand.
+			flagCond = "__fish_use_subcommand"
+		}
+		for _, f := range commandFlags(p.cmd) {
+			_, usage := flag.UnquoteUsage(f)
+			fmt.Fprintf(&b, "complete -c mapmyride-sync -n %s -o %s -d %s\n", fishQuote(flagCond), f.Name, fishQuote(usage))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fishQuote quotes s as a single fish word.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// writeManPage writes a man page for root in roff, with each command's
+// usage, help and flags.
+func writeManPage(w io.Writer, root *ffcli.Command) error {
+	var b strings.Builder
+	b.WriteString(".TH MAPMYRIDE-SYNC 1\n")
+	b.WriteString(".SH NAME\n")
+	b.WriteString("mapmyride-sync \\- sync MapMyRide workouts into a SQLite database\n")
+	b.WriteString(".SH SYNOPSIS\n")
+	fmt.Fprintf(&b, ".B %s\n", roffEscape(root.Usage))
+
+	paths := commandPaths(root)
+	if fs := commandFlags(root); len(fs) > 0 {
+		b.WriteString(".SH OPTIONS\n")
+		writeManFlags(&b, fs)
+	}
+	b.WriteString(".SH COMMANDS\n")
+	for _, p := range paths[1:] {
+		fmt.Fprintf(&b, ".SS %s\n", roffEscape(strings.Join(p.names, " ")))
+		if p.cmd.Usage != "" {
+			fmt.Fprintf(&b, ".B %s\n.PP\n", roffEscape(p.cmd.Usage))
+		}
+		if p.cmd.ShortHelp != "" {
+			fmt.Fprintf(&b, "%s\n", roffEscape(p.cmd.ShortHelp))
+		}
+		if p.cmd.LongHelp != "" {
+			fmt.Fprintf(&b, ".PP\n%s\n", roffEscape(p.cmd.LongHelp))
+		}
+		writeManFlags(&b, commandFlags(p.cmd))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeManFlags writes a tagged paragraph for each of fs.
+func writeManFlags(b *strings.Builder, fs []*flag.Flag) {
+	for _, f := range fs {
+		name, usage := flag.UnquoteUsage(f)
+		tag := "\\fB\\-" + roffEscape(f.Name) + "\\fR"
+		if name != "" {
+			tag += " \\fI" + roffEscape(name) + "\\fR"
+		}
+		// As in flag's own help, zero defaults go unmentioned.
+		switch f.DefValue {
+		case "", "false", "0", "0s":
+		default:
+			usage += " (default " + f.DefValue + ")"
+		}
+		fmt.Fprintf(b, ".TP\n%s\n%s\n", tag, roffEscape(usage))
+	}
+}
+
+// roffEscape escapes s for use as roff text, so backslashes and dashes
+// print as themselves and lines can't start a request.
+func roffEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, ".") || strings.HasPrefix(l, "'") {
+			lines[i] = `\&` + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/peterbourgon/ff/ffcli"
+)
+
+// testCommandTree returns a root command with a nested subcommand, each
+// with flags.
+func testCommandTree() *ffcli.Command {
+	rootFS := flag.NewFlagSet("mapmyride-sync", flag.ContinueOnError)
+	rootFS.String("database-file", "data.db", "data file path")
+	weeksFS := flag.NewFlagSet("mapmyride-sync stats plan", flag.ContinueOnError)
+	weeksFS.Int("weeks", 4, "number of `n` weeks")
+	return &ffcli.Command{
+		Usage:   "mapmyride-sync [flags] [<subcommand>]",
+		FlagSet: rootFS,
+		Subcommands: []*ffcli.Command{
+			{
+				Name:      "stats",
+				ShortHelp: "report statistics",
+				Subcommands: []*ffcli.Command{
+					{Name: "plan", Usage: "mapmyride-sync stats plan [flags]", ShortHelp: "it's the plan", FlagSet: weeksFS},
+				},
+			},
+			{Name: "version", ShortHelp: "print version information"},
+		},
+	}
+}
+
+func TestWriteBashCompletion(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeBashCompletion(&buf, testCommandTree()); err != nil {
+		t.Fatal(err)
+	}
+	script := buf.String()
+	for _, want := range []string{
+		`"stats"|"stats plan"|"version") path=`,
+		`"") words="stats version -database-file" ;;`,
+		`"stats") words="plan" ;;`,
+		`"stats plan") words="-weeks" ;;`,
+		"complete -o default -F _mapmyride_sync mapmyride-sync",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %s:\n%s", want, script)
+		}
+	}
+
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("no bash to run the script with")
+	}
+	for _, tc := range []struct {
+		words string
+		want  string
+	}{
+		{"mapmyride-sync st", "stats"},
+		{"mapmyride-sync -database-file x.db stats p", "plan"},
+		{"mapmyride-sync stats plan -w", "-weeks"},
+	} {
+		cmd := exec.Command(bash, "-c", script+`COMP_WORDS=($WORDS); COMP_CWORD=$((${#COMP_WORDS[@]}-1)); _mapmyride_sync; echo "${COMPREPLY[@]}"`)
+		cmd.Env = append(cmd.Environ(), "WORDS="+tc.words)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("%q: %v", tc.words, err)
+		}
+		if got := strings.TrimSpace(string(out)); got != tc.want {
+			t.Errorf("completing %q: got %q, want %q", tc.words, got, tc.want)
+		}
+	}
+}
+
+func TestWriteFishCompletion(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeFishCompletion(&buf, testCommandTree()); err != nil {
+		t.Fatal(err)
+	}
+	script := buf.String()
+	for _, want := range []string{
+		`complete -c mapmyride-sync -f -n '__fish_use_subcommand' -a stats -d 'report statistics'`,
+		`complete -c mapmyride-sync -f -n '__fish_seen_subcommand_from stats; and not __fish_seen_subcommand_from plan' -a plan -d 'it\'s the plan'`,
+		`complete -c mapmyride-sync -n '__fish_seen_subcommand_from stats; and __fish_seen_subcommand_from plan' -o weeks -d 'number of n weeks'`,
+		`complete -c mapmyride-sync -n '__fish_use_subcommand' -o database-file -d 'data file path'`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script missing %s:\n%s", want, script)
+		}
+	}
+}
+
+func TestWriteManPage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeManPage(&buf, testCommandTree()); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	for _, want := range []string{
+		".TH MAPMYRIDE-SYNC 1\n",
+		".B mapmyride\\-sync [flags] [<subcommand>]\n",
+		".TP\n\\fB\\-database\\-file\\fR \\fIstring\\fR\ndata file path (default data.db)\n",
+		".SS stats plan\n.B mapmyride\\-sync stats plan [flags]\n.PP\nit's the plan\n",
+		".TP\n\\fB\\-weeks\\fR \\fIn\\fR\nnumber of n weeks (default 4)\n",
+		".SS version\nprint version information\n",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page missing %q:\n%s", want, page)
+		}
+	}
+}
+
+func TestRoffEscape(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"plain", "plain"},
+		{"-flag", `\-flag`},
+		{`a\b`, `a\eb`},
+		{".starts a request\n'so does this", "\\&.starts a request\n\\&'so does this"},
+	} {
+		if got := roffEscape(tc.in); got != tc.want {
+			t.Errorf("roffEscape(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
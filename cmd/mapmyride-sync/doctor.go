@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/danp/mapmyride"
+	"github.com/danp/mapmyride/sync"
+)
+
+// expectedIndexes are the indexes created by migrations that doctor
+// checks for.
+var expectedIndexes = []string{
+	"workout_distances_workout_id",
+	"workout_positions_workout_id",
+	"workout_speeds_workout_id",
+	"workout_steps_workout_id",
+	"workout_previews_workout_id",
+	"workout_climbs_workout_id",
+	"workout_heart_rates_workout_id",
+	"workout_cadences_workout_id",
+	"workout_powers_workout_id",
+	"workout_zone_times_workout_id",
+}
+
+// doctor checks the environment for common problems, writing a line
+// for each check and a suggested fix for any that fail.
+func doctor(ctx context.Context, w io.Writer, databaseFile string, tokens mapmyride.TokenSource) error {
+	var failed int
+	check := func(name string, err error, fix string) {
+		if err == nil {
+			fmt.Fprintf(w, "ok    %s\n", name)
+			return
+		}
+		failed++
+		fmt.Fprintf(w, "FAIL  %s: %s\n", name, err)
+		if fix != "" {
+			fmt.Fprintf(w, "      fix: %s\n", fix)
+		}
+	}
+	// info notes something worth knowing that isn't a problem.
+	info := func(name, detail string) {
+		fmt.Fprintf(w, "info  %s: %s\n", name, detail)
+	}
+
+	check("connectivity to www.mapmyride.com", checkConnectivity(ctx),
+		"check your network connection and proxy settings")
+
+	if tokens == nil {
+		check("auth token", errors.New("neither AUTH_TOKEN nor MAPMYRIDE_EMAIL and MAPMYRIDE_PASSWORD are set"),
+			"log in to https://www.mapmyride.com/ and set AUTH_TOKEN to the value of the auth-token cookie, or set MAPMYRIDE_EMAIL and MAPMYRIDE_PASSWORD")
+	} else {
+		check("auth token", checkToken(ctx, tokens),
+			"the token may have expired; log in to https://www.mapmyride.com/ again and update AUTH_TOKEN from the auth-token cookie, or check MAPMYRIDE_EMAIL and MAPMYRIDE_PASSWORD")
+	}
+
+	if _, err := os.Stat(databaseFile); err != nil {
+		check("database file", err, "run a sync to create "+databaseFile+", or pass the right -database-file")
+	} else {
+		checkDatabase(ctx, databaseFile, check, info)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+func checkConnectivity(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "HEAD", "https://www.mapmyride.com/", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("got status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func checkToken(ctx context.Context, tokens mapmyride.TokenSource) error {
+	client := mapmyride.NewClient(tokens)
+	now := time.Now()
+	_, err := client.GetWorkouts(ctx, now, now)
+	return err
+}
+
+func checkDatabase(ctx context.Context, databaseFile string, check func(name string, err error, fix string), info func(name, detail string)) {
+	dsn, err := sync.DataSourceName(databaseFile, sync.WithReadOnly())
+	if err != nil {
+		check("database open", err, "")
+		return
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		check("database open", err, "")
+		return
+	}
+	defer db.Close()
+
+	var version int
+	err = db.QueryRowContext(ctx, "pragma user_version").Scan(&version)
+	if err == nil && version < sync.SchemaVersion() {
+		err = fmt.Errorf("schema version %d, want %d", version, sync.SchemaVersion())
+	}
+	check("database schema version", err, "run a sync to apply pending migrations")
+
+	// The default rollback journal works fine, so only suggest WAL for
+	// reading alongside syncs.
+	var journalMode string
+	err = db.QueryRowContext(ctx, "pragma journal_mode").Scan(&journalMode)
+	if err != nil {
+		check("database journal mode", err, "")
+	} else if !strings.EqualFold(journalMode, "wal") {
+		info("database journal mode", journalMode+"; to run reports while syncing without waiting on locks, run: sqlite3 "+databaseFile+" 'pragma journal_mode=wal'")
+	}
+
+	var violations int
+	rows, err := db.QueryContext(ctx, "pragma foreign_key_check")
+	if err == nil {
+		for rows.Next() {
+			violations++
+		}
+		err = rows.Err()
+		rows.Close()
+	}
+	if err == nil && violations > 0 {
+		err = fmt.Errorf("%d series rows reference missing workouts", violations)
+	}
+	check("database foreign keys", err, "run: sqlite3 "+databaseFile+" 'delete from workout_positions where workout_id not in (select id from workouts)' (and likewise for the other workout_* tables)")
+
+	var missing []string
+	for _, name := range expectedIndexes {
+		var n int
+		if err := db.QueryRowContext(ctx, "select count(*) from sqlite_master where type='index' and name=$1", name).Scan(&n); err != nil {
+			check("database indexes", err, "")
+			return
+		}
+		if n == 0 {
+			missing = append(missing, name)
+		}
+	}
+	err = nil
+	if len(missing) > 0 {
+		err = fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+	check("database indexes", err, "run a sync to apply pending migrations")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/danp/mapmyride"
+	"github.com/danp/mapmyride/sync"
+)
+
+// syncEvent is one line of -events-jsonl output.
+type syncEvent struct {
+	Time      time.Time  `json:"time"`
+	Event     string     `json:"event"`
+	UserName  string     `json:"user_name"`
+	WorkoutID int        `json:"workout_id,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	Kind      string     `json:"kind,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Message   string     `json:"message,omitempty"`
+}
+
+// eventNames maps changes to event names.
+var eventNames = map[sync.Change]string{
+	sync.Added:   "workout_added",
+	sync.Changed: "workout_updated",
+	sync.Removed: "workout_removed",
+	sync.Failed:  "error",
+}
+
+// eventWriter writes sync events as JSON Lines.
+type eventWriter struct {
+	enc      *json.Encoder
+	userName string
+}
+
+func newEventWriter(w io.Writer, userName string) *eventWriter {
+	return &eventWriter{enc: json.NewEncoder(w), userName: userName}
+}
+
+// workout writes an event for a workout that was added or changed.
+func (e *eventWriter) workout(w mapmyride.Workout, c sync.Change) error {
+	startedAt := w.StartedAt
+	return e.enc.Encode(syncEvent{
+		Time:      time.Now(),
+		Event:     eventNames[c],
+		UserName:  e.userName,
+		WorkoutID: w.ID,
+		Name:      w.Name,
+		Kind:      w.Kind,
+		StartedAt: &startedAt,
+	})
+}
+
+// anomalies writes an anomaly event for each of as.
+func (e *eventWriter) anomalies(as []anomaly) error {
+	for _, a := range as {
+		if err := e.enc.Encode(syncEvent{Time: time.Now(), Event: "anomaly", UserName: e.userName, WorkoutID: a.WorkoutID, Message: a.Message}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish writes events for the workouts run removed or failed to fetch,
+// which aren't reported as they happen, and for runErr if it's set.
+func (e *eventWriter) finish(run sync.Run, runErr error) error {
+	var ids []int
+	for id, c := range run.Changes {
+		if c == sync.Removed || c == sync.Failed {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		ev := syncEvent{Time: time.Now(), Event: eventNames[run.Changes[id]], UserName: e.userName, WorkoutID: id}
+		if run.Changes[id] == sync.Failed {
+			ev.Error = "fetching workout failed, it will be retried"
+		}
+		if err := e.enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+
+	if runErr != nil {
+		return e.enc.Encode(syncEvent{Time: time.Now(), Event: "error", UserName: e.userName, Error: runErr.Error()})
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/danp/mapmyride"
+	"github.com/danp/mapmyride/sync"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEventWriter(t *testing.T) {
+	var buf bytes.Buffer
+	ew := newEventWriter(&buf, "dan")
+
+	start := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	if err := ew.workout(mapmyride.Workout{ID: 1, Name: "Ride", Kind: "ride", StartedAt: start}, sync.Added); err != nil {
+		t.Fatal(err)
+	}
+	if err := ew.workout(mapmyride.Workout{ID: 2, Name: "Run", Kind: "run", StartedAt: start}, sync.Changed); err != nil {
+		t.Fatal(err)
+	}
+	if err := ew.anomalies([]anomaly{{WorkoutID: 2, Message: "too fast"}}); err != nil {
+		t.Fatal(err)
+	}
+	run := sync.Run{
+		UserName: "dan",
+		Changes: map[int]sync.Change{
+			1: sync.Added,
+			2: sync.Changed,
+			3: sync.Unchanged,
+			9: sync.Failed,
+			4: sync.Removed,
+			5: sync.Skipped,
+		},
+	}
+	if err := ew.finish(run, errors.New("token expired")); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []syncEvent
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var ev syncEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		if ev.Time.IsZero() {
+			t.Errorf("line %q has no time", sc.Text())
+		}
+		ev.Time = time.Time{}
+		got = append(got, ev)
+	}
+
+	want := []syncEvent{
+		{Event: "workout_added", UserName: "dan", WorkoutID: 1, Name: "Ride", Kind: "ride", StartedAt: &start},
+		{Event: "workout_updated", UserName: "dan", WorkoutID: 2, Name: "Run", Kind: "run", StartedAt: &start},
+		{Event: "anomaly", UserName: "dan", WorkoutID: 2, Message: "too fast"},
+		// Removed and failed workouts come at the end, by ID.
+		{Event: "workout_removed", UserName: "dan", WorkoutID: 4},
+		{Event: "error", UserName: "dan", WorkoutID: 9, Error: "fetching workout failed, it will be retried"},
+		{Event: "error", UserName: "dan", Error: "token expired"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEventWriterFinishNoError(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newEventWriter(&buf, "dan").finish(sync.Run{Changes: map[int]sync.Change{1: sync.Added}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("got events %q for a run with nothing removed or failed, want none", buf.String())
+	}
+}
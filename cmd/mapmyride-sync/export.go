@@ -0,0 +1,239 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/danp/mapmyride"
+	"github.com/peterbourgon/ff/ffcli"
+)
+
+func newExportCommand(ctx context.Context, cfg *config) *ffcli.Command {
+	fs := flag.NewFlagSet("mapmyride-sync export", flag.ExitOnError)
+	dir := fs.String("dir", ".", "directory to write files to, named <id>.<format>")
+	format := fs.String("format", "gpx", "file format: gpx, or tcx for Garmin Connect")
+	starred := fs.Bool("starred", false, "only export workouts starred with star, if no ids are given")
+	snapped := fs.Bool("snapped", false, "export positions snapped to roads with snap for workouts that have them")
+	compress := fs.String("compress", "", "write a single workouts.zip or workouts.tar.gz archive in -dir with a manifest.json, instead of separate files: zip or tar.gz")
+
+	return &ffcli.Command{
+		Name:      "export",
+		Usage:     "mapmyride-sync [flags] export [flags] [<id>...]",
+		ShortHelp: "write workouts as GPX or TCX files, all with positions if no ids are given",
+		FlagSet:   fs,
+		Exec: func(args []string) error {
+			write, ok := exportFormats[*format]
+			if !ok {
+				return fmt.Errorf("unknown format %q, want gpx or tcx", *format)
+			}
+			if _, ok := exportArchives[*compress]; *compress != "" && !ok {
+				return fmt.Errorf("unknown compression %q, want zip or tar.gz", *compress)
+			}
+			var ids []int
+			for _, a := range args {
+				id, err := strconv.Atoi(a)
+				if err != nil {
+					return fmt.Errorf("parsing workout id %q: %w", a, err)
+				}
+				ids = append(ids, id)
+			}
+			db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+			if err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				ids, err = db.queryIDs(ctx, "select id from workouts where has_positions and ($1 = '' or user_name=$1) and (not $2 or starred) order by started_at", cfg.username, *starred)
+				if err != nil {
+					return err
+				}
+			}
+			if err := os.MkdirAll(*dir, 0o755); err != nil {
+				return err
+			}
+			if *compress != "" {
+				name := filepath.Join(*dir, "workouts."+*compress)
+				f, err := os.Create(name)
+				if err != nil {
+					return err
+				}
+				if err := db.exportArchive(ctx, f, *compress, *format, ids, *snapped); err != nil {
+					f.Close()
+					return err
+				}
+				if err := f.Close(); err != nil {
+					return err
+				}
+				log.Printf("exported %d workouts to %s", len(ids), name)
+				return nil
+			}
+			for _, id := range ids {
+				if err := db.exportWorkoutFile(ctx, filepath.Join(*dir, strconv.Itoa(id)+"."+*format), id, *snapped, write); err != nil {
+					return fmt.Errorf("exporting workout %d: %w", id, err)
+				}
+			}
+			log.Printf("exported %d workouts to %s", len(ids), *dir)
+			return nil
+		},
+	}
+}
+
+// exportFormats are the file formats export can write, by name.
+var exportFormats = map[string]func(mapmyride.Workout, io.Writer) error{
+	"gpx": mapmyride.Workout.WriteGPX,
+	"tcx": mapmyride.Workout.WriteTCX,
+}
+
+// exportWorkoutFile writes stored workout id to a file at name with
+// write, as exportWorkout does.
+func (d *DB) exportWorkoutFile(ctx context.Context, name string, id int, snapped bool, write func(mapmyride.Workout, io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := d.exportWorkout(ctx, f, id, snapped, write); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// exportWorkout writes stored workout id to out with write, with its
+// snapped positions in place of its own if snapped is set and it has
+// them. It returns the workout written.
+func (d *DB) exportWorkout(ctx context.Context, out io.Writer, id int, snapped bool, write func(mapmyride.Workout, io.Writer) error) (mapmyride.Workout, error) {
+	wk, err := d.store.LoadWorkout(ctx, id)
+	if err != nil {
+		return mapmyride.Workout{}, err
+	}
+	if snapped {
+		ps, err := d.store.SnappedPositions(ctx, id)
+		if err != nil {
+			return mapmyride.Workout{}, err
+		}
+		if len(ps) > 0 {
+			wk.Positions = ps
+		}
+	}
+	return wk, write(wk, out)
+}
+
+// exportManifest is the manifest.json in an export archive.
+type exportManifest struct {
+	ExportedAt time.Time              `json:"exported_at"`
+	Format     string                 `json:"format"`
+	Workouts   []exportManifestRecord `json:"workouts"`
+}
+
+// exportManifestRecord describes one workout's file in an export archive.
+type exportManifestRecord struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	StartedAt time.Time `json:"started_at"`
+	File      string    `json:"file"`
+}
+
+// exportArchive writes workouts ids in format to out as a single archive
+// of kind zip or tar.gz, with a manifest.json listing them.
+func (d *DB) exportArchive(ctx context.Context, out io.Writer, kind, format string, ids []int, snapped bool) error {
+	newArchive, ok := exportArchives[kind]
+	if !ok {
+		return fmt.Errorf("unknown compression %q, want zip or tar.gz", kind)
+	}
+	write, ok := exportFormats[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q, want gpx or tcx", format)
+	}
+
+	now := time.Now()
+	ar := newArchive(out)
+	manifest := exportManifest{ExportedAt: now.UTC(), Format: format, Workouts: []exportManifestRecord{}}
+	for _, id := range ids {
+		var buf bytes.Buffer
+		wk, err := d.exportWorkout(ctx, &buf, id, snapped, write)
+		if err != nil {
+			return fmt.Errorf("exporting workout %d: %w", id, err)
+		}
+		name := strconv.Itoa(id) + "." + format
+		if err := ar.add(name, buf.Bytes(), now); err != nil {
+			return err
+		}
+		manifest.Workouts = append(manifest.Workouts, exportManifestRecord{ID: id, Name: wk.Name, Kind: wk.Kind, StartedAt: wk.StartedAt.UTC(), File: name})
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ar.add("manifest.json", append(b, '\n'), now); err != nil {
+		return err
+	}
+	return ar.Close()
+}
+
+// archiveWriter is an archive being written by export -compress.
+type archiveWriter interface {
+	add(name string, b []byte, modTime time.Time) error
+	Close() error
+}
+
+// exportArchives are the archive kinds export -compress can write, by
+// name.
+var exportArchives = map[string]func(io.Writer) archiveWriter{
+	"zip":    func(w io.Writer) archiveWriter { return zipArchive{zip.NewWriter(w)} },
+	"tar.gz": newTarGzArchive,
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a zipArchive) add(name string, b []byte, modTime time.Time) error {
+	w, err := a.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (a zipArchive) Close() error {
+	return a.zw.Close()
+}
+
+type tarGzArchive struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func newTarGzArchive(w io.Writer) archiveWriter {
+	gz := gzip.NewWriter(w)
+	return tarGzArchive{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+func (a tarGzArchive) add(name string, b []byte, modTime time.Time) error {
+	if err := a.tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(b)), ModTime: modTime, Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err := a.tw.Write(b)
+	return err
+}
+
+func (a tarGzArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danp/mapmyride"
+	"github.com/danp/mapmyride/sync"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExportArchive(t *testing.T) {
+	ctx := context.Background()
+	db, err := newDB(sync.MemoryFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.db.Close()
+
+	start := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	for _, id := range []int{1, 2} {
+		w := mapmyride.Workout{
+			ID: id, Name: "Ride", Kind: "ride", StartedAt: start.AddDate(0, 0, id),
+			Positions: []mapmyride.WorkoutPosition{{Lat: 44.65, Lng: -63.57}, {Elapsed: time.Second, Lat: 44.651, Lng: -63.571}},
+		}
+		if _, err := db.store.Sync(ctx, "u", w); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, kind := range []string{"zip", "tar.gz"} {
+		t.Run(kind, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := db.exportArchive(ctx, &buf, kind, "gpx", []int{1, 2}, false); err != nil {
+				t.Fatal(err)
+			}
+			files := readArchive(t, kind, buf.Bytes())
+
+			var names []string
+			for name := range files {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if diff := cmp.Diff([]string{"1.gpx", "2.gpx", "manifest.json"}, names); diff != "" {
+				t.Errorf("files mismatch (-want +got):\n%s", diff)
+			}
+			if !strings.Contains(files["1.gpx"], "<trkpt") {
+				t.Errorf("1.gpx has no track points:\n%s", files["1.gpx"])
+			}
+
+			var m exportManifest
+			if err := json.Unmarshal([]byte(files["manifest.json"]), &m); err != nil {
+				t.Fatal(err)
+			}
+			want := []exportManifestRecord{
+				{ID: 1, Name: "Ride", Kind: "ride", StartedAt: start.AddDate(0, 0, 1), File: "1.gpx"},
+				{ID: 2, Name: "Ride", Kind: "ride", StartedAt: start.AddDate(0, 0, 2), File: "2.gpx"},
+			}
+			if m.Format != "gpx" || m.ExportedAt.IsZero() {
+				t.Errorf("got manifest format %q exported at %v, want gpx and a time", m.Format, m.ExportedAt)
+			}
+			if diff := cmp.Diff(want, m.Workouts); diff != "" {
+				t.Errorf("manifest workouts mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if err := db.exportArchive(ctx, ioutil.Discard, "rar", "gpx", nil, false); err == nil {
+		t.Error("got no error for unknown compression")
+	}
+}
+
+// readArchive returns the contents of each file in the kind archive b.
+func readArchive(t *testing.T, kind string, b []byte) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	switch kind {
+	case "zip":
+		zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[f.Name] = string(data)
+		}
+	case "tar.gz":
+		gz, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tar.NewReader(gz)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[h.Name] = string(data)
+		}
+	}
+	return files
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/danp/mapmyride"
+	"github.com/danp/mapmyride/sync"
+)
+
+// runPostSyncCmd runs command with sh -c for a workout that was added or
+// changed. The workout is written as JSON to a temporary file whose path
+// is in MAPMYRIDE_WORKOUT_JSON, and is also provided on stdin. If it has
+// positions, its track is written as GPX to a temporary file whose path
+// is in MAPMYRIDE_WORKOUT_GPX.
+func runPostSyncCmd(ctx context.Context, command string, w mapmyride.Workout, change sync.Change) error {
+	b, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "mapmyride-sync")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	jsonPath := filepath.Join(dir, strconv.Itoa(w.ID)+".json")
+	if err := os.WriteFile(jsonPath, b, 0o600); err != nil {
+		return err
+	}
+
+	env := append(os.Environ(),
+		"MAPMYRIDE_WORKOUT_ID="+strconv.Itoa(w.ID),
+		"MAPMYRIDE_WORKOUT_CHANGE="+string(change),
+		"MAPMYRIDE_WORKOUT_JSON="+jsonPath,
+	)
+	if len(w.Positions) > 0 {
+		gpxPath := filepath.Join(dir, strconv.Itoa(w.ID)+".gpx")
+		if err := writeGPXFile(gpxPath, w); err != nil {
+			return err
+		}
+		env = append(env, "MAPMYRIDE_WORKOUT_GPX="+gpxPath)
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = env
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// writeGPXFile writes w as GPX to the file path.
+func writeGPXFile(path string, w mapmyride.Workout) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := w.WriteGPX(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
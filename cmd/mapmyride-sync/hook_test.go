@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danp/mapmyride"
+	"github.com/danp/mapmyride/sync"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunPostSyncCmd(t *testing.T) {
+	ctx := context.Background()
+	out := t.TempDir()
+	t.Setenv("HOOK_OUT", out)
+	// The temporary files are gone once the command returns, so copy
+	// them out along with what the command was given.
+	const command = `env | grep ^MAPMYRIDE_ | sort > "$HOOK_OUT/env"
+cat > "$HOOK_OUT/stdin.json"
+cp "$MAPMYRIDE_WORKOUT_JSON" "$HOOK_OUT/workout.json"
+if [ -n "$MAPMYRIDE_WORKOUT_GPX" ]; then cp "$MAPMYRIDE_WORKOUT_GPX" "$HOOK_OUT/workout.gpx"; fi`
+
+	w := mapmyride.Workout{
+		ID:        7,
+		Name:      "Ride",
+		StartedAt: time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC),
+		Positions: []mapmyride.WorkoutPosition{
+			{Elapsed: 0, Lat: 44.65, Lng: -63.57},
+			{Elapsed: 10 * time.Second, Lat: 44.651, Lng: -63.571},
+		},
+	}
+	if err := runPostSyncCmd(ctx, command, w, sync.Added); err != nil {
+		t.Fatal(err)
+	}
+
+	env := readFile(t, filepath.Join(out, "env"))
+	for _, want := range []string{"MAPMYRIDE_WORKOUT_ID=7", "MAPMYRIDE_WORKOUT_CHANGE=" + string(sync.Added), "MAPMYRIDE_WORKOUT_JSON=", "MAPMYRIDE_WORKOUT_GPX="} {
+		if !strings.Contains(env, want) {
+			t.Errorf("environment missing %s:\n%s", want, env)
+		}
+	}
+	for _, name := range []string{"stdin.json", "workout.json"} {
+		var got mapmyride.Workout
+		if err := json.Unmarshal([]byte(readFile(t, filepath.Join(out, name))), &got); err != nil {
+			t.Fatalf("decoding %s: %v", name, err)
+		}
+		if diff := cmp.Diff(w, got); diff != "" {
+			t.Errorf("%s mismatch (-want +got):\n%s", name, diff)
+		}
+	}
+	if gpx := readFile(t, filepath.Join(out, "workout.gpx")); !strings.Contains(gpx, `lat="44.6510000"`) {
+		t.Errorf("GPX missing second position:\n%s", gpx)
+	}
+
+	// Without positions there's no GPX.
+	w.Positions = nil
+	if err := runPostSyncCmd(ctx, command, w, sync.Changed); err != nil {
+		t.Fatal(err)
+	}
+	if env := readFile(t, filepath.Join(out, "env")); strings.Contains(env, "MAPMYRIDE_WORKOUT_GPX") || !strings.Contains(env, "MAPMYRIDE_WORKOUT_CHANGE="+string(sync.Changed)) {
+		t.Errorf("got environment for workout without positions:\n%s", env)
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// locale is how reports format numbers and dates for a language and
+// region. Date patterns use {weekday}, {month}, {mon}, {day}, {year} and
+// {time} for the parts of a date.
+type locale struct {
+	name           string
+	decimal, group string
+	weekdays       [7]string // Sunday first, as time.Weekday
+	months, mons   [12]string
+
+	longDay  string // such as Monday, January 2
+	shortDay string // such as Jan 2
+	dateTime string // such as Monday, January 2, 2006 at 15:04
+}
+
+var (
+	englishWeekdays = [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+	englishMonths   = [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+	englishMons     = [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+)
+
+// locales are the locales -locale can name.
+var locales = map[string]*locale{
+	"en": {
+		name: "en", decimal: ".", group: ",",
+		weekdays: englishWeekdays, months: englishMonths, mons: englishMons,
+		longDay:  "{weekday}, {month} {day}",
+		shortDay: "{mon} {day}",
+		dateTime: "{weekday}, {month} {day}, {year} at {time}",
+	},
+	"en-GB": {
+		name: "en-GB", decimal: ".", group: ",",
+		weekdays: englishWeekdays, months: englishMonths, mons: englishMons,
+		longDay:  "{weekday} {day} {month}",
+		shortDay: "{day} {mon}",
+		dateTime: "{weekday} {day} {month} {year} at {time}",
+	},
+	"de": {
+		name: "de", decimal: ",", group: ".",
+		weekdays: [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		months:   [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		mons:     [12]string{"Jan.", "Feb.", "März", "Apr.", "Mai", "Juni", "Juli", "Aug.", "Sept.", "Okt.", "Nov.", "Dez."},
+		longDay:  "{weekday}, {day}. {month}",
+		shortDay: "{day}. {mon}",
+		dateTime: "{weekday}, {day}. {month} {year} um {time}",
+	},
+	"es": {
+		name: "es", decimal: ",", group: ".",
+		weekdays: [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		months:   [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		mons:     [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		longDay:  "{weekday}, {day} de {month}",
+		shortDay: "{day} {mon}",
+		dateTime: "{weekday}, {day} de {month} de {year}, {time}",
+	},
+	"fr": {
+		name: "fr", decimal: ",", group: "\u202f",
+		weekdays: [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		months:   [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		mons:     [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		longDay:  "{weekday} {day} {month}",
+		shortDay: "{day} {mon}",
+		dateTime: "{weekday} {day} {month} {year} à {time}",
+	},
+}
+
+// localeFlag is a locale set by name, en by default.
+type localeFlag struct {
+	*locale
+}
+
+func (f *localeFlag) String() string {
+	if f == nil || f.locale == nil {
+		return "en"
+	}
+	return f.name
+}
+
+func (f *localeFlag) Set(s string) error {
+	l, ok := locales[s]
+	if !ok {
+		names := make([]string, 0, len(locales))
+		for n := range locales {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown locale %q, want one of %s", s, strings.Join(names, ", "))
+	}
+	f.locale = l
+	return nil
+}
+
+// get returns the locale that was set, or en.
+func (f localeFlag) get() *locale {
+	if f.locale == nil {
+		return locales["en"]
+	}
+	return f.locale
+}
+
+// number formats v with prec decimal places, grouping thousands.
+func (l *locale) number(v float64, prec int) string {
+	s := strconv.FormatFloat(v, 'f', prec, 64)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, c := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(l.group)
+		}
+		b.WriteRune(c)
+	}
+	if frac != "" {
+		b.WriteString(l.decimal)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+// reportFuncs are the functions report templates format numbers for l
+// with, such as {{num .Distance 1}}.
+func reportFuncs(l *locale) template.FuncMap {
+	return template.FuncMap{"num": l.number}
+}
+
+// formatDate fills in pattern's parts from t.
+func (l *locale) formatDate(t time.Time, pattern string) string {
+	return strings.NewReplacer(
+		"{weekday}", l.weekdays[t.Weekday()],
+		"{month}", l.months[t.Month()-1],
+		"{mon}", l.mons[t.Month()-1],
+		"{day}", strconv.Itoa(t.Day()),
+		"{year}", strconv.Itoa(t.Year()),
+		"{time}", t.Format("15:04"),
+	).Replace(pattern)
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestLocaleNumber(t *testing.T) {
+	for _, tc := range []struct {
+		locale string
+		v      float64
+		prec   int
+		want   string
+	}{
+		{"en", 0, 0, "0"},
+		{"en", 999, 0, "999"},
+		{"en", 1000, 0, "1,000"},
+		{"en", 1234567.891, 2, "1,234,567.89"},
+		{"en", -1234.5, 1, "-1,234.5"},
+		{"en", 0.26, 1, "0.3"},
+		{"en-GB", 12345.6, 1, "12,345.6"},
+		{"de", 1234567.891, 2, "1.234.567,89"},
+		{"de", 123.4, 1, "123,4"},
+		{"es", -98765.4, 1, "-98.765,4"},
+		{"fr", 1234.5, 1, "1\u202f234,5"},
+		{"fr", 100, 0, "100"},
+	} {
+		if got := locales[tc.locale].number(tc.v, tc.prec); got != tc.want {
+			t.Errorf("%s number(%v, %d) = %q, want %q", tc.locale, tc.v, tc.prec, got, tc.want)
+		}
+	}
+}
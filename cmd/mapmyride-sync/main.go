@@ -3,236 +3,741 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
-	"strings"
+	"text/tabwriter"
+	"text/template"
 	"time"
 
 	"github.com/danp/mapmyride"
+	"github.com/danp/mapmyride/sync"
 	"github.com/peterbourgon/ff"
-	_ "modernc.org/sqlite"
+	"github.com/peterbourgon/ff/ffcli"
 )
 
 func main() {
 	fs := flag.NewFlagSet("mapmyride-sync", flag.ExitOnError)
-	var (
-		databaseFile = fs.String("database-file", "data.db", "data file path")
-		username     = fs.String("username", "", "username to attribute workouts to")
-		beginDay     = fs.String("begin-day", "", "beginning day to sync, in 2006-01-02 format")
-		endDay       = fs.String("end-day", "", "ending day to sync, in 2006-01-02 format")
-	)
-	ff.Parse(fs, os.Args[1:])
+	var cfg config
+	fs.StringVar(&cfg.databaseFile, "database-file", "data.db", "data file path, or :memory: for a database that only lasts for the command")
+	fs.StringVar(&cfg.username, "username", "", "username to attribute workouts to")
+	fs.StringVar(&cfg.beginDay, "begin-day", "", "beginning day to sync, in 2006-01-02 format")
+	fs.StringVar(&cfg.endDay, "end-day", "", "ending day to sync, in 2006-01-02 format")
+	fs.IntVar(&cfg.dbMaxOpenConns, "db-max-open-conns", 0, "maximum open database connections, 0 for no limit")
+	fs.DurationVar(&cfg.dbBusyTimeout, "db-busy-timeout", 5*time.Second, "how long to wait for another process to release a database lock")
+	fs.DurationVar(&cfg.dbTimeout, "db-timeout", 0, "limit on each database operation, 0 for no limit")
+	fs.BoolVar(&cfg.readOnly, "read-only", false, "open the database read-only for commands that only read, so they can run alongside a sync or on a backup")
+	fs.StringVar(&cfg.backupDir, "backup-dir", "", "directory to back up the database to before migrating it (default backups next to -database-file)")
+	fs.IntVar(&cfg.backupKeep, "backup-keep", 5, "how many backups to keep in -backup-dir, 0 to not make any")
+	fs.BoolVar(&cfg.spatialIndex, "spatial-index", false, "maintain an R*Tree index of workout bounding boxes")
+	fs.Float64Var(&cfg.minDistance, "min-distance", 0, "skip storing workouts shorter than this many meters, such as accidental recordings")
+	fs.DurationVar(&cfg.minDuration, "min-duration", 0, "skip storing workouts that lasted less than this, such as accidental recordings")
+	fs.BoolVar(&cfg.progress, "progress", false, "log progress through the months being synced, for long ranges")
+	fs.BoolVar(&cfg.restart, "restart", false, "sync the whole range even if the last sync of it was interrupted, instead of resuming after the last month it finished")
+	fs.BoolVar(&cfg.force, "force", false, "remove stored workouts even when the sync fetched suspiciously few")
+	fs.Var(&cfg.units, "units", "units for distances, speeds, elevations and weights in output: metric or imperial")
+	fs.Var(&cfg.locale, "locale", "language and region to format dates and numbers in reports for: en, en-GB, de, es or fr")
+	fs.StringVar(&cfg.timezone, "timezone", "", "time zone for interpreting days, such as America/Halifax (default system time zone)")
+	fs.StringVar(&cfg.nameTemplate, "name-template", "", "Go template to name workouts with generic names like Bike Ride by, using .Date, .Kind, .DistanceKm, .Start and others, such as: {{.Date}} {{printf \"%.0f\" .DistanceKm}}km {{.Kind}}")
+	fs.StringVar(&cfg.postSyncCmd, "post-sync-cmd", "", "shell command to run for each added or changed workout, see MAPMYRIDE_WORKOUT_* in its environment")
+	fs.StringVar(&cfg.eventsJSONL, "events-jsonl", "", "file to append sync events to as JSON Lines, or - for stdout")
+	fs.StringVar(&cfg.tokenCache, "token-cache", "", "file to keep the token from logging in with MAPMYRIDE_EMAIL and MAPMYRIDE_PASSWORD in, so runs reuse it until it expires")
+	fs.StringVar(&cfg.changesetDir, "changeset-dir", "", "directory to write a JSON Lines changeset of each sync's changes to, for updating replicas with apply-changeset")
+	fs.StringVar(&cfg.pushgateway, "pushgateway", "", "Prometheus Pushgateway URL to push sync metrics to after each run, such as http://localhost:9091")
+	fs.Var(&cfg.missingIDs, "missing-ids", "what to do with listed workouts that have no id: error, skip or synthesize")
+	fs.IntVar(&cfg.maxRetries, "max-retries", 3, "how many times to retry requests to mapmyride that fail with network errors, 5xx statuses or rate limiting, with exponential backoff")
+	fs.Var(&cfg.schemaDrift, "schema-drift", "what to do when site responses gain or lose fields: ignore, log or fail")
+	fs.Var(&cfg.hrZones, "hr-zones", "heart rate zone boundaries in beats per minute, such as 120,140,155,170 for five zones")
+	fs.Var(&cfg.kinds, "kind", "normalize workouts of a kind to another for stats, such as road_cycling=ride (repeatable, added to the built-in defaults)")
+	fs.Var(&cfg.privacyZones, "privacy-zone", "circle as lat,lng,meters to hide positions within, and a random margin beyond, on share pages, such as around home; track ends are always cut back (repeatable)")
+	fs.Var(&cfg.plan, "plan", "weekly plan target as kind:duration:distance, such as ride:5h:100km or ride:5h:60mi (repeatable)")
+	fs.String("config", "", "config file with one flag per line, such as: plan ride:5h:100km")
+	version := fs.Bool("version", false, "print version information and exit")
+
+	auditFS := flag.NewFlagSet("mapmyride-sync audit", flag.ExitOnError)
+	auditYear := auditFS.Int("year", time.Now().Year(), "year to audit")
+
+	noteFS := flag.NewFlagSet("mapmyride-sync note", flag.ExitOnError)
+	notePush := noteFS.Bool("push", false, "also set the note on mapmyride, replacing the workout's notes there")
 
-	if *username == "" {
-		log.Fatal("need -username")
-	}
+	ctx := context.Background()
 
-	authToken := os.Getenv("AUTH_TOKEN")
-	if authToken == "" {
-		log.Fatal("need AUTH_TOKEN, which can be acquired by logging in to https://www.mapmyride.com/ and grabbing the value of the auth-token cookie")
+	root := &ffcli.Command{
+		Usage:   "mapmyride-sync [flags] [<subcommand>]",
+		FlagSet: fs,
+		Options: []ff.Option{
+			ff.WithConfigFileFlag("config"),
+			ff.WithConfigFileParser(ff.PlainParser),
+		},
+		Subcommands: []*ffcli.Command{
+			{
+				Name:      "doctor",
+				Usage:     "mapmyride-sync [flags] doctor",
+				ShortHelp: "check the token, database and connectivity for common problems",
+				Exec: func([]string) error {
+					tokens, _ := cfg.tokenSource()
+					return doctor(ctx, os.Stdout, cfg.databaseFile, tokens)
+				},
+			},
+			newStatsCommand(ctx, &cfg),
+			newReportCommand(ctx, &cfg),
+			newShareCommand(ctx, &cfg),
+			newExportCommand(ctx, &cfg),
+			newSnapCommand(ctx, &cfg),
+			newGeocodeCommand(ctx, &cfg),
+			newRoutesCommand(ctx, &cfg),
+			newUploadCommand(ctx, &cfg),
+			newSchemaCommand(ctx),
+			newOpenCommand(ctx, &cfg),
+			newStarCommand(ctx, &cfg),
+			newFTPCommand(ctx, &cfg),
+			newWeightCommand(ctx, &cfg),
+			{
+				Name:      "trash",
+				Usage:     "mapmyride-sync [flags] trash",
+				ShortHelp: "list workouts removed by syncs",
+				Exec: func([]string) error {
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					return db.listTrash(ctx, os.Stdout)
+				},
+			},
+			{
+				Name:      "retries",
+				Usage:     "mapmyride-sync [flags] retries",
+				ShortHelp: "list workouts that failed to fetch and are retried by syncs",
+				Exec: func([]string) error {
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					return db.listRetries(ctx, os.Stdout, cfg.username)
+				},
+			},
+			{
+				Name:      "restore",
+				Usage:     "mapmyride-sync [flags] restore <id>",
+				ShortHelp: "restore a workout from the trash",
+				Exec: func(args []string) error {
+					if len(args) != 1 {
+						return flag.ErrHelp
+					}
+					id, err := strconv.Atoi(args[0])
+					if err != nil {
+						return fmt.Errorf("parsing workout id %q: %w", args[0], err)
+					}
+					db, err := newDB(cfg.databaseFile, cfg.dbOptions()...)
+					if err != nil {
+						return err
+					}
+					if err := db.store.Restore(ctx, id); err != nil {
+						return err
+					}
+					log.Println("restored workout", id)
+					return nil
+				},
+			},
+			{
+				Name:      "backup",
+				Usage:     "mapmyride-sync [flags] backup",
+				ShortHelp: "back up the database to -backup-dir now, removing the oldest backups beyond -backup-keep",
+				Exec: func([]string) error {
+					if cfg.backupKeep <= 0 {
+						return errors.New("need -backup-keep above 0")
+					}
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					name, err := db.store.Backup(ctx, "manual")
+					if err != nil {
+						return err
+					}
+					if name == "" {
+						return errors.New("can't back up an in-memory database")
+					}
+					log.Println("backed up to", name)
+					return nil
+				},
+			},
+			{
+				Name:      "apply-changeset",
+				Usage:     "mapmyride-sync [flags] apply-changeset <changeset.jsonl>...",
+				ShortHelp: "apply changesets written by -changeset-dir syncs to a replica database, oldest first",
+				Exec: func(args []string) error {
+					if len(args) == 0 {
+						return flag.ErrHelp
+					}
+					db, err := newDB(cfg.databaseFile, cfg.dbOptions()...)
+					if err != nil {
+						return err
+					}
+					for _, a := range args {
+						f, err := os.Open(a)
+						if err != nil {
+							return err
+						}
+						n, err := db.applyChangeset(ctx, f)
+						f.Close()
+						if err != nil {
+							return fmt.Errorf("applying %s: %w", a, err)
+						}
+						log.Printf("applied %d changes from %s", n, a)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "audit",
+				Usage:     "mapmyride-sync -username <user> [flags] audit [-year 2021]",
+				ShortHelp: "compare a year of workout summaries on mapmyride with synced workouts, without writing",
+				FlagSet:   auditFS,
+				Exec: func([]string) error {
+					return runAudit(ctx, cfg, *auditYear)
+				},
+			},
+			{
+				Name:      "verify",
+				Usage:     "mapmyride-sync [flags] verify <export.csv>",
+				ShortHelp: "cross-check the site's CSV export of workout history against synced workouts",
+				Exec: func(args []string) error {
+					if len(args) != 1 {
+						return flag.ErrHelp
+					}
+					loc, err := cfg.location()
+					if err != nil {
+						return err
+					}
+					f, err := os.Open(args[0])
+					if err != nil {
+						return err
+					}
+					defer f.Close()
+					exported, err := mapmyride.ParseExport(f)
+					if err != nil {
+						return fmt.Errorf("parsing %s: %w", args[0], err)
+					}
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					n, err := db.verifyExport(ctx, os.Stdout, cfg.username, exported, loc)
+					if err != nil {
+						return err
+					}
+					if n > 0 {
+						return fmt.Errorf("%d workouts differ", n)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "note",
+				Usage:     "mapmyride-sync [flags] note [-push] <id> [<text>]",
+				ShortHelp: "show or set the local note for a workout, an empty text removes it",
+				FlagSet:   noteFS,
+				Exec: func(args []string) error {
+					if len(args) < 1 || len(args) > 2 || (*notePush && len(args) != 2) {
+						return flag.ErrHelp
+					}
+					id, err := strconv.Atoi(args[0])
+					if err != nil {
+						return fmt.Errorf("parsing workout id %q: %w", args[0], err)
+					}
+					db, err := newDB(cfg.databaseFile, cfg.dbOptions()...)
+					if err != nil {
+						return err
+					}
+					if len(args) == 1 {
+						note, err := db.store.Note(ctx, id)
+						if err != nil {
+							return err
+						}
+						if note != "" {
+							fmt.Println(note)
+						}
+						return nil
+					}
+					if *notePush {
+						tokens, err := cfg.tokenSource()
+						if err != nil {
+							return err
+						}
+						client := mapmyride.NewClient(tokens)
+						client.Logf = log.Printf
+						client.MaxRetries = cfg.maxRetries
+						if err := client.UpdateWorkout(ctx, id, mapmyride.WorkoutUpdate{Notes: &args[1]}); err != nil {
+							return err
+						}
+					}
+					return db.store.SetNote(ctx, id, args[1])
+				},
+			},
+			{
+				Name:      "version",
+				Usage:     "mapmyride-sync version",
+				ShortHelp: "print version information",
+				Exec: func([]string) error {
+					printVersion(os.Stdout)
+					return nil
+				},
+			},
+		},
+		Exec: func([]string) error {
+			if *version {
+				printVersion(os.Stdout)
+				return nil
+			}
+			return runSync(ctx, cfg)
+		},
 	}
 
-	db, err := newDB(*databaseFile)
-	if err != nil {
-		log.Fatal(err)
-	}
+	root.Subcommands = append(root.Subcommands, newCompletionCommand(root), newManCommand(root))
 
-	ctx := context.Background()
-
-	var begin time.Time
-	if *beginDay == "" {
-		latest, err := db.latestWorkoutStartedAt(ctx, *username)
-		if err != nil {
-			log.Fatal(err)
+	if err := root.Run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
 		}
-		if !latest.IsZero() {
-			// Re-sync things from 14 days before latest to account for
-			// possible edits.
-			begin = latest.AddDate(0, 0, -14)
+		if hint := errorHint(err); hint != "" {
+			log.Fatalf("%v\n%s", err, hint)
 		}
-	} else {
-		begin, err = time.Parse("2006-01-02", *beginDay)
-		if err != nil {
-			log.Fatal(err)
-		}
-	}
-
-	end := time.Now()
-	if *endDay != "" {
-		end, err = time.Parse("2006-01-02", *endDay)
-		if err != nil {
-			log.Fatal(err)
-		}
-	}
-
-	log.Println("syncing for", *username, "from", begin.Format(time.RFC3339), "to", end.Format(time.RFC3339))
-
-	client := mapmyride.NewClient(mapmyride.StaticTokenSource(authToken))
-
-	// TODO: break the rest of this up into more manageable chunks so
-	// it's easier to, say, sync a whole year at once.
-	workouts, err := client.GetWorkouts(ctx, begin, end)
-	if err != nil {
 		log.Fatal(err)
 	}
+}
 
-	for _, w := range workouts {
-		if err := db.sync(ctx, *username, w); err != nil {
-			log.Fatal(err)
-		}
-	}
-
-	if err := db.removeExtra(ctx, *username, begin, end, workouts); err != nil {
-		log.Fatal(err)
+// errorHint returns advice for fixing err, or "" if there's none.
+func errorHint(err error) string {
+	var se *mapmyride.StatusError
+	switch {
+	case errors.Is(err, mapmyride.ErrUnauthorized):
+		return "the token was rejected and has probably expired; log in to https://www.mapmyride.com/ again and update AUTH_TOKEN from the auth-token cookie, or use MAPMYRIDE_EMAIL and MAPMYRIDE_PASSWORD to log in automatically"
+	case errors.As(err, &se) && se.RetryAfter > 0:
+		return fmt.Sprintf("mapmyride is limiting requests; wait %s and sync again, workouts synced so far are kept", se.RetryAfter)
+	case errors.Is(err, mapmyride.ErrRateLimited):
+		return "mapmyride is limiting requests; wait a while and sync again, workouts synced so far are kept"
 	}
+	return ""
 }
 
-type DB struct {
-	db *sql.DB
+// config holds the flags shared by the sync and its subcommands.
+type config struct {
+	databaseFile     string
+	dbMaxOpenConns   int
+	dbBusyTimeout    time.Duration
+	dbTimeout        time.Duration
+	readOnly         bool
+	backupDir        string
+	backupKeep       int
+	username         string
+	beginDay, endDay string
+	spatialIndex     bool
+	force            bool
+	restart          bool
+	progress         bool
+	minDistance      float64
+	minDuration      time.Duration
+	timezone         string
+	units            units
+	locale           localeFlag
+	nameTemplate     string
+	postSyncCmd      string
+	pushgateway      string
+	eventsJSONL      string
+	changesetDir     string
+	tokenCache       string
+	plan             weeklyPlan
+	hrZones          zonesFlag
+	privacyZones     privacyZones
+	kinds            kindsFlag
+	missingIDs       missingIDsFlag
+	schemaDrift      schemaDriftFlag
+	maxRetries       int
 }
 
-func newDB(filename string) (*DB, error) {
-	db, err := sql.Open("sqlite", filename)
-	if err != nil {
-		return nil, fmt.Errorf("opening database file %q: %w", filename, err)
+// dbOptions returns the options for opening the database from the -db-*
+// and -backup-* flags.
+func (c config) dbOptions() []sync.OpenOption {
+	backupDir := c.backupDir
+	if backupDir == "" {
+		backupDir = filepath.Join(filepath.Dir(c.databaseFile), "backups")
 	}
-
-	st := &DB{db: db}
-	if err := st.init(); err != nil {
-		db.Close()
-		return nil, err
+	return []sync.OpenOption{
+		sync.WithMaxOpenConns(c.dbMaxOpenConns),
+		sync.WithBusyTimeout(c.dbBusyTimeout),
+		sync.WithTimeout(c.dbTimeout),
+		sync.WithBackups(backupDir, c.backupKeep),
 	}
-
-	return st, nil
 }
 
-func (s *DB) init() error {
-	for _, q := range []string{
-		"create table if not exists workouts (id integer primary key, user_name text not null, name text not null, kind text not null, activity_type text, kcal integer, distance_m numeric, speed_mps numeric, duration_s integer, step_count bigint, gain_m numeric, started_at datetime, created_at datetime, updated_at datetime)",
-		"create table if not exists workout_distances (workout_id integer references workouts (id), elapsed_seconds numeric, total_meters numeric)",
-		"create table if not exists workout_positions (workout_id integer references workouts (id), elapsed_seconds numeric, elevation numeric, lat numeric, lng numeric)",
-		"create table if not exists workout_speeds (workout_id integer references workouts (id), elapsed_seconds numeric, meters_per_second numeric)",
-		"create table if not exists workout_steps (workout_id integer references workouts (id), elapsed_seconds numeric, steps numeric)",
-	} {
-		_, err := s.db.Exec(q)
-		if err != nil {
-			return err
-		}
+// readDBOptions is dbOptions for commands that only read, which open the
+// database read-only if -read-only is set.
+func (c config) readDBOptions() []sync.OpenOption {
+	opts := c.dbOptions()
+	if c.readOnly {
+		opts = append(opts, sync.WithReadOnly())
 	}
+	return opts
+}
 
-	return nil
+// location returns the time zone named by -timezone.
+func (c config) location() (*time.Location, error) {
+	if c.timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(c.timezone)
 }
 
-func (d *DB) latestWorkoutStartedAt(ctx context.Context, userName string) (time.Time, error) {
-	row := d.db.QueryRowContext(ctx, "select date(max(started_at)) from workouts where user_name=?", userName)
-	var latests string
-	if err := row.Scan(&latests); err != nil {
-		return time.Time{}, err
+// errNoAuth is returned by tokenSource when no credentials are set.
+var errNoAuth = errors.New("need AUTH_TOKEN, which can be acquired by logging in to https://www.mapmyride.com/ and grabbing the value of the auth-token cookie, or MAPMYRIDE_EMAIL and MAPMYRIDE_PASSWORD to log in with")
+
+// tokenSource returns a token source for AUTH_TOKEN or, if it isn't set,
+// one that logs in with MAPMYRIDE_EMAIL and MAPMYRIDE_PASSWORD, caching
+// its tokens in -token-cache if set.
+func (c config) tokenSource() (mapmyride.TokenSource, error) {
+	if tok := os.Getenv("AUTH_TOKEN"); tok != "" {
+		return mapmyride.StaticTokenSource(tok), nil
+	}
+	email, password := os.Getenv("MAPMYRIDE_EMAIL"), os.Getenv("MAPMYRIDE_PASSWORD")
+	if email == "" || password == "" {
+		return nil, errNoAuth
 	}
-	return time.Parse("2006-01-02", latests)
+	var ts mapmyride.TokenSource = mapmyride.NewLoginTokenSource(email, password)
+	if c.tokenCache != "" {
+		ts = mapmyride.NewCachingTokenSource(ts, c.tokenCache)
+	}
+	return ts, nil
 }
 
-const timeFormat = "2006-01-02 15:04:05.999999999-07:00"
+func runSync(ctx context.Context, cfg config) error {
+	if cfg.username == "" {
+		return errors.New("need -username")
+	}
 
-func (d *DB) sync(ctx context.Context, userName string, w mapmyride.Workout) error {
-	log.Println("sync", userName, "workout started", w.StartedAt.Format(time.RFC3339), "named", w.Name)
+	tokens, err := cfg.tokenSource()
+	if err != nil {
+		return err
+	}
 
-	tx, err := d.db.BeginTx(ctx, nil)
+	loc, err := cfg.location()
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
 
-	for _, t := range []string{"workout_steps", "workout_speeds", "workout_positions", "workout_distances"} {
-		_, err := tx.ExecContext(ctx, "delete from "+t+" where workout_id=$1", w.ID)
+	dbOpts := cfg.dbOptions()
+	if cfg.nameTemplate != "" {
+		tmpl, err := template.New("name").Parse(cfg.nameTemplate)
 		if err != nil {
-			return err
+			return fmt.Errorf("parsing -name-template: %w", err)
 		}
+		dbOpts = append(dbOpts, sync.WithNameTemplate(tmpl, loc))
 	}
 
-	_, err = tx.ExecContext(ctx, "delete from workouts where id=$1", w.ID)
+	db, err := newDB(cfg.databaseFile, dbOpts...)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.ExecContext(
-		ctx,
-		"insert into workouts (id, user_name, name, kind, activity_type, kcal, distance_m, speed_mps, duration_s, step_count, gain_m, started_at, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)",
-		w.ID, userName, w.Name, w.Kind, w.ActivityType, w.Kcal, w.Distance, w.Speed,
-		int(w.Duration.Seconds()), w.StepCount, w.Gain,
-		w.StartedAt.Format(timeFormat), w.CreatedAt.Format(timeFormat), w.UpdatedAt.Format(timeFormat),
-	)
-	if err != nil {
-		return err
+	if cfg.spatialIndex {
+		if err := db.store.EnableSpatialIndex(); err != nil {
+			return err
+		}
 	}
 
-	for _, d := range w.Distances {
-		_, err := tx.ExecContext(
-			ctx,
-			"insert into workout_distances (workout_id, elapsed_seconds, total_meters) values ($1, $2, $3)",
-			w.ID, d.Elapsed.Seconds(), d.Total,
-		)
-		if err != nil {
+	if len(cfg.hrZones.Zones) > 0 {
+		if err := db.store.SetHeartRateZones(ctx, cfg.hrZones.Zones); err != nil {
 			return err
 		}
 	}
 
-	for _, p := range w.Positions {
-		_, err := tx.ExecContext(
-			ctx,
-			"insert into workout_positions (workout_id, elapsed_seconds, elevation, lat, lng) values ($1, $2, $3, $4, $5)",
-			w.ID, p.Elapsed.Seconds(), p.Elevation, p.Lat, p.Lng,
-		)
-		if err != nil {
+	if len(cfg.kinds) > 0 {
+		if err := db.store.SetKinds(ctx, cfg.kinds); err != nil {
 			return err
 		}
 	}
 
-	for _, s := range w.Speeds {
-		_, err := tx.ExecContext(
-			ctx,
-			"insert into workout_speeds (workout_id, elapsed_seconds, meters_per_second) values ($1, $2, $3)",
-			w.ID, s.Elapsed.Seconds(), s.MetersPerSecond,
-		)
+	var begin, end time.Time
+	if cfg.beginDay != "" {
+		begin, err = time.ParseInLocation("2006-01-02", cfg.beginDay, loc)
 		if err != nil {
 			return err
 		}
 	}
-
-	for _, s := range w.Steps {
-		_, err := tx.ExecContext(
-			ctx,
-			"insert into workout_steps (workout_id, elapsed_seconds, steps) values ($1, $2, $3)",
-			w.ID, s.Elapsed.Seconds(), s.StepsInPeriod,
-		)
+	if cfg.endDay != "" {
+		end, err = time.ParseInLocation("2006-01-02", cfg.endDay, loc)
 		if err != nil {
 			return err
 		}
 	}
 
-	return tx.Commit()
+	opts := []sync.Option{
+		sync.WithLocation(loc),
+		sync.WithForce(cfg.force),
+		sync.WithRestart(cfg.restart),
+		sync.WithMinDistance(cfg.minDistance),
+		sync.WithMinDuration(cfg.minDuration),
+		sync.WithLogf(log.Printf),
+	}
+	getOpts := []mapmyride.GetWorkoutsOption{mapmyride.WithMissingIDs(cfg.missingIDs.MissingIDPolicy)}
+	if cfg.progress {
+		var monthsDone int
+		getOpts = append(getOpts, mapmyride.WithProgress(func(p mapmyride.Progress) {
+			if p.MonthsDone == monthsDone {
+				return
+			}
+			monthsDone = p.MonthsDone
+			log.Printf("progress: listed %s, month %d of %d, fetched %d of %d workouts listed so far", p.Month.Format("2006-01"), p.MonthsDone, p.Months, p.Fetched, p.Listed)
+		}))
+	}
+	opts = append(opts, sync.WithGetWorkoutsOptions(getOpts...))
+	var events *eventWriter
+	if cfg.eventsJSONL != "" {
+		w := io.Writer(os.Stdout)
+		if cfg.eventsJSONL != "-" {
+			f, err := os.OpenFile(cfg.eventsJSONL, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		events = newEventWriter(w, cfg.username)
+	}
+	var changeset *changesetWriter
+	if cfg.changesetDir != "" {
+		changeset, err = newChangesetWriter(cfg.changesetDir, cfg.username)
+		if err != nil {
+			return err
+		}
+	}
+	var anomalies []anomaly
+	opts = append(opts, sync.WithOnChange(func(ctx context.Context, w mapmyride.Workout, change sync.Change) {
+		if change == sync.Changed {
+			if a, ok := lateEdit(w); ok {
+				anomalies = append(anomalies, a)
+			}
+		}
+		if events != nil {
+			if err := events.workout(w, change); err != nil {
+				log.Println("writing event failed for workout", w.ID, err)
+			}
+		}
+		if changeset != nil {
+			if err := changeset.workout(w); err != nil {
+				log.Println("writing changeset failed for workout", w.ID, err)
+			}
+		}
+		if cfg.postSyncCmd != "" {
+			if err := runPostSyncCmd(ctx, cfg.postSyncCmd, w, change); err != nil {
+				log.Println("post-sync-cmd failed for workout", w.ID, err)
+			}
+		}
+	}))
+
+	client := mapmyride.NewClient(tokens)
+	client.Logf = log.Printf
+	client.SchemaDrift = cfg.schemaDrift.SchemaDriftPolicy
+	client.MaxRetries = cfg.maxRetries
+	run, err := sync.New(client, db.store, opts...).Sync(ctx, cfg.username, begin, end)
+	if err != nil && !run.Through.IsZero() {
+		log.Printf("synced through %s before failing, sync again to carry on from there", run.Through.In(loc).Format("2006-01-02"))
+	}
+	var removed []int
+	for id, c := range run.Changes {
+		if c == sync.Removed {
+			removed = append(removed, id)
+		}
+	}
+	sort.Ints(removed)
+	for _, id := range removed {
+		anomalies = append(anomalies, anomaly{WorkoutID: id, Message: fmt.Sprintf("workout %d was removed upstream, it has been moved to the trash", id)})
+	}
+	if err == nil {
+		a, ok, aerr := db.monthlyDrop(ctx, cfg.username, time.Now().In(loc))
+		if aerr != nil {
+			log.Println("checking monthly workout counts failed:", aerr)
+		} else if ok {
+			anomalies = append(anomalies, a)
+		}
+	}
+	for _, a := range anomalies {
+		log.Println("anomaly:", a.Message)
+	}
+	if events != nil {
+		if eerr := events.anomalies(anomalies); eerr != nil {
+			log.Println("writing events failed:", eerr)
+		}
+		if eerr := events.finish(run, err); eerr != nil {
+			log.Println("writing events failed:", eerr)
+		}
+	}
+	if changeset != nil {
+		// Workouts are committed as they sync, so even a failed run's
+		// changes need to reach replicas.
+		if cerr := changeset.finish(run); cerr != nil {
+			log.Println("writing changeset failed:", cerr)
+		}
+	}
+	if cfg.pushgateway != "" {
+		if perr := pushMetrics(ctx, cfg.pushgateway, cfg.username, run, err); perr != nil {
+			log.Println("pushing metrics failed:", perr)
+		}
+	}
+	return err
 }
 
-func (d *DB) removeExtra(ctx context.Context, userName string, begin, end time.Time, workouts []mapmyride.Workout) error {
-	ids := make([]string, 0, len(workouts))
-	for _, w := range workouts {
-		ids = append(ids, strconv.Itoa(w.ID))
+func runAudit(ctx context.Context, cfg config, year int) error {
+	if cfg.username == "" {
+		return errors.New("need -username")
+	}
+
+	tokens, err := cfg.tokenSource()
+	if err != nil {
+		return err
+	}
+
+	loc, err := cfg.location()
+	if err != nil {
+		return err
+	}
+	begin := time.Date(year, 1, 1, 0, 0, 0, 0, loc)
+	end := begin.AddDate(1, 0, 0).Add(-time.Second)
+	if now := time.Now(); end.After(now) {
+		end = now
+	}
+
+	db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+	if err != nil {
+		return err
 	}
-	idss := strings.Join(ids, ",")
 
-	res, err := d.db.ExecContext(ctx, "delete from workouts where started_at >= $1 and started_at <= $2 and user_name=$3 and id not in ("+idss+")", begin, end, userName)
+	client := mapmyride.NewClient(tokens)
+	client.Logf = log.Printf
+	client.SchemaDrift = cfg.schemaDrift.SchemaDriftPolicy
+	client.MaxRetries = cfg.maxRetries
+	remote, err := client.ListWorkouts(ctx, begin, end, mapmyride.WithMissingIDs(cfg.missingIDs.MissingIDPolicy))
 	if err != nil {
 		return err
 	}
-	ra, err := res.RowsAffected()
+
+	n, err := db.audit(ctx, os.Stdout, cfg.username, remote, begin, end)
 	if err != nil {
 		return err
 	}
+	if n > 0 {
+		return fmt.Errorf("%d workouts differ, sync with -begin-day %s to update them", n, begin.Format("2006-01-02"))
+	}
+	return nil
+}
+
+// missingIDsFlag is a mapmyride.MissingIDPolicy set by name.
+type missingIDsFlag struct {
+	mapmyride.MissingIDPolicy
+}
+
+var missingIDPolicies = map[string]mapmyride.MissingIDPolicy{
+	"error":      mapmyride.MissingIDError,
+	"skip":       mapmyride.MissingIDSkip,
+	"synthesize": mapmyride.MissingIDSynthesize,
+}
+
+func (f *missingIDsFlag) String() string {
+	for name, p := range missingIDPolicies {
+		if p == f.MissingIDPolicy {
+			return name
+		}
+	}
+	return ""
+}
+
+func (f *missingIDsFlag) Set(s string) error {
+	p, ok := missingIDPolicies[s]
+	if !ok {
+		return fmt.Errorf("unknown policy %q, want error, skip or synthesize", s)
+	}
+	f.MissingIDPolicy = p
+	return nil
+}
 
-	log.Println("removeExtra removed", ra, "extra workouts for", userName, "started_at between", begin, "and", end, "and not ids", idss)
+// schemaDriftFlag is a mapmyride.SchemaDriftPolicy set by name.
+type schemaDriftFlag struct {
+	mapmyride.SchemaDriftPolicy
+}
 
+var schemaDriftPolicies = map[string]mapmyride.SchemaDriftPolicy{
+	"ignore": mapmyride.SchemaDriftIgnore,
+	"log":    mapmyride.SchemaDriftLog,
+	"fail":   mapmyride.SchemaDriftFail,
+}
+
+func (f *schemaDriftFlag) String() string {
+	for name, p := range schemaDriftPolicies {
+		if p == f.SchemaDriftPolicy {
+			return name
+		}
+	}
+	return ""
+}
+
+func (f *schemaDriftFlag) Set(s string) error {
+	p, ok := schemaDriftPolicies[s]
+	if !ok {
+		return fmt.Errorf("unknown policy %q, want ignore, log or fail", s)
+	}
+	f.SchemaDriftPolicy = p
 	return nil
 }
+
+// DB wraps the sync store with the queries used by the analysis
+// subcommands.
+type DB struct {
+	store *sync.DB
+	db    *sql.DB
+}
+
+func newDB(filename string, opts ...sync.OpenOption) (*DB, error) {
+	st, err := sync.Open(filename, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{store: st, db: st.SQL()}, nil
+}
+
+func (d *DB) listRetries(ctx context.Context, w io.Writer, userName string) error {
+	retries, err := d.store.Retries(ctx, userName)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUSER\tDATE\tATTEMPTS\tSTATUS\tLAST ERROR")
+	for _, r := range retries {
+		status := "retrying"
+		if r.Permanent {
+			status = "gave up"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\n", r.WorkoutID, r.UserName, r.Day.Format("2006-01-02"), r.Attempts, status, r.LastError)
+	}
+	return tw.Flush()
+}
+
+func (d *DB) listTrash(ctx context.Context, w io.Writer) error {
+	trashed, err := d.store.Trashed(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUSER\tNAME\tSTARTED AT\tREMOVED AT")
+	for _, t := range trashed {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", t.ID, t.UserName, t.Name, t.StartedAt.Format(time.RFC3339), t.RemovedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
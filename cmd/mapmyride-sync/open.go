@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+
+	"github.com/danp/mapmyride"
+	"github.com/peterbourgon/ff/ffcli"
+)
+
+func newOpenCommand(ctx context.Context, cfg *config) *ffcli.Command {
+	fs := flag.NewFlagSet("mapmyride-sync open", flag.ExitOnError)
+	printOnly := fs.Bool("print", false, "only print the address, without opening it")
+
+	return &ffcli.Command{
+		Name:      "open",
+		Usage:     "mapmyride-sync [flags] open [flags] <id>",
+		ShortHelp: "print and open the mapmyride page for a synced workout in a browser",
+		FlagSet:   fs,
+		Exec: func(args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			id, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("parsing workout id %q: %w", args[0], err)
+			}
+			db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+			if err != nil {
+				return err
+			}
+			u, err := db.workoutURL(ctx, id)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(u)
+			if *printOnly {
+				return nil
+			}
+			if err := openBrowser(ctx, u); err != nil {
+				log.Println("opening browser failed:", err)
+			}
+			return nil
+		},
+	}
+}
+
+// workoutURL returns the mapmyride address of stored workout id.
+func (d *DB) workoutURL(ctx context.Context, id int) (string, error) {
+	var n int
+	if err := d.db.QueryRowContext(ctx, "select count(*) from workouts where id=$1", id).Scan(&n); err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "", fmt.Errorf("workout %d not found", id)
+	}
+	if id < 0 {
+		// Synthesized by -missing-ids=synthesize, so there's no page.
+		return "", fmt.Errorf("workout %d has no id on mapmyride", id)
+	}
+	return mapmyride.WorkoutURL(id), nil
+}
+
+// openBrowser opens u in the default browser.
+func openBrowser(ctx context.Context, u string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.CommandContext(ctx, "open", u)
+	case "windows":
+		cmd = exec.CommandContext(ctx, "rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		cmd = exec.CommandContext(ctx, "xdg-open", u)
+	}
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
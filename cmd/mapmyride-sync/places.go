@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danp/mapmyride/sync"
+	"github.com/peterbourgon/ff/ffcli"
+)
+
+func newGeocodeCommand(ctx context.Context, cfg *config) *ffcli.Command {
+	fs := flag.NewFlagSet("mapmyride-sync geocode", flag.ExitOnError)
+	serviceURL := fs.String("url", "https://nominatim.openstreetmap.org", "base URL of the Nominatim server to reverse geocode with")
+	interval := fs.Duration("interval", time.Second, "time between requests, at least a second for the public Nominatim server")
+	all := fs.Bool("all", false, "geocode workouts again even if they already have been")
+
+	return &ffcli.Command{
+		Name:      "geocode",
+		Usage:     "mapmyride-sync [flags] geocode [flags]",
+		ShortHelp: "look up the country, region and city each workout started in, for stats places",
+		FlagSet:   fs,
+		Exec: func([]string) error {
+			db, err := newDB(cfg.databaseFile, cfg.dbOptions()...)
+			if err != nil {
+				return err
+			}
+			starts, err := db.workoutStarts(ctx, cfg.username, *all)
+			if err != nil {
+				return err
+			}
+
+			tick := time.NewTicker(*interval)
+			defer tick.Stop()
+			for i, s := range starts {
+				if i > 0 {
+					<-tick.C
+				}
+				p, err := reverseGeocode(ctx, strings.TrimSuffix(*serviceURL, "/"), s.lat, s.lng)
+				if err != nil {
+					return fmt.Errorf("geocoding workout %d: %w", s.id, err)
+				}
+				if err := db.store.SetPlace(ctx, s.id, p); err != nil {
+					return err
+				}
+			}
+			log.Printf("geocoded %d workouts", len(starts))
+			return nil
+		},
+	}
+}
+
+// workoutStart is where a workout started.
+type workoutStart struct {
+	id       int
+	lat, lng float64
+}
+
+// workoutStarts returns where each of userName's workouts with positions
+// started, or all users' if it's empty, skipping those already geocoded
+// unless all is set.
+func (d *DB) workoutStarts(ctx context.Context, userName string, all bool) ([]workoutStart, error) {
+	rows, err := d.db.QueryContext(
+		ctx,
+		`select w.id, p.lat, p.lng from workouts w join workout_positions p on p.workout_id = w.id
+		where p.elapsed_seconds = (select min(elapsed_seconds) from workout_positions where workout_id = w.id)
+		and p.lat is not null and p.lng is not null and w.has_positions and ($1 = '' or w.user_name=$1)
+		and ($2 or w.id not in (select workout_id from workout_places))
+		group by w.id order by w.started_at`,
+		userName, all,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []workoutStart
+	for rows.Next() {
+		var s workoutStart
+		if err := rows.Scan(&s.id, &s.lat, &s.lng); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// reverseGeocode names the place at lat, lng with the Nominatim server at
+// baseURL.
+func reverseGeocode(ctx context.Context, baseURL string, lat, lng float64) (sync.Place, error) {
+	q := url.Values{
+		"format": {"jsonv2"},
+		"lat":    {strconv.FormatFloat(lat, 'f', -1, 64)},
+		"lon":    {strconv.FormatFloat(lng, 'f', -1, 64)},
+		"zoom":   {"10"},
+	}
+	var resp struct {
+		Error   string
+		Address map[string]string
+	}
+	if err := serviceRequest(ctx, "GET", baseURL+"/reverse?"+q.Encode(), nil, &resp); err != nil {
+		return sync.Place{}, err
+	}
+	if resp.Error != "" {
+		return sync.Place{}, fmt.Errorf("nominatim: %s", resp.Error)
+	}
+
+	first := func(keys ...string) string {
+		for _, k := range keys {
+			if v := resp.Address[k]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	return sync.Place{
+		Country: first("country"),
+		Region:  first("state", "province", "region", "state_district", "county"),
+		City:    first("city", "town", "village", "hamlet", "municipality"),
+	}, nil
+}
+
+// statsPlaces writes totals for userName's geocoded workouts, or all
+// users' if it's empty, grouped by country, region or city as by says, in
+// year if it's not zero. The places with the most distance come first.
+func (d *DB) statsPlaces(ctx context.Context, w io.Writer, userName, by string, year int, loc *time.Location, u units) error {
+	var parts int
+	switch by {
+	case "country":
+		parts = 1
+	case "region":
+		parts = 2
+	case "city":
+		parts = 3
+	default:
+		return fmt.Errorf("unknown grouping %q, want country, region or city", by)
+	}
+
+	rows, err := d.db.QueryContext(
+		ctx,
+		"select p.city, p.region, p.country, w.started_at, coalesce(w.distance_m, 0), coalesce(w.duration_s, 0) from workouts w join workout_places p on p.workout_id = w.id where ($1 = '' or w.user_name=$1)",
+		userName,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type total struct {
+		place    string
+		workouts int
+		distance float64
+		duration time.Duration
+	}
+	byPlace := make(map[string]*total)
+	for rows.Next() {
+		var (
+			names     [3]string // city, region, country
+			startedAt time.Time
+			distance  float64
+			durationS int
+		)
+		if err := rows.Scan(&names[0], &names[1], &names[2], &startedAt, &distance, &durationS); err != nil {
+			return err
+		}
+		if year != 0 && startedAt.In(loc).Year() != year {
+			continue
+		}
+
+		var named []string
+		for _, n := range names[3-parts:] {
+			if n != "" {
+				named = append(named, n)
+			}
+		}
+		place := strings.Join(named, ", ")
+		if place == "" {
+			place = "unknown"
+		}
+		t := byPlace[place]
+		if t == nil {
+			t = &total{place: place}
+			byPlace[place] = t
+		}
+		t.workouts++
+		t.distance += distance
+		t.duration += time.Duration(durationS) * time.Second
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	totals := make([]*total, 0, len(byPlace))
+	for _, t := range byPlace {
+		totals = append(totals, t)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].distance != totals[j].distance {
+			return totals[i].distance > totals[j].distance
+		}
+		return totals[i].place < totals[j].place
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\tWORKOUTS\t%s\tHOURS\n", strings.ToUpper(by), strings.ToUpper(u.distanceUnit()))
+	for _, t := range totals {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f\t%.1f\n", t.place, t.workouts, u.distance(t.distance), t.duration.Hours())
+	}
+	return tw.Flush()
+}
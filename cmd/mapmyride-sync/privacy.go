@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danp/mapmyride"
+)
+
+// earthRadius is the mean radius of the Earth in meters.
+const earthRadius = 6371000
+
+// privacyZone is a circle around a place, such as home, that positions
+// are hidden within on shared pages.
+type privacyZone struct {
+	lat, lng float64
+	radius   float64 // meters
+}
+
+// privacyZones is a flag.Value collecting privacyZones in the form
+// lat,lng,meters.
+type privacyZones []privacyZone
+
+func (z *privacyZones) String() string {
+	if z == nil {
+		return ""
+	}
+	var parts []string
+	for _, pz := range *z {
+		parts = append(parts, strconv.FormatFloat(pz.lat, 'f', -1, 64)+","+strconv.FormatFloat(pz.lng, 'f', -1, 64)+","+strconv.FormatFloat(pz.radius, 'f', -1, 64))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (z *privacyZones) Set(s string) error {
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return fmt.Errorf("privacy zone %q is not lat,lng,meters", s)
+	}
+	var vs [3]float64
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return fmt.Errorf("privacy zone %q: %w", s, err)
+		}
+		vs[i] = v
+	}
+	if vs[0] < -90 || vs[0] > 90 || vs[1] < -180 || vs[1] > 180 {
+		return fmt.Errorf("privacy zone %q is not a valid position", s)
+	}
+	if vs[2] <= 0 {
+		return fmt.Errorf("privacy zone %q needs a radius above zero", s)
+	}
+	*z = append(*z, privacyZone{lat: vs[0], lng: vs[1], radius: vs[2]})
+	return nil
+}
+
+// trackEndRadius is the radius in meters of the zone a track's own start
+// and end are treated as leaving and entering, so they are hidden even
+// with no zones configured.
+const trackEndRadius = 200
+
+// split returns the runs of ps outside all of the zones, so a path drawn
+// from them doesn't cut straight across a zone. Where a run meets a zone,
+// or the start or end of the track, it is cut back by margin(radius)
+// meters more along the path, so its end doesn't sit on the zone's edge
+// and give away the center or where the ride began. Runs with fewer than
+// two positions left are dropped.
+func (z privacyZones) split(ps []mapmyride.WorkoutPosition, margin func(radius float64) float64) [][]mapmyride.WorkoutPosition {
+	var (
+		out [][]mapmyride.WorkoutPosition
+		run []mapmyride.WorkoutPosition
+		// enterR and lastR are the radii of the zone the run started
+		// from and the last zone passed through.
+		enterR, lastR float64 = trackEndRadius, trackEndRadius
+	)
+	add := func(exitR float64) {
+		run = trimEnd(trimStart(run, margin(enterR)), margin(exitR))
+		if len(run) > 1 {
+			out = append(out, run)
+		}
+		run = nil
+	}
+	for _, p := range ps {
+		if r := z.radiusAt(p); r > 0 {
+			if len(run) > 0 {
+				add(r)
+			}
+			lastR = r
+			continue
+		}
+		if len(run) == 0 {
+			enterR = lastR
+		}
+		run = append(run, p)
+	}
+	if len(run) > 0 {
+		add(trackEndRadius)
+	}
+	return out
+}
+
+// radiusAt returns the radius of the largest zone containing p, or 0 if
+// none do.
+func (z privacyZones) radiusAt(p mapmyride.WorkoutPosition) float64 {
+	var r float64
+	for _, pz := range z {
+		if distanceMeters(p.Lat, p.Lng, pz.lat, pz.lng) <= pz.radius {
+			r = math.Max(r, pz.radius)
+		}
+	}
+	return r
+}
+
+// trimStart returns ps from its first position at least meters along
+// the path from its start.
+func trimStart(ps []mapmyride.WorkoutPosition, meters float64) []mapmyride.WorkoutPosition {
+	var d float64
+	for i := range ps {
+		if i > 0 {
+			d += distanceMeters(ps[i-1].Lat, ps[i-1].Lng, ps[i].Lat, ps[i].Lng)
+		}
+		if d >= meters {
+			return ps[i:]
+		}
+	}
+	return nil
+}
+
+// trimEnd returns ps up to its last position at least meters along the
+// path from its end.
+func trimEnd(ps []mapmyride.WorkoutPosition, meters float64) []mapmyride.WorkoutPosition {
+	var d float64
+	for i := len(ps) - 1; i >= 0; i-- {
+		if i < len(ps)-1 {
+			d += distanceMeters(ps[i].Lat, ps[i].Lng, ps[i+1].Lat, ps[i+1].Lng)
+		}
+		if d >= meters {
+			return ps[:i+1]
+		}
+	}
+	return nil
+}
+
+// randomMargin returns a margin for split that cuts tracks back by a
+// random distance up to each zone's radius, different on each run.
+func randomMargin() func(radius float64) float64 {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return func(radius float64) float64 {
+		return rnd.Float64() * radius
+	}
+}
+
+// distanceMeters returns the great-circle distance between two positions.
+func distanceMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	rad := func(d float64) float64 { return d * math.Pi / 180 }
+	dLat, dLng := rad(lat2-lat1), rad(lng2-lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
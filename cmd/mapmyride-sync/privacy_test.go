@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danp/mapmyride"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPrivacyZonesSplit(t *testing.T) {
+	// 21 positions eastward along the equator, about 111m apart.
+	ps := make([]mapmyride.WorkoutPosition, 21)
+	for i := range ps {
+		ps[i] = mapmyride.WorkoutPosition{Lng: float64(i) * 0.001}
+	}
+	run := func(from, to int) []mapmyride.WorkoutPosition { return ps[from : to+1] }
+	noMargin := func(float64) float64 { return 0 }
+	// 150m for a 250m zone, cutting back one more position each side, and
+	// 120m for the track's own ends, cutting back two positions.
+	someMargin := func(r float64) float64 { return r * 0.6 }
+	// Zones 250m around positions 10 and 0 cover 8 to 12 and 0 to 2.
+	middle := privacyZone{lng: 0.010, radius: 250}
+	start := privacyZone{lng: 0, radius: 250}
+
+	for _, tc := range []struct {
+		name   string
+		zones  privacyZones
+		margin func(float64) float64
+		want   [][]mapmyride.WorkoutPosition
+	}{
+		{"no zones", nil, someMargin, [][]mapmyride.WorkoutPosition{run(2, 18)}},
+		{"no zones or margin", nil, noMargin, [][]mapmyride.WorkoutPosition{ps}},
+		{"zone elsewhere", privacyZones{{lat: 10, radius: 250}}, someMargin, [][]mapmyride.WorkoutPosition{run(2, 18)}},
+		{"gap", privacyZones{middle}, noMargin, [][]mapmyride.WorkoutPosition{run(0, 7), run(13, 20)}},
+		{"gap with margin", privacyZones{middle}, someMargin, [][]mapmyride.WorkoutPosition{run(2, 5), run(15, 18)}},
+		{"starts in zone", privacyZones{start}, someMargin, [][]mapmyride.WorkoutPosition{run(5, 18)}},
+		// Cut back from both zones, 3 to 7 leaves only 5 and is dropped.
+		{"two zones", privacyZones{start, middle}, someMargin, [][]mapmyride.WorkoutPosition{run(15, 18)}},
+		{"margin longer than runs", privacyZones{start, middle}, func(float64) float64 { return 1000 }, nil},
+		{"all inside", privacyZones{{lng: 0.010, radius: 2000}}, noMargin, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.zones.split(ps, tc.margin)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("split mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRandomMargin(t *testing.T) {
+	margin := randomMargin()
+	for i := 0; i < 100; i++ {
+		if m := margin(250); m < 0 || m >= 250 {
+			t.Fatalf("got margin %v, want within [0, 250)", m)
+		}
+	}
+}
+
+func TestSVGSegmentsPath(t *testing.T) {
+	segs := [][]mapmyride.WorkoutPosition{
+		{{Lat: 0, Lng: 0}, {Lat: 0, Lng: 1}},
+		{{Lat: 1, Lng: 0}, {Lat: 1, Lng: 1}},
+	}
+	got := svgSegmentsPath(segs, 100)
+	if n := strings.Count(got, "M"); n != 2 {
+		t.Errorf("got %d subpaths in %q, want 2", n, got)
+	}
+	if want := "M0.0 100.0 L100.0 100.0 M0.0 0.0 L100.0 0.0"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := svgSegmentsPath(nil, 100); got != "" {
+		t.Errorf("got %q for no segments, want empty", got)
+	}
+}
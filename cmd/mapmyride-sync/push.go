@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/danp/mapmyride/sync"
+)
+
+// pushChanges are the changes reported as mapmyride_sync_workouts.
+var pushChanges = []sync.Change{sync.Added, sync.Changed, sync.Unchanged, sync.Removed, sync.Failed, sync.Skipped}
+
+// writeMetrics writes metrics about run, which ended with runErr, in the
+// Prometheus text format.
+func writeMetrics(w io.Writer, run sync.Run, runErr error) {
+	fmt.Fprintln(w, "# HELP mapmyride_sync_workouts Workouts seen by the last sync, by what it did to them.")
+	fmt.Fprintln(w, "# TYPE mapmyride_sync_workouts gauge")
+	for _, c := range pushChanges {
+		fmt.Fprintf(w, "mapmyride_sync_workouts{change=%q} %d\n", string(c), run.Count(c))
+	}
+
+	success := 1
+	if runErr != nil {
+		success = 0
+	}
+	fmt.Fprintln(w, "# HELP mapmyride_sync_success Whether the last sync succeeded.")
+	fmt.Fprintln(w, "# TYPE mapmyride_sync_success gauge")
+	fmt.Fprintf(w, "mapmyride_sync_success %d\n", success)
+
+	finished := run.FinishedAt
+	if finished.IsZero() {
+		finished = time.Now()
+	}
+	fmt.Fprintln(w, "# HELP mapmyride_sync_duration_seconds How long the last sync took.")
+	fmt.Fprintln(w, "# TYPE mapmyride_sync_duration_seconds gauge")
+	fmt.Fprintf(w, "mapmyride_sync_duration_seconds %g\n", finished.Sub(run.StartedAt).Seconds())
+
+	fmt.Fprintln(w, "# HELP mapmyride_sync_last_run_timestamp_seconds When the last sync finished.")
+	fmt.Fprintln(w, "# TYPE mapmyride_sync_last_run_timestamp_seconds gauge")
+	fmt.Fprintf(w, "mapmyride_sync_last_run_timestamp_seconds %d\n", finished.Unix())
+}
+
+// pushMetrics sends metrics about run to the Prometheus Pushgateway at
+// gatewayURL, grouped under the mapmyride_sync job and userName so each
+// user's last run replaces their previous one.
+func pushMetrics(ctx context.Context, gatewayURL, userName string, run sync.Run, runErr error) error {
+	var b bytes.Buffer
+	writeMetrics(&b, run, runErr)
+
+	u := strings.TrimSuffix(gatewayURL, "/") + "/metrics/job/mapmyride_sync/user/" + url.PathEscape(userName)
+	req, err := http.NewRequestWithContext(ctx, "PUT", u, &b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("pushing metrics to %s: got status %d", gatewayURL, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danp/mapmyride/sync"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	start := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	run := sync.Run{
+		UserName:   "dan",
+		StartedAt:  start,
+		FinishedAt: start.Add(2500 * time.Millisecond),
+		Changes: map[int]sync.Change{
+			1: sync.Added,
+			2: sync.Added,
+			3: sync.Unchanged,
+			4: sync.Failed,
+		},
+	}
+
+	const header = `# HELP mapmyride_sync_workouts Workouts seen by the last sync, by what it did to them.
+# TYPE mapmyride_sync_workouts gauge
+mapmyride_sync_workouts{change="added"} 2
+mapmyride_sync_workouts{change="changed"} 0
+mapmyride_sync_workouts{change="unchanged"} 1
+mapmyride_sync_workouts{change="removed"} 0
+mapmyride_sync_workouts{change="failed"} 1
+mapmyride_sync_workouts{change="skipped"} 0
+# HELP mapmyride_sync_success Whether the last sync succeeded.
+# TYPE mapmyride_sync_success gauge
+`
+	const footer = `# HELP mapmyride_sync_duration_seconds How long the last sync took.
+# TYPE mapmyride_sync_duration_seconds gauge
+mapmyride_sync_duration_seconds 2.5
+# HELP mapmyride_sync_last_run_timestamp_seconds When the last sync finished.
+# TYPE mapmyride_sync_last_run_timestamp_seconds gauge
+mapmyride_sync_last_run_timestamp_seconds 1622541602
+`
+	for _, tc := range []struct {
+		name   string
+		runErr error
+		want   string
+	}{
+		{"success", nil, header + "mapmyride_sync_success 1\n" + footer},
+		{"failure", errors.New("token expired"), header + "mapmyride_sync_success 0\n" + footer},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writeMetrics(&buf, run, tc.runErr)
+			if diff := cmp.Diff(tc.want, buf.String()); diff != "" {
+				t.Errorf("metrics mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPushMetrics(t *testing.T) {
+	var method, path, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.EscapedPath(), string(b)
+	}))
+	defer srv.Close()
+
+	start := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	run := sync.Run{StartedAt: start, FinishedAt: start.Add(time.Second)}
+	if err := pushMetrics(context.Background(), srv.URL+"/", "dan p", run, nil); err != nil {
+		t.Fatal(err)
+	}
+	if method != "PUT" || path != "/metrics/job/mapmyride_sync/user/dan%20p" {
+		t.Errorf("got %s %s, want PUT /metrics/job/mapmyride_sync/user/dan%%20p", method, path)
+	}
+	var want bytes.Buffer
+	writeMetrics(&want, run, nil)
+	if body != want.String() {
+		t.Errorf("got body %q, want %q", body, want.String())
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+	"time"
+)
+
+// maxPlausibleSpeed is the fastest believable average speed, in meters
+// per second, by kind. Kinds not listed use maxPlausibleSpeed[""].
+var maxPlausibleSpeed = map[string]float64{
+	"":     25, // 90 km/h
+	"ride": 20, // 72 km/h
+	"run":  7,  // 25 km/h
+	"walk": 3,  // 11 km/h
+	"hike": 3,
+}
+
+// outdoorKinds are kinds expected to have GPS positions.
+var outdoorKinds = map[string]bool{
+	"ride": true,
+	"run":  true,
+	"walk": true,
+	"hike": true,
+}
+
+// statsQuality prints workouts in the last weeks weeks with data that
+// looks wrong, one line per problem, so they can be fixed upstream.
+func (d *DB) statsQuality(ctx context.Context, w io.Writer, userName string, weeks int, now time.Time, u units) error {
+	if weeks < 1 {
+		return fmt.Errorf("need at least one week")
+	}
+	begin := weekStart(now).AddDate(0, 0, -7*(weeks-1))
+
+	type workout struct {
+		id           int
+		name, kind   string
+		startedAt    time.Time
+		duration     time.Duration
+		distance     float64
+		gain         sql.NullFloat64
+		hasPositions bool
+	}
+	rows, err := d.db.QueryContext(
+		ctx,
+		"select id, name, normalized_kind, started_at, coalesce(duration_s, 0), coalesce(distance_m, 0), gain_m, coalesce(has_positions, 0) from workouts where ($1 = '' or user_name=$1) order by started_at",
+		userName,
+	)
+	if err != nil {
+		return err
+	}
+	var workouts []workout
+	for rows.Next() {
+		var (
+			wk        workout
+			durationS int
+		)
+		if err := rows.Scan(&wk.id, &wk.name, &wk.kind, &wk.startedAt, &durationS, &wk.distance, &wk.gain, &wk.hasPositions); err != nil {
+			rows.Close()
+			return err
+		}
+		if wk.startedAt.Before(begin) {
+			continue
+		}
+		wk.duration = time.Duration(durationS) * time.Second
+		workouts = append(workouts, wk)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tID\tNAME\tPROBLEM")
+	var problems int
+	for _, wk := range workouts {
+		var found []string
+		if wk.distance == 0 && wk.duration >= 20*time.Minute && outdoorKinds[wk.kind] {
+			found = append(found, fmt.Sprintf("no distance in %s", wk.duration))
+		}
+		maxSpeed, ok := maxPlausibleSpeed[wk.kind]
+		if !ok {
+			maxSpeed = maxPlausibleSpeed[""]
+		}
+		if wk.duration > 0 && wk.distance/wk.duration.Seconds() > maxSpeed {
+			found = append(found, fmt.Sprintf("average speed %.0f %s is implausible", u.speed(wk.distance/wk.duration.Seconds()), u.speedUnit()))
+		}
+		if !wk.hasPositions && outdoorKinds[wk.kind] && wk.distance > 0 {
+			found = append(found, "no GPS positions")
+		}
+		if wk.hasPositions && wk.gain.Valid {
+			tg, err := d.trackGain(ctx, wk.id)
+			if err != nil {
+				return err
+			}
+			if gainsDisagree(wk.gain.Float64, tg) {
+				found = append(found, fmt.Sprintf("gain %.0f %s but track climbs %.0f %[2]s", u.elevation(wk.gain.Float64), u.elevationUnit(), u.elevation(tg)))
+			}
+		}
+
+		day := wk.startedAt.In(now.Location()).Format("2006-01-02")
+		for _, p := range found {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", day, wk.id, wk.name, p)
+			problems++
+		}
+	}
+	if problems == 0 {
+		fmt.Fprintln(tw, "no problems found")
+	}
+	return tw.Flush()
+}
+
+// trackGain returns the total climbing computed from workout id's stored
+// positions.
+func (d *DB) trackGain(ctx context.Context, id int) (float64, error) {
+	var gain float64
+	err := d.db.QueryRowContext(
+		ctx,
+		`select coalesce(sum(case when climb > 0 then climb else 0 end), 0) from (
+			select elevation - lag(elevation) over (order by elapsed_seconds) as climb
+			from workout_positions where workout_id=$1
+		)`,
+		id,
+	).Scan(&gain)
+	return gain, err
+}
+
+// gainsDisagree reports whether a workout's stated gain and the gain
+// computed from its track differ by more than GPS noise explains.
+func gainsDisagree(stated, track float64) bool {
+	if math.Abs(stated-track) < 100 {
+		return false
+	}
+	lo, hi := math.Min(stated, track), math.Max(stated, track)
+	return lo == 0 || hi/lo > 3
+}
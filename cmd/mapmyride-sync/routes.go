@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danp/mapmyride"
+	"github.com/peterbourgon/ff/ffcli"
+)
+
+func newRoutesCommand(ctx context.Context, cfg *config) *ffcli.Command {
+	exportFS := flag.NewFlagSet("mapmyride-sync routes export", flag.ExitOnError)
+	exportDir := exportFS.String("dir", ".", "directory to write files to, named route-<id>.<format>")
+	exportFormat := exportFS.String("format", "gpx", "file format: gpx for bike computers, or kml for Google Earth")
+
+	return &ffcli.Command{
+		Name:      "routes",
+		Usage:     "mapmyride-sync [flags] routes <subcommand>",
+		ShortHelp: "sync and list saved routes",
+		Subcommands: []*ffcli.Command{
+			{
+				Name:      "sync",
+				Usage:     "mapmyride-sync -username <user> [flags] routes sync",
+				ShortHelp: "fetch the logged in user's saved routes, with their points, into the database",
+				Exec: func([]string) error {
+					if cfg.username == "" {
+						return errors.New("need -username")
+					}
+					tokens, err := cfg.tokenSource()
+					if err != nil {
+						return err
+					}
+					db, err := newDB(cfg.databaseFile, cfg.dbOptions()...)
+					if err != nil {
+						return err
+					}
+
+					client := mapmyride.NewClient(tokens)
+					client.Logf = log.Printf
+					client.SchemaDrift = cfg.schemaDrift.SchemaDriftPolicy
+					client.MaxRetries = cfg.maxRetries
+					n, err := db.syncRoutes(ctx, client, cfg.username)
+					if err != nil {
+						return err
+					}
+					log.Println("synced", n, "routes for", cfg.username)
+					return nil
+				},
+			},
+			{
+				Name:      "list",
+				Usage:     "mapmyride-sync [flags] routes list",
+				ShortHelp: "list synced routes and how many workouts were attached to each",
+				Exec: func([]string) error {
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					return db.listRoutes(ctx, os.Stdout, cfg.username, cfg.units)
+				},
+			},
+			{
+				Name:      "export",
+				Usage:     "mapmyride-sync [flags] routes export [flags] [<id>...]",
+				ShortHelp: "write synced routes as GPX or KML files, all with points if no ids are given",
+				FlagSet:   exportFS,
+				Exec: func(args []string) error {
+					write, ok := routeExportFormats[*exportFormat]
+					if !ok {
+						return fmt.Errorf("unknown format %q, want gpx or kml", *exportFormat)
+					}
+					var ids []int
+					for _, a := range args {
+						id, err := strconv.Atoi(a)
+						if err != nil {
+							return fmt.Errorf("parsing route id %q: %w", a, err)
+						}
+						ids = append(ids, id)
+					}
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					if len(ids) == 0 {
+						ids, err = db.queryIDs(ctx, "select id from routes where ($1 = '' or user_name=$1) and exists (select 1 from route_points where route_id=routes.id) order by id", cfg.username)
+						if err != nil {
+							return err
+						}
+					}
+					if err := os.MkdirAll(*exportDir, 0o755); err != nil {
+						return err
+					}
+					for _, id := range ids {
+						if err := db.exportRoute(ctx, filepath.Join(*exportDir, "route-"+strconv.Itoa(id)+"."+*exportFormat), id, write); err != nil {
+							return fmt.Errorf("exporting route %d: %w", id, err)
+						}
+					}
+					log.Printf("exported %d routes to %s", len(ids), *exportDir)
+					return nil
+				},
+			},
+		},
+		Exec: func([]string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+// routeExportFormats are the file formats routes export can write, by
+// name.
+var routeExportFormats = map[string]func(mapmyride.Route, io.Writer) error{
+	"gpx": mapmyride.Route.WriteGPX,
+	"kml": mapmyride.Route.WriteKML,
+}
+
+// exportRoute writes stored route id to a file at name with write.
+func (d *DB) exportRoute(ctx context.Context, name string, id int, write func(mapmyride.Route, io.Writer) error) error {
+	r, err := d.store.LoadRoute(ctx, id)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(r, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncRoutes fetches the routes client's user saved and stores them for
+// userName, returning how many there were. Points are only fetched for
+// routes that are new or updated since they were stored.
+func (d *DB) syncRoutes(ctx context.Context, client *mapmyride.Client, userName string) (int, error) {
+	routes, err := client.ListRoutes(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range routes {
+		var updatedAt time.Time
+		err := d.db.QueryRowContext(ctx, "select updated_at from routes where id=$1 and exists (select 1 from route_points where route_id=routes.id)", r.ID).Scan(&updatedAt)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, err
+		}
+		if !updatedAt.Equal(r.UpdatedAt) {
+			r, err = client.GetRoute(ctx, r.ID)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if err := d.store.SaveRoute(ctx, userName, r); err != nil {
+			return 0, fmt.Errorf("saving route %d: %w", r.ID, err)
+		}
+	}
+	return len(routes), nil
+}
+
+// listRoutes writes a line for each stored route of userName, or all
+// users if it's empty, with the number of workouts attached to it.
+func (d *DB) listRoutes(ctx context.Context, w io.Writer, userName string, u units) error {
+	rows, err := d.db.QueryContext(
+		ctx,
+		"select r.id, r.name, coalesce(r.distance_m, 0), coalesce(r.ascent_m, 0), (select count(*) from workouts where route_id = r.id) from routes r where ($1 = '' or r.user_name=$1) order by r.name",
+		userName,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDISTANCE\tASCENT\tWORKOUTS\tNAME")
+	for rows.Next() {
+		var (
+			id, workouts     int
+			name             string
+			distance, ascent float64
+		)
+		if err := rows.Scan(&id, &name, &distance, &ascent, &workouts); err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%d\t%.1f %s\t%.0f %s\t%d\t%s\n", id, u.distance(distance), u.distanceUnit(), u.elevation(ascent), u.elevationUnit(), workouts, name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return tw.Flush()
+}
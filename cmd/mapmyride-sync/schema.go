@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/danp/mapmyride/sync"
+	"github.com/peterbourgon/ff/ffcli"
+)
+
+func newSchemaCommand(ctx context.Context) *ffcli.Command {
+	fs := flag.NewFlagSet("mapmyride-sync schema", flag.ExitOnError)
+
+	return &ffcli.Command{
+		Name:      "schema",
+		Usage:     "mapmyride-sync schema",
+		ShortHelp: "describe the database tables and columns, with units and example queries",
+		FlagSet:   fs,
+		Exec: func(args []string) error {
+			if len(args) != 0 {
+				return flag.ErrHelp
+			}
+			// Describe a fresh database rather than -database-file so the
+			// output always matches the migrations in this build.
+			db, err := newDB(sync.MemoryFilename)
+			if err != nil {
+				return err
+			}
+			defer db.db.Close()
+			if err := db.store.EnableSpatialIndex(); err != nil {
+				return err
+			}
+			return db.printSchema(ctx, os.Stdout)
+		},
+	}
+}
+
+// tableDocs describe each table printed by schema.
+var tableDocs = map[string]string{
+	"workouts":                  "one row per synced workout, with its summary from mapmyride and values computed from its series",
+	"workout_distances":         "cumulative distance series",
+	"workout_positions":         "GPS track",
+	"workout_snapped_positions": "GPS track snapped to roads with snap, used by export -snapped",
+	"workout_speeds":            "speed series",
+	"workout_steps":             "step count series, steps taken since the previous point",
+	"workout_heart_rates":       "heart rate series",
+	"workout_cadences":          "cadence series, such as from a bike's cadence sensor",
+	"workout_powers":            "power series, such as from a bike's power meter",
+	"workout_previews":          "downsampled track for maps, as an encoded polyline",
+	"workout_climbs":            "climbs found in the GPS track",
+	"workout_zone_times":        "time spent in each heart rate zone, for the zones set with -hr-zones",
+	"workout_places":            "where each workout started, reverse geocoded with geocode",
+	"workout_bounds":            "R*Tree of each GPS track's bounding box, with -spatial-index",
+	"routes":                    "saved routes fetched with routes sync",
+	"route_points":              "each saved route's path",
+	"zones":                     "zones set with -hr-zones",
+	"thresholds":                "FTP and threshold heart rate history set with ftp",
+	"weights":                   "body weight log set with weight",
+	"kind_map":                  "kind normalizations set with -kind",
+	"sync_runs":                 "one row per sync",
+	"sync_run_changes":          "workouts each sync added, changed or removed",
+	"sync_retries":              "workouts that failed to fetch and are retried by syncs",
+	"sync_state":                "how far each user's unfinished sync got, so the next one can resume",
+}
+
+// columnDocs describe columns whose meaning isn't clear from their name
+// and unit, keyed by table and column.
+var columnDocs = map[string]string{
+	"workouts.id":                         "mapmyride workout ID",
+	"workouts.name":                       "name, renamed by -name-template if generic",
+	"workouts.original_name":              "name on mapmyride",
+	"workouts.kind":                       "activity kind on mapmyride, such as ride",
+	"workouts.normalized_kind":            "kind after -kind normalizations, used by stats",
+	"workouts.speed_mps":                  "average speed",
+	"workouts.corrected_speed_mps":        "average speed with GPS spikes smoothed out",
+	"workouts.corrected_max_speed_mps":    "max speed with GPS spikes smoothed out",
+	"workouts.duration_s":                 "moving time",
+	"workouts.paused_s":                   "time paused",
+	"workouts.elapsed_s":                  "wall clock time from start to finish including pauses, if the site gave it",
+	"workouts.gain_m":                     "elevation gain",
+	"workouts.vam":                        "vertical meters climbed per hour",
+	"workouts.notes":                      "local note set with note",
+	"workouts.starred":                    "set for favorites starred with star",
+	"workouts.series_checksum":            "checksum of the series, to notice upstream recalculations",
+	"workouts.started_at":                 "start time in UTC",
+	"workouts.route_id":                   "saved route the workout followed, if any",
+	"workout_places.country":              "country the workout started in",
+	"workout_places.region":               "state, province or similar the workout started in",
+	"workout_places.city":                 "city, town or village the workout started in",
+	"routes.id":                           "mapmyride route ID",
+	"route_points.distance_m":             "distance from the route's start",
+	"route_points.elevation":              "meters",
+	"route_points.lat":                    "degrees",
+	"route_points.lng":                    "degrees",
+	"sync_state.begin_at":                 "start of the range the unfinished sync was asked for",
+	"sync_state.end_at":                   "end of the range the unfinished sync was asked for",
+	"sync_state.through_at":               "end of the last month fully synced",
+	"workout_positions.elevation":         "meters",
+	"workout_positions.lat":               "degrees",
+	"workout_positions.lng":               "degrees",
+	"workout_snapped_positions.elevation": "meters",
+	"workout_snapped_positions.lat":       "degrees",
+	"workout_snapped_positions.lng":       "degrees",
+	"workout_zone_times.kind":             "zone kind, heart_rate",
+	"workout_zone_times.zone":             "zone number, from 1",
+	"thresholds.kind":                     "ftp or heart_rate",
+	"thresholds.value":                    "watts for ftp, beats per minute for heart_rate",
+	"thresholds.effective_on":             "first day the value applies, as 2006-01-02",
+	"weights.measured_on":                 "day measured, as 2006-01-02",
+	"zones.bounds":                        "comma-separated zone boundaries in beats per minute",
+	"sync_retries.permanent":              "set once a workout is given up on",
+}
+
+// columnUnit returns the unit of a column from its name's suffix, or ""
+// if it has none.
+func columnUnit(name string) string {
+	switch {
+	case strings.HasSuffix(name, "_mps"), name == "meters_per_second":
+		return "m/s"
+	case strings.HasSuffix(name, "_m"), strings.HasSuffix(name, "_meters"):
+		return "meters"
+	case strings.HasSuffix(name, "_s"), strings.HasSuffix(name, "_seconds"), name == "seconds":
+		return "seconds"
+	case name == "kcal":
+		return "kilocalories"
+	case name == "kg":
+		return "kilograms"
+	case name == "watts":
+		return "watts"
+	case name == "beats_per_minute", name == "avg_heart_rate":
+		return "beats per minute"
+	case name == "revolutions_per_minute":
+		return "revolutions per minute"
+	case name == "avg_steps_per_minute":
+		return "steps per minute"
+	}
+	return ""
+}
+
+// schemaExamples are example queries printed by schema.
+var schemaExamples = []struct {
+	doc, query string
+}{
+	{
+		"Kilometers ridden per month:",
+		"select strftime('%Y-%m', started_at) as month, round(sum(distance_m) / 1000) as km from workouts where normalized_kind='ride' group by month order by month",
+	},
+	{
+		"Longest workouts by moving time, in hours:",
+		"select id, name, round(duration_s / 3600.0, 1) as hours from workouts order by duration_s desc limit 10",
+	},
+	{
+		"Average heart rate over each workout's first ten minutes:",
+		"select workout_id, round(avg(beats_per_minute)) from workout_heart_rates where elapsed_seconds < 600 group by workout_id",
+	},
+	{
+		"Highest point reached on each ride:",
+		"select w.id, w.name, max(p.elevation) as meters from workouts w join workout_positions p on p.workout_id=w.id where w.normalized_kind='ride' group by w.id",
+	},
+}
+
+// printSchema writes each table in the database with its columns, their
+// types, units and descriptions, followed by example queries.
+func (d *DB) printSchema(ctx context.Context, w io.Writer) error {
+	tables, err := d.schemaTables(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i, table := range tables {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, table)
+		if doc := tableDocs[table]; doc != "" {
+			fmt.Fprintln(w, "  "+doc)
+		}
+
+		rows, err := d.db.QueryContext(ctx, "select name, type from pragma_table_info($1) order by cid", table)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		tw := tabwriter.NewWriter(&buf, 0, 2, 2, ' ', 0)
+		for rows.Next() {
+			var name, typ string
+			if err := rows.Scan(&name, &typ); err != nil {
+				rows.Close()
+				return err
+			}
+			var desc []string
+			if u := columnUnit(name); u != "" {
+				desc = append(desc, u)
+			}
+			if doc := columnDocs[table+"."+name]; doc != "" && doc != columnUnit(name) {
+				desc = append(desc, doc)
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", name, typ, strings.Join(desc, "; "))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		// Columns without a description would end in padding.
+		for _, line := range strings.SplitAfter(buf.String(), "\n") {
+			if line != "" {
+				fmt.Fprintln(w, strings.TrimRight(line, " \n"))
+			}
+		}
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Removed workouts are kept in a matching _trash table for each workouts and workout_* table, with a removed_at column.")
+	fmt.Fprintln(w, "Times are stored in UTC.")
+	for _, ex := range schemaExamples {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, ex.doc)
+		fmt.Fprintln(w, "  "+ex.query)
+	}
+	return nil
+}
+
+// schemaTables returns the names of the tables to describe, leaving out
+// trash tables and SQLite's internal and R*Tree shadow tables.
+func (d *DB) schemaTables(ctx context.Context) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx, "select name from sqlite_master where type='table' and name not like 'sqlite_%' and name not like '%_trash' and name not like 'workout_bounds_%' order by name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
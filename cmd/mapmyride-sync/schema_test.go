@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/danp/mapmyride/sync"
+)
+
+func TestSchemaTablesDocumented(t *testing.T) {
+	ctx := context.Background()
+	db, err := newDB(sync.MemoryFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.db.Close()
+	if err := db.store.EnableSpatialIndex(); err != nil {
+		t.Fatal(err)
+	}
+
+	tables, err := db.schemaTables(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) == 0 {
+		t.Fatal("got no tables")
+	}
+	documented := make(map[string]bool)
+	for _, table := range tables {
+		documented[table] = true
+		if tableDocs[table] == "" {
+			t.Errorf("table %s has no tableDocs entry", table)
+		}
+	}
+	for table := range tableDocs {
+		if !documented[table] {
+			t.Errorf("tableDocs has %s, which isn't in the schema", table)
+		}
+	}
+
+	for key := range columnDocs {
+		table, column, _ := strings.Cut(key, ".")
+		var n int
+		if err := db.db.QueryRowContext(ctx, "select count(*) from pragma_table_info($1) where name=$2", table, column).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			t.Errorf("columnDocs has %s, which isn't in the schema", key)
+		}
+	}
+}
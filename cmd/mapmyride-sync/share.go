@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danp/mapmyride"
+	"github.com/peterbourgon/ff/ffcli"
+)
+
+func newShareCommand(ctx context.Context, cfg *config) *ffcli.Command {
+	fs := flag.NewFlagSet("mapmyride-sync share", flag.ExitOnError)
+	out := fs.String("out", "", "output file (default workout-<id>.html)")
+
+	return &ffcli.Command{
+		Name:      "share",
+		Usage:     "mapmyride-sync [flags] share [flags] <id>",
+		ShortHelp: "write a self-contained HTML page for a workout, for any static host",
+		FlagSet:   fs,
+		Exec: func(args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			id, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("parsing workout id %q: %w", args[0], err)
+			}
+			loc, err := cfg.location()
+			if err != nil {
+				return err
+			}
+			db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+			if err != nil {
+				return err
+			}
+
+			name := *out
+			if name == "" {
+				name = "workout-" + args[0] + ".html"
+			}
+			f, err := os.Create(name)
+			if err != nil {
+				return err
+			}
+			if err := db.sharePage(ctx, f, id, cfg.privacyZones, loc, cfg.units, cfg.locale.get()); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		},
+	}
+}
+
+type sharePageData struct {
+	Name     string
+	Kind     string
+	Date     string
+	Note     string
+	Stats    []shareStat
+	MapPath  string
+	Profile  string
+	MinElev  float64
+	MaxElev  float64
+	ElevUnit string
+}
+
+type shareStat struct {
+	Label string
+	Value string
+}
+
+// sharePage writes a single HTML page for workout id with its stats,
+// route and elevation profile, needing nothing beyond the file itself.
+// Positions inside zones, and a random margin beyond them and from each
+// end of the track, are left out of the route and profile, so the page
+// doesn't show where rides start or end near home. Dates and numbers are
+// formatted for l.
+func (d *DB) sharePage(ctx context.Context, w io.Writer, id int, zones privacyZones, loc *time.Location, u units, l *locale) error {
+	wk, err := d.store.LoadWorkout(ctx, id)
+	if err != nil {
+		return err
+	}
+	note, err := d.store.Note(ctx, id)
+	if err != nil {
+		return err
+	}
+	segments := zones.split(wk.Positions, randomMargin())
+	var positions []mapmyride.WorkoutPosition
+	for _, seg := range segments {
+		positions = append(positions, seg...)
+	}
+
+	data := sharePageData{
+		Name:     wk.Name,
+		Kind:     wk.Kind,
+		Date:     l.formatDate(wk.StartedAt.In(loc), l.dateTime),
+		Note:     note,
+		MapPath:  svgSegmentsPath(segments, 100),
+		ElevUnit: u.elevationUnit(),
+	}
+
+	// Duration is the time spent moving.
+	data.Stats = append(data.Stats,
+		shareStat{"Distance", l.number(u.distance(wk.Distance), 2) + " " + u.distanceUnit()},
+		shareStat{"Moving time", wk.Duration.String()},
+	)
+	if paused := wk.PausedTime(); paused > 0 {
+		data.Stats = append(data.Stats, shareStat{"Elapsed time", (wk.Duration + paused).String()})
+	}
+	if wk.Duration > 0 && wk.Distance > 0 {
+		data.Stats = append(data.Stats, shareStat{"Average speed", l.number(u.speed(wk.Distance/wk.Duration.Seconds()), 1) + " " + u.speedUnit()})
+	}
+	if max := wk.CorrectedMaxSpeed(); max > 0 {
+		data.Stats = append(data.Stats, shareStat{"Max speed", l.number(u.speed(max), 1) + " " + u.speedUnit()})
+	}
+	if wk.Gain > 0 {
+		data.Stats = append(data.Stats, shareStat{"Climbing", l.number(u.elevation(wk.Gain), 0) + " " + u.elevationUnit()})
+	}
+	if hr := wk.AverageHeartRate(); hr > 0 {
+		data.Stats = append(data.Stats, shareStat{"Average heart rate", l.number(hr, 0) + " bpm"})
+	}
+	if wk.Kcal > 0 {
+		data.Stats = append(data.Stats, shareStat{"Energy", l.number(float64(wk.Kcal), 0) + " kcal"})
+	}
+
+	if len(positions) > 1 {
+		data.Profile = elevationProfilePath(positions, 600, 120)
+		minEl, maxEl := positions[0].Elevation, positions[0].Elevation
+		for _, p := range positions {
+			minEl, maxEl = math.Min(minEl, p.Elevation), math.Max(maxEl, p.Elevation)
+		}
+		data.MinElev, data.MaxElev = u.elevation(minEl), u.elevation(maxEl)
+	}
+
+	t, err := sharePageTemplate.Clone()
+	if err != nil {
+		return err
+	}
+	return t.Funcs(reportFuncs(l)).Execute(w, data)
+}
+
+// elevationProfilePath returns SVG path data for a filled profile of ps'
+// elevations over elapsed time, scaled to fit a width by height box.
+func elevationProfilePath(ps []mapmyride.WorkoutPosition, width, height float64) string {
+	minEl, maxEl := ps[0].Elevation, ps[0].Elevation
+	for _, p := range ps {
+		minEl, maxEl = math.Min(minEl, p.Elevation), math.Max(maxEl, p.Elevation)
+	}
+	span := ps[len(ps)-1].Elapsed.Seconds() - ps[0].Elapsed.Seconds()
+	if span <= 0 {
+		return ""
+	}
+	// Keep flat workouts from filling the whole box with noise.
+	elSpan := math.Max(maxEl-minEl, 10)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "M0 %.1f ", height)
+	for _, p := range ps {
+		x := (p.Elapsed.Seconds() - ps[0].Elapsed.Seconds()) / span * width
+		y := height - (p.Elevation-minEl)/elSpan*height
+		fmt.Fprintf(&b, "L%.1f %.1f ", x, y)
+	}
+	fmt.Fprintf(&b, "L%.1f %.1f Z", width, height)
+	return b.String()
+}
+
+var sharePageTemplate = template.Must(template.New("share").Funcs(reportFuncs(locales["en"])).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}}</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 2em auto; padding: 0 1em; color: #222; }
+.stats { display: flex; flex-wrap: wrap; gap: 1.5em; }
+.value { font-size: 1.5em; font-weight: bold; }
+.map { background: #f4f4f4; width: 100%; }
+.map path { fill: none; stroke: #d33; stroke-width: 0.8; }
+.profile { width: 100%; }
+.profile path { fill: #d33; fill-opacity: 0.3; stroke: #d33; stroke-width: 1; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<p>{{.Kind}}, {{.Date}}</p>
+{{with .Note}}<p>{{.}}</p>{{end}}
+<div class="stats">
+{{range .Stats}}<div><div class="value">{{.Value}}</div>{{.Label}}</div>
+{{end}}</div>
+{{if .MapPath}}<h2>Route</h2>
+<svg class="map" viewBox="0 0 100 100"><path d="{{.MapPath}}"/></svg>{{end}}
+{{if .Profile}}<h2>Elevation</h2>
+<svg class="profile" viewBox="0 0 600 120" preserveAspectRatio="none"><path d="{{.Profile}}"/></svg>
+<p>{{num .MinElev 0}} {{.ElevUnit}} to {{num .MaxElev 0}} {{.ElevUnit}}</p>{{end}}
+</body>
+</html>
+`))
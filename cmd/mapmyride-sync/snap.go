@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danp/mapmyride"
+	"github.com/peterbourgon/ff/ffcli"
+)
+
+// osrmMaxPoints is how many positions are sent to OSRM's match service at
+// once, its default limit.
+const osrmMaxPoints = 100
+
+func newSnapCommand(ctx context.Context, cfg *config) *ffcli.Command {
+	fs := flag.NewFlagSet("mapmyride-sync snap", flag.ExitOnError)
+	service := fs.String("service", "osrm", "map matching service: osrm or valhalla")
+	serviceURL := fs.String("url", "http://localhost:5000", "base URL of the map matching service")
+	profile := fs.String("profile", "", "OSRM profile or Valhalla costing to match with (default bike for OSRM, bicycle for Valhalla)")
+	all := fs.Bool("all", false, "snap workouts again even if they already have been, if no ids are given")
+
+	return &ffcli.Command{
+		Name:      "snap",
+		Usage:     "mapmyride-sync [flags] snap [flags] [<id>...]",
+		ShortHelp: "snap workout positions to roads with an OSRM or Valhalla server, all not yet snapped if no ids are given, for export -snapped",
+		FlagSet:   fs,
+		Exec: func(args []string) error {
+			match, ok := snapServices[*service]
+			if !ok {
+				return fmt.Errorf("unknown service %q, want osrm or valhalla", *service)
+			}
+			if *profile == "" {
+				*profile = snapProfiles[*service]
+			}
+			var ids []int
+			for _, a := range args {
+				id, err := strconv.Atoi(a)
+				if err != nil {
+					return fmt.Errorf("parsing workout id %q: %w", a, err)
+				}
+				ids = append(ids, id)
+			}
+			db, err := newDB(cfg.databaseFile, cfg.dbOptions()...)
+			if err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				ids, err = db.queryIDs(ctx, "select id from workouts where has_positions and ($1 = '' or user_name=$1) and ($2 or id not in (select workout_id from workout_snapped_positions)) order by started_at", cfg.username, *all)
+				if err != nil {
+					return err
+				}
+			}
+			for _, id := range ids {
+				wk, err := db.store.LoadWorkout(ctx, id)
+				if err != nil {
+					return err
+				}
+				snapped, err := match(ctx, strings.TrimSuffix(*serviceURL, "/"), *profile, wk)
+				if err != nil {
+					return fmt.Errorf("snapping workout %d: %w", id, err)
+				}
+				if err := db.store.SetSnappedPositions(ctx, id, snapped); err != nil {
+					return err
+				}
+			}
+			log.Printf("snapped %d workouts", len(ids))
+			return nil
+		},
+	}
+}
+
+// snapServices map-match a workout's positions to roads with the service
+// at a base URL, by name. They return a position for each of the
+// workout's, keeping those the service couldn't match as they were.
+var snapServices = map[string]func(ctx context.Context, baseURL, profile string, w mapmyride.Workout) ([]mapmyride.WorkoutPosition, error){
+	"osrm":     snapOSRM,
+	"valhalla": snapValhalla,
+}
+
+// snapProfiles are the profiles matched with for cycling by service name.
+var snapProfiles = map[string]string{
+	"osrm":     "bike",
+	"valhalla": "bicycle",
+}
+
+// snapOSRM matches w's positions with OSRM's match service, a chunk of
+// osrmMaxPoints at a time.
+func snapOSRM(ctx context.Context, baseURL, profile string, w mapmyride.Workout) ([]mapmyride.WorkoutPosition, error) {
+	out := append([]mapmyride.WorkoutPosition(nil), w.Positions...)
+	for i := 0; i < len(out); i += osrmMaxPoints {
+		j := i + osrmMaxPoints
+		if j > len(out) {
+			j = len(out)
+		}
+		chunk := out[i:j]
+		if len(chunk) < 2 {
+			break
+		}
+
+		coords := make([]string, len(chunk))
+		timestamps := make([]string, len(chunk))
+		for k, p := range chunk {
+			coords[k] = strconv.FormatFloat(p.Lng, 'f', -1, 64) + "," + strconv.FormatFloat(p.Lat, 'f', -1, 64)
+			timestamps[k] = strconv.FormatInt(w.StartedAt.Add(p.Elapsed).Unix(), 10)
+		}
+		u := baseURL + "/match/v1/" + profile + "/" + strings.Join(coords, ";") + "?overview=false&timestamps=" + strings.Join(timestamps, ";")
+
+		var resp struct {
+			Code        string
+			Message     string
+			Tracepoints []*struct {
+				Location [2]float64 // lng, lat
+			}
+		}
+		if err := serviceRequest(ctx, "GET", u, nil, &resp); err != nil {
+			return nil, err
+		}
+		if resp.Code != "Ok" {
+			return nil, fmt.Errorf("osrm: %s: %s", resp.Code, resp.Message)
+		}
+		if len(resp.Tracepoints) != len(chunk) {
+			return nil, fmt.Errorf("osrm: got %d matched points for %d positions", len(resp.Tracepoints), len(chunk))
+		}
+		for k, tp := range resp.Tracepoints {
+			if tp != nil {
+				chunk[k].Lng, chunk[k].Lat = tp.Location[0], tp.Location[1]
+			}
+		}
+	}
+	return out, nil
+}
+
+// snapValhalla matches w's positions with Valhalla's trace_attributes
+// service.
+func snapValhalla(ctx context.Context, baseURL, costing string, w mapmyride.Workout) ([]mapmyride.WorkoutPosition, error) {
+	type point struct {
+		Lat  float64 `json:"lat"`
+		Lon  float64 `json:"lon"`
+		Time int64   `json:"time"`
+	}
+	req := struct {
+		Shape      []point `json:"shape"`
+		Costing    string  `json:"costing"`
+		ShapeMatch string  `json:"shape_match"`
+		Filters    struct {
+			Attributes []string `json:"attributes"`
+			Action     string   `json:"action"`
+		} `json:"filters"`
+	}{Costing: costing, ShapeMatch: "map_snap"}
+	req.Filters.Attributes = []string{"matched.point", "matched.type"}
+	req.Filters.Action = "include"
+	for _, p := range w.Positions {
+		req.Shape = append(req.Shape, point{Lat: p.Lat, Lon: p.Lng, Time: w.StartedAt.Add(p.Elapsed).Unix()})
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Error         string `json:"error"`
+		MatchedPoints []struct {
+			Lat  float64 `json:"lat"`
+			Lon  float64 `json:"lon"`
+			Type string  `json:"type"`
+		} `json:"matched_points"`
+	}
+	if err := serviceRequest(ctx, "POST", baseURL+"/trace_attributes", body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("valhalla: %s", resp.Error)
+	}
+	if len(resp.MatchedPoints) != len(w.Positions) {
+		return nil, fmt.Errorf("valhalla: got %d matched points for %d positions", len(resp.MatchedPoints), len(w.Positions))
+	}
+
+	out := append([]mapmyride.WorkoutPosition(nil), w.Positions...)
+	for i, mp := range resp.MatchedPoints {
+		if mp.Type != "unmatched" {
+			out[i].Lat, out[i].Lng = mp.Lat, mp.Lon
+		}
+	}
+	return out, nil
+}
+
+// serviceRequest makes a request to a JSON web service, such as a map
+// matching server, and decodes its response into v. Error responses are
+// decoded too, since the services used describe what went wrong in them.
+func serviceRequest(ctx context.Context, method, u string, body []byte, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("User-Agent", "mapmyride-sync")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decoding response with status %d: %w", resp.StatusCode, err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/peterbourgon/ff/ffcli"
+)
+
+func newStarCommand(ctx context.Context, cfg *config) *ffcli.Command {
+	fs := flag.NewFlagSet("mapmyride-sync star", flag.ExitOnError)
+	remove := fs.Bool("remove", false, "unstar the workouts instead")
+
+	return &ffcli.Command{
+		Name:      "star",
+		Usage:     "mapmyride-sync [flags] star [flags] [<id>...]",
+		ShortHelp: "star workouts as favorites, or list the starred workouts if no ids are given",
+		FlagSet:   fs,
+		Exec: func(args []string) error {
+			var ids []int
+			for _, a := range args {
+				id, err := strconv.Atoi(a)
+				if err != nil {
+					return fmt.Errorf("parsing workout id %q: %w", a, err)
+				}
+				ids = append(ids, id)
+			}
+
+			if len(ids) == 0 {
+				if *remove {
+					return flag.ErrHelp
+				}
+				loc, err := cfg.location()
+				if err != nil {
+					return err
+				}
+				db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+				if err != nil {
+					return err
+				}
+				return db.listStarred(ctx, os.Stdout, cfg.username, loc, cfg.units)
+			}
+
+			db, err := newDB(cfg.databaseFile, cfg.dbOptions()...)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if err := db.store.SetStarred(ctx, id, !*remove); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// listStarred writes a line for each starred workout of userName, or all
+// users if it's empty, oldest first.
+func (d *DB) listStarred(ctx context.Context, w io.Writer, userName string, loc *time.Location, u units) error {
+	rows, err := d.db.QueryContext(
+		ctx,
+		"select id, name, normalized_kind, started_at, coalesce(distance_m, 0), notes from workouts where starred and ($1 = '' or user_name=$1) order by started_at",
+		userName,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tID\tKIND\tDISTANCE\tNAME\tNOTE")
+	for rows.Next() {
+		var (
+			id         int
+			name, kind string
+			startedAt  time.Time
+			distance   float64
+			note       sql.NullString
+		)
+		if err := rows.Scan(&id, &name, &kind, &startedAt, &distance, &note); err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%.1f %s\t%s\t%s\n", startedAt.In(loc).Format("2006-01-02"), id, kind, u.distance(distance), u.distanceUnit(), name, note.String)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,830 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danp/mapmyride"
+	"github.com/peterbourgon/ff/ffcli"
+)
+
+func newStatsCommand(ctx context.Context, cfg *config) *ffcli.Command {
+	planFS := flag.NewFlagSet("mapmyride-sync stats plan", flag.ExitOnError)
+	planWeeks := planFS.Int("weeks", 8, "number of weeks to compare, ending with the current week")
+
+	curvesFS := flag.NewFlagSet("mapmyride-sync stats curves", flag.ExitOnError)
+	curvesID := curvesFS.Int("id", 0, "workout to report on (default all-time bests)")
+
+	climbsFS := flag.NewFlagSet("mapmyride-sync stats climbs", flag.ExitOnError)
+	climbsTop := climbsFS.Int("top", 10, "number of climbs to list")
+	climbsStarred := climbsFS.Bool("starred", false, "only include workouts starred with star")
+
+	zonesFS := flag.NewFlagSet("mapmyride-sync stats zones", flag.ExitOnError)
+	zonesWeeks := zonesFS.Int("weeks", 4, "number of weeks to include, ending with the current week")
+
+	intensityFS := flag.NewFlagSet("mapmyride-sync stats intensity", flag.ExitOnError)
+	intensityWeeks := intensityFS.Int("weeks", 4, "number of weeks to include, ending with the current week")
+
+	energyFS := flag.NewFlagSet("mapmyride-sync stats energy", flag.ExitOnError)
+	energyWeeks := energyFS.Int("weeks", 4, "number of weeks to include, ending with the current week")
+
+	qualityFS := flag.NewFlagSet("mapmyride-sync stats quality", flag.ExitOnError)
+	qualityWeeks := qualityFS.Int("weeks", 1, "number of weeks to include, ending with the current week")
+
+	placesFS := flag.NewFlagSet("mapmyride-sync stats places", flag.ExitOnError)
+	placesBy := placesFS.String("by", "country", "what to group by: country, region or city")
+	placesYear := placesFS.Int("year", 0, "year to include (default all)")
+
+	yoyFS := flag.NewFlagSet("mapmyride-sync stats yoy", flag.ExitOnError)
+	yoyPeriod := yoyFS.String("period", "ytd", "period to compare: ytd (year to date) or mtd (month to date)")
+	yoyYears := yoyFS.Int("years", 2, "number of previous years to compare against")
+
+	return &ffcli.Command{
+		Name:      "stats",
+		Usage:     "mapmyride-sync [flags] stats <subcommand>",
+		ShortHelp: "report statistics from synced workouts",
+		Subcommands: []*ffcli.Command{
+			{
+				Name:      "plan",
+				Usage:     "mapmyride-sync [flags] stats plan [flags]",
+				ShortHelp: "compare the weekly plan from -plan with actual workouts",
+				FlagSet:   planFS,
+				Exec: func([]string) error {
+					if len(cfg.plan) == 0 {
+						return fmt.Errorf("no weekly plan, set one with -plan")
+					}
+					loc, err := cfg.location()
+					if err != nil {
+						return err
+					}
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					return db.statsPlan(ctx, os.Stdout, cfg.username, cfg.plan, *planWeeks, time.Now().In(loc), cfg.units)
+				},
+			},
+			{
+				Name:      "curves",
+				Usage:     "mapmyride-sync [flags] stats curves [flags]",
+				ShortHelp: "show best average speeds over 1s to 60m",
+				FlagSet:   curvesFS,
+				Exec: func([]string) error {
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					return db.statsCurves(ctx, os.Stdout, cfg.username, *curvesID, cfg.units)
+				},
+			},
+			{
+				Name:      "climbs",
+				Usage:     "mapmyride-sync [flags] stats climbs [flags]",
+				ShortHelp: "list the climbs with the highest VAM",
+				FlagSet:   climbsFS,
+				Exec: func([]string) error {
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					return db.statsClimbs(ctx, os.Stdout, cfg.username, *climbsTop, *climbsStarred, cfg.units)
+				},
+			},
+			{
+				Name:      "yoy",
+				Usage:     "mapmyride-sync [flags] stats yoy [flags]",
+				ShortHelp: "compare this period with the same period in previous years",
+				FlagSet:   yoyFS,
+				Exec: func([]string) error {
+					loc, err := cfg.location()
+					if err != nil {
+						return err
+					}
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					return db.statsYOY(ctx, os.Stdout, cfg.username, *yoyPeriod, *yoyYears, time.Now().In(loc), cfg.units)
+				},
+			},
+			{
+				Name:      "zones",
+				Usage:     "mapmyride-sync [flags] stats zones [flags]",
+				ShortHelp: "show time spent in each heart rate zone from -hr-zones",
+				FlagSet:   zonesFS,
+				Exec: func([]string) error {
+					loc, err := cfg.location()
+					if err != nil {
+						return err
+					}
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					return db.statsZones(ctx, os.Stdout, cfg.username, *zonesWeeks, time.Now().In(loc))
+				},
+			},
+			{
+				Name:      "intensity",
+				Usage:     "mapmyride-sync [flags] stats intensity [flags]",
+				ShortHelp: "show intensity and effort against the FTP or threshold heart rate from ftp add",
+				FlagSet:   intensityFS,
+				Exec: func([]string) error {
+					loc, err := cfg.location()
+					if err != nil {
+						return err
+					}
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					return db.statsIntensity(ctx, os.Stdout, cfg.username, *intensityWeeks, time.Now().In(loc))
+				},
+			},
+			{
+				Name:      "energy",
+				Usage:     "mapmyride-sync [flags] stats energy [flags]",
+				ShortHelp: "show calories burned per kilogram of body weight from weight add",
+				FlagSet:   energyFS,
+				Exec: func([]string) error {
+					loc, err := cfg.location()
+					if err != nil {
+						return err
+					}
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					return db.statsEnergy(ctx, os.Stdout, cfg.username, *energyWeeks, time.Now().In(loc), cfg.units)
+				},
+			},
+			{
+				Name:      "quality",
+				Usage:     "mapmyride-sync [flags] stats quality [flags]",
+				ShortHelp: "flag workouts with suspicious data that may need fixing on mapmyride",
+				FlagSet:   qualityFS,
+				Exec: func([]string) error {
+					loc, err := cfg.location()
+					if err != nil {
+						return err
+					}
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					return db.statsQuality(ctx, os.Stdout, cfg.username, *qualityWeeks, time.Now().In(loc), cfg.units)
+				},
+			},
+			{
+				Name:      "places",
+				Usage:     "mapmyride-sync [flags] stats places [flags]",
+				ShortHelp: "total workouts by the country, region or city they started in, from geocode",
+				FlagSet:   placesFS,
+				Exec: func([]string) error {
+					loc, err := cfg.location()
+					if err != nil {
+						return err
+					}
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					return db.statsPlaces(ctx, os.Stdout, cfg.username, *placesBy, *placesYear, loc, cfg.units)
+				},
+			},
+		},
+		Exec: func([]string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+// workoutSummary is the subset of a stored workout used by most stats.
+type workoutSummary struct {
+	ID        int
+	UserName  string
+	Name      string
+	Kind      string // normalized
+	StartedAt time.Time
+	Duration  time.Duration
+	Distance  float64 // meters
+	Gain      float64 // meters
+}
+
+// workoutSummaries returns summaries of workouts for userName, or all
+// users if it's empty, that started in [begin, end).
+func (d *DB) workoutSummaries(ctx context.Context, userName string, begin, end time.Time) ([]workoutSummary, error) {
+	rows, err := d.db.QueryContext(
+		ctx,
+		"select id, user_name, name, normalized_kind, started_at, coalesce(duration_s, 0), coalesce(distance_m, 0), coalesce(gain_m, 0) from workouts where ($1 = '' or user_name=$1) order by started_at",
+		userName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []workoutSummary
+	for rows.Next() {
+		var (
+			ws        workoutSummary
+			durationS int
+		)
+		if err := rows.Scan(&ws.ID, &ws.UserName, &ws.Name, &ws.Kind, &ws.StartedAt, &durationS, &ws.Distance, &ws.Gain); err != nil {
+			return nil, err
+		}
+		if ws.StartedAt.Before(begin) || !ws.StartedAt.Before(end) {
+			continue
+		}
+		ws.Duration = time.Duration(durationS) * time.Second
+		out = append(out, ws)
+	}
+	return out, rows.Err()
+}
+
+// planTarget is a weekly target for one kind of workout. A zero duration
+// or distance means there is no target for it.
+type planTarget struct {
+	kind     string
+	duration time.Duration
+	distance float64 // meters
+}
+
+// weeklyPlan is a flag.Value collecting planTargets.
+type weeklyPlan []planTarget
+
+func (p *weeklyPlan) String() string {
+	if p == nil {
+		return ""
+	}
+	var parts []string
+	for _, t := range *p {
+		var dur, dist string
+		if t.duration > 0 {
+			dur = t.duration.String()
+		}
+		if t.distance > 0 {
+			dist = strconv.FormatFloat(t.distance/1000, 'f', -1, 64) + "km"
+		}
+		parts = append(parts, t.kind+":"+dur+":"+dist)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set parses a target in the form kind:duration[:distance], where
+// duration is a Go duration and distance is in kilometers with an
+// optional km suffix, or in miles with a mi suffix. Either duration or
+// distance may be empty.
+func (p *weeklyPlan) Set(s string) error {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return fmt.Errorf("plan target %q is not kind:duration[:distance]", s)
+	}
+
+	t := planTarget{kind: parts[0]}
+	if parts[1] != "" {
+		d, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return fmt.Errorf("plan target %q: %w", s, err)
+		}
+		t.duration = d
+	}
+	if len(parts) == 3 && parts[2] != "" {
+		dist, perUnit := parts[2], 1000.0
+		if strings.HasSuffix(dist, "mi") {
+			dist, perUnit = strings.TrimSuffix(dist, "mi"), metersPerMile
+		}
+		v, err := strconv.ParseFloat(strings.TrimSuffix(dist, "km"), 64)
+		if err != nil {
+			return fmt.Errorf("plan target %q: %w", s, err)
+		}
+		t.distance = v * perUnit
+	}
+	if t.duration == 0 && t.distance == 0 {
+		return fmt.Errorf("plan target %q has no duration or distance", s)
+	}
+
+	*p = append(*p, t)
+	return nil
+}
+
+// weekStart returns the start of the Monday-based week containing t, in
+// t's location.
+func weekStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// statsPlan compares plan with actual workouts for the given number of
+// weeks ending with the week containing now.
+func (d *DB) statsPlan(ctx context.Context, w io.Writer, userName string, plan weeklyPlan, weeks int, now time.Time, u units) error {
+	if weeks < 1 {
+		return fmt.Errorf("need at least one week")
+	}
+
+	first := weekStart(now).AddDate(0, 0, -7*(weeks-1))
+	summaries, err := d.workoutSummaries(ctx, userName, first, weekStart(now).AddDate(0, 0, 7))
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(tw, "WEEK\tKIND\tHOURS\tTARGET\t%s\tTARGET\tCOMPLIANCE\n", strings.ToUpper(u.distanceUnit()))
+
+	var total float64
+	for i := 0; i < weeks; i++ {
+		begin := first.AddDate(0, 0, 7*i)
+		end := begin.AddDate(0, 0, 7)
+
+		for _, t := range plan {
+			var (
+				dur  time.Duration
+				dist float64
+			)
+			for _, s := range summaries {
+				if s.Kind != t.kind || s.StartedAt.Before(begin) || !s.StartedAt.Before(end) {
+					continue
+				}
+				dur += s.Duration
+				dist += s.Distance
+			}
+
+			c := t.compliance(dur, dist)
+			total += c
+
+			fmt.Fprintf(tw, "%s\t%s\t%.1f\t%s\t%.1f\t%s\t%.0f%%\n",
+				begin.Format("2006-01-02"), t.kind,
+				dur.Hours(), formatTarget(t.duration.Hours()),
+				u.distance(dist), formatTarget(u.distance(t.distance)),
+				c*100)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nrolling compliance over %d weeks: %.0f%%\n", weeks, total/float64(weeks*len(plan))*100)
+	return nil
+}
+
+// compliance returns how much of t was achieved, from 0 to 1, averaging
+// over the duration and distance targets that are set.
+func (t planTarget) compliance(dur time.Duration, dist float64) float64 {
+	var sum, n float64
+	if t.duration > 0 {
+		sum += minFloat(dur.Hours()/t.duration.Hours(), 1)
+		n++
+	}
+	if t.distance > 0 {
+		sum += minFloat(dist/t.distance, 1)
+		n++
+	}
+	return sum / n
+}
+
+func formatTarget(v float64) string {
+	if v == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// statsCurves prints the speed curve for workout id or, if id is zero,
+// the best of all workouts for userName at each duration.
+func (d *DB) statsCurves(ctx context.Context, w io.Writer, userName string, id int, u units) error {
+	ids := []int{id}
+	if id == 0 {
+		var err error
+		ids, err = d.queryIDs(ctx, "select id from workouts where has_speeds and ($1 = '' or user_name=$1)", userName)
+		if err != nil {
+			return err
+		}
+	}
+
+	type best struct {
+		mapmyride.CurvePoint
+		workoutID int
+		startedAt time.Time
+	}
+	bests := make(map[time.Duration]best)
+	for _, id := range ids {
+		wk, err := d.store.LoadWorkout(ctx, id)
+		if err != nil {
+			return fmt.Errorf("loading workout %d: %w", id, err)
+		}
+		// Smooth speeds so a GPS jump can't set a best.
+		wk.Speeds = wk.SmoothedSpeeds()
+		for _, cp := range wk.SpeedCurve(mapmyride.DefaultCurveDurations...) {
+			if b, ok := bests[cp.Duration]; !ok || cp.Value > b.Value {
+				bests[cp.Duration] = best{CurvePoint: cp, workoutID: id, startedAt: wk.StartedAt}
+			}
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(tw, "DURATION\t%s\tWORKOUT\tSTARTED AT\n", strings.ToUpper(u.speedUnit()))
+	for _, dur := range mapmyride.DefaultCurveDurations {
+		b, ok := bests[dur]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%.1f\t%d\t%s\n", dur, u.speed(b.Value), b.workoutID, b.startedAt.Format("2006-01-02"))
+	}
+	return tw.Flush()
+}
+
+// statsClimbs prints a leaderboard of the top climbs by VAM, only from
+// starred workouts if starred is set.
+func (d *DB) statsClimbs(ctx context.Context, w io.Writer, userName string, top int, starred bool, u units) error {
+	rows, err := d.db.QueryContext(
+		ctx,
+		"select c.workout_id, w.name, w.started_at, c.gain_meters, c.end_elapsed_seconds - c.start_elapsed_seconds, c.vam from workout_climbs c join workouts w on w.id = c.workout_id where ($1 = '' or w.user_name=$1) and (not $3 or w.starred) order by c.vam desc limit $2",
+		userName, top, starred,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "RANK\tVAM\tGAIN\tTIME\tWORKOUT\tSTARTED AT\tNAME")
+	for rank := 1; rows.Next(); rank++ {
+		var (
+			id              int
+			name            string
+			startedAt       time.Time
+			gain, secs, vam float64
+		)
+		if err := rows.Scan(&id, &name, &startedAt, &gain, &secs, &vam); err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%d\t%.0f %s/h\t%.0f %s\t%s\t%d\t%s\t%s\n", rank, u.elevation(vam), u.elevationUnit(), u.elevation(gain), u.elevationUnit(), time.Duration(secs*float64(time.Second)).Round(time.Second), id, startedAt.Format("2006-01-02"), name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return tw.Flush()
+}
+
+// yearsBefore returns the same time of day and day of the year n years
+// before t. Unlike AddDate, it keeps to the same month, so Feb 29 becomes
+// Feb 28 rather than Mar 1.
+func yearsBefore(t time.Time, n int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y-n, m, 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); d > last {
+		d = last
+	}
+	return first.AddDate(0, 0, d-1)
+}
+
+// statsYOY compares totals by kind for the period up to now with the
+// same period in each of the previous years.
+func (d *DB) statsYOY(ctx context.Context, w io.Writer, userName, period string, years int, now time.Time, u units) error {
+	periodStart := func(t time.Time) time.Time {
+		if period == "mtd" {
+			return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		}
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+	}
+	if period != "ytd" && period != "mtd" {
+		return fmt.Errorf("unknown period %q, want ytd or mtd", period)
+	}
+
+	type totals struct {
+		workouts int
+		distance float64
+		duration time.Duration
+		gain     float64
+	}
+	// kind -> years ago -> totals
+	byKind := make(map[string][]totals)
+
+	for ago := 0; ago <= years; ago++ {
+		end := yearsBefore(now, ago)
+		summaries, err := d.workoutSummaries(ctx, userName, periodStart(end), end)
+		if err != nil {
+			return err
+		}
+		for _, s := range summaries {
+			if byKind[s.Kind] == nil {
+				byKind[s.Kind] = make([]totals, years+1)
+			}
+			t := &byKind[s.Kind][ago]
+			t.workouts++
+			t.distance += s.Distance
+			t.duration += s.Duration
+			t.gain += s.Gain
+		}
+	}
+
+	kinds := make([]string, 0, len(byKind))
+	for k := range byKind {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	dist, elev := strings.ToUpper(u.distanceUnit()), strings.ToUpper(u.elevationUnit())
+	fmt.Fprintf(tw, "KIND\tPERIOD\tWORKOUTS\t%s\tHOURS\tGAIN %s\t%s CHANGE\n", dist, elev, dist)
+	for _, k := range kinds {
+		for ago, t := range byKind[k] {
+			end := yearsBefore(now, ago)
+			change := "-"
+			if ago < years {
+				if prev := byKind[k][ago+1]; prev.distance > 0 {
+					change = fmt.Sprintf("%+.0f%%", (t.distance/prev.distance-1)*100)
+				}
+			}
+			fmt.Fprintf(tw, "%s\t%s to %s\t%d\t%.1f\t%.1f\t%.0f\t%s\n",
+				k, periodStart(end).Format("2006-01-02"), end.Format("01-02"),
+				t.workouts, u.distance(t.distance), t.duration.Hours(), u.elevation(t.gain), change)
+		}
+	}
+	return tw.Flush()
+}
+
+// queryIDs returns the integer first column of each row returned by query.
+func (d *DB) queryIDs(ctx context.Context, query string, args ...interface{}) ([]int, error) {
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// zonesFlag is a flag.Value holding zone boundaries, such as
+// 120,140,155,170.
+type zonesFlag struct {
+	mapmyride.Zones
+}
+
+func (z *zonesFlag) Set(s string) error {
+	zs, err := mapmyride.ParseZones(s)
+	if err != nil {
+		return err
+	}
+	z.Zones = zs
+	return nil
+}
+
+// kindsFlag is a flag.Value collecting kind normalizations in the form
+// kind=normalized, such as bike=ride.
+type kindsFlag map[string]string
+
+func (k *kindsFlag) String() string {
+	if k == nil {
+		return ""
+	}
+	parts := make([]string, 0, len(*k))
+	for from, to := range *k {
+		parts = append(parts, from+"="+to)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (k *kindsFlag) Set(s string) error {
+	from, to, ok := strings.Cut(s, "=")
+	if !ok || from == "" || to == "" {
+		return fmt.Errorf("kind normalization %q is not kind=normalized", s)
+	}
+	if *k == nil {
+		*k = make(kindsFlag)
+	}
+	(*k)[from] = to
+	return nil
+}
+
+// statsZones prints the time userName spent in each heart rate zone over
+// the given number of weeks ending with the week containing now.
+func (d *DB) statsZones(ctx context.Context, w io.Writer, userName string, weeks int, now time.Time) error {
+	if weeks < 1 {
+		return fmt.Errorf("need at least one week")
+	}
+	zones := d.store.HeartRateZones()
+	if len(zones) == 0 {
+		return fmt.Errorf("no heart rate zones, set them with -hr-zones and run a sync")
+	}
+
+	begin := weekStart(now).AddDate(0, 0, -7*(weeks-1))
+	rows, err := d.db.QueryContext(
+		ctx,
+		"select w.started_at, z.zone, z.seconds from workout_zone_times z join workouts w on w.id = z.workout_id where z.kind = 'heart_rate' and ($1 = '' or w.user_name=$1)",
+		userName,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	times := make([]float64, len(zones)+1)
+	var total float64
+	for rows.Next() {
+		var (
+			startedAt time.Time
+			zone      int
+			seconds   float64
+		)
+		if err := rows.Scan(&startedAt, &zone, &seconds); err != nil {
+			return err
+		}
+		if startedAt.Before(begin) || zone < 1 || zone > len(times) {
+			continue
+		}
+		times[zone-1] += seconds
+		total += seconds
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "ZONE\tBPM\tTIME\tSHARE")
+	for i, secs := range times {
+		var bpm string
+		switch {
+		case i == 0:
+			bpm = fmt.Sprintf("< %v", zones[0])
+		case i == len(zones):
+			bpm = fmt.Sprintf(">= %v", zones[i-1])
+		default:
+			bpm = fmt.Sprintf("%v-%v", zones[i-1], zones[i])
+		}
+		var share float64
+		if total > 0 {
+			share = secs / total * 100
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%.0f%%\n", i+1, bpm, time.Duration(secs)*time.Second, share)
+	}
+	return tw.Flush()
+}
+
+// statsIntensity prints the intensity and effort of each workout with
+// powers or heart rates over the given number of weeks ending with the
+// week containing now. Intensity is average power over the FTP in effect
+// on the day of each when both are known, else average heart rate over
+// the threshold heart rate.
+func (d *DB) statsIntensity(ctx context.Context, w io.Writer, userName string, weeks int, now time.Time) error {
+	if weeks < 1 {
+		return fmt.Errorf("need at least one week")
+	}
+	ts, err := d.thresholds(ctx)
+	if err != nil {
+		return err
+	}
+	if len(ts[thresholdFTP]) == 0 && len(ts[thresholdHeartRate]) == 0 {
+		return fmt.Errorf("no FTP or threshold heart rate, record one with ftp add")
+	}
+
+	begin := weekStart(now).AddDate(0, 0, -7*(weeks-1))
+	rows, err := d.db.QueryContext(
+		ctx,
+		"select name, started_at, coalesce(duration_s, 0), coalesce(avg_heart_rate, 0), coalesce(avg_watts, 0) from (select *, (select avg(watts) from workout_powers where workout_id=workouts.id) as avg_watts from workouts where ($1 = '' or user_name=$1)) where avg_heart_rate is not null or avg_watts is not null order by started_at",
+		userName,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tNAME\tTIME\tAVG HR\tAVG W\tTHRESHOLD\tIF\tEFFORT")
+	var total float64
+	for rows.Next() {
+		var (
+			name        string
+			startedAt   time.Time
+			durationS   int
+			avgHR, avgW float64
+		)
+		if err := rows.Scan(&name, &startedAt, &durationS, &avgHR, &avgW); err != nil {
+			return err
+		}
+		if startedAt.Before(begin) {
+			continue
+		}
+
+		day := startedAt.In(now.Location()).Format("2006-01-02")
+		dur := time.Duration(durationS) * time.Second
+		var intensity float64
+		thr := "-"
+		if ftp := valueOn(ts[thresholdFTP], day); avgW > 0 && ftp > 0 {
+			intensity = avgW / ftp
+			thr = fmt.Sprintf("%.0f W", ftp)
+		} else if thrHR := valueOn(ts[thresholdHeartRate], day); avgHR > 0 && thrHR > 0 {
+			intensity = avgHR / thrHR
+			thr = fmt.Sprintf("%.0f bpm", thrHR)
+		}
+		if intensity == 0 {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t-\t-\t-\n", day, name, dur, optionalValue(avgHR), optionalValue(avgW))
+			continue
+		}
+		effort := mapmyride.Effort(dur, intensity)
+		total += effort
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%.2f\t%.0f\n", day, name, dur, optionalValue(avgHR), optionalValue(avgW), thr, intensity, effort)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t\t\t\t\t\t%.0f\n", total)
+	return tw.Flush()
+}
+
+// optionalValue formats v rounded to a whole number, or - if it's 0.
+func optionalValue(v float64) string {
+	if v <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f", v)
+}
+
+// statsEnergy prints the calories of each workout with a recorded kcal in
+// the last weeks weeks, alongside the user's weight on that day and the
+// calories per kilogram per hour. The latter is roughly the workout's
+// average MET value. Workouts with powers also show their average watts
+// per kilogram.
+func (d *DB) statsEnergy(ctx context.Context, w io.Writer, userName string, weeks int, now time.Time, u units) error {
+	if weeks < 1 {
+		return fmt.Errorf("need at least one week")
+	}
+	ws, err := d.weights(ctx)
+	if err != nil {
+		return err
+	}
+	if len(ws) == 0 {
+		return fmt.Errorf("no weights, record one with weight add")
+	}
+
+	begin := weekStart(now).AddDate(0, 0, -7*(weeks-1))
+	rows, err := d.db.QueryContext(
+		ctx,
+		"select user_name, name, started_at, coalesce(duration_s, 0), kcal, coalesce((select avg(watts) from workout_powers where workout_id=workouts.id), 0) from workouts where kcal > 0 and ($1 = '' or user_name=$1) order by started_at",
+		userName,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintf(tw, "DATE\tNAME\tTIME\tKCAL\tWEIGHT %s\tKCAL/KG/H\tW/KG\n", strings.ToUpper(u.weightUnit()))
+	for rows.Next() {
+		var (
+			user, name string
+			startedAt  time.Time
+			durationS  int
+			kcal       int
+			avgW       float64
+		)
+		if err := rows.Scan(&user, &name, &startedAt, &durationS, &kcal, &avgW); err != nil {
+			return err
+		}
+		if startedAt.Before(begin) {
+			continue
+		}
+
+		day := startedAt.In(now.Location()).Format("2006-01-02")
+		dur := time.Duration(durationS) * time.Second
+		kg := valueOn(ws[user], day)
+		if kg <= 0 || durationS == 0 {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t-\t-\t-\n", day, name, dur, kcal)
+			continue
+		}
+		wkg := "-"
+		if avgW > 0 {
+			wkg = fmt.Sprintf("%.2f", avgW/kg)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%.1f\t%.1f\t%s\n", day, name, dur, kcal, u.weight(kg), float64(kcal)/kg/dur.Hours(), wkg)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return tw.Flush()
+}
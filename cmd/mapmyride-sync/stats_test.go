@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danp/mapmyride"
+	"github.com/danp/mapmyride/sync"
+)
+
+func TestYearsBefore(t *testing.T) {
+	for _, tc := range []struct {
+		t    time.Time
+		n    int
+		want time.Time
+	}{
+		{time.Date(2023, 7, 4, 9, 30, 0, 0, time.UTC), 1, time.Date(2022, 7, 4, 9, 30, 0, 0, time.UTC)},
+		{time.Date(2024, 2, 29, 15, 4, 5, 0, time.UTC), 1, time.Date(2023, 2, 28, 15, 4, 5, 0, time.UTC)},
+		{time.Date(2024, 2, 29, 15, 4, 5, 0, time.UTC), 4, time.Date(2020, 2, 29, 15, 4, 5, 0, time.UTC)},
+		{time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC), 1, time.Date(2023, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), 0, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+	} {
+		if got := yearsBefore(tc.t, tc.n); !got.Equal(tc.want) {
+			t.Errorf("yearsBefore(%v, %d) = %v, want %v", tc.t, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestStatsIntensityPower(t *testing.T) {
+	ctx := context.Background()
+	db, err := newDB(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2023, 7, 4, 9, 0, 0, 0, time.UTC)
+	for _, w := range []mapmyride.Workout{
+		{
+			ID: 1, Name: "Ride", StartedAt: start, Duration: time.Hour, Kcal: 800,
+			Powers: []mapmyride.WorkoutPower{{Elapsed: 0, Watts: 200}, {Elapsed: time.Second, Watts: 200}},
+		},
+		{
+			ID: 2, Name: "Run", StartedAt: start.AddDate(0, 0, 1), Duration: time.Hour, Kcal: 700,
+			HeartRates: []mapmyride.WorkoutHeartRate{{Elapsed: 0, BeatsPerMinute: 150}, {Elapsed: time.Second, BeatsPerMinute: 150}},
+		},
+	} {
+		if _, err := db.store.Sync(ctx, "u", w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.addThreshold(ctx, thresholdFTP, "2023-01-01", 250); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.addThreshold(ctx, thresholdHeartRate, "2023-01-01", 150); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.addWeight(ctx, "u", "2023-01-01", 80); err != nil {
+		t.Fatal(err)
+	}
+
+	now := start.AddDate(0, 0, 2)
+	var buf bytes.Buffer
+	if err := db.statsIntensity(ctx, &buf, "u", 1, now); err != nil {
+		t.Fatal(err)
+	}
+	want := `DATE        NAME  TIME    AVG HR  AVG W  THRESHOLD  IF    EFFORT
+2023-07-04  Ride  1h0m0s  -       200    250 W      0.80  64
+2023-07-05  Run   1h0m0s  150     -      150 bpm    1.00  100
+TOTAL                                                     164
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got intensity:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	if err := db.statsEnergy(ctx, &buf, "u", 1, now, metric); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "2.50") {
+		t.Errorf("energy output missing W/kg 2.50:\n%s", buf.String())
+	}
+}
+
+func TestWeeklyPlanSet(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    planTarget
+		wantErr bool
+	}{
+		{in: "ride:3h", want: planTarget{kind: "ride", duration: 3 * time.Hour}},
+		{in: "ride:3h:100", want: planTarget{kind: "ride", duration: 3 * time.Hour, distance: 100000}},
+		{in: "ride:3h:100km", want: planTarget{kind: "ride", duration: 3 * time.Hour, distance: 100000}},
+		{in: "run::10mi", want: planTarget{kind: "run", distance: 10 * metersPerMile}},
+		{in: "swim:45m:", want: planTarget{kind: "swim", duration: 45 * time.Minute}},
+		{in: "ride", wantErr: true},
+		{in: ":3h", wantErr: true},
+		{in: "ride:3h:100:x", wantErr: true},
+		{in: "ride:3 hours", wantErr: true},
+		{in: "ride:3h:far", wantErr: true},
+		{in: "ride::", wantErr: true},
+		{in: "ride:0s:0", wantErr: true},
+	} {
+		var p weeklyPlan
+		err := p.Set(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("Set(%q): got error %v, want error %v", tc.in, err, tc.wantErr)
+			continue
+		}
+		if tc.wantErr {
+			if len(p) != 0 {
+				t.Errorf("Set(%q): got plan %v after error, want none", tc.in, p)
+			}
+			continue
+		}
+		if len(p) != 1 || p[0] != tc.want {
+			t.Errorf("Set(%q): got %+v, want %+v", tc.in, p, tc.want)
+		}
+	}
+
+	var p weeklyPlan
+	for _, s := range []string{"ride:3h:100km", "run::10mi"} {
+		if err := p.Set(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := p.String(), "ride:3h0m0s:100km,run::16.09344km"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestPlanTargetCompliance(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		target planTarget
+		dur    time.Duration
+		dist   float64
+		want   float64
+	}{
+		{"duration met", planTarget{duration: 2 * time.Hour}, 2 * time.Hour, 0, 1},
+		{"duration half", planTarget{duration: 2 * time.Hour}, time.Hour, 50000, 0.5},
+		{"duration exceeded", planTarget{duration: 2 * time.Hour}, 5 * time.Hour, 0, 1},
+		{"distance only", planTarget{distance: 100000}, 10 * time.Hour, 25000, 0.25},
+		{"both averaged", planTarget{duration: 2 * time.Hour, distance: 100000}, 2 * time.Hour, 50000, 0.75},
+		{"nothing done", planTarget{duration: 2 * time.Hour, distance: 100000}, 0, 0, 0},
+	} {
+		if got := tc.target.compliance(tc.dur, tc.dist); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestStatsPlan(t *testing.T) {
+	ctx := context.Background()
+	db, err := newDB(sync.MemoryFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.db.Close()
+
+	// The week of Monday, July 3, with a ride either side of it.
+	monday := time.Date(2023, 7, 3, 9, 0, 0, 0, time.UTC)
+	for _, w := range []mapmyride.Workout{
+		{ID: 1, Name: "Before", Kind: "ride", StartedAt: monday.AddDate(0, 0, -1), Duration: time.Hour, Distance: 30000},
+		{ID: 2, Name: "Ride", Kind: "ride", StartedAt: monday, Duration: time.Hour, Distance: 30000},
+		{ID: 3, Name: "Run", Kind: "running", StartedAt: monday.AddDate(0, 0, 1), Duration: 30 * time.Minute, Distance: 5000},
+		{ID: 4, Name: "Long ride", Kind: "ride", StartedAt: monday.AddDate(0, 0, 6), Duration: 90 * time.Minute, Distance: 40000},
+		{ID: 5, Name: "After", Kind: "ride", StartedAt: monday.AddDate(0, 0, 7), Duration: time.Hour, Distance: 30000},
+	} {
+		if _, err := db.store.Sync(ctx, "u", w); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var plan weeklyPlan
+	for _, s := range []string{"ride:3h:100km", "run:1h"} {
+		if err := plan.Set(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := db.statsPlan(ctx, &buf, "u", plan, 1, monday.AddDate(0, 0, 3), metric); err != nil {
+		t.Fatal(err)
+	}
+	// Rides: 2.5/3h and 70/100km average to 77%. Run: 0.5/1h is 50%.
+	want := `WEEK        KIND  HOURS  TARGET  KM    TARGET  COMPLIANCE
+2023-07-03  ride  2.5    3.0     70.0  100.0   77%
+2023-07-03  run   0.5    1.0     5.0   -       50%
+
+rolling compliance over 1 weeks: 63%
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got plan:\n%s\nwant:\n%s", got, want)
+	}
+}
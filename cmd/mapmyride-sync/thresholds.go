@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/peterbourgon/ff/ffcli"
+)
+
+// Threshold kinds stored in the thresholds table.
+const (
+	thresholdFTP       = "ftp"        // watts
+	thresholdHeartRate = "heart_rate" // beats per minute
+)
+
+func newFTPCommand(ctx context.Context, cfg *config) *ffcli.Command {
+	addFS := flag.NewFlagSet("mapmyride-sync ftp add", flag.ExitOnError)
+	addDate := addFS.String("date", "", "day the values take effect, in 2006-01-02 format (default today)")
+	addWatts := addFS.Float64("watts", 0, "functional threshold power in watts")
+	addHR := addFS.Float64("hr", 0, "threshold heart rate in beats per minute")
+
+	return &ffcli.Command{
+		Name:      "ftp",
+		Usage:     "mapmyride-sync [flags] ftp <subcommand>",
+		ShortHelp: "manage the FTP and threshold heart rate history used for intensity",
+		Subcommands: []*ffcli.Command{
+			{
+				Name:      "add",
+				Usage:     "mapmyride-sync [flags] ftp add [-date 2006-01-02] [-watts n] [-hr n]",
+				ShortHelp: "record a new FTP and/or threshold heart rate",
+				FlagSet:   addFS,
+				Exec: func([]string) error {
+					if *addWatts <= 0 && *addHR <= 0 {
+						return fmt.Errorf("need -watts and/or -hr")
+					}
+					loc, err := cfg.location()
+					if err != nil {
+						return err
+					}
+					day := time.Now().In(loc).Format("2006-01-02")
+					if *addDate != "" {
+						if _, err := time.Parse("2006-01-02", *addDate); err != nil {
+							return err
+						}
+						day = *addDate
+					}
+					db, err := newDB(cfg.databaseFile, cfg.dbOptions()...)
+					if err != nil {
+						return err
+					}
+					if *addWatts > 0 {
+						if err := db.addThreshold(ctx, thresholdFTP, day, *addWatts); err != nil {
+							return err
+						}
+					}
+					if *addHR > 0 {
+						if err := db.addThreshold(ctx, thresholdHeartRate, day, *addHR); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "list",
+				Usage:     "mapmyride-sync [flags] ftp list",
+				ShortHelp: "list the FTP and threshold heart rate history",
+				Exec: func([]string) error {
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					return db.listThresholds(ctx, os.Stdout)
+				},
+			},
+		},
+		Exec: func([]string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+// datedValue is a value in effect from a day onward, such as a
+// threshold or a body weight.
+type datedValue struct {
+	effectiveOn string // 2006-01-02
+	value       float64
+}
+
+// addThreshold records value as the threshold of kind from day onward,
+// replacing any value already recorded for that day.
+func (d *DB) addThreshold(ctx context.Context, kind, day string, value float64) error {
+	_, err := d.db.ExecContext(ctx, "insert or replace into thresholds (kind, effective_on, value) values ($1, $2, $3)", kind, day, value)
+	return err
+}
+
+// thresholds returns the recorded thresholds by kind, oldest first.
+func (d *DB) thresholds(ctx context.Context) (map[string][]datedValue, error) {
+	rows, err := d.db.QueryContext(ctx, "select kind, effective_on, value from thresholds order by kind, effective_on")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string][]datedValue)
+	for rows.Next() {
+		var (
+			kind string
+			t    datedValue
+		)
+		if err := rows.Scan(&kind, &t.effectiveOn, &t.value); err != nil {
+			return nil, err
+		}
+		out[kind] = append(out[kind], t)
+	}
+	return out, rows.Err()
+}
+
+// valueOn returns the value from ts in effect on day, or 0 if none
+// was recorded yet. ts must be sorted oldest first.
+func valueOn(ts []datedValue, day string) float64 {
+	i := sort.Search(len(ts), func(i int) bool { return ts[i].effectiveOn > day })
+	if i == 0 {
+		return 0
+	}
+	return ts[i-1].value
+}
+
+func (d *DB) listThresholds(ctx context.Context, w io.Writer) error {
+	ts, err := d.thresholds(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tEFFECTIVE\tVALUE")
+	for _, kind := range []string{thresholdFTP, thresholdHeartRate} {
+		for _, t := range ts[kind] {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", kind, t.effectiveOn, strconv.FormatFloat(t.value, 'f', -1, 64))
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,94 @@
+package main
+
+import "fmt"
+
+// units is the system of measurement for output, set with -units by name.
+// Workouts are always stored in metric units.
+type units int
+
+const (
+	metric units = iota
+	imperial
+)
+
+const (
+	metersPerMile = 1609.344
+	metersPerFoot = 0.3048
+	kgPerPound    = 0.45359237
+)
+
+func (u *units) String() string {
+	if u != nil && *u == imperial {
+		return "imperial"
+	}
+	return "metric"
+}
+
+func (u *units) Set(s string) error {
+	switch s {
+	case "metric":
+		*u = metric
+	case "imperial":
+		*u = imperial
+	default:
+		return fmt.Errorf("unknown units %q, want metric or imperial", s)
+	}
+	return nil
+}
+
+// distance converts m meters to kilometers or miles.
+func (u units) distance(m float64) float64 {
+	if u == imperial {
+		return m / metersPerMile
+	}
+	return m / 1000
+}
+
+func (u units) distanceUnit() string {
+	if u == imperial {
+		return "mi"
+	}
+	return "km"
+}
+
+// speed converts mps meters per second to kilometers or miles per hour.
+func (u units) speed(mps float64) float64 {
+	return u.distance(mps * 3600)
+}
+
+func (u units) speedUnit() string {
+	if u == imperial {
+		return "mph"
+	}
+	return "km/h"
+}
+
+// elevation converts m meters of elevation or climbing to meters or feet.
+func (u units) elevation(m float64) float64 {
+	if u == imperial {
+		return m / metersPerFoot
+	}
+	return m
+}
+
+func (u units) elevationUnit() string {
+	if u == imperial {
+		return "ft"
+	}
+	return "m"
+}
+
+// weight converts kg kilograms to kilograms or pounds.
+func (u units) weight(kg float64) float64 {
+	if u == imperial {
+		return kg / kgPerPound
+	}
+	return kg
+}
+
+func (u units) weightUnit() string {
+	if u == imperial {
+		return "lb"
+	}
+	return "kg"
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUnits(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		conv func(units, float64) float64
+		in   float64
+		// metric and imperial are the converted values.
+		metric, imperial float64
+	}{
+		{"distance", units.distance, 1609.344, 1.609344, 1},
+		{"distance zero", units.distance, 0, 0, 0},
+		{"speed", units.speed, 10, 36, 22.369363},
+		{"elevation", units.elevation, 304.8, 304.8, 1000},
+		{"weight", units.weight, 70, 70, 154.323584},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.conv(metric, tc.in); math.Abs(got-tc.metric) > 1e-6 {
+				t.Errorf("metric: got %v, want %v", got, tc.metric)
+			}
+			if got := tc.conv(imperial, tc.in); math.Abs(got-tc.imperial) > 1e-6 {
+				t.Errorf("imperial: got %v, want %v", got, tc.imperial)
+			}
+		})
+	}
+}
+
+func TestUnitsSet(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    units
+		wantErr bool
+	}{
+		{"metric", metric, false},
+		{"imperial", imperial, false},
+		{"furlongs", metric, true},
+	} {
+		var u units
+		err := u.Set(tc.in)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("Set(%q): got error %v, want error %v", tc.in, err, tc.wantErr)
+			continue
+		}
+		if u != tc.want {
+			t.Errorf("Set(%q): got %v, want %v", tc.in, u.String(), tc.want.String())
+		}
+		if !tc.wantErr && u.String() != tc.in {
+			t.Errorf("Set(%q): String() = %q", tc.in, u.String())
+		}
+	}
+}
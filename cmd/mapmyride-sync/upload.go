@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danp/mapmyride"
+	"github.com/peterbourgon/ff/ffcli"
+)
+
+func newUploadCommand(ctx context.Context, cfg *config) *ffcli.Command {
+	return &ffcli.Command{
+		Name:      "upload",
+		Usage:     "mapmyride-sync [flags] upload <file>...",
+		ShortHelp: "import GPX or TCX recordings into mapmyride, such as ones from another service; sync afterward to store them",
+		Exec: func(args []string) error {
+			if len(args) == 0 {
+				return flag.ErrHelp
+			}
+			tokens, err := cfg.tokenSource()
+			if err != nil {
+				return err
+			}
+			client := mapmyride.NewClient(tokens)
+			client.Logf = log.Printf
+			client.MaxRetries = cfg.maxRetries
+
+			for _, name := range args {
+				format := mapmyride.FileFormat(strings.ToLower(strings.TrimPrefix(filepath.Ext(name), ".")))
+				f, err := os.Open(name)
+				if err != nil {
+					return err
+				}
+				id, err := client.UploadWorkoutFile(ctx, f, format)
+				f.Close()
+				if err != nil {
+					return fmt.Errorf("uploading %s: %w", name, err)
+				}
+				log.Printf("uploaded %s as workout %d", name, id)
+			}
+			return nil
+		},
+	}
+}
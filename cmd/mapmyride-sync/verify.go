@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danp/mapmyride"
+)
+
+// verifyExport cross-checks exported, from the site's CSV export, against
+// userName's synced workouts on the days the export covers. It prints
+// workouts missing on either side and returns how many there were.
+func (d *DB) verifyExport(ctx context.Context, w io.Writer, userName string, exported []mapmyride.ExportedWorkout, loc *time.Location) (int, error) {
+	if len(exported) == 0 {
+		return 0, fmt.Errorf("export has no workouts")
+	}
+
+	first, last := exported[0].Day, exported[0].Day
+	inExport := make(map[int]bool)
+	for _, ew := range exported {
+		inExport[ew.ID] = true
+		if ew.Day.Before(first) {
+			first = ew.Day
+		}
+		if ew.Day.After(last) {
+			last = ew.Day
+		}
+	}
+	begin := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc)
+	end := time.Date(last.Year(), last.Month(), last.Day()+1, 0, 0, 0, 0, loc)
+
+	rows, err := d.db.QueryContext(ctx, "select id, name, started_at from workouts where ($1 = '' or user_name=$1) order by started_at", userName)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type local struct {
+		id        int
+		name      string
+		startedAt time.Time
+	}
+	stored := make(map[int]bool)
+	var extra []local
+	for rows.Next() {
+		var l local
+		if err := rows.Scan(&l.id, &l.name, &l.startedAt); err != nil {
+			return 0, err
+		}
+		stored[l.id] = true
+		if !inExport[l.id] && !l.startedAt.Before(begin) && l.startedAt.Before(end) {
+			extra = append(extra, l)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	trashed, err := d.store.Trashed(ctx)
+	if err != nil {
+		return 0, err
+	}
+	inTrash := make(map[int]bool)
+	for _, t := range trashed {
+		inTrash[t.ID] = true
+	}
+
+	var missing []mapmyride.ExportedWorkout
+	for _, ew := range exported {
+		if !stored[ew.ID] {
+			missing = append(missing, ew)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Day.Before(missing[j].Day) })
+
+	fmt.Fprintf(w, "checked %d exported workouts from %s to %s\n", len(exported), first.Format("2006-01-02"), last.Format("2006-01-02"))
+	if len(missing)+len(extra) == 0 {
+		fmt.Fprintln(w, "all workouts match")
+		return 0, nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDATE\tNAME\tPROBLEM")
+	for _, ew := range missing {
+		problem := "missing locally"
+		if inTrash[ew.ID] {
+			problem = "in trash, see restore"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", ew.ID, ew.Day.Format("2006-01-02"), ew.ActivityType, problem)
+	}
+	for _, l := range extra {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", l.id, l.startedAt.In(loc).Format("2006-01-02"), l.name, "not in export")
+	}
+	return len(missing) + len(extra), tw.Flush()
+}
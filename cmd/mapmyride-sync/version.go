@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+)
+
+// printVersion writes the module version, VCS details and Go version
+// the binary was built with.
+func printVersion(w io.Writer) {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		fmt.Fprintln(w, "mapmyride-sync (no build info)")
+		return
+	}
+
+	fmt.Fprintln(w, "mapmyride-sync", bi.Main.Version)
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision", "vcs.time", "vcs.modified":
+			fmt.Fprintf(w, "%s: %s\n", s.Key, s.Value)
+		}
+	}
+	fmt.Fprintln(w, "go:", bi.GoVersion)
+}
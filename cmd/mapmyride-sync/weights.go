@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/peterbourgon/ff/ffcli"
+)
+
+func newWeightCommand(ctx context.Context, cfg *config) *ffcli.Command {
+	addFS := flag.NewFlagSet("mapmyride-sync weight add", flag.ExitOnError)
+	addDate := addFS.String("date", "", "day of the measurement, in 2006-01-02 format (default today)")
+
+	return &ffcli.Command{
+		Name:      "weight",
+		Usage:     "mapmyride-sync [flags] weight <subcommand>",
+		ShortHelp: "manage the body weight log used for per-kg stats",
+		Subcommands: []*ffcli.Command{
+			{
+				Name:      "add",
+				Usage:     "mapmyride-sync -username <user> [flags] weight add [-date 2006-01-02] <kg>",
+				ShortHelp: "record a body weight in kilograms",
+				FlagSet:   addFS,
+				Exec: func(args []string) error {
+					if len(args) != 1 {
+						return flag.ErrHelp
+					}
+					if cfg.username == "" {
+						return errors.New("need -username")
+					}
+					kg, err := strconv.ParseFloat(args[0], 64)
+					if err != nil || kg <= 0 {
+						return fmt.Errorf("weight %q is not a number of kilograms", args[0])
+					}
+					loc, err := cfg.location()
+					if err != nil {
+						return err
+					}
+					day := time.Now().In(loc).Format("2006-01-02")
+					if *addDate != "" {
+						if _, err := time.Parse("2006-01-02", *addDate); err != nil {
+							return err
+						}
+						day = *addDate
+					}
+					db, err := newDB(cfg.databaseFile, cfg.dbOptions()...)
+					if err != nil {
+						return err
+					}
+					return db.addWeight(ctx, cfg.username, day, kg)
+				},
+			},
+			{
+				Name:      "import",
+				Usage:     "mapmyride-sync -username <user> [flags] weight import <file.csv>",
+				ShortHelp: "import weights from a CSV file such as a Withings weight.csv export",
+				Exec: func(args []string) error {
+					if len(args) != 1 {
+						return flag.ErrHelp
+					}
+					if cfg.username == "" {
+						return errors.New("need -username")
+					}
+					f, err := os.Open(args[0])
+					if err != nil {
+						return err
+					}
+					defer f.Close()
+					db, err := newDB(cfg.databaseFile, cfg.dbOptions()...)
+					if err != nil {
+						return err
+					}
+					n, err := db.importWeights(ctx, cfg.username, f)
+					if err != nil {
+						return err
+					}
+					log.Println("imported", n, "weights for", cfg.username)
+					return nil
+				},
+			},
+			{
+				Name:      "list",
+				Usage:     "mapmyride-sync [flags] weight list",
+				ShortHelp: "list recorded weights",
+				Exec: func([]string) error {
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+					return db.listWeights(ctx, os.Stdout, cfg.username)
+				},
+			},
+		},
+		Exec: func([]string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+// addWeight records kg as userName's weight on day, replacing any weight
+// already recorded for that day.
+func (d *DB) addWeight(ctx context.Context, userName, day string, kg float64) error {
+	_, err := d.db.ExecContext(ctx, "insert or replace into weights (user_name, measured_on, kg) values ($1, $2, $3)", userName, day, kg)
+	return err
+}
+
+// importWeights reads weights from a CSV file with a header row naming a
+// Date column and a Weight column, such as Withings' weight.csv with its
+// "Date" and "Weight (kg)" columns. Weights are taken to be in kilograms
+// unless the Weight column's name mentions lb, and must be above zero.
+// When a day has several measurements, the last one in the file wins.
+func (d *DB) importWeights(ctx context.Context, userName string, r io.Reader) (int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return 0, fmt.Errorf("reading header: %w", err)
+	}
+	dateCol, weightCol, kgPerUnit := -1, -1, 1.0
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		switch {
+		case dateCol < 0 && strings.HasPrefix(h, "date"):
+			dateCol = i
+		case weightCol < 0 && strings.HasPrefix(h, "weight"):
+			weightCol = i
+			if strings.Contains(h, "lb") {
+				kgPerUnit = kgPerPound
+			}
+		}
+	}
+	if dateCol < 0 || weightCol < 0 {
+		return 0, fmt.Errorf("header %q has no Date and Weight columns", header)
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var n int
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if dateCol >= len(rec) || weightCol >= len(rec) || strings.TrimSpace(rec[weightCol]) == "" {
+			continue
+		}
+
+		// Withings uses "2006-01-02 15:04:05"; only the day matters.
+		day := strings.TrimSpace(rec[dateCol])
+		if len(day) > len("2006-01-02") {
+			day = day[:len("2006-01-02")]
+		}
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			return 0, fmt.Errorf("line %d: parsing date %q: %w", line, rec[dateCol], err)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(rec[weightCol]), 64)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: parsing weight %q: %w", line, rec[weightCol], err)
+		}
+		if v <= 0 {
+			return 0, fmt.Errorf("line %d: weight %q is not above zero", line, rec[weightCol])
+		}
+
+		if _, err := tx.ExecContext(ctx, "insert or replace into weights (user_name, measured_on, kg) values ($1, $2, $3)", userName, day, v*kgPerUnit); err != nil {
+			return 0, err
+		}
+		n++
+	}
+
+	return n, tx.Commit()
+}
+
+// weights returns the recorded weights by user, oldest first.
+func (d *DB) weights(ctx context.Context) (map[string][]datedValue, error) {
+	rows, err := d.db.QueryContext(ctx, "select user_name, measured_on, kg from weights order by user_name, measured_on")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string][]datedValue)
+	for rows.Next() {
+		var (
+			userName string
+			v        datedValue
+		)
+		if err := rows.Scan(&userName, &v.effectiveOn, &v.value); err != nil {
+			return nil, err
+		}
+		out[userName] = append(out[userName], v)
+	}
+	return out, rows.Err()
+}
+
+func (d *DB) listWeights(ctx context.Context, w io.Writer, userName string) error {
+	ws, err := d.weights(ctx)
+	if err != nil {
+		return err
+	}
+
+	users := make([]string, 0, len(ws))
+	for user := range ws {
+		if userName == "" || user == userName {
+			users = append(users, user)
+		}
+	}
+	sort.Strings(users)
+
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "USER\tDATE\tKG")
+	for _, user := range users {
+		for _, v := range ws[user] {
+			fmt.Fprintf(tw, "%s\t%s\t%.1f\n", user, v.effectiveOn, v.value)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/danp/mapmyride/sync"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestImportWeights(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		csv     string
+		wantN   int
+		want    []datedValue
+		wantErr string
+	}{
+		{
+			name: "withings",
+			csv: "Date,Weight (kg),Fat mass (kg),Bone mass (kg),Comments\n" +
+				"\"2021-06-02 07:15:00\",70.5,,,\n" +
+				"\"2021-06-01 07:10:00\",71,,,\n" +
+				"\"2021-06-01 21:00:00\",71.2,,,\n" +
+				"\"2021-06-03 07:00:00\",,12.1,,no weight\n",
+			wantN: 3,
+			want:  []datedValue{{"2021-06-01", 71.2}, {"2021-06-02", 70.5}},
+		},
+		{
+			name:  "pounds",
+			csv:   "date,weight (lb)\n2021-06-01,154.32358\n",
+			wantN: 1,
+			want:  []datedValue{{"2021-06-01", 70}},
+		},
+		{
+			name:    "no weight column",
+			csv:     "Date,Fat mass (kg)\n2021-06-01,12\n",
+			wantErr: "no Date and Weight columns",
+		},
+		{
+			name:    "bad date",
+			csv:     "Date,Weight (kg)\n2021-06-01,70\nJune 2,71\n",
+			wantErr: `line 3: parsing date "June 2"`,
+		},
+		{
+			name:    "zero weight",
+			csv:     "Date,Weight (kg)\n2021-06-01,70\n2021-06-02,71\n2021-06-03,0\n",
+			wantErr: `line 4: weight "0" is not above zero`,
+		},
+		{
+			name:    "negative weight",
+			csv:     "Date,Weight (kg)\n2021-06-01,-70\n",
+			wantErr: `line 2: weight "-70" is not above zero`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			db, err := newDB(sync.MemoryFilename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.db.Close()
+
+			n, err := db.importWeights(ctx, "dan", strings.NewReader(tc.csv))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tc.wantErr)
+				}
+				ws, err := db.weights(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(ws) != 0 {
+					t.Errorf("got weights %v after a failed import, want none", ws)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tc.wantN {
+				t.Errorf("imported %d weights, want %d", n, tc.wantN)
+			}
+
+			ws, err := db.weights(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, ws["dan"], cmp.AllowUnexported(datedValue{}), cmpopts.EquateApprox(0, 1e-3)); diff != "" {
+				t.Errorf("weights mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danp/mapmyride"
+	"github.com/peterbourgon/ff/ffcli"
+)
+
+func newReportCommand(ctx context.Context, cfg *config) *ffcli.Command {
+	yearFS := flag.NewFlagSet("mapmyride-sync report year", flag.ExitOnError)
+	yearOut := yearFS.String("out", "", "output file (default year-<year>.html)")
+
+	return &ffcli.Command{
+		Name:      "report",
+		Usage:     "mapmyride-sync [flags] report <subcommand>",
+		ShortHelp: "generate reports from synced workouts",
+		Subcommands: []*ffcli.Command{
+			{
+				Name:      "year",
+				Usage:     "mapmyride-sync [flags] report year [flags] <year>",
+				ShortHelp: "write an HTML year in review",
+				FlagSet:   yearFS,
+				Exec: func(args []string) error {
+					if len(args) != 1 {
+						return flag.ErrHelp
+					}
+					year, err := strconv.Atoi(args[0])
+					if err != nil {
+						return fmt.Errorf("parsing year %q: %w", args[0], err)
+					}
+					loc, err := cfg.location()
+					if err != nil {
+						return err
+					}
+					db, err := newDB(cfg.databaseFile, cfg.readDBOptions()...)
+					if err != nil {
+						return err
+					}
+
+					out := *yearOut
+					if out == "" {
+						out = "year-" + args[0] + ".html"
+					}
+					f, err := os.Create(out)
+					if err != nil {
+						return err
+					}
+					if err := db.yearReport(ctx, f, cfg.username, year, loc, cfg.units, cfg.locale.get()); err != nil {
+						f.Close()
+						return err
+					}
+					return f.Close()
+				},
+			},
+		},
+		Exec: func([]string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+type yearReportData struct {
+	Year         int
+	UserName     string
+	Workouts     int
+	Distance     float64
+	Hours        float64
+	Gain         float64
+	Kinds        []yearReportKind
+	DistanceUnit string
+	ElevUnit     string
+
+	BiggestDay         string
+	BiggestDayDistance float64
+	FavoriteRoute      string
+	FavoriteRouteCount int
+	FavoriteRoutePath  string
+
+	Maps []yearReportMap
+}
+
+type yearReportKind struct {
+	Kind     string
+	Workouts int
+	Distance float64
+}
+
+type yearReportMap struct {
+	Name string
+	Date string
+	Path string
+}
+
+// yearReport writes an HTML summary of userName's workouts in year, with
+// distances and climbing in u and dates and numbers formatted for l.
+func (d *DB) yearReport(ctx context.Context, w io.Writer, userName string, year int, loc *time.Location, u units, l *locale) error {
+	begin := time.Date(year, 1, 1, 0, 0, 0, 0, loc)
+	summaries, err := d.workoutSummaries(ctx, userName, begin, begin.AddDate(1, 0, 0))
+	if err != nil {
+		return err
+	}
+
+	data := yearReportData{
+		Year:         year,
+		UserName:     userName,
+		Workouts:     len(summaries),
+		DistanceUnit: u.distanceUnit(),
+		ElevUnit:     u.elevationUnit(),
+	}
+
+	kinds := make(map[string]*yearReportKind)
+	days := make(map[string]float64)
+	for _, s := range summaries {
+		data.Distance += u.distance(s.Distance)
+		data.Hours += s.Duration.Hours()
+		data.Gain += u.elevation(s.Gain)
+
+		k, ok := kinds[s.Kind]
+		if !ok {
+			k = &yearReportKind{Kind: s.Kind}
+			kinds[s.Kind] = k
+		}
+		k.Workouts++
+		k.Distance += u.distance(s.Distance)
+
+		days[s.StartedAt.In(loc).Format("2006-01-02")] += u.distance(s.Distance)
+	}
+	for _, k := range kinds {
+		data.Kinds = append(data.Kinds, *k)
+	}
+	sort.Slice(data.Kinds, func(i, j int) bool { return data.Kinds[i].Distance > data.Kinds[j].Distance })
+	var biggestDay string
+	for day, dist := range days {
+		if dist > data.BiggestDayDistance || (dist == data.BiggestDayDistance && day < biggestDay) {
+			biggestDay, data.BiggestDayDistance = day, dist
+		}
+	}
+	if t, err := time.Parse("2006-01-02", biggestDay); err == nil {
+		data.BiggestDay = l.formatDate(t, l.longDay)
+	}
+
+	// Workouts count as the same route when they start and end within
+	// about 500 meters of each other and are within 2 km in length.
+	type route struct {
+		key   string
+		count int
+		name  string
+		path  string
+		last  time.Time
+	}
+	routes := make(map[string]*route)
+	for _, s := range summaries {
+		ps, err := d.store.Preview(ctx, s.ID)
+		if err != nil {
+			return err
+		}
+		if len(ps) == 0 {
+			continue
+		}
+		path := svgPath(ps, 100)
+		data.Maps = append(data.Maps, yearReportMap{Name: s.Name, Date: l.formatDate(s.StartedAt.In(loc), l.shortDay), Path: path})
+
+		first, last := ps[0], ps[len(ps)-1]
+		key := fmt.Sprintf("%.0f,%.0f,%.0f,%.0f,%.0f", first.Lat*200, first.Lng*200, last.Lat*200, last.Lng*200, s.Distance/2000)
+		r, ok := routes[key]
+		if !ok {
+			r = &route{key: key}
+			routes[key] = r
+		}
+		r.count++
+		if !s.StartedAt.Before(r.last) {
+			r.name, r.path, r.last = s.Name, path, s.StartedAt
+		}
+	}
+	// Ties go to the route ridden most recently, then by key, so the
+	// same data always picks the same route.
+	var favorite *route
+	for _, r := range routes {
+		if r.count < 2 {
+			continue
+		}
+		if favorite == nil || r.count > favorite.count ||
+			(r.count == favorite.count && (r.last.After(favorite.last) || (r.last.Equal(favorite.last) && r.key < favorite.key))) {
+			favorite = r
+		}
+	}
+	if favorite != nil {
+		data.FavoriteRoute, data.FavoriteRouteCount, data.FavoriteRoutePath = favorite.name, favorite.count, favorite.path
+	}
+
+	t, err := yearReportTemplate.Clone()
+	if err != nil {
+		return err
+	}
+	return t.Funcs(reportFuncs(l)).Execute(w, data)
+}
+
+// svgPath returns SVG path data drawing ps scaled to fit a size by size
+// box, north up.
+func svgPath(ps []mapmyride.WorkoutPosition, size float64) string {
+	return svgSegmentsPath([][]mapmyride.WorkoutPosition{ps}, size)
+}
+
+// svgSegmentsPath is svgPath drawing each of segs as a separate subpath,
+// scaled together, with no line between one segment and the next.
+func svgSegmentsPath(segs [][]mapmyride.WorkoutPosition, size float64) string {
+	var first *mapmyride.WorkoutPosition
+	for _, ps := range segs {
+		if len(ps) > 0 {
+			first = &ps[0]
+			break
+		}
+	}
+	if first == nil {
+		return ""
+	}
+
+	minLat, maxLat, minLng, maxLng := first.Lat, first.Lat, first.Lng, first.Lng
+	for _, ps := range segs {
+		for _, p := range ps {
+			minLat, maxLat = math.Min(minLat, p.Lat), math.Max(maxLat, p.Lat)
+			minLng, maxLng = math.Min(minLng, p.Lng), math.Max(maxLng, p.Lng)
+		}
+	}
+
+	// Scale longitude so shapes aren't stretched away from the equator.
+	lngScale := math.Cos((minLat + maxLat) / 2 * math.Pi / 180)
+	width, height := (maxLng-minLng)*lngScale, maxLat-minLat
+	scale := size / math.Max(math.Max(width, height), 1e-9)
+	xOff, yOff := (size-width*scale)/2, (size-height*scale)/2
+
+	var b strings.Builder
+	for _, ps := range segs {
+		for i, p := range ps {
+			cmd := "L"
+			if i == 0 {
+				cmd = "M"
+			}
+			fmt.Fprintf(&b, "%s%.1f %.1f ", cmd, xOff+(p.Lng-minLng)*lngScale*scale, yOff+(maxLat-p.Lat)*scale)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+var yearReportTemplate = template.Must(template.New("year").Funcs(reportFuncs(locales["en"])).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Year}} in review</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 2em auto; color: #222; }
+.totals { display: flex; gap: 2em; }
+.total { font-size: 2em; font-weight: bold; }
+.maps { display: flex; flex-wrap: wrap; gap: 0.5em; }
+.map { width: 8em; text-align: center; font-size: 0.8em; }
+svg { width: 100%; background: #f4f4f4; }
+path { fill: none; stroke: #d33; stroke-width: 1.5; }
+</style>
+</head>
+<body>
+<h1>{{if .UserName}}{{.UserName}}'s {{end}}{{.Year}} in review</h1>
+<div class="totals">
+<div><div class="total">{{.Workouts}}</div>workouts</div>
+<div><div class="total">{{num .Distance 0}}</div>{{.DistanceUnit}}</div>
+<div><div class="total">{{num .Hours 0}}</div>hours</div>
+<div><div class="total">{{num .Gain 0}}</div>{{.ElevUnit}} climbed</div>
+</div>
+{{with .Kinds}}<h2>By kind</h2>
+<table>
+{{range .}}<tr><td>{{.Kind}}</td><td>{{.Workouts}} workouts</td><td>{{num .Distance 0}} {{$.DistanceUnit}}</td></tr>
+{{end}}</table>{{end}}
+{{if .BiggestDay}}<h2>Biggest day</h2>
+<p>{{.BiggestDay}}: {{num .BiggestDayDistance 1}} {{.DistanceUnit}}</p>{{end}}
+{{if .FavoriteRoute}}<h2>Most-ridden route</h2>
+<div class="map"><svg viewBox="0 0 100 100"><path d="{{.FavoriteRoutePath}}"/></svg>{{.FavoriteRoute}}, {{.FavoriteRouteCount}} times</div>{{end}}
+{{with .Maps}}<h2>Every route</h2>
+<div class="maps">
+{{range .}}<div class="map"><svg viewBox="0 0 100 100"><path d="{{.Path}}"/></svg>{{.Date}} {{.Name}}</div>
+{{end}}</div>{{end}}
+</body>
+</html>
+`))
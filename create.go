@@ -0,0 +1,145 @@
+package mapmyride
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// joulesPerKcal converts kilocalories to the joules the API measures
+// energy in.
+const joulesPerKcal = 4184
+
+// CreateWorkout creates w on MapMyRide as a workout of the activity type
+// with the given ID, such as 11 for a road ride, and returns it with its
+// new ID and the times the site recorded. Its name, start time, duration,
+// distance and calories are sent along with any series it has. The time
+// zone of w.StartedAt is sent as the workout's, so it should be a
+// location loaded by name rather than time.Local.
+//
+// Unlike fetching, creating a workout is never retried, since a request
+// that seemed to fail may still have created it.
+func (c *Client) CreateWorkout(ctx context.Context, w Workout, activityTypeID int) (Workout, error) {
+	body, err := json.Marshal(newWorkoutRequest(w, activityTypeID))
+	if err != nil {
+		return Workout{}, err
+	}
+
+	req, err := c.newRequest(ctx, "POST", "/vxproxy/v7.0/workout/")
+	if err != nil {
+		return Workout{}, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("content-type", "application/json")
+
+	resp, err := c.httpDoOnce(req)
+	if err != nil {
+		return Workout{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		if err := checkResponse(resp); err != nil {
+			return Workout{}, fmt.Errorf("creating workout: %w", err)
+		}
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Workout{}, err
+	}
+	var rawresp struct {
+		CreatedAt time.Time `json:"created_datetime"`
+		UpdatedAt time.Time `json:"updated_datetime"`
+		Links     map[string][]struct {
+			ID string
+		} `json:"_links"`
+	}
+	if err := json.Unmarshal(b, &rawresp); err != nil {
+		return Workout{}, fmt.Errorf("creating workout: %w", err)
+	}
+	self := rawresp.Links["self"]
+	if len(self) != 1 {
+		return Workout{}, fmt.Errorf("creating workout: no id in response")
+	}
+	w.ID, err = strconv.Atoi(self[0].ID)
+	if err != nil {
+		return Workout{}, fmt.Errorf("creating workout: bad id in response: %w", err)
+	}
+	w.CreatedAt, w.UpdatedAt = rawresp.CreatedAt, rawresp.UpdatedAt
+	return w, nil
+}
+
+// workoutRequest is a workout as the API takes it to create one.
+type workoutRequest struct {
+	Name         string                 `json:"name"`
+	ActivityType string                 `json:"activity_type"`
+	StartedAt    string                 `json:"start_datetime"`
+	TimeZone     string                 `json:"start_locale_timezone"`
+	Aggregates   map[string]float64     `json:"aggregates"`
+	HasSeries    bool                   `json:"has_time_series"`
+	TimeSeries   map[string]interface{} `json:"time_series,omitempty"`
+}
+
+func newWorkoutRequest(w Workout, activityTypeID int) workoutRequest {
+	tz := w.StartedAt.Location().String()
+	if tz == "Local" {
+		tz = "UTC"
+	}
+	wr := workoutRequest{
+		Name:         w.Name,
+		ActivityType: "/v7.0/activity_type/" + strconv.Itoa(activityTypeID) + "/",
+		StartedAt:    w.StartedAt.Format(time.RFC3339),
+		TimeZone:     tz,
+		Aggregates: map[string]float64{
+			"active_time_total":  w.Duration.Seconds(),
+			"elapsed_time_total": (w.Duration + w.PausedTime()).Seconds(),
+			"distance_total":     w.Distance,
+		},
+		TimeSeries: make(map[string]interface{}),
+	}
+	if w.Kcal > 0 {
+		wr.Aggregates["metabolic_energy_total"] = float64(w.Kcal * joulesPerKcal)
+	}
+
+	series := func(name string, n int, point func(i int) []interface{}) {
+		if n == 0 {
+			return
+		}
+		points := make([][]interface{}, n)
+		for i := range points {
+			points[i] = point(i)
+		}
+		wr.TimeSeries[name] = points
+	}
+	series("distance", len(w.Distances), func(i int) []interface{} {
+		return []interface{}{w.Distances[i].Elapsed.Seconds(), w.Distances[i].Total}
+	})
+	series("position", len(w.Positions), func(i int) []interface{} {
+		p := w.Positions[i]
+		return []interface{}{p.Elapsed.Seconds(), map[string]float64{"lat": p.Lat, "lng": p.Lng, "elevation": p.Elevation}}
+	})
+	series("speed", len(w.Speeds), func(i int) []interface{} {
+		return []interface{}{w.Speeds[i].Elapsed.Seconds(), w.Speeds[i].MetersPerSecond}
+	})
+	series("steps", len(w.Steps), func(i int) []interface{} {
+		return []interface{}{w.Steps[i].Elapsed.Seconds(), w.Steps[i].StepsInPeriod}
+	})
+	series("heartrate", len(w.HeartRates), func(i int) []interface{} {
+		return []interface{}{w.HeartRates[i].Elapsed.Seconds(), w.HeartRates[i].BeatsPerMinute}
+	})
+	series("cadence", len(w.Cadences), func(i int) []interface{} {
+		return []interface{}{w.Cadences[i].Elapsed.Seconds(), w.Cadences[i].RPM}
+	})
+	series("power", len(w.Powers), func(i int) []interface{} {
+		return []interface{}{w.Powers[i].Elapsed.Seconds(), w.Powers[i].Watts}
+	})
+	wr.HasSeries = len(wr.TimeSeries) > 0
+	return wr
+}
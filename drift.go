@@ -0,0 +1,180 @@
+package mapmyride
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SchemaDriftPolicy is what a Client does when a response from the site
+// has fields it doesn't know about or lacks fields it expects, which
+// usually means the site's API changed and data may be going missing.
+type SchemaDriftPolicy int
+
+const (
+	// SchemaDriftIgnore doesn't check responses. It is the default.
+	SchemaDriftIgnore SchemaDriftPolicy = iota
+	// SchemaDriftLog logs each distinct drift to the Client's Logf once.
+	SchemaDriftLog
+	// SchemaDriftFail fails the request with a *SchemaDriftError.
+	SchemaDriftFail
+)
+
+// SchemaDriftError describes how a response differs from what the Client
+// expects.
+type SchemaDriftError struct {
+	// Response names the response, such as "dashboard" or "detail".
+	Response string
+
+	// Unknown are fields the Client doesn't know about. Missing are
+	// fields the Client reads that weren't present. Fields of nested
+	// objects are given as paths, such as workout_data.workouts[].name.
+	Unknown, Missing []string
+}
+
+func (e *SchemaDriftError) Error() string {
+	var parts []string
+	if len(e.Unknown) > 0 {
+		parts = append(parts, "unknown fields "+strings.Join(e.Unknown, ", "))
+	}
+	if len(e.Missing) > 0 {
+		parts = append(parts, "missing fields "+strings.Join(e.Missing, ", "))
+	}
+	return fmt.Sprintf("%s response schema changed: %s", e.Response, strings.Join(parts, "; "))
+}
+
+// fieldSet is the fields expected in a JSON object. Required fields are
+// read by the Client and reported missing if absent. Optional fields are
+// known but may be absent.
+type fieldSet struct {
+	required, optional []string
+}
+
+var (
+	dashboardFields     = fieldSet{required: []string{"workout_data"}}
+	dashboardDataFields = fieldSet{required: []string{"workouts"}, optional: []string{"totals"}}
+	// view_url is left out of some manually entered workouts.
+	dashboardWorkoutFields = fieldSet{
+		required: []string{"activity_short_name", "date", "distance", "energy", "name", "speed", "steps", "time"},
+		optional: []string{"view_url", "is_private", "source"},
+	}
+	// time_series is left out of workouts without any, such as manually
+	// entered ones.
+	detailFields = fieldSet{
+		required: []string{"created_datetime", "start_datetime", "updated_datetime", "_links"},
+		optional: []string{"time_series", "name", "start_locale_timezone", "reference_key", "source", "has_time_series", "is_verified", "aggregates", "notes", "is_default_name"},
+	}
+)
+
+// check records the fields of obj that fs doesn't know about and those it
+// requires that are missing, prefixing each with path.
+func (fs fieldSet) check(path string, obj map[string]json.RawMessage, unknown, missing map[string]bool) {
+	known := make(map[string]bool, len(fs.required)+len(fs.optional))
+	for _, f := range fs.optional {
+		known[f] = true
+	}
+	for _, f := range fs.required {
+		known[f] = true
+		if _, ok := obj[f]; !ok {
+			missing[path+f] = true
+		}
+	}
+	for f := range obj {
+		if !known[f] {
+			unknown[path+f] = true
+		}
+	}
+}
+
+// dashboardDrift returns how the dashboard.json response b differs from
+// what parseDashboard expects, or nil if it doesn't.
+func dashboardDrift(b []byte) (*SchemaDriftError, error) {
+	unknown, missing := make(map[string]bool), make(map[string]bool)
+
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(b, &top); err != nil {
+		return nil, err
+	}
+	dashboardFields.check("", top, unknown, missing)
+
+	if raw, ok := top["workout_data"]; ok {
+		var data map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, err
+		}
+		dashboardDataFields.check("workout_data.", data, unknown, missing)
+
+		if raw, ok := data["workouts"]; ok {
+			var days map[string][]map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &days); err != nil {
+				return nil, err
+			}
+			for _, wks := range days {
+				for _, wk := range wks {
+					dashboardWorkoutFields.check("workout_data.workouts[].", wk, unknown, missing)
+				}
+			}
+		}
+	}
+
+	return driftError("dashboard", unknown, missing), nil
+}
+
+// detailDrift returns how the workout detail response b differs from what
+// parseWorkoutDetail expects, or nil if it doesn't.
+func detailDrift(b []byte) (*SchemaDriftError, error) {
+	unknown, missing := make(map[string]bool), make(map[string]bool)
+
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(b, &top); err != nil {
+		return nil, err
+	}
+	detailFields.check("", top, unknown, missing)
+
+	return driftError("detail", unknown, missing), nil
+}
+
+func driftError(response string, unknown, missing map[string]bool) *SchemaDriftError {
+	if len(unknown) == 0 && len(missing) == 0 {
+		return nil
+	}
+	e := &SchemaDriftError{Response: response}
+	for f := range unknown {
+		e.Unknown = append(e.Unknown, f)
+	}
+	for f := range missing {
+		e.Missing = append(e.Missing, f)
+	}
+	sort.Strings(e.Unknown)
+	sort.Strings(e.Missing)
+	return e
+}
+
+// checkDrift applies the Client's SchemaDrift policy to the response b,
+// using drift to compare it with what's expected.
+func (c *Client) checkDrift(b []byte, drift func([]byte) (*SchemaDriftError, error)) error {
+	if c.SchemaDrift == SchemaDriftIgnore {
+		return nil
+	}
+
+	e, err := drift(b)
+	if err != nil || e == nil {
+		// Let parsing report malformed responses.
+		return nil
+	}
+
+	if c.SchemaDrift == SchemaDriftFail {
+		return e
+	}
+	msg := e.Error()
+	if c.loggedDrift[msg] {
+		return nil
+	}
+	if c.loggedDrift == nil {
+		c.loggedDrift = make(map[string]bool)
+	}
+	c.loggedDrift[msg] = true
+	c.logf("%s", msg)
+	return nil
+}
@@ -0,0 +1,115 @@
+package mapmyride
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metersPerMile converts the export's miles to meters.
+const metersPerMile = 1609.344
+
+// ExportedWorkout is a workout summary from the site's CSV export of
+// workout history.
+type ExportedWorkout struct {
+	ID           int
+	Day          time.Time // date the workout was done, at midnight UTC
+	ActivityType string
+	Kcal         int
+	Distance     float64 // meters
+	Duration     time.Duration
+}
+
+// ParseExport parses the CSV export of workout history offered on the
+// site. Workout IDs are taken from each row's Link column.
+func ParseExport(r io.Reader) ([]ExportedWorkout, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	cols := make(map[string]int)
+	for i, h := range header {
+		cols[strings.TrimSpace(h)] = i
+	}
+	for _, c := range []string{"Workout Date", "Link"} {
+		if _, ok := cols[c]; !ok {
+			return nil, fmt.Errorf("export has no %q column", c)
+		}
+	}
+
+	field := func(rec []string, name string) string {
+		i, ok := cols[name]
+		if !ok || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	var out []ExportedWorkout
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ew := ExportedWorkout{ActivityType: field(rec, "Activity Type")}
+
+		ew.ID, err = exportLinkID(field(rec, "Link"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		ew.Day, err = time.Parse("January 2, 2006", field(rec, "Workout Date"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: parsing workout date: %w", line, err)
+		}
+		if s := field(rec, "Calories Burned (kCal)"); s != "" {
+			kcal, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: parsing calories: %w", line, err)
+			}
+			ew.Kcal = int(kcal)
+		}
+		if s := field(rec, "Distance (mi)"); s != "" {
+			mi, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: parsing distance: %w", line, err)
+			}
+			ew.Distance = mi * metersPerMile
+		}
+		if s := field(rec, "Workout Time (seconds)"); s != "" {
+			secs, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: parsing workout time: %w", line, err)
+			}
+			ew.Duration = time.Duration(secs * float64(time.Second))
+		}
+
+		out = append(out, ew)
+	}
+	return out, nil
+}
+
+// exportLinkID returns the workout ID at the end of a link such as
+// http://www.mapmyfitness.com/workout/1234567.
+func exportLinkID(link string) (int, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return 0, fmt.Errorf("parsing link %q: %w", link, err)
+	}
+	id, err := strconv.Atoi(path.Base(strings.TrimSuffix(u.Path, "/")))
+	if err != nil {
+		return 0, fmt.Errorf("no workout id in link %q", link)
+	}
+	return id, nil
+}
@@ -0,0 +1,47 @@
+package mapmyride
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParseExport(t *testing.T) {
+	const in = `Date Submitted,Workout Date,Activity Type,Calories Burned (kCal),Distance (mi),Workout Time (seconds),Avg Pace (min/mi),Max Pace (min/mi),Avg Speed (mi/h),Max Speed (mi/h),Avg Heart Rate,Steps,Notes,Source,Link
+"June 2, 2021","June 1, 2021",Road Cycling,712,18.64,3723,3.33,,17.99,31.2,,,"windy, cold",Garmin,http://www.mapmyfitness.com/workout/5678901234
+"June 3, 2021","June 3, 2021",Walk,,,1800,,,,,,2514,,,http://www.mapmyfitness.com/workout/5678901299/
+`
+	got, err := ParseExport(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ExportedWorkout{
+		{
+			ID:           5678901234,
+			Day:          time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+			ActivityType: "Road Cycling",
+			Kcal:         712,
+			Distance:     18.64 * metersPerMile,
+			Duration:     3723 * time.Second,
+		},
+		{
+			ID:           5678901299,
+			Day:          time.Date(2021, 6, 3, 0, 0, 0, 0, time.UTC),
+			ActivityType: "Walk",
+			Duration:     30 * time.Minute,
+		},
+	}
+	if d := cmp.Diff(want, got, cmpopts.EquateApprox(0, 1e-9)); d != "" {
+		t.Errorf("mismatch (-want +got):\n%s", d)
+	}
+
+	if _, err := ParseExport(strings.NewReader("Workout Date,Link\n\"June 1, 2021\",http://www.mapmyfitness.com/workouts/\n")); err == nil {
+		t.Error("got no error for link without workout id")
+	}
+	if _, err := ParseExport(strings.NewReader("Date,Weight\n")); err == nil {
+		t.Error("got no error for export without expected columns")
+	}
+}
@@ -0,0 +1,142 @@
+package mapmyride
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files for the parser fixtures in testdata/fixtures")
+
+// TestParseFixtures runs the response parsers over saved payloads in
+// testdata/fixtures and compares what they produce to the .golden file
+// alongside each one.
+//
+// To add a fixture, save a response into the matching directory, remove
+// anything personal from it, then run:
+//
+//	go test -run TestParseFixtures -update
+//
+// and check the new .golden file looks right.
+func TestParseFixtures(t *testing.T) {
+	t.Run("Dashboard", func(t *testing.T) {
+		forEachFixture(t, "dashboard", ".json", func(t *testing.T, name string, b []byte) (interface{}, error) {
+			// Dashboard fixtures are named for the month they were fetched for.
+			month, err := time.Parse("2006-01", name)
+			if err != nil {
+				t.Fatalf("dashboard fixture names must be 2006-01 months: %v", err)
+			}
+			checkNoDrift(t, b, dashboardDrift)
+			wks, err := parseDashboard(b, month.Year(), int(month.Month()), month, month.AddDate(0, 1, -1))
+			if err != nil {
+				return nil, err
+			}
+			sort.Slice(wks, func(i, j int) bool {
+				if wks[i].ID == wks[j].ID {
+					return wks[i].Name < wks[j].Name
+				}
+				return wks[i].ID < wks[j].ID
+			})
+			return wks, nil
+		})
+	})
+
+	t.Run("Detail", func(t *testing.T) {
+		forEachFixture(t, "detail", ".json", func(t *testing.T, name string, b []byte) (interface{}, error) {
+			checkNoDrift(t, b, detailDrift)
+			var wk Workout
+			atID, err := parseWorkoutDetail(b, &wk)
+			if err != nil {
+				return nil, err
+			}
+			return struct {
+				ActivityTypeID string
+				Workout        Workout
+			}{atID, wk}, nil
+		})
+	})
+
+	t.Run("Elevation", func(t *testing.T) {
+		forEachFixture(t, "elevation", ".html", func(t *testing.T, name string, b []byte) (interface{}, error) {
+			return parseElevation(bytes.NewReader(b))
+		})
+	})
+
+	t.Run("Route", func(t *testing.T) {
+		forEachFixture(t, "route", ".json", func(t *testing.T, name string, b []byte) (interface{}, error) {
+			return parseRoute(b)
+		})
+	})
+}
+
+// checkNoDrift fails t if the saved response b has fields drift doesn't
+// expect, so the expected fields are kept in step with real responses.
+func checkNoDrift(t *testing.T, b []byte, drift func([]byte) (*SchemaDriftError, error)) {
+	t.Helper()
+	e, err := drift(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e != nil {
+		t.Errorf("fixture has schema drift: %v", e)
+	}
+}
+
+// forEachFixture calls parse for each file in testdata/fixtures/dir with
+// extension ext and compares its result, as JSON, to the fixture's
+// golden file.
+func forEachFixture(t *testing.T, dir, ext string, parse func(t *testing.T, name string, b []byte) (interface{}, error)) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "fixtures", dir, "*"+ext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no %s fixtures found", dir)
+	}
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ext)
+		t.Run(name, func(t *testing.T) {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Parse errors are recorded in the golden file too, so
+			// fixtures can cover payloads that should be rejected.
+			got, err := parse(t, name, b)
+			if err != nil {
+				got = struct{ Error string }{err.Error()}
+			}
+			gotb, err := json.MarshalIndent(got, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotb = append(gotb, '\n')
+
+			golden := strings.TrimSuffix(path, ext) + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, gotb, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v; run with -update to create it", err)
+			}
+			if d := cmp.Diff(string(want), string(gotb)); d != "" {
+				t.Errorf("%s mismatch (-want +got):\n%s", golden, d)
+			}
+		})
+	}
+}
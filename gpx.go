@@ -0,0 +1,162 @@
+package mapmyride
+
+import (
+	"encoding/xml"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// gpx is the subset of GPX 1.1 written by WriteGPX.
+type gpx struct {
+	XMLName  xml.Name    `xml:"gpx"`
+	Version  string      `xml:"version,attr"`
+	Creator  string      `xml:"creator,attr"`
+	XMLNS    string      `xml:"xmlns,attr"`
+	XMLNSTPX string      `xml:"xmlns:gpxtpx,attr,omitempty"`
+	Metadata gpxMetadata `xml:"metadata"`
+	Track    gpxTrack    `xml:"trk"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name,omitempty"`
+	Time string `xml:"time,omitempty"`
+}
+
+type gpxTrack struct {
+	Name     string       `xml:"name,omitempty"`
+	Type     string       `xml:"type,omitempty"`
+	Segments []gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+type gpxPoint struct {
+	Lat        string         `xml:"lat,attr"`
+	Lon        string         `xml:"lon,attr"`
+	Elevation  string         `xml:"ele"`
+	Time       string         `xml:"time,omitempty"`
+	Extensions *gpxExtensions `xml:"extensions,omitempty"`
+}
+
+type gpxExtensions struct {
+	TrackPoint gpxTrackPointExtension `xml:"gpxtpx:TrackPointExtension"`
+}
+
+// gpxTrackPointExtension is Garmin's TrackPointExtension v2, which most
+// tools read heart rate and speed from.
+type gpxTrackPointExtension struct {
+	HeartRate string `xml:"gpxtpx:hr,omitempty"`
+	Cadence   string `xml:"gpxtpx:cad,omitempty"`
+	Speed     string `xml:"gpxtpx:speed,omitempty"`
+}
+
+// WriteGPX writes w's positions to out as a GPX 1.1 track, with heart
+// rate, cadence and speed at each point, where w has them, in Garmin's
+// TrackPointExtension. Point times are StartedAt plus each position's
+// Elapsed, and the track is split into segments at w.Pauses().
+func (w Workout) WriteGPX(out io.Writer) error {
+	doc := gpx{
+		Version:  "1.1",
+		Creator:  "github.com/danp/mapmyride",
+		XMLNS:    "http://www.topografix.com/GPX/1/1",
+		XMLNSTPX: "http://www.garmin.com/xmlschemas/TrackPointExtension/v2",
+		Metadata: gpxMetadata{Name: w.Name, Time: xmlTime(w.StartedAt)},
+		Track:    gpxTrack{Name: w.Name, Type: w.Kind},
+	}
+
+	pauses := w.Pauses()
+	var (
+		seg        gpxSegment
+		prev       time.Duration
+		hi, ci, si int // next heart rate, cadence and speed not yet reached
+	)
+	for i, p := range w.Positions {
+		if i > 0 && inPause(pauses, prev, p.Elapsed) && len(seg.Points) > 0 {
+			doc.Track.Segments = append(doc.Track.Segments, seg)
+			seg = gpxSegment{}
+		}
+		prev = p.Elapsed
+
+		pt := gpxPoint{
+			Lat:       formatCoord(p.Lat),
+			Lon:       formatCoord(p.Lng),
+			Elevation: strconv.FormatFloat(p.Elevation, 'f', 1, 64),
+			Time:      xmlTime(w.StartedAt.Add(p.Elapsed)),
+		}
+		// Use the latest heart rate, cadence and speed measured by each
+		// point.
+		var ext gpxTrackPointExtension
+		for hi < len(w.HeartRates) && w.HeartRates[hi].Elapsed <= p.Elapsed {
+			hi++
+		}
+		if hi > 0 {
+			ext.HeartRate = strconv.Itoa(int(math.Round(w.HeartRates[hi-1].BeatsPerMinute)))
+		}
+		for ci < len(w.Cadences) && w.Cadences[ci].Elapsed <= p.Elapsed {
+			ci++
+		}
+		if ci > 0 {
+			ext.Cadence = strconv.Itoa(int(math.Round(w.Cadences[ci-1].RPM)))
+		}
+		for si < len(w.Speeds) && w.Speeds[si].Elapsed <= p.Elapsed {
+			si++
+		}
+		if si > 0 {
+			ext.Speed = strconv.FormatFloat(w.Speeds[si-1].MetersPerSecond, 'f', 2, 64)
+		}
+		if ext != (gpxTrackPointExtension{}) {
+			pt.Extensions = &gpxExtensions{TrackPoint: ext}
+		}
+		seg.Points = append(seg.Points, pt)
+	}
+	if len(seg.Points) > 0 {
+		doc.Track.Segments = append(doc.Track.Segments, seg)
+	}
+
+	return writeXML(out, doc)
+}
+
+// WriteGPX writes r's points to out as a GPX 1.1 track with no times, as
+// bike computers and mapping tools import courses.
+func (r Route) WriteGPX(out io.Writer) error {
+	doc := gpx{
+		Version:  "1.1",
+		Creator:  "github.com/danp/mapmyride",
+		XMLNS:    "http://www.topografix.com/GPX/1/1",
+		Metadata: gpxMetadata{Name: r.Name},
+		Track:    gpxTrack{Name: r.Name},
+	}
+
+	var seg gpxSegment
+	for _, p := range r.Points {
+		seg.Points = append(seg.Points, gpxPoint{
+			Lat:       formatCoord(p.Lat),
+			Lon:       formatCoord(p.Lng),
+			Elevation: strconv.FormatFloat(p.Elevation, 'f', 1, 64),
+		})
+	}
+	if len(seg.Points) > 0 {
+		doc.Track.Segments = append(doc.Track.Segments, seg)
+	}
+
+	return writeXML(out, doc)
+}
+
+// xmlTime formats t as an XML Schema dateTime in UTC, or returns "" if t
+// is zero.
+func xmlTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// formatCoord formats a latitude or longitude to 7 decimal places, about
+// a centimeter.
+func formatCoord(v float64) string {
+	return strconv.FormatFloat(v, 'f', 7, 64)
+}
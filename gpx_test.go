@@ -0,0 +1,133 @@
+package mapmyride
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWorkoutWriteGPX(t *testing.T) {
+	w := Workout{
+		Name:      "Morning Ride",
+		Kind:      "ride",
+		Duration:  10 * time.Second,
+		StartedAt: time.Date(2021, 7, 10, 7, 32, 56, 0, time.UTC),
+		Positions: []WorkoutPosition{
+			{Elapsed: 0, Lat: 44.6488, Lng: -63.5752, Elevation: 10},
+			{Elapsed: 5 * time.Second, Lat: 44.6489, Lng: -63.5753, Elevation: 11.25},
+			// Paused from 5s to 65s.
+			{Elapsed: 65 * time.Second, Lat: 44.65, Lng: -63.576, Elevation: 12},
+			{Elapsed: 70 * time.Second, Lat: 44.6501, Lng: -63.5761, Elevation: 12},
+		},
+		HeartRates: []WorkoutHeartRate{
+			{Elapsed: 5 * time.Second, BeatsPerMinute: 120.6},
+		},
+		Speeds: []WorkoutSpeed{
+			{Elapsed: 0, MetersPerSecond: 5},
+			{Elapsed: 65 * time.Second, MetersPerSecond: 6.125},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := w.WriteGPX(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="github.com/danp/mapmyride" xmlns="http://www.topografix.com/GPX/1/1" xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v2">
+  <metadata>
+    <name>Morning Ride</name>
+    <time>2021-07-10T07:32:56Z</time>
+  </metadata>
+  <trk>
+    <name>Morning Ride</name>
+    <type>ride</type>
+    <trkseg>
+      <trkpt lat="44.6488000" lon="-63.5752000">
+        <ele>10.0</ele>
+        <time>2021-07-10T07:32:56Z</time>
+        <extensions>
+          <gpxtpx:TrackPointExtension>
+            <gpxtpx:speed>5.00</gpxtpx:speed>
+          </gpxtpx:TrackPointExtension>
+        </extensions>
+      </trkpt>
+      <trkpt lat="44.6489000" lon="-63.5753000">
+        <ele>11.2</ele>
+        <time>2021-07-10T07:33:01Z</time>
+        <extensions>
+          <gpxtpx:TrackPointExtension>
+            <gpxtpx:hr>121</gpxtpx:hr>
+            <gpxtpx:speed>5.00</gpxtpx:speed>
+          </gpxtpx:TrackPointExtension>
+        </extensions>
+      </trkpt>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="44.6500000" lon="-63.5760000">
+        <ele>12.0</ele>
+        <time>2021-07-10T07:34:01Z</time>
+        <extensions>
+          <gpxtpx:TrackPointExtension>
+            <gpxtpx:hr>121</gpxtpx:hr>
+            <gpxtpx:speed>6.12</gpxtpx:speed>
+          </gpxtpx:TrackPointExtension>
+        </extensions>
+      </trkpt>
+      <trkpt lat="44.6501000" lon="-63.5761000">
+        <ele>12.0</ele>
+        <time>2021-07-10T07:34:06Z</time>
+        <extensions>
+          <gpxtpx:TrackPointExtension>
+            <gpxtpx:hr>121</gpxtpx:hr>
+            <gpxtpx:speed>6.12</gpxtpx:speed>
+          </gpxtpx:TrackPointExtension>
+        </extensions>
+      </trkpt>
+    </trkseg>
+  </trk>
+</gpx>
+`
+	if d := cmp.Diff(want, buf.String()); d != "" {
+		t.Errorf("gpx mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestRouteWriteGPX(t *testing.T) {
+	r := Route{
+		Name: "Peggys Cove loop",
+		Points: []RoutePoint{
+			{Lat: 44.65, Lng: -63.61, Elevation: 12.1},
+			{Lat: 44.6512, Lng: -63.6134, Elevation: 18.44, Distance: 302.7},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteGPX(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="github.com/danp/mapmyride" xmlns="http://www.topografix.com/GPX/1/1">
+  <metadata>
+    <name>Peggys Cove loop</name>
+  </metadata>
+  <trk>
+    <name>Peggys Cove loop</name>
+    <trkseg>
+      <trkpt lat="44.6500000" lon="-63.6100000">
+        <ele>12.1</ele>
+      </trkpt>
+      <trkpt lat="44.6512000" lon="-63.6134000">
+        <ele>18.4</ele>
+      </trkpt>
+    </trkseg>
+  </trk>
+</gpx>
+`
+	if d := cmp.Diff(want, buf.String()); d != "" {
+		t.Errorf("gpx mismatch (-want +got):\n%s", d)
+	}
+}
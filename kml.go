@@ -0,0 +1,54 @@
+package mapmyride
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// kml is the subset of KML 2.2 written by WriteKML.
+type kml struct {
+	XMLName  xml.Name    `xml:"kml"`
+	XMLNS    string      `xml:"xmlns,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name      string       `xml:"name,omitempty"`
+	Placemark kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name        string        `xml:"name,omitempty"`
+	Description string        `xml:"description,omitempty"`
+	LineString  kmlLineString `xml:"LineString"`
+}
+
+type kmlLineString struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+// WriteKML writes r's points to out as a KML 2.2 line, such as for
+// Google Earth. The line follows the ground rather than the points'
+// elevations, which are included for tools that use them.
+func (r Route) WriteKML(out io.Writer) error {
+	coords := make([]string, 0, len(r.Points))
+	for _, p := range r.Points {
+		coords = append(coords, formatCoord(p.Lng)+","+formatCoord(p.Lat)+","+strconv.FormatFloat(p.Elevation, 'f', 1, 64))
+	}
+
+	doc := kml{
+		XMLNS: "http://www.opengis.net/kml/2.2",
+		Document: kmlDocument{
+			Name: r.Name,
+			Placemark: kmlPlacemark{
+				Name:        r.Name,
+				Description: r.Description,
+				LineString:  kmlLineString{Tessellate: 1, Coordinates: strings.Join(coords, " ")},
+			},
+		},
+	}
+	return writeXML(out, doc)
+}
@@ -0,0 +1,43 @@
+package mapmyride
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRouteWriteKML(t *testing.T) {
+	r := Route{
+		Name:        "Peggys Cove loop",
+		Description: "Coastal loop",
+		Points: []RoutePoint{
+			{Lat: 44.65, Lng: -63.61, Elevation: 12.1},
+			{Lat: 44.6512, Lng: -63.6134, Elevation: 18.44, Distance: 302.7},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteKML(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+  <Document>
+    <name>Peggys Cove loop</name>
+    <Placemark>
+      <name>Peggys Cove loop</name>
+      <description>Coastal loop</description>
+      <LineString>
+        <tessellate>1</tessellate>
+        <coordinates>-63.6100000,44.6500000,12.1 -63.6134000,44.6512000,18.4</coordinates>
+      </LineString>
+    </Placemark>
+  </Document>
+</kml>
+`
+	if d := cmp.Diff(want, buf.String()); d != "" {
+		t.Errorf("kml mismatch (-want +got):\n%s", d)
+	}
+}
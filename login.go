@@ -0,0 +1,175 @@
+package mapmyride
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// LoginTokenSource is a TokenSource that logs in to MapMyRide with an
+// email address and password, the way the site's login form does, and
+// logs in again once the auth-token cookie it got expires.
+type LoginTokenSource struct {
+	// HTTPDo is used to make HTTP requests, if provided. It must not
+	// follow redirects, since the auth-token cookie is set on the
+	// redirect after logging in. Otherwise, an http.Client that doesn't
+	// follow redirects is used.
+	HTTPDo func(*http.Request) (*http.Response, error)
+
+	email, password string
+	baseURL         string
+
+	mu  sync.Mutex
+	tok Token // from the last login
+	now func() time.Time
+}
+
+// NewLoginTokenSource returns a LoginTokenSource that logs in with email
+// and password when a token is first needed.
+func NewLoginTokenSource(email, password string) *LoginTokenSource {
+	return &LoginTokenSource{email: email, password: password, now: time.Now}
+}
+
+// Token returns the token from the last login, logging in first if there
+// hasn't been one or its token has expired. The token's Expiry is that of
+// the auth-token cookie.
+func (s *LoginTokenSource) Token() (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tok.Token != "" && !s.tok.Expired(s.now()) {
+		return s.tok, nil
+	}
+
+	tok, err := s.login(context.Background())
+	if err != nil {
+		return Token{}, fmt.Errorf("logging in as %s: %w", s.email, err)
+	}
+	s.tok = tok
+	return tok, nil
+}
+
+// Invalidate forgets the token from the last login, such as after it was
+// rejected, so the next call to Token logs in again.
+func (s *LoginTokenSource) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tok = Token{}
+}
+
+// login fetches the login form for its CSRF token, posts the credentials
+// with it and returns the token from the auth-token cookie in the
+// response.
+func (s *LoginTokenSource) login(ctx context.Context) (Token, error) {
+	loginURL := s.url("/auth/login/")
+
+	req, err := http.NewRequestWithContext(ctx, "GET", loginURL, nil)
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("user-agent", userAgent)
+
+	resp, err := s.httpDo(req)
+	if err != nil {
+		return Token{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return Token{}, fmt.Errorf("getting login form: got status %d", resp.StatusCode)
+	}
+
+	csrf, err := loginCSRFToken(resp)
+	if err != nil {
+		return Token{}, err
+	}
+
+	form := url.Values{
+		"email":               {s.email},
+		"password":            {s.password},
+		"csrfmiddlewaretoken": {csrf},
+	}
+	req, err = http.NewRequestWithContext(ctx, "POST", loginURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("user-agent", userAgent)
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	req.Header.Set("referer", loginURL)
+	req.Header.Set("x-csrftoken", csrf)
+	req.Header.Set("cookie", "csrftoken="+csrf)
+
+	resp, err = s.httpDo(req)
+	if err != nil {
+		return Token{}, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	for _, c := range resp.Cookies() {
+		if c.Name != "auth-token" || c.Value == "" {
+			continue
+		}
+		expiry := c.Expires
+		if c.MaxAge > 0 {
+			expiry = s.now().Add(time.Duration(c.MaxAge) * time.Second)
+		}
+		return Token{Token: c.Value, Expiry: expiry}, nil
+	}
+
+	if resp.StatusCode == 200 || resp.StatusCode == 401 || resp.StatusCode == 403 {
+		// The form is shown again with an error for bad credentials.
+		return Token{}, fmt.Errorf("no auth-token cookie in response, check the email and password")
+	}
+	return Token{}, fmt.Errorf("got status %d", resp.StatusCode)
+}
+
+// loginCSRFToken returns the CSRF token for the login form in resp, from
+// its csrftoken cookie or, failing that, the form's hidden field.
+func loginCSRFToken(resp *http.Response) (string, error) {
+	for _, c := range resp.Cookies() {
+		if c.Name == "csrftoken" && c.Value != "" {
+			return c.Value, nil
+		}
+	}
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if v, ok := doc.Find(`input[name="csrfmiddlewaretoken"]`).Attr("value"); ok && v != "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("no CSRF token found on login form")
+}
+
+func (s *LoginTokenSource) url(path string) string {
+	base := s.baseURL
+	if base == "" {
+		base = "https://www.mapmyride.com"
+	}
+	return base + path
+}
+
+func (s *LoginTokenSource) httpDo(req *http.Request) (*http.Response, error) {
+	if s.HTTPDo != nil {
+		return s.HTTPDo(req)
+	}
+	return noRedirectClient.Do(req)
+}
+
+// noRedirectClient returns redirect responses rather than following them.
+var noRedirectClient = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
@@ -0,0 +1,74 @@
+package mapmyride
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLoginTokenSource(t *testing.T) {
+	var logins int
+	srv := httptest.NewServer(http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/auth/login/" {
+			http.NotFound(wr, req)
+			return
+		}
+		if req.Method == "GET" {
+			fmt.Fprintln(wr, `<form method="post"><input type="hidden" name="csrfmiddlewaretoken" value="csrf1"></form>`)
+			return
+		}
+
+		if req.FormValue("csrfmiddlewaretoken") != "csrf1" || req.Header.Get("x-csrftoken") != "csrf1" {
+			wr.WriteHeader(403)
+			return
+		}
+		if req.FormValue("email") != "me@example.com" || req.FormValue("password") != "hunter2" {
+			fmt.Fprintln(wr, "bad email or password")
+			return
+		}
+		logins++
+		http.SetCookie(wr, &http.Cookie{Name: "auth-token", Value: "token" + strconv.Itoa(logins), MaxAge: 3600})
+		http.Redirect(wr, req, "/dashboard", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	now := time.Date(2021, 7, 10, 12, 0, 0, 0, time.UTC)
+	s := NewLoginTokenSource("me@example.com", "hunter2")
+	s.baseURL = srv.URL
+	s.now = func() time.Time { return now }
+
+	for i, want := range []string{"token1", "token1"} {
+		tok, err := s.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.Token != want {
+			t.Errorf("call %d: got token %q, want %q", i, tok.Token, want)
+		}
+	}
+
+	// Close enough to the cookie's expiry to log in again.
+	now = now.Add(time.Hour - time.Minute)
+	tok, err := s.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Token != "token2" {
+		t.Errorf("got token %q after expiry, want token2", tok.Token)
+	}
+
+	// A rejected token is replaced by logging in again.
+	s.Invalidate()
+	if tok, err := s.Token(); err != nil || tok.Token != "token3" {
+		t.Errorf("got token %q, %v after invalidating, want token3", tok.Token, err)
+	}
+
+	bad := NewLoginTokenSource("me@example.com", "wrong")
+	bad.baseURL = srv.URL
+	if _, err := bad.Token(); err == nil {
+		t.Error("got no error logging in with the wrong password")
+	}
+}
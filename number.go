@@ -0,0 +1,50 @@
+package mapmyride
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseNumber parses a number as rendered on the site for any locale,
+// such as "1234", "1,234", "1.234,5", "1 234,5" or "1'234.5".
+//
+// A lone separator followed by exactly three digits is taken to be a
+// thousands separator, so "1,234" and "1.234" are both 1234.
+func parseNumber(s string) (float64, error) {
+	clean := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\u00a0', '\u202f', '\'', '\u2019':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(s))
+
+	lastDot, lastComma := strings.LastIndex(clean, "."), strings.LastIndex(clean, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		// Whichever comes last is the decimal separator.
+		if lastComma > lastDot {
+			clean = strings.Replace(strings.Replace(clean, ".", "", -1), ",", ".", 1)
+		} else {
+			clean = strings.Replace(clean, ",", "", -1)
+		}
+	case lastDot >= 0 || lastComma >= 0:
+		sep := "."
+		if lastComma >= 0 {
+			sep = ","
+		}
+		last := strings.LastIndex(clean, sep)
+		if strings.Count(clean, sep) > 1 || len(clean)-last-1 == 3 {
+			clean = strings.Replace(clean, sep, "", -1)
+		} else {
+			clean = strings.Replace(clean, sep, ".", 1)
+		}
+	}
+
+	f, err := strconv.ParseFloat(clean, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing number %q", s)
+	}
+	return f, nil
+}
@@ -0,0 +1,44 @@
+package mapmyride
+
+import "testing"
+
+func TestParseNumber(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want float64
+	}{
+		{"412", 412},
+		{" 412 ", 412},
+		{"-3", -3},
+		{"1,234", 1234},
+		{"1.234", 1234},
+		{"1 234", 1234},
+		{"1\u00a0234", 1234},
+		{"1\u202f234", 1234},
+		{"1'234", 1234},
+		{"1,234,567", 1234567},
+		{"1.234.567", 1234567},
+		{"12.5", 12.5},
+		{"12,5", 12.5},
+		{"0,25", 0.25},
+		{"1,234.5", 1234.5},
+		{"1.234,5", 1234.5},
+		{"1 234,5", 1234.5},
+		{"1'234.5", 1234.5},
+	} {
+		got, err := parseNumber(tc.in)
+		if err != nil {
+			t.Errorf("parseNumber(%q): %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("parseNumber(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+
+	for _, in := range []string{"", "--", "abc", "1,2,3.4.5"} {
+		if got, err := parseNumber(in); err == nil {
+			t.Errorf("parseNumber(%q) = %v, want error", in, got)
+		}
+	}
+}
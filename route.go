@@ -0,0 +1,205 @@
+package mapmyride
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// routesPageSize is how many routes ListRoutes asks for at a time.
+const routesPageSize = 40
+
+// Route is a route, or course, saved on MapMyRide, which workouts may be
+// attached to.
+type Route struct {
+	ID          int
+	Name        string
+	Description string
+	Distance    float64 // meters
+	Ascent      float64 // meters
+	Descent     float64 // meters
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+
+	// Points is the route's path. It is only filled in by GetRoute.
+	Points []RoutePoint
+}
+
+// RoutePoint is a point along a route.
+type RoutePoint struct {
+	Lat       float64
+	Lng       float64
+	Elevation float64 // meters
+	Distance  float64 // meters from the start
+}
+
+// ListRoutes returns the routes saved by the logged in user, without
+// their points.
+func (c *Client) ListRoutes(ctx context.Context) ([]Route, error) {
+	userID, err := c.fetchUserID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("finding user: %w", err)
+	}
+
+	var routes []Route
+	for {
+		q := make(url.Values)
+		q.Set("user", userID)
+		q.Set("order_by", "-date_created")
+		q.Set("limit", strconv.Itoa(routesPageSize))
+		q.Set("offset", strconv.Itoa(len(routes)))
+		b, err := c.getAPI(ctx, "/vxproxy/v7.0/route/", q)
+		if err != nil {
+			return nil, fmt.Errorf("listing routes: %w", err)
+		}
+
+		page, total, err := parseRoutes(b)
+		if err != nil {
+			return nil, fmt.Errorf("listing routes: %w", err)
+		}
+		routes = append(routes, page...)
+		if len(page) == 0 || len(routes) >= total {
+			return routes, nil
+		}
+	}
+}
+
+// GetRoute returns the route with the given ID, including its points. If
+// the route doesn't exist, the error wraps ErrNotFound.
+func (c *Client) GetRoute(ctx context.Context, id int) (Route, error) {
+	q := make(url.Values)
+	q.Set("field_set", "detailed")
+	b, err := c.getAPI(ctx, "/vxproxy/v7.0/route/"+strconv.Itoa(id)+"/", q)
+	if err != nil {
+		return Route{}, fmt.Errorf("fetching route %d: %w", id, err)
+	}
+	r, err := parseRoute(b)
+	if err != nil {
+		return Route{}, fmt.Errorf("fetching route %d: %w", id, err)
+	}
+	return r, nil
+}
+
+// fetchUserID returns the ID of the logged in user, fetching it the first
+// time.
+func (c *Client) fetchUserID(ctx context.Context) (string, error) {
+	if c.userID != "" {
+		return c.userID, nil
+	}
+
+	b, err := c.getAPI(ctx, "/vxproxy/v7.0/user/self/", nil)
+	if err != nil {
+		return "", err
+	}
+	var rawresp struct {
+		ID json.Number
+	}
+	if err := json.Unmarshal(b, &rawresp); err != nil {
+		return "", err
+	}
+	if rawresp.ID == "" {
+		return "", fmt.Errorf("no user id in response")
+	}
+	c.userID = rawresp.ID.String()
+	return c.userID, nil
+}
+
+// getAPI returns the body of a GET request to path with query q.
+func (c *Client) getAPI(ctx context.Context, path string, q url.Values) ([]byte, error) {
+	req, err := c.newRequest(ctx, "GET", path)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = q.Encode()
+
+	resp, err := c.httpDo(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// rawRoute is a route as the API returns it.
+type rawRoute struct {
+	Name         string
+	Description  string
+	Distance     float64
+	TotalAscent  float64   `json:"total_ascent"`
+	TotalDescent float64   `json:"total_descent"`
+	CreatedAt    time.Time `json:"created_datetime"`
+	UpdatedAt    time.Time `json:"updated_datetime"`
+	Points       []struct {
+		Lat, Lng, Ele, Dis float64
+	}
+	Links map[string][]struct {
+		ID string
+	} `json:"_links"`
+}
+
+func (rr rawRoute) route() (Route, error) {
+	self := rr.Links["self"]
+	if len(self) != 1 {
+		return Route{}, fmt.Errorf("route %q has no id", rr.Name)
+	}
+	id, err := strconv.Atoi(self[0].ID)
+	if err != nil {
+		return Route{}, fmt.Errorf("route %q has a bad id: %w", rr.Name, err)
+	}
+
+	r := Route{
+		ID:          id,
+		Name:        rr.Name,
+		Description: rr.Description,
+		Distance:    rr.Distance,
+		Ascent:      rr.TotalAscent,
+		Descent:     rr.TotalDescent,
+		CreatedAt:   rr.CreatedAt,
+		UpdatedAt:   rr.UpdatedAt,
+	}
+	for _, p := range rr.Points {
+		r.Points = append(r.Points, RoutePoint{Lat: p.Lat, Lng: p.Lng, Elevation: p.Ele, Distance: p.Dis})
+	}
+	return r, nil
+}
+
+// parseRoutes parses a page of routes, returning them and how many there
+// are in all.
+func parseRoutes(b []byte) ([]Route, int, error) {
+	var rawresp struct {
+		Embedded struct {
+			Routes []rawRoute
+		} `json:"_embedded"`
+		TotalCount int `json:"total_count"`
+	}
+	if err := json.Unmarshal(b, &rawresp); err != nil {
+		return nil, 0, err
+	}
+
+	routes := make([]Route, 0, len(rawresp.Embedded.Routes))
+	for _, rr := range rawresp.Embedded.Routes {
+		r, err := rr.route()
+		if err != nil {
+			return nil, 0, err
+		}
+		routes = append(routes, r)
+	}
+	return routes, rawresp.TotalCount, nil
+}
+
+// parseRoute parses a single route response.
+func parseRoute(b []byte) (Route, error) {
+	var rr rawRoute
+	if err := json.Unmarshal(b, &rr); err != nil {
+		return Route{}, err
+	}
+	return rr.route()
+}
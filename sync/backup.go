@@ -0,0 +1,76 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupTimeFormat names backups so they sort oldest first.
+const backupTimeFormat = "20060102T150405.000Z"
+
+// WithBackups makes the DB snapshot itself into dir before destructive
+// operations, such as applying migrations, keeping the newest keep
+// snapshots. Backups are named for the database file, the time and the
+// reason for them. A keep of zero or less turns backups off.
+func WithBackups(dir string, keep int) OpenOption {
+	return func(cfg *openConfig) {
+		cfg.backupDir = dir
+		cfg.backupKeep = keep
+	}
+}
+
+// Backup writes a consistent copy of the database to a new file in the
+// directory set with WithBackups, naming it for reason, and removes the
+// oldest backups beyond the number to keep. It returns the new file's
+// name, or "" without doing anything if backups are off.
+func (d *DB) Backup(ctx context.Context, reason string) (string, error) {
+	if d.backupDir == "" || d.backupKeep <= 0 {
+		return "", nil
+	}
+
+	if err := os.MkdirAll(d.backupDir, 0o755); err != nil {
+		return "", err
+	}
+	name := filepath.Join(d.backupDir, d.backupPrefix()+time.Now().UTC().Format(backupTimeFormat)+"-"+reason+".db")
+	if _, err := d.db.ExecContext(ctx, "vacuum into $1", name); err != nil {
+		return "", fmt.Errorf("backing up to %s: %w", name, err)
+	}
+
+	return name, d.rotateBackups()
+}
+
+// backupPrefix is the start of the names of this database's backups.
+func (d *DB) backupPrefix() string {
+	base := filepath.Base(d.filename)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-"
+}
+
+// rotateBackups removes all but the newest backups to keep.
+func (d *DB) rotateBackups() error {
+	entries, err := os.ReadDir(d.backupDir)
+	if err != nil {
+		return err
+	}
+
+	prefix := d.backupPrefix()
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), prefix) && strings.HasSuffix(e.Name(), ".db") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for len(names) > d.backupKeep {
+		if err := os.Remove(filepath.Join(d.backupDir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
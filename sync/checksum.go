@@ -0,0 +1,126 @@
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/danp/mapmyride"
+)
+
+// checksummedSeries are the series tables covered by series_checksum, in
+// the order they are hashed, and their value columns.
+var checksummedSeries = []struct {
+	table string
+	cols  []string
+}{
+	{"workout_distances", []string{"elapsed_seconds", "total_meters"}},
+	{"workout_positions", []string{"elapsed_seconds", "elevation", "lat", "lng"}},
+	{"workout_speeds", []string{"elapsed_seconds", "meters_per_second"}},
+	{"workout_steps", []string{"elapsed_seconds", "steps"}},
+	{"workout_heart_rates", []string{"elapsed_seconds", "beats_per_minute"}},
+	{"workout_cadences", []string{"elapsed_seconds", "revolutions_per_minute"}},
+	{"workout_powers", []string{"elapsed_seconds", "watts"}},
+}
+
+// seriesChecksum returns a checksum of w's series as they are stored, so
+// syncs can skip rewriting series that haven't changed and notice when
+// old tracks are recalculated upstream.
+func seriesChecksum(w mapmyride.Workout) string {
+	h := sha256.New()
+	for _, d := range w.Distances {
+		writeSeriesRow(h, "workout_distances", d.Elapsed.Seconds(), d.Total)
+	}
+	for _, p := range w.Positions {
+		writeSeriesRow(h, "workout_positions", p.Elapsed.Seconds(), p.Elevation, p.Lat, p.Lng)
+	}
+	for _, s := range w.Speeds {
+		writeSeriesRow(h, "workout_speeds", s.Elapsed.Seconds(), s.MetersPerSecond)
+	}
+	for _, s := range w.Steps {
+		writeSeriesRow(h, "workout_steps", s.Elapsed.Seconds(), s.StepsInPeriod)
+	}
+	for _, hr := range w.HeartRates {
+		writeSeriesRow(h, "workout_heart_rates", hr.Elapsed.Seconds(), hr.BeatsPerMinute)
+	}
+	for _, c := range w.Cadences {
+		writeSeriesRow(h, "workout_cadences", c.Elapsed.Seconds(), c.RPM)
+	}
+	for _, p := range w.Powers {
+		writeSeriesRow(h, "workout_powers", p.Elapsed.Seconds(), p.Watts)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeSeriesRow(w io.Writer, table string, vs ...float64) {
+	io.WriteString(w, table)
+	for _, v := range vs {
+		io.WriteString(w, " "+strconv.FormatFloat(v, 'g', -1, 64))
+	}
+	io.WriteString(w, "\n")
+}
+
+// storedSeriesChecksum computes seriesChecksum for stored workout id from
+// its series rows, in the order they were inserted. Series tables added by
+// later migrations than the one being applied are skipped, as they would
+// have no rows.
+func storedSeriesChecksum(ctx context.Context, tx *sql.Tx, id int) (string, error) {
+	h := sha256.New()
+	for _, s := range checksummedSeries {
+		var n int
+		if err := tx.QueryRowContext(ctx, "select count(*) from sqlite_master where type='table' and name=$1", s.table).Scan(&n); err != nil {
+			return "", err
+		}
+		if n == 0 {
+			continue
+		}
+		if err := hashSeriesRows(ctx, tx, h, s.table, s.cols, id); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashSeriesRows(ctx context.Context, tx *sql.Tx, h hash.Hash, table string, cols []string, id int) error {
+	rows, err := tx.QueryContext(ctx, "select "+strings.Join(cols, ", ")+" from "+table+" where workout_id=$1 order by rowid", id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	vs := make([]float64, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vs {
+		ptrs[i] = &vs[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		writeSeriesRow(h, table, vs...)
+	}
+	return rows.Err()
+}
+
+func backfillSeriesChecksums(ctx context.Context, tx *sql.Tx) error {
+	ids, err := queryIDs(ctx, tx, "select id from workouts")
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		sum, err := storedSeriesChecksum(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "update workouts set series_checksum=$1 where id=$2", sum, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1035 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/danp/mapmyride"
+	_ "modernc.org/sqlite"
+)
+
+// DB is a Store backed by a SQLite database.
+type DB struct {
+	db *sql.DB
+
+	// spatialIndex is set when the workout_bounds R*Tree exists
+	// and should be kept up to date.
+	spatialIndex bool
+
+	// hrZones are the heart rate zones stored workouts' zone times are
+	// computed with, if any have been set.
+	hrZones mapmyride.Zones
+
+	// kinds are the kind normalizations set by SetKinds, overriding
+	// DefaultKinds.
+	kinds map[string]string
+
+	// nameTemplate renames workouts with generic names, if set, with
+	// times in nameLocation.
+	nameTemplate *template.Template
+	nameLocation *time.Location
+
+	// timeout limits each method call, if set.
+	timeout time.Duration
+
+	// filename is the database file, and backupDir and backupKeep are
+	// from WithBackups.
+	filename   string
+	backupDir  string
+	backupKeep int
+}
+
+// MemoryFilename is the filename that makes Open use an in-memory
+// database.
+const MemoryFilename = ":memory:"
+
+// Open opens or creates the SQLite database in filename, applying any
+// pending migrations unless it is opened WithReadOnly.
+//
+// A filename of ":memory:" opens a fresh database held in memory, which
+// is gone once the DB is closed.
+func Open(filename string, opts ...OpenOption) (*DB, error) {
+	var cfg openConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	inMemory := filename == MemoryFilename
+	if inMemory && cfg.readOnly {
+		return nil, fmt.Errorf("an in-memory database cannot be opened read-only")
+	}
+
+	dsn, err := dataSourceName(filename, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("opening database file %q: %w", filename, err)
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening database file %q: %w", filename, err)
+	}
+	if cfg.maxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.maxOpenConns)
+	}
+	if inMemory {
+		// Each connection to :memory: gets its own empty database, so
+		// keep exactly one open for the life of the DB.
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+		db.SetConnMaxLifetime(0)
+		db.SetConnMaxIdleTime(0)
+	}
+
+	st := &DB{db: db, timeout: cfg.timeout, nameTemplate: cfg.nameTemplate, nameLocation: cfg.nameLocation, filename: filename}
+	if !inMemory {
+		st.backupDir, st.backupKeep = cfg.backupDir, cfg.backupKeep
+	}
+	initFn := st.init
+	if cfg.readOnly {
+		initFn = st.initReadOnly
+	}
+	if err := initFn(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return st, nil
+}
+
+// DataSourceName returns the database/sql data source name for the
+// "sqlite" driver that Open uses for filename with opts, for callers that
+// need their own *sql.DB on the same file. Pragmas in the name are applied
+// to every connection in the pool.
+func DataSourceName(filename string, opts ...OpenOption) (string, error) {
+	var cfg openConfig
+	for _, o := range opts {
+		o(&cfg)
+	}
+	return dataSourceName(filename, cfg)
+}
+
+// dataSourceName returns the name to open filename as configured by cfg.
+//
+// Files are opened by URI so that characters such as ? and # in
+// filename are escaped rather than taken as the start of the query.
+func dataSourceName(filename string, cfg openConfig) (string, error) {
+	q := make(url.Values)
+	if cfg.readOnly {
+		q.Set("mode", "ro")
+		q.Add("_pragma", "query_only(1)")
+	}
+	if cfg.busyTimeout > 0 {
+		q.Add("_pragma", "busy_timeout("+strconv.FormatInt(cfg.busyTimeout.Milliseconds(), 10)+")")
+	}
+
+	if filename == MemoryFilename {
+		if len(q) == 0 {
+			return filename, nil
+		}
+		return filename + "?" + q.Encode(), nil
+	}
+
+	// A relative path would be taken as the URI's authority.
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	p := filepath.ToSlash(abs)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	u := url.URL{Scheme: "file", Path: p, RawQuery: q.Encode()}
+	return u.String(), nil
+}
+
+// OpenOption configures a DB opened with Open.
+type OpenOption func(*openConfig)
+
+type openConfig struct {
+	maxOpenConns int
+	busyTimeout  time.Duration
+	timeout      time.Duration
+	readOnly     bool
+	nameTemplate *template.Template
+	nameLocation *time.Location
+	backupDir    string
+	backupKeep   int
+}
+
+// WithMaxOpenConns limits the number of open connections to the database.
+// The default is no limit.
+func WithMaxOpenConns(n int) OpenOption {
+	return func(cfg *openConfig) {
+		cfg.maxOpenConns = n
+	}
+}
+
+// WithBusyTimeout makes statements wait up to d for other connections,
+// possibly in other processes, to release their locks rather than failing
+// immediately with SQLITE_BUSY.
+func WithBusyTimeout(d time.Duration) OpenOption {
+	return func(cfg *openConfig) {
+		cfg.busyTimeout = d
+	}
+}
+
+// WithTimeout limits how long each call to a DB method that takes a
+// context may run, including waiting for locks. The default is no limit.
+func WithTimeout(d time.Duration) OpenOption {
+	return func(cfg *openConfig) {
+		cfg.timeout = d
+	}
+}
+
+// WithReadOnly opens the database read-only, so it can be queried while
+// another process syncs to it or from a backup. Nothing is created or
+// migrated, so the database must already be at SchemaVersion, and methods
+// that write fail.
+func WithReadOnly() OpenOption {
+	return func(cfg *openConfig) {
+		cfg.readOnly = true
+	}
+}
+
+// withTimeout returns ctx limited by the timeout from WithTimeout, if any.
+func (d *DB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d.timeout)
+}
+
+// SQL returns the underlying database, for queries beyond what DB
+// provides.
+func (s *DB) SQL() *sql.DB {
+	return s.db
+}
+
+func (s *DB) init() error {
+	for _, q := range []string{
+		"create table if not exists workouts (id integer primary key, user_name text not null, name text not null, kind text not null, activity_type text, kcal integer, distance_m numeric, speed_mps numeric, duration_s integer, step_count bigint, gain_m numeric, started_at datetime, created_at datetime, updated_at datetime)",
+		"create table if not exists workout_distances (workout_id integer references workouts (id), elapsed_seconds numeric, total_meters numeric)",
+		"create table if not exists workout_positions (workout_id integer references workouts (id), elapsed_seconds numeric, elevation numeric, lat numeric, lng numeric)",
+		"create table if not exists workout_speeds (workout_id integer references workouts (id), elapsed_seconds numeric, meters_per_second numeric)",
+		"create table if not exists workout_steps (workout_id integer references workouts (id), elapsed_seconds numeric, steps numeric)",
+	} {
+		_, err := s.db.Exec(q)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := s.migrate(); err != nil {
+		return err
+	}
+
+	if err := s.initTrash(); err != nil {
+		return err
+	}
+
+	if err := s.loadZones(); err != nil {
+		return err
+	}
+
+	if err := s.loadKinds(); err != nil {
+		return err
+	}
+
+	var n int
+	if err := s.db.QueryRow("select count(*) from sqlite_master where name='workout_bounds'").Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		s.spatialIndex = true
+		return s.backfillBounds()
+	}
+
+	return nil
+}
+
+// initReadOnly is init for a database opened with WithReadOnly, which
+// can only check that the schema is current.
+func (s *DB) initReadOnly() error {
+	var version int
+	if err := s.db.QueryRow("pragma user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version != SchemaVersion() {
+		return fmt.Errorf("database schema version is %d, want %d; open it for writing, such as with a sync, to migrate it", version, SchemaVersion())
+	}
+
+	if err := s.loadZones(); err != nil {
+		return err
+	}
+
+	if err := s.loadKinds(); err != nil {
+		return err
+	}
+
+	var n int
+	if err := s.db.QueryRow("select count(*) from sqlite_master where name='workout_bounds'").Scan(&n); err != nil {
+		return err
+	}
+	s.spatialIndex = n > 0
+	return nil
+}
+
+// EnableSpatialIndex creates the workout_bounds R*Tree, if needed, and
+// populates it for all synced workouts. Once created, the index is
+// maintained by every sync.
+func (s *DB) EnableSpatialIndex() error {
+	if _, err := s.db.Exec("create virtual table if not exists workout_bounds using rtree(workout_id, min_lat, max_lat, min_lng, max_lng)"); err != nil {
+		return fmt.Errorf("creating spatial index: %w", err)
+	}
+	s.spatialIndex = true
+	return s.backfillBounds()
+}
+
+func (s *DB) backfillBounds() error {
+	_, err := s.db.Exec("insert into workout_bounds select workout_id, min(lat), max(lat), min(lng), max(lng) from workout_positions where workout_id not in (select workout_id from workout_bounds) group by workout_id")
+	return err
+}
+
+// migration is a schema change applied on top of the tables created by
+// init. Its statements run first, followed by fn if it is set.
+type migration struct {
+	stmts []string
+	fn    func(context.Context, *sql.Tx) error
+}
+
+// migrations are applied in order. The database's user_version records
+// how many have been applied, so entries must only ever be appended.
+var migrations = []migration{
+	// Per-workout series presence flags and point counts.
+	{stmts: []string{
+		"alter table workouts add column has_distances boolean not null default false",
+		"alter table workouts add column distance_points integer not null default 0",
+		"alter table workouts add column has_positions boolean not null default false",
+		"alter table workouts add column position_points integer not null default 0",
+		"alter table workouts add column has_speeds boolean not null default false",
+		"alter table workouts add column speed_points integer not null default 0",
+		"alter table workouts add column has_steps boolean not null default false",
+		"alter table workouts add column step_points integer not null default 0",
+		"update workouts set distance_points=(select count(*) from workout_distances where workout_id=workouts.id), position_points=(select count(*) from workout_positions where workout_id=workouts.id), speed_points=(select count(*) from workout_speeds where workout_id=workouts.id), step_points=(select count(*) from workout_steps where workout_id=workouts.id)",
+		"update workouts set has_distances=distance_points>0, has_positions=position_points>0, has_speeds=speed_points>0, has_steps=step_points>0",
+	}},
+	// Downsampled preview geometry.
+	{
+		stmts: []string{
+			"create table workout_previews (workout_id integer references workouts (id), points integer not null, polyline text not null)",
+		},
+		fn: backfillPreviews,
+	},
+	// Series lookups by workout.
+	{stmts: []string{
+		"create index if not exists workout_distances_workout_id on workout_distances (workout_id)",
+		"create index if not exists workout_positions_workout_id on workout_positions (workout_id)",
+		"create index if not exists workout_speeds_workout_id on workout_speeds (workout_id)",
+		"create index if not exists workout_steps_workout_id on workout_steps (workout_id)",
+		"create index if not exists workout_previews_workout_id on workout_previews (workout_id)",
+	}},
+	// Per-run sync reports.
+	{stmts: []string{
+		"create table sync_runs (id integer primary key, user_name text not null, started_at datetime, finished_at datetime, begin_at datetime, end_at datetime, added integer, changed integer, unchanged integer, removed integer)",
+		"create table sync_run_changes (run_id integer references sync_runs (id), workout_id integer, change text not null)",
+	}},
+	// Average cadence derived from steps.
+	{
+		stmts: []string{
+			"alter table workouts add column avg_steps_per_minute numeric",
+		},
+		fn: backfillStepCadence,
+	},
+	// Total paused time.
+	{
+		stmts: []string{
+			"alter table workouts add column paused_s integer not null default 0",
+		},
+		fn: backfillPausedTime,
+	},
+	// VAM and detected climbs.
+	{
+		stmts: []string{
+			"alter table workouts add column vam numeric",
+			"update workouts set vam=gain_m / (duration_s / 3600.0) where duration_s > 0",
+			"create table workout_climbs (workout_id integer references workouts (id), start_elapsed_seconds numeric, end_elapsed_seconds numeric, gain_meters numeric, vam numeric)",
+			"create index workout_climbs_workout_id on workout_climbs (workout_id)",
+		},
+		fn: backfillClimbs,
+	},
+	// Start, max and min elevation.
+	{stmts: []string{
+		"alter table workouts add column start_elevation_m numeric",
+		"alter table workouts add column max_elevation_m numeric",
+		"alter table workouts add column min_elevation_m numeric",
+		"update workouts set start_elevation_m=(select elevation from workout_positions where workout_id=workouts.id order by elapsed_seconds limit 1), max_elevation_m=(select max(elevation) from workout_positions where workout_id=workouts.id), min_elevation_m=(select min(elevation) from workout_positions where workout_id=workouts.id) where has_positions",
+	}},
+	// Heart rates and time in zones.
+	{stmts: []string{
+		"alter table workouts add column has_heart_rates boolean not null default false",
+		"alter table workouts add column heart_rate_points integer not null default 0",
+		"create table workout_heart_rates (workout_id integer references workouts (id), elapsed_seconds numeric, beats_per_minute numeric)",
+		"create index workout_heart_rates_workout_id on workout_heart_rates (workout_id)",
+		"create table zones (kind text primary key, bounds text not null)",
+		"create table workout_zone_times (workout_id integer references workouts (id), kind text not null, zone integer not null, seconds numeric not null)",
+		"create index workout_zone_times_workout_id on workout_zone_times (workout_id)",
+	}},
+	// Threshold history and average heart rate for intensity.
+	{
+		stmts: []string{
+			"create table thresholds (kind text not null, effective_on text not null, value numeric not null, primary key (kind, effective_on))",
+			"alter table workouts add column avg_heart_rate numeric",
+		},
+		fn: backfillAverageHeartRate,
+	},
+	// Body weight log.
+	{stmts: []string{
+		"create table weights (user_name text not null, measured_on text not null, kg numeric not null, primary key (user_name, measured_on))",
+	}},
+	// Local workout notes, kept across syncs.
+	{stmts: []string{
+		"alter table workouts add column notes text",
+	}},
+	// Workouts that failed to fetch, to retry on later syncs.
+	{stmts: []string{
+		"create table sync_retries (workout_id integer primary key, user_name text not null, day text not null, attempts integer not null, last_error text not null, last_attempt_at datetime not null, permanent boolean not null default 0)",
+	}},
+	// Normalized workout kinds.
+	{
+		stmts: []string{
+			"create table kind_map (kind text primary key, normalized text not null)",
+			"alter table workouts add column normalized_kind text",
+		},
+		fn: backfillNormalizedKinds,
+	},
+	// Series checksums, to skip rewriting unchanged series.
+	{
+		stmts: []string{
+			"alter table workouts add column series_checksum text",
+		},
+		fn: backfillSeriesChecksums,
+	},
+	// Raw and GPS-glitch corrected speeds.
+	{
+		stmts: []string{
+			"alter table workouts add column max_speed_mps numeric",
+			"alter table workouts add column corrected_max_speed_mps numeric",
+			"alter table workouts add column corrected_speed_mps numeric",
+		},
+		fn: backfillCorrectedSpeeds,
+	},
+	// Names from the site, for workouts renamed by WithNameTemplate.
+	{stmts: []string{
+		"alter table workouts add column original_name text",
+		"update workouts set original_name=name",
+	}},
+	// Cadence.
+	{stmts: []string{
+		"alter table workouts add column has_cadences boolean not null default false",
+		"alter table workouts add column cadence_points integer not null default 0",
+		"create table workout_cadences (workout_id integer references workouts (id), elapsed_seconds numeric, revolutions_per_minute numeric)",
+		"create index workout_cadences_workout_id on workout_cadences (workout_id)",
+	}},
+	// Power.
+	{stmts: []string{
+		"alter table workouts add column has_powers boolean not null default false",
+		"alter table workouts add column power_points integer not null default 0",
+		"create table workout_powers (workout_id integer references workouts (id), elapsed_seconds numeric, watts numeric)",
+		"create index workout_powers_workout_id on workout_powers (workout_id)",
+	}},
+	// Local stars for favorite workouts, kept across syncs.
+	{stmts: []string{
+		"alter table workouts add column starred boolean not null default false",
+	}},
+	// How far an unfinished sync got, so the next can resume it.
+	{stmts: []string{
+		"create table sync_state (user_name text primary key, begin_at datetime not null, end_at datetime not null, through_at datetime not null, updated_at datetime not null)",
+	}},
+	// Positions snapped to roads by a map matching service.
+	{stmts: []string{
+		"create table workout_snapped_positions (workout_id integer references workouts (id), elapsed_seconds numeric, elevation numeric, lat numeric, lng numeric)",
+		"create index workout_snapped_positions_workout_id on workout_snapped_positions (workout_id)",
+	}},
+	// Where workouts started, from reverse geocoding.
+	{stmts: []string{
+		"create table workout_places (workout_id integer primary key references workouts (id), country text not null, region text not null, city text not null)",
+	}},
+	// Saved routes, and which workouts were attached to them.
+	{stmts: []string{
+		"alter table workouts add column route_id integer",
+		"create table routes (id integer primary key, user_name text not null, name text not null, description text not null, distance_m numeric, ascent_m numeric, descent_m numeric, created_at datetime, updated_at datetime)",
+		"create table route_points (route_id integer references routes (id), distance_m numeric, elevation numeric, lat numeric, lng numeric)",
+		"create index route_points_route_id on route_points (route_id)",
+	}},
+	// Wall clock time including pauses, from the site, and paused time
+	// found by comparing series to the time spent moving.
+	{
+		stmts: []string{
+			"alter table workouts add column elapsed_s integer",
+		},
+		fn: backfillPausedTime,
+	},
+	// Climbs detected again without short GPS elevation spikes.
+	{
+		stmts: []string{
+			"delete from workout_climbs",
+		},
+		fn: backfillClimbs,
+	},
+}
+
+// SchemaVersion returns the schema version a database has once all
+// migrations are applied, as recorded in its user_version.
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+func (s *DB) migrate() error {
+	var version int
+	if err := s.db.QueryRow("pragma user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if version < len(migrations) {
+		// A new database has nothing worth backing up.
+		var n int
+		if err := s.db.QueryRowContext(ctx, "select count(*) from workouts").Scan(&n); err != nil {
+			return err
+		}
+		if version > 0 || n > 0 {
+			if _, err := s.Backup(ctx, "migration-"+strconv.Itoa(version)+"-to-"+strconv.Itoa(len(migrations))); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		for _, q := range migrations[i].stmts {
+			if _, err := tx.ExecContext(ctx, q); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("applying migration %d: %w", i+1, err)
+			}
+		}
+		if fn := migrations[i].fn; fn != nil {
+			if err := fn(ctx, tx); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("applying migration %d: %w", i+1, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "pragma user_version="+strconv.Itoa(i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func backfillPreviews(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "select workout_id, lat, lng from workout_positions where lat is not null and lng is not null order by workout_id, elapsed_seconds")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byWorkout := make(map[int][]mapmyride.WorkoutPosition)
+	var ids []int
+	for rows.Next() {
+		var (
+			id int
+			p  mapmyride.WorkoutPosition
+		)
+		if err := rows.Scan(&id, &p.Lat, &p.Lng); err != nil {
+			return err
+		}
+		if _, ok := byWorkout[id]; !ok {
+			ids = append(ids, id)
+		}
+		byWorkout[id] = append(byWorkout[id], p)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := insertPreview(ctx, tx, id, byWorkout[id]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func backfillStepCadence(ctx context.Context, tx *sql.Tx) error {
+	ids, err := queryIDs(ctx, tx, "select id from workouts where has_steps")
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		w, err := loadBackfillWorkout(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "update workouts set avg_steps_per_minute=$1 where id=$2", w.AverageStepCadence(), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func backfillPausedTime(ctx context.Context, tx *sql.Tx) error {
+	ids, err := queryIDs(ctx, tx, "select id from workouts where has_positions or has_distances or has_speeds")
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		w, err := loadBackfillWorkout(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "update workouts set paused_s=$1 where id=$2", int(w.PausedTime().Seconds()), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func backfillAverageHeartRate(ctx context.Context, tx *sql.Tx) error {
+	ids, err := queryIDs(ctx, tx, "select id from workouts where has_heart_rates")
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		w, err := loadBackfillWorkout(ctx, tx, id, "workout_heart_rates")
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "update workouts set avg_heart_rate=$1 where id=$2", averageHeartRateArg(w), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func backfillCorrectedSpeeds(ctx context.Context, tx *sql.Tx) error {
+	ids, err := queryIDs(ctx, tx, "select id from workouts where has_speeds")
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		w, err := loadBackfillWorkout(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "update workouts set max_speed_mps=$1, corrected_max_speed_mps=$2, corrected_speed_mps=$3 where id=$4", w.MaxSpeed(), w.CorrectedMaxSpeed(), w.CorrectedAverageSpeed(), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func backfillClimbs(ctx context.Context, tx *sql.Tx) error {
+	ids, err := queryIDs(ctx, tx, "select id from workouts where has_positions")
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		w, err := loadBackfillWorkout(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := insertClimbs(ctx, tx, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertClimbs(ctx context.Context, tx *sql.Tx, w mapmyride.Workout) error {
+	for _, c := range w.Climbs() {
+		_, err := tx.ExecContext(
+			ctx,
+			"insert into workout_climbs (workout_id, start_elapsed_seconds, end_elapsed_seconds, gain_meters, vam) values ($1, $2, $3, $4, $5)",
+			w.ID, c.Start.Seconds(), c.End.Seconds(), c.Gain, c.VAM(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertPreview(ctx context.Context, tx *sql.Tx, workoutID int, positions []mapmyride.WorkoutPosition) error {
+	if len(positions) == 0 {
+		return nil
+	}
+	ps := previewPositions(positions, previewPoints)
+	_, err := tx.ExecContext(
+		ctx,
+		"insert into workout_previews (workout_id, points, polyline) values ($1, $2, $3)",
+		workoutID, len(ps), encodePolyline(ps),
+	)
+	return err
+}
+
+// LatestStartedAt returns the start of the day, in loc, on which
+// userName's latest stored workout started, or the zero time if there
+// are none.
+func (d *DB) LatestStartedAt(ctx context.Context, userName string, loc *time.Location) (time.Time, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	row := d.db.QueryRowContext(ctx, "select max(started_at) from workouts where user_name=?", userName)
+	var latests sql.NullString
+	if err := row.Scan(&latests); err != nil {
+		return time.Time{}, err
+	}
+	if !latests.Valid {
+		return time.Time{}, nil
+	}
+
+	latest, err := time.Parse(timeFormat, latests.String)
+	if err != nil {
+		return time.Time{}, err
+	}
+	y, m, dd := latest.In(loc).Date()
+	return time.Date(y, m, dd, 0, 0, 0, 0, loc), nil
+}
+
+const timeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// seriesTables hold per-workout rows keyed by workout_id.
+var seriesTables = []string{"workout_distances", "workout_positions", "workout_speeds", "workout_steps", "workout_previews", "workout_climbs", "workout_heart_rates", "workout_zone_times", "workout_cadences", "workout_powers", "workout_snapped_positions", "workout_places"}
+
+// Sync stores w for userName, replacing any existing copy, and reports
+// how it differs from what was stored.
+func (d *DB) Sync(ctx context.Context, userName string, w mapmyride.Workout) (Change, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	name, err := d.storedName(w)
+	if err != nil {
+		return "", err
+	}
+
+	checksum := seriesChecksum(w)
+	change, err := compareStored(ctx, tx, w, checksum)
+	if err != nil {
+		return "", err
+	}
+
+	// Notes and stars only exist locally so carry them over to the new
+	// row.
+	var (
+		notes, storedChecksum sql.NullString
+		starred               bool
+	)
+	err = tx.QueryRowContext(ctx, "select notes, series_checksum, starred from workouts where id=$1", w.ID).Scan(&notes, &storedChecksum, &starred)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	// Series are by far most of what's written, so leave them be when
+	// they haven't changed.
+	sameSeries := storedChecksum.Valid && storedChecksum.String == checksum
+
+	if !sameSeries {
+		for _, t := range seriesTables {
+			_, err := tx.ExecContext(ctx, "delete from "+t+" where workout_id=$1", w.ID)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from workouts where id=$1", w.ID)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from sync_retries where workout_id=$1", w.ID)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"insert into workouts (id, user_name, name, kind, activity_type, kcal, distance_m, speed_mps, duration_s, step_count, gain_m, started_at, created_at, updated_at, has_distances, distance_points, has_positions, position_points, has_speeds, speed_points, has_steps, step_points, avg_steps_per_minute, paused_s, vam, start_elevation_m, max_elevation_m, min_elevation_m, has_heart_rates, heart_rate_points, avg_heart_rate, notes, normalized_kind, series_checksum, max_speed_mps, corrected_max_speed_mps, corrected_speed_mps, original_name, has_cadences, cadence_points, has_powers, power_points, starred, route_id, elapsed_s) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34, $35, $36, $37, $38, $39, $40, $41, $42, $43, $44, $45)",
+		w.ID, userName, name, w.Kind, w.ActivityType, w.Kcal, w.Distance, w.Speed,
+		int(w.Duration.Seconds()), w.StepCount, w.Gain,
+		w.StartedAt.Format(timeFormat), w.CreatedAt.Format(timeFormat), w.UpdatedAt.Format(timeFormat),
+		len(w.Distances) > 0, len(w.Distances), len(w.Positions) > 0, len(w.Positions),
+		len(w.Speeds) > 0, len(w.Speeds), len(w.Steps) > 0, len(w.Steps),
+		w.AverageStepCadence(), int(w.PausedTime().Seconds()), w.VAM(),
+		elevationArg(w, w.StartElevation), elevationArg(w, w.MaxElevation), elevationArg(w, w.MinElevation),
+		len(w.HeartRates) > 0, len(w.HeartRates), averageHeartRateArg(w),
+		notes, d.NormalizeKind(w.Kind), checksum,
+		speedArg(w, w.MaxSpeed()), speedArg(w, w.CorrectedMaxSpeed()), speedArg(w, w.CorrectedAverageSpeed()),
+		w.Name, len(w.Cadences) > 0, len(w.Cadences),
+		len(w.Powers) > 0, len(w.Powers), starred, routeIDArg(w), elapsedArg(w),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	if !sameSeries {
+		if err := d.insertSeries(ctx, tx, w); err != nil {
+			return "", err
+		}
+	}
+
+	return change, tx.Commit()
+}
+
+// insertSeries writes w's series, and what's derived from them, to the
+// series tables.
+func (d *DB) insertSeries(ctx context.Context, tx *sql.Tx, w mapmyride.Workout) error {
+	for _, d := range w.Distances {
+		_, err := tx.ExecContext(
+			ctx,
+			"insert into workout_distances (workout_id, elapsed_seconds, total_meters) values ($1, $2, $3)",
+			w.ID, d.Elapsed.Seconds(), d.Total,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range w.Positions {
+		_, err := tx.ExecContext(
+			ctx,
+			"insert into workout_positions (workout_id, elapsed_seconds, elevation, lat, lng) values ($1, $2, $3, $4, $5)",
+			w.ID, p.Elapsed.Seconds(), p.Elevation, p.Lat, p.Lng,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := insertPreview(ctx, tx, w.ID, w.Positions); err != nil {
+		return err
+	}
+
+	if err := insertClimbs(ctx, tx, w); err != nil {
+		return err
+	}
+
+	if d.spatialIndex {
+		if _, err := tx.ExecContext(ctx, "delete from workout_bounds where workout_id=$1", w.ID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "insert into workout_bounds select workout_id, min(lat), max(lat), min(lng), max(lng) from workout_positions where workout_id=$1 group by workout_id", w.ID); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range w.Speeds {
+		_, err := tx.ExecContext(
+			ctx,
+			"insert into workout_speeds (workout_id, elapsed_seconds, meters_per_second) values ($1, $2, $3)",
+			w.ID, s.Elapsed.Seconds(), s.MetersPerSecond,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, s := range w.Steps {
+		_, err := tx.ExecContext(
+			ctx,
+			"insert into workout_steps (workout_id, elapsed_seconds, steps) values ($1, $2, $3)",
+			w.ID, s.Elapsed.Seconds(), s.StepsInPeriod,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, h := range w.HeartRates {
+		_, err := tx.ExecContext(
+			ctx,
+			"insert into workout_heart_rates (workout_id, elapsed_seconds, beats_per_minute) values ($1, $2, $3)",
+			w.ID, h.Elapsed.Seconds(), h.BeatsPerMinute,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, c := range w.Cadences {
+		_, err := tx.ExecContext(
+			ctx,
+			"insert into workout_cadences (workout_id, elapsed_seconds, revolutions_per_minute) values ($1, $2, $3)",
+			w.ID, c.Elapsed.Seconds(), c.RPM,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range w.Powers {
+		_, err := tx.ExecContext(
+			ctx,
+			"insert into workout_powers (workout_id, elapsed_seconds, watts) values ($1, $2, $3)",
+			w.ID, p.Elapsed.Seconds(), p.Watts,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(d.hrZones) > 0 {
+		if err := insertZoneTimes(ctx, tx, heartRateZones, w.ID, w.HeartRateZoneTimes(d.hrZones)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// elevationArg returns v, or nil if w has no elevation data at all so
+// its elevation columns are left null.
+func elevationArg(w mapmyride.Workout, v float64) interface{} {
+	if len(w.Positions) == 0 && w.StartElevation == 0 && w.MaxElevation == 0 && w.MinElevation == 0 {
+		return nil
+	}
+	return v
+}
+
+// averageHeartRateArg returns w's average heart rate, or nil if it has
+// none so avg_heart_rate is left null.
+func averageHeartRateArg(w mapmyride.Workout) interface{} {
+	if avg := w.AverageHeartRate(); avg > 0 {
+		return avg
+	}
+	return nil
+}
+
+// speedArg returns v, or nil if w has no speeds so its speed columns
+// derived from them are left null.
+func speedArg(w mapmyride.Workout, v float64) interface{} {
+	if len(w.Speeds) == 0 {
+		return nil
+	}
+	return v
+}
+
+// routeIDArg returns w's route ID, or nil if it has none.
+func routeIDArg(w mapmyride.Workout) interface{} {
+	if w.RouteID == 0 {
+		return nil
+	}
+	return w.RouteID
+}
+
+// elapsedArg returns w's elapsed time in seconds, or nil if it isn't
+// known.
+func elapsedArg(w mapmyride.Workout) interface{} {
+	if w.ElapsedTime <= 0 {
+		return nil
+	}
+	return int(w.ElapsedTime.Seconds())
+}
+
+// RemoveExtra moves workouts stored for userName in the begin to end range
+// that are not in workouts to the trash, returning their IDs.
+//
+// Unless force is set, it refuses to do so when workouts is empty or when
+// more than half of the stored workouts would be removed, as that's more
+// likely a problem fetching workouts than real deletions.
+func (d *DB) RemoveExtra(ctx context.Context, userName string, begin, end time.Time, workouts []mapmyride.Workout, force bool) ([]int, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Fetched IDs go in a temporary table rather than the query itself
+	// so full history syncs of large accounts don't run into SQLite's
+	// limits on statement length or bound parameters.
+	if _, err := tx.ExecContext(ctx, "create temp table fetched_ids (id integer primary key)"); err != nil {
+		return nil, err
+	}
+	ins, err := tx.PrepareContext(ctx, "insert or ignore into fetched_ids (id) values ($1)")
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range workouts {
+		if _, err := ins.ExecContext(ctx, w.ID); err != nil {
+			ins.Close()
+			return nil, err
+		}
+	}
+	ins.Close()
+
+	// Bounds are compared as text, so format them like stored times.
+	beginArg, endArg := begin.UTC().Format(timeFormat), end.UTC().Format(timeFormat)
+	rows, err := tx.QueryContext(ctx, "select id from workouts where started_at >= $1 and started_at <= $2 and user_name=$3 and id not in (select id from fetched_ids)", beginArg, endArg, userName)
+	if err != nil {
+		return nil, err
+	}
+	var extra []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		extra = append(extra, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(extra) > 0 && !force {
+		var stored int
+		if err := tx.QueryRowContext(ctx, "select count(*) from workouts where started_at >= $1 and started_at <= $2 and user_name=$3", beginArg, endArg, userName).Scan(&stored); err != nil {
+			return nil, err
+		}
+		if len(workouts) == 0 || len(extra)*2 > stored {
+			return nil, fmt.Errorf("refusing to remove %d of %d stored workouts for %s after fetching %d; sync with force if they really were deleted", len(extra), stored, userName, len(workouts))
+		}
+	}
+
+	for _, id := range extra {
+		if err := d.trash(ctx, tx, id, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "drop table fetched_ids"); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return extra, nil
+}
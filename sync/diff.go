@@ -0,0 +1,141 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/danp/mapmyride"
+)
+
+// Change describes what a sync did to a stored workout.
+type Change string
+
+const (
+	Added     Change = "added"
+	Changed   Change = "changed"
+	Unchanged Change = "unchanged"
+	Removed   Change = "removed"
+	// Failed means the workout couldn't be fetched and will be retried.
+	Failed Change = "failed"
+	// Skipped means the workout was shorter than WithMinDistance or
+	// WithMinDuration allow and wasn't stored.
+	Skipped Change = "skipped"
+)
+
+// Run collects the changes made by one sync run.
+type Run struct {
+	UserName              string
+	StartedAt, FinishedAt time.Time
+	// Begin and End are the range of workout start times synced.
+	Begin, End time.Time
+	// Through is the end of the last month of the range whose workouts
+	// were all stored, or their failures recorded, so a run that fails
+	// part way can be carried on from there. It is End once the whole
+	// range is done.
+	Through time.Time
+	// Changes maps workout IDs to what the run did to them.
+	Changes map[int]Change
+}
+
+// Count returns the number of workouts in r with change c.
+func (r Run) Count(c Change) int {
+	var n int
+	for _, rc := range r.Changes {
+		if rc == c {
+			n++
+		}
+	}
+	return n
+}
+
+// Summary returns a one-line summary of r's changes.
+func (r Run) Summary() string {
+	s := fmt.Sprintf("%d added, %d changed, %d unchanged, %d removed",
+		r.Count(Added), r.Count(Changed), r.Count(Unchanged), r.Count(Removed))
+	if n := r.Count(Failed); n > 0 {
+		s += fmt.Sprintf(", %d failed", n)
+	}
+	if n := r.Count(Skipped); n > 0 {
+		s += fmt.Sprintf(", %d skipped", n)
+	}
+	return s
+}
+
+// compareStored reports how w, whose series have checksum seriesSum,
+// differs from the stored copy of the workout with the same ID, if any.
+// Series recalculated upstream without other changes count as changes.
+func compareStored(ctx context.Context, tx *sql.Tx, w mapmyride.Workout, seriesSum string) (Change, error) {
+	var (
+		name, kind                              string
+		distance, gain                          float64
+		durationS, positions, steps, heartRates int
+		cadences, powers                        int
+		updatedAt                               time.Time
+		storedSum                               sql.NullString
+	)
+	err := tx.QueryRowContext(
+		ctx,
+		"select coalesce(original_name, name), kind, distance_m, gain_m, duration_s, position_points, step_points, heart_rate_points, cadence_points, power_points, updated_at, series_checksum from workouts where id=$1",
+		w.ID,
+	).Scan(&name, &kind, &distance, &gain, &durationS, &positions, &steps, &heartRates, &cadences, &powers, &updatedAt, &storedSum)
+	if err == sql.ErrNoRows {
+		return Added, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !updatedAt.Equal(w.UpdatedAt) ||
+		name != w.Name || kind != w.Kind ||
+		distance != w.Distance || gain != w.Gain ||
+		durationS != int(w.Duration.Seconds()) ||
+		positions != len(w.Positions) || steps != len(w.Steps) ||
+		heartRates != len(w.HeartRates) || cadences != len(w.Cadences) ||
+		powers != len(w.Powers) ||
+		(storedSum.Valid && storedSum.String != seriesSum) {
+		return Changed, nil
+	}
+	return Unchanged, nil
+}
+
+// RecordRun stores a summary of run in sync_runs and the workouts it
+// added, changed or removed in sync_run_changes.
+func (d *DB) RecordRun(ctx context.Context, run Run) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(
+		ctx,
+		"insert into sync_runs (user_name, started_at, finished_at, begin_at, end_at, added, changed, unchanged, removed) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		run.UserName,
+		run.StartedAt.Format(timeFormat), run.FinishedAt.Format(timeFormat),
+		run.Begin.Format(timeFormat), run.End.Format(timeFormat),
+		run.Count(Added), run.Count(Changed), run.Count(Unchanged), run.Count(Removed),
+	)
+	if err != nil {
+		return err
+	}
+	runID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for id, c := range run.Changes {
+		if c == Unchanged {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "insert into sync_run_changes (run_id, workout_id, change) values ($1, $2, $3)", runID, id, string(c)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,162 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+)
+
+// DefaultKinds maps workout kinds as reported by the site, which are
+// inconsistent across devices and app versions, to the kinds they are
+// stored as in normalized_kind. Kinds not listed are stored as is.
+var DefaultKinds = map[string]string{
+	"bike":            "ride",
+	"bike_ride":       "ride",
+	"biking":          "ride",
+	"cycling":         "ride",
+	"road_cycling":    "ride",
+	"road_bike":       "ride",
+	"mountain_biking": "ride",
+	"mountain_bike":   "ride",
+	"gravel_cycling":  "ride",
+	"running":         "run",
+	"jog":             "run",
+	"jogging":         "run",
+	"road_running":    "run",
+	"trail_running":   "run",
+	"walking":         "walk",
+	"hiking":          "hike",
+	"swimming":        "swim",
+}
+
+// kindKey returns kind in the form DefaultKinds and SetKinds keys are
+// matched in: lower case with words joined by underscores.
+func kindKey(kind string) string {
+	return strings.NewReplacer("-", "_", " ", "_").Replace(strings.ToLower(strings.TrimSpace(kind)))
+}
+
+// normalizeKind returns the normalized form of kind using overrides, then
+// DefaultKinds.
+func normalizeKind(overrides map[string]string, kind string) string {
+	k := kindKey(kind)
+	if n, ok := overrides[k]; ok {
+		return n
+	}
+	if n, ok := DefaultKinds[k]; ok {
+		return n
+	}
+	return kind
+}
+
+// NormalizeKind returns the kind a workout of the given kind is stored
+// with in normalized_kind.
+func (d *DB) NormalizeKind(kind string) string {
+	return normalizeKind(d.kinds, kind)
+}
+
+// loadKinds reads the overrides set by SetKinds, if any.
+func (s *DB) loadKinds() error {
+	rows, err := s.db.Query("select kind, normalized from kind_map")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	kinds := make(map[string]string)
+	for rows.Next() {
+		var k, n string
+		if err := rows.Scan(&k, &n); err != nil {
+			return err
+		}
+		kinds[k] = n
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	s.kinds = kinds
+	return nil
+}
+
+// SetKinds sets kind normalizations that override DefaultKinds, replacing
+// any set before. They are saved in the database and used by future
+// syncs. If they differ from the overrides already set, normalized_kind
+// is recomputed for all stored workouts.
+func (d *DB) SetKinds(ctx context.Context, overrides map[string]string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	kinds := make(map[string]string, len(overrides))
+	for k, n := range overrides {
+		kinds[kindKey(k)] = n
+	}
+	if kindsString(kinds) == kindsString(d.kinds) {
+		return nil
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "delete from kind_map"); err != nil {
+		return err
+	}
+	for k, n := range kinds {
+		if _, err := tx.ExecContext(ctx, "insert into kind_map (kind, normalized) values ($1, $2)", k, n); err != nil {
+			return err
+		}
+	}
+	if err := renormalizeKinds(ctx, tx, kinds); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	d.kinds = kinds
+	return nil
+}
+
+// kindsString returns a canonical string form of kinds for comparison.
+func kindsString(kinds map[string]string) string {
+	parts := make([]string, 0, len(kinds))
+	for k, n := range kinds {
+		parts = append(parts, k+"="+n)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// renormalizeKinds sets normalized_kind for all stored workouts.
+func renormalizeKinds(ctx context.Context, tx *sql.Tx, overrides map[string]string) error {
+	rows, err := tx.QueryContext(ctx, "select distinct kind from workouts")
+	if err != nil {
+		return err
+	}
+	var kinds []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			rows.Close()
+			return err
+		}
+		kinds = append(kinds, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, k := range kinds {
+		if _, err := tx.ExecContext(ctx, "update workouts set normalized_kind=$1 where kind=$2", normalizeKind(overrides, k), k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func backfillNormalizedKinds(ctx context.Context, tx *sql.Tx) error {
+	return renormalizeKinds(ctx, tx, nil)
+}
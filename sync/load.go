@@ -0,0 +1,236 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/danp/mapmyride"
+)
+
+// dbtx is implemented by both *sql.DB and *sql.Tx.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// LoadWorkout reads the stored workout id, including its series.
+func (d *DB) LoadWorkout(ctx context.Context, id int) (mapmyride.Workout, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	return loadWorkout(ctx, d.db, id)
+}
+
+// loadWorkout reads a stored workout, including its series, back into a
+// mapmyride.Workout.
+func loadWorkout(ctx context.Context, q dbtx, id int) (mapmyride.Workout, error) {
+	w := mapmyride.Workout{ID: id}
+
+	var durationS, elapsedS int
+	err := q.QueryRowContext(
+		ctx,
+		"select name, kind, coalesce(activity_type, ''), coalesce(kcal, 0), coalesce(distance_m, 0), coalesce(speed_mps, 0), coalesce(duration_s, 0), coalesce(step_count, 0), coalesce(gain_m, 0), coalesce(start_elevation_m, 0), coalesce(max_elevation_m, 0), coalesce(min_elevation_m, 0), started_at, created_at, updated_at, coalesce(route_id, 0), coalesce(elapsed_s, 0) from workouts where id=$1",
+		id,
+	).Scan(
+		&w.Name, &w.Kind, &w.ActivityType, &w.Kcal, &w.Distance, &w.Speed,
+		&durationS, &w.StepCount, &w.Gain, &w.StartElevation, &w.MaxElevation, &w.MinElevation,
+		&w.StartedAt, &w.CreatedAt, &w.UpdatedAt, &w.RouteID, &elapsedS,
+	)
+	if err != nil {
+		return mapmyride.Workout{}, err
+	}
+	w.Duration = time.Duration(durationS) * time.Second
+	w.ElapsedTime = time.Duration(elapsedS) * time.Second
+
+	for _, s := range storedSeries {
+		if err := s.load(ctx, q, &w); err != nil {
+			return mapmyride.Workout{}, err
+		}
+	}
+	return w, nil
+}
+
+// loadBackfillWorkout is loadWorkout for migration backfills, which run
+// before later migrations have added columns and tables. It only reads the
+// workouts columns and series tables created by init, along with the
+// series in tables, which must exist by the migration calling it.
+func loadBackfillWorkout(ctx context.Context, tx *sql.Tx, id int, tables ...string) (mapmyride.Workout, error) {
+	w := mapmyride.Workout{ID: id}
+
+	var durationS int
+	err := tx.QueryRowContext(
+		ctx,
+		"select name, kind, coalesce(activity_type, ''), coalesce(kcal, 0), coalesce(distance_m, 0), coalesce(speed_mps, 0), coalesce(duration_s, 0), coalesce(step_count, 0), coalesce(gain_m, 0), started_at, created_at, updated_at from workouts where id=$1",
+		id,
+	).Scan(
+		&w.Name, &w.Kind, &w.ActivityType, &w.Kcal, &w.Distance, &w.Speed,
+		&durationS, &w.StepCount, &w.Gain, &w.StartedAt, &w.CreatedAt, &w.UpdatedAt,
+	)
+	if err != nil {
+		return mapmyride.Workout{}, err
+	}
+	w.Duration = time.Duration(durationS) * time.Second
+
+	want := map[string]bool{
+		"workout_distances": true,
+		"workout_positions": true,
+		"workout_speeds":    true,
+		"workout_steps":     true,
+	}
+	for _, t := range tables {
+		want[t] = true
+	}
+	for _, s := range storedSeries {
+		if !want[s.table] {
+			continue
+		}
+		if err := s.load(ctx, tx, &w); err != nil {
+			return mapmyride.Workout{}, err
+		}
+	}
+	return w, nil
+}
+
+// seriesLoader reads a series table's rows for a workout into it, with
+// scan taking elapsed_seconds and cols from each row.
+type seriesLoader struct {
+	table string
+	cols  string
+	scan  func(rows *sql.Rows, w *mapmyride.Workout) error
+}
+
+// storedSeries are the series tables loadWorkout reads.
+var storedSeries = []seriesLoader{
+	{"workout_distances", "total_meters", func(rows *sql.Rows, w *mapmyride.Workout) error {
+		var (
+			el float64
+			d  mapmyride.WorkoutDistance
+		)
+		if err := rows.Scan(&el, &d.Total); err != nil {
+			return err
+		}
+		d.Elapsed = seconds(el)
+		w.Distances = append(w.Distances, d)
+		return nil
+	}},
+	{"workout_positions", "elevation, lat, lng", func(rows *sql.Rows, w *mapmyride.Workout) error {
+		var (
+			el float64
+			p  mapmyride.WorkoutPosition
+		)
+		if err := rows.Scan(&el, &p.Elevation, &p.Lat, &p.Lng); err != nil {
+			return err
+		}
+		p.Elapsed = seconds(el)
+		w.Positions = append(w.Positions, p)
+		return nil
+	}},
+	{"workout_speeds", "meters_per_second", func(rows *sql.Rows, w *mapmyride.Workout) error {
+		var (
+			el float64
+			s  mapmyride.WorkoutSpeed
+		)
+		if err := rows.Scan(&el, &s.MetersPerSecond); err != nil {
+			return err
+		}
+		s.Elapsed = seconds(el)
+		w.Speeds = append(w.Speeds, s)
+		return nil
+	}},
+	{"workout_steps", "steps", func(rows *sql.Rows, w *mapmyride.Workout) error {
+		var (
+			el float64
+			s  mapmyride.WorkoutStep
+		)
+		if err := rows.Scan(&el, &s.StepsInPeriod); err != nil {
+			return err
+		}
+		s.Elapsed = seconds(el)
+		w.Steps = append(w.Steps, s)
+		return nil
+	}},
+	{"workout_heart_rates", "beats_per_minute", func(rows *sql.Rows, w *mapmyride.Workout) error {
+		var (
+			el float64
+			h  mapmyride.WorkoutHeartRate
+		)
+		if err := rows.Scan(&el, &h.BeatsPerMinute); err != nil {
+			return err
+		}
+		h.Elapsed = seconds(el)
+		w.HeartRates = append(w.HeartRates, h)
+		return nil
+	}},
+	{"workout_cadences", "revolutions_per_minute", func(rows *sql.Rows, w *mapmyride.Workout) error {
+		var (
+			el float64
+			c  mapmyride.WorkoutCadence
+		)
+		if err := rows.Scan(&el, &c.RPM); err != nil {
+			return err
+		}
+		c.Elapsed = seconds(el)
+		w.Cadences = append(w.Cadences, c)
+		return nil
+	}},
+	{"workout_powers", "watts", func(rows *sql.Rows, w *mapmyride.Workout) error {
+		var (
+			el float64
+			p  mapmyride.WorkoutPower
+		)
+		if err := rows.Scan(&el, &p.Watts); err != nil {
+			return err
+		}
+		p.Elapsed = seconds(el)
+		w.Powers = append(w.Powers, p)
+		return nil
+	}},
+}
+
+// load reads w's rows of the series into it, in elapsed order.
+func (s seriesLoader) load(ctx context.Context, q dbtx, w *mapmyride.Workout) error {
+	return loadSeries(ctx, q, "select elapsed_seconds, "+s.cols+" from "+s.table+" where workout_id=$1 order by elapsed_seconds", w.ID, func(rows *sql.Rows) error {
+		return s.scan(rows, w)
+	})
+}
+
+func loadSeries(ctx context.Context, q dbtx, query string, id int, scan func(*sql.Rows) error) error {
+	rows, err := q.QueryContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// seconds converts a stored elapsed_seconds value back to a duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s*1000) * time.Millisecond
+}
+
+// queryIDs returns the integer first column of each row returned by query.
+func queryIDs(ctx context.Context, q dbtx, query string, args ...interface{}) ([]int, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
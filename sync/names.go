@@ -0,0 +1,100 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/danp/mapmyride"
+)
+
+// GenericNames are workout names the site gives workouts by default,
+// which WithNameTemplate replaces. Names matching the workout's kind or
+// activity type are also treated as generic. Matching ignores case.
+var GenericNames = []string{
+	"Bike Ride",
+	"Ride",
+	"Road Cycling",
+	"Run",
+	"Run / Jog",
+	"Walk",
+	"Hike",
+	"Workout",
+}
+
+// NameTemplateData is what a WithNameTemplate template is executed with.
+type NameTemplateData struct {
+	// Name is the workout's name from the site.
+	Name         string
+	Kind         string
+	ActivityType string
+	// StartedAt is in the location given to WithNameTemplate.
+	StartedAt time.Time
+	// Date is StartedAt's day, such as 2021-07-10.
+	Date       string
+	DistanceKm float64
+	// Start is the first position as "lat,lng" to 3 decimal places, or
+	// empty if the workout has no positions.
+	Start string
+}
+
+// WithNameTemplate makes Sync store workouts with generic names, see
+// GenericNames, under the name tmpl produces from their NameTemplateData
+// instead, with times in loc. The name from the site is kept in
+// original_name, and workouts are still compared to the site by it.
+func WithNameTemplate(tmpl *template.Template, loc *time.Location) OpenOption {
+	return func(cfg *openConfig) {
+		cfg.nameTemplate = tmpl
+		cfg.nameLocation = loc
+	}
+}
+
+// storedName returns the name w is stored under.
+func (d *DB) storedName(w mapmyride.Workout) (string, error) {
+	if d.nameTemplate == nil || !isGenericName(w) {
+		return w.Name, nil
+	}
+
+	loc := d.nameLocation
+	if loc == nil {
+		loc = time.UTC
+	}
+	data := NameTemplateData{
+		Name:         w.Name,
+		Kind:         w.Kind,
+		ActivityType: w.ActivityType,
+		StartedAt:    w.StartedAt.In(loc),
+		Date:         w.StartedAt.In(loc).Format("2006-01-02"),
+		DistanceKm:   w.Distance / 1000,
+	}
+	if len(w.Positions) > 0 {
+		data.Start = fmt.Sprintf("%.3f,%.3f", w.Positions[0].Lat, w.Positions[0].Lng)
+	}
+
+	var b strings.Builder
+	if err := d.nameTemplate.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("naming workout %d: %w", w.ID, err)
+	}
+	if name := strings.TrimSpace(b.String()); name != "" {
+		return name, nil
+	}
+	return w.Name, nil
+}
+
+// isGenericName reports whether w has a default name from the site.
+func isGenericName(w mapmyride.Workout) bool {
+	name := strings.TrimSpace(w.Name)
+	if name == "" {
+		return true
+	}
+	if strings.EqualFold(name, w.ActivityType) || strings.EqualFold(name, strings.ReplaceAll(w.Kind, "_", " ")) {
+		return true
+	}
+	for _, g := range GenericNames {
+		if strings.EqualFold(name, g) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Note returns the local note for the workout with the given ID, or the
+// empty string if it has none.
+func (d *DB) Note(ctx context.Context, id int) (string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var note sql.NullString
+	err := d.db.QueryRowContext(ctx, "select notes from workouts where id=$1", id).Scan(&note)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("no workout %d", id)
+	}
+	return note.String, err
+}
+
+// SetNote sets the local note for the workout with the given ID. An empty
+// note removes it. Notes are kept when the workout is synced again.
+func (d *DB) SetNote(ctx context.Context, id int, note string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var arg interface{}
+	if note != "" {
+		arg = note
+	}
+	res, err := d.db.ExecContext(ctx, "update workouts set notes=$1 where id=$2", arg, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no workout %d", id)
+	}
+	return nil
+}
+
+// SetStarred stars or unstars the workout with the given ID, to mark it
+// as a favorite. Stars are kept when the workout is synced again.
+func (d *DB) SetStarred(ctx context.Context, id int, starred bool) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	res, err := d.db.ExecContext(ctx, "update workouts set starred=$1 where id=$2", starred, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no workout %d", id)
+	}
+	return nil
+}
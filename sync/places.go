@@ -0,0 +1,47 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Place is where a workout started, as named by a reverse geocoder. Any
+// part it couldn't name is empty.
+type Place struct {
+	Country string
+	Region  string // such as a state or province
+	City    string // or town or village
+}
+
+// SetPlace stores where the workout with the given ID started, replacing
+// any place stored before. It is kept when the workout is synced again
+// unless its series change.
+func (d *DB) SetPlace(ctx context.Context, id int, p Place) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(
+		ctx,
+		`insert into workout_places (workout_id, country, region, city) values ($1, $2, $3, $4)
+		on conflict (workout_id) do update set country=excluded.country, region=excluded.region, city=excluded.city`,
+		id, p.Country, p.Region, p.City,
+	)
+	return err
+}
+
+// Place returns where the workout with the given ID started, and false if
+// it hasn't been geocoded.
+func (d *DB) Place(ctx context.Context, id int) (Place, bool, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var p Place
+	err := d.db.QueryRowContext(ctx, "select country, region, city from workout_places where workout_id=$1", id).Scan(&p.Country, &p.Region, &p.City)
+	if err == sql.ErrNoRows {
+		return Place{}, false, nil
+	}
+	if err != nil {
+		return Place{}, false, err
+	}
+	return p, true, nil
+}
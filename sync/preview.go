@@ -0,0 +1,116 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/danp/mapmyride"
+)
+
+// previewPoints is the maximum number of points kept in a workout preview.
+const previewPoints = 200
+
+// previewPositions returns at most n positions from ps, evenly spaced
+// through the workout and always including the first and last.
+func previewPositions(ps []mapmyride.WorkoutPosition, n int) []mapmyride.WorkoutPosition {
+	if len(ps) <= n {
+		return ps
+	}
+
+	out := make([]mapmyride.WorkoutPosition, 0, n)
+	for i := 0; i < n; i++ {
+		out = append(out, ps[i*(len(ps)-1)/(n-1)])
+	}
+	return out
+}
+
+// encodePolyline encodes ps using the Google encoded polyline algorithm
+// with 5 decimal places of precision.
+func encodePolyline(ps []mapmyride.WorkoutPosition) string {
+	var (
+		b                strings.Builder
+		prevLat, prevLng int
+	)
+	for _, p := range ps {
+		lat := int(math.Round(p.Lat * 1e5))
+		lng := int(math.Round(p.Lng * 1e5))
+		encodePolylineValue(&b, lat-prevLat)
+		encodePolylineValue(&b, lng-prevLng)
+		prevLat, prevLng = lat, lng
+	}
+	return b.String()
+}
+
+func encodePolylineValue(b *strings.Builder, v int) {
+	u := v << 1
+	if v < 0 {
+		u = ^u
+	}
+	for u >= 0x20 {
+		b.WriteByte(byte((0x20 | (u & 0x1f)) + 63))
+		u >>= 5
+	}
+	b.WriteByte(byte(u + 63))
+}
+
+// decodePolyline decodes a polyline produced by encodePolyline.
+func decodePolyline(s string) ([]mapmyride.WorkoutPosition, error) {
+	var (
+		out      []mapmyride.WorkoutPosition
+		lat, lng int
+	)
+	for i := 0; i < len(s); {
+		var deltas [2]int
+		for j := range deltas {
+			var (
+				result, shift int
+				b             int
+			)
+			for {
+				if i >= len(s) {
+					return nil, fmt.Errorf("truncated polyline")
+				}
+				b = int(s[i]) - 63
+				i++
+				result |= (b & 0x1f) << shift
+				shift += 5
+				if b < 0x20 {
+					break
+				}
+			}
+			if result&1 != 0 {
+				deltas[j] = ^(result >> 1)
+			} else {
+				deltas[j] = result >> 1
+			}
+		}
+		lat += deltas[0]
+		lng += deltas[1]
+		out = append(out, mapmyride.WorkoutPosition{Lat: float64(lat) / 1e5, Lng: float64(lng) / 1e5})
+	}
+	return out, nil
+}
+
+// Preview returns the downsampled positions stored for workout id, or
+// nil if it has none.
+func (d *DB) Preview(ctx context.Context, id int) ([]mapmyride.WorkoutPosition, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := d.db.QueryContext(ctx, "select polyline from workout_previews where workout_id=$1", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var polyline string
+	if err := rows.Scan(&polyline); err != nil {
+		return nil, err
+	}
+	return decodePolyline(polyline)
+}
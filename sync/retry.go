@@ -0,0 +1,81 @@
+package sync
+
+import (
+	"context"
+	"time"
+
+	"github.com/danp/mapmyride"
+)
+
+// maxRetryAttempts is how many times fetching a workout may fail before
+// it is marked as permanently failed and no longer retried.
+const maxRetryAttempts = 5
+
+// Retry is a workout that failed to fetch.
+type Retry struct {
+	WorkoutID int
+	UserName  string
+	// Day is the day the workout was listed on, at midnight UTC.
+	Day           time.Time
+	Attempts      int
+	LastError     string
+	LastAttemptAt time.Time
+	// Permanent is set once Attempts reaches the limit, after which the
+	// workout is no longer retried.
+	Permanent bool
+}
+
+// RecordFailure notes that fetching w for userName failed with err, so
+// later syncs retry it.
+func (d *DB) RecordFailure(ctx context.Context, userName string, w mapmyride.Workout, err error) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, xerr := d.db.ExecContext(
+		ctx,
+		`insert into sync_retries (workout_id, user_name, day, attempts, last_error, last_attempt_at, permanent) values ($1, $2, $3, 1, $4, $5, $6 <= 1)
+		on conflict (workout_id) do update set attempts=attempts+1, last_error=excluded.last_error, last_attempt_at=excluded.last_attempt_at, permanent=attempts+1 >= $6`,
+		w.ID, userName, w.StartedAt.UTC().Format("2006-01-02"), err.Error(), time.Now().Format(timeFormat), maxRetryAttempts,
+	)
+	return xerr
+}
+
+// Retries returns the workouts that failed to fetch for userName, or all
+// users if it's empty, including those that have permanently failed.
+func (d *DB) Retries(ctx context.Context, userName string) ([]Retry, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := d.db.QueryContext(ctx, "select workout_id, user_name, day, attempts, last_error, last_attempt_at, permanent from sync_retries where ($1 = '' or user_name=$1) order by day, workout_id", userName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Retry
+	for rows.Next() {
+		var (
+			r   Retry
+			day string
+		)
+		if err := rows.Scan(&r.WorkoutID, &r.UserName, &day, &r.Attempts, &r.LastError, &r.LastAttemptAt, &r.Permanent); err != nil {
+			return nil, err
+		}
+		r.Day, err = time.Parse("2006-01-02", day)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// DropRetry forgets the failure recorded for workout id, such as when it
+// no longer exists.
+func (d *DB) DropRetry(ctx context.Context, id int) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx, "delete from sync_retries where workout_id=$1", id)
+	return err
+}
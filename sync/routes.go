@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/danp/mapmyride"
+)
+
+// SaveRoute stores r, saved by userName, replacing any copy stored before.
+// Its points are only replaced if r has some, so routes listed without
+// them keep those from an earlier GetRoute.
+func (d *DB) SaveRoute(ctx context.Context, userName string, r mapmyride.Route) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`insert into routes (id, user_name, name, description, distance_m, ascent_m, descent_m, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		on conflict (id) do update set user_name=excluded.user_name, name=excluded.name, description=excluded.description, distance_m=excluded.distance_m, ascent_m=excluded.ascent_m, descent_m=excluded.descent_m, created_at=excluded.created_at, updated_at=excluded.updated_at`,
+		r.ID, userName, r.Name, r.Description, r.Distance, r.Ascent, r.Descent, r.CreatedAt.Format(timeFormat), r.UpdatedAt.Format(timeFormat),
+	)
+	if err != nil {
+		return err
+	}
+
+	if len(r.Points) > 0 {
+		if _, err := tx.ExecContext(ctx, "delete from route_points where route_id=$1", r.ID); err != nil {
+			return err
+		}
+		for _, p := range r.Points {
+			_, err := tx.ExecContext(ctx,
+				"insert into route_points (route_id, distance_m, elevation, lat, lng) values ($1, $2, $3, $4, $5)",
+				r.ID, p.Distance, p.Elevation, p.Lat, p.Lng,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadRoute reads the stored route id, including its points.
+func (d *DB) LoadRoute(ctx context.Context, id int) (mapmyride.Route, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	r := mapmyride.Route{ID: id}
+	err := d.db.QueryRowContext(
+		ctx,
+		"select name, description, coalesce(distance_m, 0), coalesce(ascent_m, 0), coalesce(descent_m, 0), created_at, updated_at from routes where id=$1",
+		id,
+	).Scan(&r.Name, &r.Description, &r.Distance, &r.Ascent, &r.Descent, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return mapmyride.Route{}, err
+	}
+
+	err = loadSeries(ctx, d.db, "select lat, lng, elevation, distance_m from route_points where route_id=$1 order by rowid", id, func(rows *sql.Rows) error {
+		var p mapmyride.RoutePoint
+		if err := rows.Scan(&p.Lat, &p.Lng, &p.Elevation, &p.Distance); err != nil {
+			return err
+		}
+		r.Points = append(r.Points, p)
+		return nil
+	})
+	if err != nil {
+		return mapmyride.Route{}, err
+	}
+	return r, nil
+}
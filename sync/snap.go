@@ -0,0 +1,58 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/danp/mapmyride"
+)
+
+// SetSnappedPositions stores positions as the workout with the given ID's
+// positions snapped to roads, replacing any stored before. They are kept
+// when the workout is synced again unless its series change.
+func (d *DB) SetSnappedPositions(ctx context.Context, id int, positions []mapmyride.WorkoutPosition) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "delete from workout_snapped_positions where workout_id=$1", id); err != nil {
+		return err
+	}
+	for _, p := range positions {
+		_, err := tx.ExecContext(ctx,
+			"insert into workout_snapped_positions (workout_id, elapsed_seconds, elevation, lat, lng) values ($1, $2, $3, $4, $5)",
+			id, p.Elapsed.Seconds(), p.Elevation, p.Lat, p.Lng,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SnappedPositions returns the workout with the given ID's positions
+// snapped to roads, or none if it hasn't been snapped.
+func (d *DB) SnappedPositions(ctx context.Context, id int) ([]mapmyride.WorkoutPosition, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var out []mapmyride.WorkoutPosition
+	err := loadSeries(ctx, d.db, "select elapsed_seconds, elevation, lat, lng from workout_snapped_positions where workout_id=$1 order by elapsed_seconds", id, func(rows *sql.Rows) error {
+		var (
+			el float64
+			p  mapmyride.WorkoutPosition
+		)
+		if err := rows.Scan(&el, &p.Elevation, &p.Lat, &p.Lng); err != nil {
+			return err
+		}
+		p.Elapsed = seconds(el)
+		out = append(out, p)
+		return nil
+	})
+	return out, err
+}
@@ -0,0 +1,57 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SyncState is how far an unfinished sync got.
+type SyncState struct {
+	// Begin and End are the range the sync was asked for.
+	Begin, End time.Time
+	// Through is the end of the last month fully synced.
+	Through time.Time
+}
+
+// SetSyncState records how far the sync for userName has got.
+func (d *DB) SetSyncState(ctx context.Context, userName string, st SyncState) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(
+		ctx,
+		`insert into sync_state (user_name, begin_at, end_at, through_at, updated_at) values ($1, $2, $3, $4, $5)
+		on conflict (user_name) do update set begin_at=excluded.begin_at, end_at=excluded.end_at, through_at=excluded.through_at, updated_at=excluded.updated_at`,
+		userName, st.Begin.Format(timeFormat), st.End.Format(timeFormat), st.Through.Format(timeFormat), time.Now().Format(timeFormat),
+	)
+	return err
+}
+
+// SyncState returns how far the last unfinished sync for userName got,
+// and false if there is none.
+func (d *DB) SyncState(ctx context.Context, userName string) (SyncState, bool, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	var st SyncState
+	err := d.db.QueryRowContext(ctx, "select begin_at, end_at, through_at from sync_state where user_name=$1", userName).Scan(&st.Begin, &st.End, &st.Through)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SyncState{}, false, nil
+	}
+	if err != nil {
+		return SyncState{}, false, err
+	}
+	return st, true, nil
+}
+
+// ClearSyncState forgets the state recorded for userName, such as once a
+// sync finishes.
+func (d *DB) ClearSyncState(ctx context.Context, userName string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.db.ExecContext(ctx, "delete from sync_state where user_name=$1", userName)
+	return err
+}
@@ -0,0 +1,474 @@
+// Package sync copies workouts from mapmyride into a local store.
+//
+// It is the engine behind mapmyride-sync, exposed so other programs can
+// embed syncing instead of running the command.
+package sync
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/danp/mapmyride"
+)
+
+// Client fetches workouts. It is implemented by *mapmyride.Client.
+type Client interface {
+	GetWorkouts(ctx context.Context, begin, end time.Time, opts ...mapmyride.GetWorkoutsOption) ([]mapmyride.Workout, error)
+}
+
+// EachWorkoutClient is a Client that can also pass on workouts as they
+// are fetched. Syncers use it when the Client implements it, so long syncs
+// store each workout before fetching the next instead of holding them all
+// in memory. It is implemented by *mapmyride.Client.
+type EachWorkoutClient interface {
+	Client
+	EachWorkout(ctx context.Context, begin, end time.Time, fn func(mapmyride.Workout) error, opts ...mapmyride.GetWorkoutsOption) error
+}
+
+// GetWorkoutClient is a Client that can also fetch a single workout by
+// ID, such as *mapmyride.Client, so failed workouts can be retried even
+// if they've since moved to another day.
+type GetWorkoutClient interface {
+	Client
+	GetWorkout(ctx context.Context, id int) (mapmyride.Workout, error)
+}
+
+// Store persists synced workouts. It is implemented by *DB.
+type Store interface {
+	// LatestStartedAt returns the start of the day, in loc, on which
+	// userName's latest stored workout started, or the zero time if
+	// there are none.
+	LatestStartedAt(ctx context.Context, userName string, loc *time.Location) (time.Time, error)
+
+	// Sync stores w for userName, replacing any existing copy, and
+	// reports how it differs from what was stored.
+	Sync(ctx context.Context, userName string, w mapmyride.Workout) (Change, error)
+
+	// RemoveExtra removes workouts stored for userName in the begin to
+	// end range that are not in workouts, returning their IDs. Unless
+	// force is set, it should refuse when that looks like a problem
+	// fetching workouts rather than real deletions.
+	RemoveExtra(ctx context.Context, userName string, begin, end time.Time, workouts []mapmyride.Workout, force bool) ([]int, error)
+
+	// RecordRun stores a report of run.
+	RecordRun(ctx context.Context, run Run) error
+
+	// RecordFailure notes that fetching w for userName failed with err.
+	// A later successful Sync of w should clear it.
+	RecordFailure(ctx context.Context, userName string, w mapmyride.Workout, err error) error
+
+	// Retries returns the failures recorded for userName.
+	Retries(ctx context.Context, userName string) ([]Retry, error)
+
+	// DropRetry forgets the failure recorded for workout id.
+	DropRetry(ctx context.Context, id int) error
+}
+
+// ResumableStore is a Store that can also record how far a sync got.
+// Syncers use it when the Store implements it, so a sync that fails or is
+// interrupted part way resumes after the last month it finished instead of
+// starting over. It is implemented by *DB.
+type ResumableStore interface {
+	Store
+
+	// SetSyncState records how far the sync for userName has got.
+	SetSyncState(ctx context.Context, userName string, st SyncState) error
+
+	// SyncState returns what SetSyncState last recorded for userName,
+	// and false if nothing has been recorded since ClearSyncState.
+	SyncState(ctx context.Context, userName string) (SyncState, bool, error)
+
+	// ClearSyncState forgets the state recorded for userName.
+	ClearSyncState(ctx context.Context, userName string) error
+}
+
+// resyncDays is how many days before the latest stored workout a sync
+// with no begin time starts, to pick up possible edits.
+const resyncDays = 14
+
+// Syncer syncs workouts from a Client to a Store.
+type Syncer struct {
+	client Client
+	store  Store
+
+	loc      *time.Location
+	force    bool
+	restart  bool
+	minDist  float64
+	minDur   time.Duration
+	getOpts  []mapmyride.GetWorkoutsOption
+	onChange func(context.Context, mapmyride.Workout, Change)
+	logf     func(format string, args ...interface{})
+}
+
+// Option configures a Syncer.
+type Option func(*Syncer)
+
+// WithLocation sets the time zone used to find the day of the latest
+// stored workout. The default is time.Local.
+func WithLocation(loc *time.Location) Option {
+	return func(s *Syncer) {
+		s.loc = loc
+	}
+}
+
+// WithForce makes the Syncer remove stored workouts even when the sync
+// fetched suspiciously few.
+func WithForce(force bool) Option {
+	return func(s *Syncer) {
+		s.force = force
+	}
+}
+
+// WithRestart makes the Syncer sync the whole range asked for even if an
+// earlier sync of it was interrupted, rather than resuming that one.
+func WithRestart(restart bool) Option {
+	return func(s *Syncer) {
+		s.restart = restart
+	}
+}
+
+// WithMinDistance makes the Syncer skip storing workouts shorter than
+// meters, such as accidental recordings, logging each. Skipped workouts
+// already stored are kept.
+func WithMinDistance(meters float64) Option {
+	return func(s *Syncer) {
+		s.minDist = meters
+	}
+}
+
+// WithMinDuration makes the Syncer skip storing workouts that lasted less
+// than d, as WithMinDistance does for distance.
+func WithMinDuration(d time.Duration) Option {
+	return func(s *Syncer) {
+		s.minDur = d
+	}
+}
+
+// WithGetWorkoutsOptions sets options passed to the Client's GetWorkouts.
+func WithGetWorkoutsOptions(opts ...mapmyride.GetWorkoutsOption) Option {
+	return func(s *Syncer) {
+		s.getOpts = opts
+	}
+}
+
+// WithOnChange sets a function called after each workout is added or
+// changed.
+func WithOnChange(fn func(ctx context.Context, w mapmyride.Workout, c Change)) Option {
+	return func(s *Syncer) {
+		s.onChange = fn
+	}
+}
+
+// WithLogf sets a function used to log progress, such as log.Printf.
+// By default nothing is logged.
+func WithLogf(logf func(format string, args ...interface{})) Option {
+	return func(s *Syncer) {
+		s.logf = logf
+	}
+}
+
+// New returns a Syncer fetching workouts with client and storing them in
+// store.
+func New(client Client, store Store, opts ...Option) *Syncer {
+	s := &Syncer{
+		client: client,
+		store:  store,
+		loc:    time.Local,
+		logf:   func(string, ...interface{}) {},
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Sync fetches userName's workouts started between begin and end, stores
+// them and removes stored workouts in that range that no longer exist.
+//
+// If begin is zero, the sync starts 14 days before the day of the latest
+// stored workout, or from the beginning if there are none. If end is
+// zero, it is the current time.
+//
+// Workouts are fetched and stored a calendar month at a time. If the sync
+// fails part way, the months before the failure stay synced and the
+// returned Run's Through says how far it got. If the Store is a
+// ResumableStore, the next sync for userName with the same or a zero begin
+// carries on after Through instead of starting over, unless WithRestart is
+// set. Stored workouts are then only removed from the part of the range
+// the resumed sync fetched.
+func (s *Syncer) Sync(ctx context.Context, userName string, begin, end time.Time) (Run, error) {
+	run := Run{
+		UserName:  userName,
+		StartedAt: time.Now(),
+		Changes:   make(map[int]Change),
+	}
+
+	rs, resumable := s.store.(ResumableStore)
+	var from time.Time
+	if resumable && !s.restart {
+		st, ok, err := rs.SyncState(ctx, userName)
+		if err != nil {
+			return run, err
+		}
+		if ok && (begin.IsZero() || begin.Equal(st.Begin)) {
+			begin = st.Begin
+			from = st.Through.Add(time.Nanosecond)
+		}
+	}
+
+	if begin.IsZero() && from.IsZero() {
+		latest, err := s.store.LatestStartedAt(ctx, userName, s.loc)
+		if err != nil {
+			return run, err
+		}
+		if !latest.IsZero() {
+			begin = latest.AddDate(0, 0, -resyncDays)
+		}
+	}
+	if end.IsZero() {
+		end = run.StartedAt
+	}
+	run.Begin, run.End = begin, end
+	if from.IsZero() || from.After(end) {
+		from = begin
+	}
+
+	if from.Equal(begin) {
+		s.logf("syncing for %s from %s to %s", userName, begin.Format(time.RFC3339), end.Format(time.RFC3339))
+	} else {
+		s.logf("resuming sync for %s from %s to %s, synced through %s before", userName, from.Format(time.RFC3339), end.Format(time.RFC3339), from.Add(-time.Nanosecond).Format(time.RFC3339))
+	}
+
+	// Sync a month at a time so a failure part way through a long range
+	// leaves the months before it done, as recorded in run.Through. Only
+	// what RemoveExtra needs is kept of each workout once it's stored,
+	// not its series.
+	var listed []mapmyride.Workout
+	for _, c := range monthChunks(from, end, s.loc) {
+		failures, err := s.each(ctx, c[0], c[1], func(w mapmyride.Workout) error {
+			listed = append(listed, listing(w))
+			return s.syncWorkout(ctx, &run, w)
+		})
+		if err != nil {
+			return run, err
+		}
+		if err := s.recordFailures(ctx, &run, failures); err != nil {
+			return run, err
+		}
+
+		// Workouts that failed to fetch still exist, so keep them
+		// when removing extras.
+		for _, f := range failures {
+			listed = append(listed, listing(f.w))
+		}
+		run.Through = c[1]
+		if resumable {
+			if err := rs.SetSyncState(ctx, userName, SyncState{Begin: begin, End: end, Through: c[1]}); err != nil {
+				return run, err
+			}
+		}
+	}
+
+	// Extras are only removed once the whole range is fetched, so the
+	// check for suspiciously few fetched covers all of it.
+	removed, err := s.store.RemoveExtra(ctx, userName, from, end, listed, s.force)
+	if err != nil {
+		return run, err
+	}
+	for _, id := range removed {
+		run.Changes[id] = Removed
+	}
+	if len(removed) > 0 {
+		s.logf("moved %d extra workouts to trash for %s: %v", len(removed), userName, removed)
+	}
+
+	if err := s.retry(ctx, &run); err != nil {
+		return run, err
+	}
+
+	run.FinishedAt = time.Now()
+	s.logf("sync report for %s: %s", userName, run.Summary())
+
+	if err := s.store.RecordRun(ctx, run); err != nil {
+		return run, err
+	}
+	if resumable {
+		return run, rs.ClearSyncState(ctx, userName)
+	}
+	return run, nil
+}
+
+// failure is a workout that GetWorkouts couldn't fetch.
+type failure struct {
+	w   mapmyride.Workout
+	err error
+}
+
+// fetch gets the workouts started between begin and end, along with any
+// that failed to fetch.
+func (s *Syncer) fetch(ctx context.Context, begin, end time.Time) ([]mapmyride.Workout, []failure, error) {
+	var failures []failure
+	opts := append(s.getOpts[:len(s.getOpts):len(s.getOpts)], mapmyride.WithSkipFailed(func(w mapmyride.Workout, err error) {
+		failures = append(failures, failure{w, err})
+	}))
+	workouts, err := s.client.GetWorkouts(ctx, begin, end, opts...)
+	return workouts, failures, err
+}
+
+// each calls fn with each workout started between begin and end, as it is
+// fetched if the Client is an EachWorkoutClient, and returns any that
+// failed to fetch.
+func (s *Syncer) each(ctx context.Context, begin, end time.Time, fn func(mapmyride.Workout) error) ([]failure, error) {
+	ec, ok := s.client.(EachWorkoutClient)
+	if !ok {
+		workouts, failures, err := s.fetch(ctx, begin, end)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range workouts {
+			if err := fn(w); err != nil {
+				return nil, err
+			}
+		}
+		return failures, nil
+	}
+
+	var failures []failure
+	opts := append(s.getOpts[:len(s.getOpts):len(s.getOpts)], mapmyride.WithSkipFailed(func(w mapmyride.Workout, err error) {
+		failures = append(failures, failure{w, err})
+	}))
+	if err := ec.EachWorkout(ctx, begin, end, fn, opts...); err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
+
+// monthChunks splits begin to end into calendar months in loc, the first
+// starting at begin and the last ending at end. Each chunk's end is
+// inclusive, as GetWorkouts' is.
+func monthChunks(begin, end time.Time, loc *time.Location) [][2]time.Time {
+	var chunks [][2]time.Time
+	for b := begin.In(loc); !b.After(end); {
+		next := time.Date(b.Year(), b.Month()+1, 1, 0, 0, 0, 0, loc)
+		e := next.Add(-time.Nanosecond)
+		if e.After(end) {
+			e = end
+		}
+		chunks = append(chunks, [2]time.Time{b, e})
+		b = next
+	}
+	return chunks
+}
+
+// listing returns w's listing fields without its series.
+func listing(w mapmyride.Workout) mapmyride.Workout {
+	return mapmyride.Workout{ID: w.ID, Name: w.Name, Kind: w.Kind, StartedAt: w.StartedAt}
+}
+
+func (s *Syncer) syncWorkout(ctx context.Context, run *Run, w mapmyride.Workout) error {
+	if w.Distance < s.minDist || w.Duration < s.minDur {
+		run.Changes[w.ID] = Skipped
+		s.logf("sync %s workout started %s named %s skipped, only %.0f m in %s", run.UserName, w.StartedAt.Format(time.RFC3339), w.Name, w.Distance, w.Duration)
+		return nil
+	}
+
+	change, err := s.store.Sync(ctx, run.UserName, w)
+	if err != nil {
+		return err
+	}
+	run.Changes[w.ID] = change
+
+	s.logf("sync %s workout started %s named %s %s", run.UserName, w.StartedAt.Format(time.RFC3339), w.Name, change)
+
+	if s.onChange != nil && change != Unchanged {
+		s.onChange(ctx, w, change)
+	}
+	return nil
+}
+
+func (s *Syncer) recordFailures(ctx context.Context, run *Run, failures []failure) error {
+	for _, f := range failures {
+		if err := s.store.RecordFailure(ctx, run.UserName, f.w, f.err); err != nil {
+			return err
+		}
+		run.Changes[f.w.ID] = Failed
+		s.logf("sync %s workout %d named %s failed, will retry: %v", run.UserName, f.w.ID, f.w.Name, f.err)
+	}
+	return nil
+}
+
+// retry fetches again the workouts that failed on earlier runs and
+// weren't already handled by this one. If the Client is a
+// GetWorkoutClient, workouts are fetched by ID wherever they now start
+// and only forgotten once they're not found. Otherwise workouts no longer
+// listed around their day are forgotten.
+func (s *Syncer) retry(ctx context.Context, run *Run) error {
+	retries, err := s.store.Retries(ctx, run.UserName)
+	if err != nil {
+		return err
+	}
+
+	gc, byID := s.client.(GetWorkoutClient)
+	for _, r := range retries {
+		if _, ok := run.Changes[r.WorkoutID]; ok || r.Permanent {
+			continue
+		}
+
+		if byID {
+			w, err := gc.GetWorkout(ctx, r.WorkoutID)
+			switch {
+			case errors.Is(err, mapmyride.ErrNotFound):
+				s.logf("sync %s workout %d is gone, no longer retrying it", run.UserName, r.WorkoutID)
+				if err := s.store.DropRetry(ctx, r.WorkoutID); err != nil {
+					return err
+				}
+			case err != nil:
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if err := s.recordFailures(ctx, run, []failure{{mapmyride.Workout{ID: r.WorkoutID, StartedAt: r.Day}, err}}); err != nil {
+					return err
+				}
+			default:
+				if err := s.syncWorkout(ctx, run, w); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		// The listing's day may not match the UTC day the workout
+		// started, so look either side of it.
+		workouts, failures, err := s.fetch(ctx, r.Day.AddDate(0, 0, -1), r.Day.AddDate(0, 0, 2))
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, w := range workouts {
+			if w.ID == r.WorkoutID {
+				found = true
+				if err := s.syncWorkout(ctx, run, w); err != nil {
+					return err
+				}
+			}
+		}
+		for _, f := range failures {
+			if f.w.ID == r.WorkoutID {
+				found = true
+				if err := s.recordFailures(ctx, run, []failure{f}); err != nil {
+					return err
+				}
+			}
+		}
+		if !found {
+			s.logf("sync %s workout %d is gone, no longer retrying it", run.UserName, r.WorkoutID)
+			if err := s.store.DropRetry(ctx, r.WorkoutID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1411 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/danp/mapmyride"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+type fakeClient struct {
+	workouts []mapmyride.Workout
+}
+
+func (c *fakeClient) GetWorkouts(ctx context.Context, begin, end time.Time, opts ...mapmyride.GetWorkoutsOption) ([]mapmyride.Workout, error) {
+	var out []mapmyride.Workout
+	for _, w := range c.workouts {
+		if !w.StartedAt.Before(begin) && !w.StartedAt.After(end) {
+			out = append(out, w)
+		}
+	}
+	return out, nil
+}
+
+// fakeEachClient is a fakeClient that also implements EachWorkoutClient,
+// checking each workout it passes on was stored before the next is
+// fetched.
+type fakeEachClient struct {
+	fakeClient
+	t     *testing.T
+	store *DB
+}
+
+func (c *fakeEachClient) EachWorkout(ctx context.Context, begin, end time.Time, fn func(mapmyride.Workout) error, opts ...mapmyride.GetWorkoutsOption) error {
+	ws, err := c.GetWorkouts(ctx, begin, end, opts...)
+	if err != nil {
+		return err
+	}
+	for _, w := range ws {
+		if err := fn(w); err != nil {
+			return err
+		}
+		if _, err := c.store.LoadWorkout(ctx, w.ID); err != nil {
+			c.t.Errorf("workout %d not stored before the next was fetched: %v", w.ID, err)
+		}
+	}
+	return nil
+}
+
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := Open(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.SQL().Close() })
+	return db
+}
+
+func testWorkout(id int, startedAt time.Time) mapmyride.Workout {
+	return mapmyride.Workout{
+		ID:       id,
+		Name:     "ride",
+		Kind:     "Road Cycling",
+		Distance: 1000,
+		Duration: 5 * time.Minute,
+		Gain:     12.5,
+
+		StartElevation: 10,
+		MaxElevation:   20,
+		MinElevation:   10,
+
+		StartedAt: startedAt,
+		CreatedAt: startedAt,
+		UpdatedAt: startedAt,
+		Positions: []mapmyride.WorkoutPosition{
+			{Elapsed: 0, Lat: 44.6, Lng: -63.5, Elevation: 10},
+			{Elapsed: time.Minute, Lat: 44.61, Lng: -63.51, Elevation: 20},
+		},
+		HeartRates: []mapmyride.WorkoutHeartRate{
+			{Elapsed: 0, BeatsPerMinute: 90},
+			{Elapsed: 30 * time.Second, BeatsPerMinute: 130},
+			{Elapsed: time.Minute, BeatsPerMinute: 150},
+		},
+		Cadences: []mapmyride.WorkoutCadence{
+			{Elapsed: 0, RPM: 0},
+			{Elapsed: 30 * time.Second, RPM: 82},
+		},
+		Powers: []mapmyride.WorkoutPower{
+			{Elapsed: 0, Watts: 0},
+			{Elapsed: 30 * time.Second, Watts: 215},
+		},
+	}
+}
+
+func TestSyncer(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	client := &fakeClient{workouts: []mapmyride.Workout{
+		testWorkout(1, day.Add(10*time.Hour)),
+		testWorkout(2, day.AddDate(0, 0, 1).Add(10*time.Hour)),
+		testWorkout(3, day.AddDate(0, 0, 2).Add(10*time.Hour)),
+	}}
+
+	var changed []int
+	s := New(client, db, WithLocation(time.UTC), WithOnChange(func(_ context.Context, w mapmyride.Workout, c Change) {
+		changed = append(changed, w.ID)
+	}))
+
+	end := day.AddDate(0, 0, 7)
+	run, err := s.Sync(ctx, "user", day, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := run.Summary(), "3 added, 0 changed, 0 unchanged, 0 removed"; got != want {
+		t.Errorf("got summary %q, want %q", got, want)
+	}
+	if d := cmp.Diff([]int{1, 2, 3}, changed); d != "" {
+		t.Errorf("changed mismatch (-want +got):\n%s", d)
+	}
+
+	got, err := db.LoadWorkout(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(client.workouts[1], got, cmp.Comparer(func(a, b time.Time) bool { return a.Equal(b) })); d != "" {
+		t.Errorf("loaded workout mismatch (-want +got):\n%s", d)
+	}
+
+	latest, err := db.LatestStartedAt(ctx, "user", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := day.AddDate(0, 0, 2); !latest.Equal(want) {
+		t.Errorf("got latest %v, want %v", latest, want)
+	}
+
+	client.workouts[0].Name = "renamed"
+	client.workouts[0].UpdatedAt = client.workouts[0].UpdatedAt.Add(time.Hour)
+	client.workouts = client.workouts[:2]
+	changed = nil
+
+	// A zero begin resyncs from before the latest stored workout.
+	run, err = s.Sync(ctx, "user", time.Time{}, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := run.Summary(), "0 added, 1 changed, 1 unchanged, 1 removed"; got != want {
+		t.Errorf("got summary %q, want %q", got, want)
+	}
+	if !run.Begin.Equal(day.AddDate(0, 0, 2-resyncDays)) {
+		t.Errorf("got begin %v, want %d days before latest", run.Begin, resyncDays)
+	}
+	if d := cmp.Diff([]int{1}, changed); d != "" {
+		t.Errorf("changed mismatch (-want +got):\n%s", d)
+	}
+
+	trashed, err := db.Trashed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trashed) != 1 || trashed[0].ID != 3 {
+		t.Fatalf("got trashed %+v, want workout 3", trashed)
+	}
+
+	if err := db.Restore(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.LoadWorkout(ctx, 3); err != nil {
+		t.Errorf("loading restored workout: %v", err)
+	}
+
+	if err := db.Remove(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.LoadWorkout(ctx, 3); err == nil {
+		t.Error("got no error loading removed workout")
+	}
+	if trashed, err := db.Trashed(ctx); err != nil || len(trashed) != 1 {
+		t.Errorf("got trashed %+v, %v after remove, want workout 3", trashed, err)
+	}
+}
+
+func TestSyncerMinimums(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	short := testWorkout(2, day.Add(11*time.Hour))
+	short.Distance, short.Duration = 20, 30*time.Second
+	quick := testWorkout(3, day.Add(12*time.Hour))
+	quick.Duration = 50 * time.Second
+	client := &fakeClient{workouts: []mapmyride.Workout{
+		testWorkout(1, day.Add(10*time.Hour)),
+		short,
+		quick,
+	}}
+	end := day.AddDate(0, 0, 1)
+
+	// Store the short workout first, as if synced before the minimums
+	// were set.
+	if _, err := db.Sync(ctx, "user", short); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := New(client, db, WithMinDistance(100), WithMinDuration(time.Minute)).Sync(ctx, "user", day, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := run.Summary(), "1 added, 0 changed, 0 unchanged, 0 removed, 2 skipped"; got != want {
+		t.Errorf("got summary %q, want %q", got, want)
+	}
+	if _, err := db.LoadWorkout(ctx, 2); err != nil {
+		t.Errorf("loading already stored short workout: %v", err)
+	}
+	if _, err := db.LoadWorkout(ctx, 3); err == nil {
+		t.Error("got no error loading skipped workout 3")
+	}
+}
+
+func TestSyncerEachWorkout(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := db.Sync(ctx, "user", testWorkout(3, day.Add(12*time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	client := &fakeEachClient{
+		fakeClient: fakeClient{workouts: []mapmyride.Workout{
+			testWorkout(1, day.Add(10*time.Hour)),
+			testWorkout(2, day.Add(11*time.Hour)),
+		}},
+		t:     t,
+		store: db,
+	}
+
+	run, err := New(client, db, WithForce(true)).Sync(ctx, "user", day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := run.Summary(), "2 added, 0 changed, 0 unchanged, 1 removed"; got != want {
+		t.Errorf("got summary %q, want %q", got, want)
+	}
+}
+
+// failingClient is a fakeClient that fails to fetch ranges ending after
+// failAfter.
+type failingClient struct {
+	fakeClient
+	failAfter time.Time
+}
+
+func (c *failingClient) GetWorkouts(ctx context.Context, begin, end time.Time, opts ...mapmyride.GetWorkoutsOption) ([]mapmyride.Workout, error) {
+	if end.After(c.failAfter) {
+		return nil, fmt.Errorf("listing up to %s failed", end.Format("2006-01-02"))
+	}
+	return c.fakeClient.GetWorkouts(ctx, begin, end, opts...)
+}
+
+func TestSyncerChunks(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	begin := time.Date(2021, 5, 15, 0, 0, 0, 0, time.UTC)
+	client := &failingClient{
+		fakeClient: fakeClient{workouts: []mapmyride.Workout{
+			testWorkout(1, begin.AddDate(0, 0, 1)),
+			testWorkout(2, begin.AddDate(0, 1, 0)),
+			testWorkout(3, begin.AddDate(0, 2, 0)),
+		}},
+		failAfter: time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC),
+	}
+	end := begin.AddDate(0, 3, 0)
+
+	run, err := New(client, db, WithLocation(time.UTC)).Sync(ctx, "user", begin, end)
+	if err == nil {
+		t.Fatal("got no error syncing through the failing month")
+	}
+	if want := time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond); !run.Through.Equal(want) {
+		t.Errorf("got run through %v, want %v", run.Through, want)
+	}
+	for _, id := range []int{1, 2} {
+		if _, err := db.LoadWorkout(ctx, id); err != nil {
+			t.Errorf("loading workout %d from a month synced before the failure: %v", id, err)
+		}
+	}
+
+	// Carrying on from there finishes the range.
+	client.failAfter = end
+	run, err = New(client, db, WithLocation(time.UTC)).Sync(ctx, "user", run.Through, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !run.Through.Equal(end) {
+		t.Errorf("got run through %v, want the end %v", run.Through, end)
+	}
+	if got, want := run.Summary(), "1 added, 0 changed, 0 unchanged, 0 removed"; got != want {
+		t.Errorf("got summary %q, want %q", got, want)
+	}
+}
+
+func TestSyncerResumes(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	begin := time.Date(2021, 5, 15, 0, 0, 0, 0, time.UTC)
+	client := &failingClient{
+		fakeClient: fakeClient{workouts: []mapmyride.Workout{
+			testWorkout(1, begin.AddDate(0, 0, 1)),
+			testWorkout(2, begin.AddDate(0, 1, 0)),
+			testWorkout(3, begin.AddDate(0, 2, 0)),
+		}},
+		failAfter: time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC),
+	}
+	end := begin.AddDate(0, 3, 0)
+
+	if _, err := New(client, db, WithLocation(time.UTC)).Sync(ctx, "user", begin, end); err == nil {
+		t.Fatal("got no error syncing through the failing month")
+	}
+	st, ok, err := db.SyncState(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SyncState{Begin: begin, End: end, Through: time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond)}); !ok || !st.Begin.Equal(want.Begin) || !st.End.Equal(want.End) || !st.Through.Equal(want.Through) {
+		t.Errorf("got state %+v, %v, want %+v", st, ok, want)
+	}
+
+	// Syncing the same range again picks up after the months done, so
+	// the workouts in them aren't seen, nor removed.
+	client.failAfter = end
+	run, err := New(client, db, WithLocation(time.UTC)).Sync(ctx, "user", begin, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := run.Summary(), "1 added, 0 changed, 0 unchanged, 0 removed"; got != want {
+		t.Errorf("got summary %q, want %q", got, want)
+	}
+	if !run.Begin.Equal(begin) {
+		t.Errorf("got run begin %v, want %v", run.Begin, begin)
+	}
+	if _, ok, err := db.SyncState(ctx, "user"); err != nil || ok {
+		t.Errorf("got state left after finishing, err %v", err)
+	}
+
+	// With nothing left to resume, or WithRestart, the whole range is
+	// synced.
+	run, err = New(client, db, WithLocation(time.UTC), WithRestart(true)).Sync(ctx, "user", begin, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := run.Summary(), "0 added, 0 changed, 3 unchanged, 0 removed"; got != want {
+		t.Errorf("got summary %q, want %q", got, want)
+	}
+}
+
+func TestSyncerRefusesMassRemoval(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	client := &fakeClient{workouts: []mapmyride.Workout{
+		testWorkout(1, day.Add(10*time.Hour)),
+		testWorkout(2, day.Add(12*time.Hour)),
+	}}
+	end := day.AddDate(0, 0, 1)
+
+	if _, err := New(client, db).Sync(ctx, "user", day, end); err != nil {
+		t.Fatal(err)
+	}
+
+	client.workouts = nil
+	if _, err := New(client, db).Sync(ctx, "user", day, end); err == nil {
+		t.Fatal("got no error removing every workout, want one")
+	}
+
+	run, err := New(client, db, WithForce(true)).Sync(ctx, "user", day, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := run.Count(Removed), 2; got != want {
+		t.Errorf("got %d removed, want %d", got, want)
+	}
+}
+
+func TestDBHeartRateZones(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL().Close()
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := db.Sync(ctx, "user", testWorkout(1, day)); err != nil {
+		t.Fatal(err)
+	}
+
+	zoneTimes := func(db *DB) map[int]float64 {
+		t.Helper()
+		rows, err := db.SQL().QueryContext(ctx, "select zone, seconds from workout_zone_times where workout_id=1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		out := make(map[int]float64)
+		for rows.Next() {
+			var (
+				zone    int
+				seconds float64
+			)
+			if err := rows.Scan(&zone, &seconds); err != nil {
+				t.Fatal(err)
+			}
+			out[zone] = seconds
+		}
+		return out
+	}
+
+	if got := zoneTimes(db); len(got) != 0 {
+		t.Errorf("got zone times %v before setting zones, want none", got)
+	}
+
+	// Setting zones recomputes stored workouts.
+	if err := db.SetHeartRateZones(ctx, mapmyride.Zones{120, 140}); err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(map[int]float64{1: 0, 2: 30, 3: 30}, zoneTimes(db)); d != "" {
+		t.Errorf("zone times mismatch (-want +got):\n%s", d)
+	}
+
+	// The zones are remembered and used by later syncs.
+	db2, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.SQL().Close()
+	if d := cmp.Diff(mapmyride.Zones{120, 140}, db2.HeartRateZones()); d != "" {
+		t.Errorf("zones mismatch (-want +got):\n%s", d)
+	}
+	if _, err := db2.Sync(ctx, "user", testWorkout(1, day)); err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(map[int]float64{1: 0, 2: 30, 3: 30}, zoneTimes(db2)); d != "" {
+		t.Errorf("zone times after resync mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestDBKinds(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL().Close()
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i, kind := range []string{"ride", "Road-Cycling", "bike", "yoga"} {
+		w := testWorkout(i+1, day)
+		w.Kind = kind
+		if _, err := db.Sync(ctx, "user", w); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	normalized := func(db *DB) map[int]string {
+		t.Helper()
+		rows, err := db.SQL().QueryContext(ctx, "select id, normalized_kind from workouts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		out := make(map[int]string)
+		for rows.Next() {
+			var (
+				id   int
+				kind string
+			)
+			if err := rows.Scan(&id, &kind); err != nil {
+				t.Fatal(err)
+			}
+			out[id] = kind
+		}
+		return out
+	}
+
+	if d := cmp.Diff(map[int]string{1: "ride", 2: "ride", 3: "ride", 4: "yoga"}, normalized(db)); d != "" {
+		t.Errorf("normalized kinds mismatch (-want +got):\n%s", d)
+	}
+
+	// Overrides recompute stored workouts and are remembered.
+	if err := db.SetKinds(ctx, map[string]string{"Bike": "spin", "yoga": "stretch"}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]string{1: "ride", 2: "ride", 3: "spin", 4: "stretch"}
+	if d := cmp.Diff(want, normalized(db)); d != "" {
+		t.Errorf("normalized kinds after SetKinds mismatch (-want +got):\n%s", d)
+	}
+
+	db2, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.SQL().Close()
+	if got := db2.NormalizeKind("bike"); got != "spin" {
+		t.Errorf("got NormalizeKind(bike) = %q after reopening, want spin", got)
+	}
+}
+
+func TestDBSeriesChecksum(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	w := testWorkout(1, day)
+	w.Positions[1].Elapsed = 61234 * time.Millisecond
+	if _, err := db.Sync(ctx, "user", w); err != nil {
+		t.Fatal(err)
+	}
+
+	storedSum := func() string {
+		t.Helper()
+		var sum string
+		if err := db.SQL().QueryRowContext(ctx, "select series_checksum from workouts where id=1").Scan(&sum); err != nil {
+			t.Fatal(err)
+		}
+		return sum
+	}
+	elevation := func() float64 {
+		t.Helper()
+		got, err := db.LoadWorkout(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.Positions[1].Elevation
+	}
+	sum := storedSum()
+
+	// What's computed from the stored rows, as for the backfill, matches.
+	tx, err := db.SQL().BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromRows, err := storedSeriesChecksum(ctx, tx, 1)
+	tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromRows != sum {
+		t.Errorf("got checksum %s from stored rows, want %s", fromRows, sum)
+	}
+
+	// Unchanged series aren't rewritten, as shown by a stored row edited
+	// behind the checksum's back surviving a sync.
+	if _, err := db.SQL().ExecContext(ctx, "update workout_positions set elevation=99 where workout_id=1 and elevation=20"); err != nil {
+		t.Fatal(err)
+	}
+	w.Name = "renamed"
+	if _, err := db.Sync(ctx, "user", w); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedSum(); got != sum {
+		t.Errorf("got checksum %s after renaming, want %s", got, sum)
+	}
+	if got := elevation(); got != 99 {
+		t.Errorf("got elevation %v after renaming, want 99 left alone", got)
+	}
+
+	// A recalculated track is a change even with the same point counts.
+	w.Positions[1].Elevation = 25
+	change, err := db.Sync(ctx, "user", w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change != Changed {
+		t.Errorf("got change %q after recalculating track, want %q", change, Changed)
+	}
+	if got := storedSum(); got == sum {
+		t.Errorf("got unchanged checksum %s after recalculating track", got)
+	}
+	if got := elevation(); got != 25 {
+		t.Errorf("got elevation %v after recalculating track, want 25", got)
+	}
+}
+
+func TestDBNameTemplate(t *testing.T) {
+	ctx := context.Background()
+	tmpl := template.Must(template.New("name").Parse(`{{.Date}} {{printf "%.1f" .DistanceKm}}km {{.Kind}} from {{.Start}}`))
+	loc, err := time.LoadLocation("America/Halifax")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(filepath.Join(t.TempDir(), "data.db"), WithNameTemplate(tmpl, loc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL().Close()
+
+	// Just after midnight UTC is the previous day in Halifax.
+	day := time.Date(2021, 6, 2, 1, 0, 0, 0, time.UTC)
+	generic := testWorkout(1, day)
+	generic.Name = "Bike Ride"
+	named := testWorkout(2, day)
+	named.Name = "Commute"
+	for _, w := range []mapmyride.Workout{generic, named} {
+		if _, err := db.Sync(ctx, "user", w); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names := func() map[int][2]string {
+		t.Helper()
+		rows, err := db.SQL().QueryContext(ctx, "select id, name, original_name from workouts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		out := make(map[int][2]string)
+		for rows.Next() {
+			var (
+				id             int
+				name, original string
+			)
+			if err := rows.Scan(&id, &name, &original); err != nil {
+				t.Fatal(err)
+			}
+			out[id] = [2]string{name, original}
+		}
+		return out
+	}
+	want := map[int][2]string{
+		1: {"2021-06-01 1.0km Road Cycling from 44.600,-63.500", "Bike Ride"},
+		2: {"Commute", "Commute"},
+	}
+	if d := cmp.Diff(want, names()); d != "" {
+		t.Errorf("names mismatch (-want +got):\n%s", d)
+	}
+
+	// Renamed workouts still compare as unchanged with the site.
+	change, err := db.Sync(ctx, "user", generic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change != Unchanged {
+		t.Errorf("got change %q resyncing renamed workout, want %q", change, Unchanged)
+	}
+}
+
+func TestDBNotes(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := db.Sync(ctx, "user", testWorkout(1, day)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetNote(ctx, 1, "headwind both ways"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetNote(ctx, 2, "nope"); err == nil {
+		t.Error("got no error setting note on missing workout")
+	}
+
+	// Syncing again keeps the note.
+	w := testWorkout(1, day)
+	w.Name = "renamed"
+	if _, err := db.Sync(ctx, "user", w); err != nil {
+		t.Fatal(err)
+	}
+	note, err := db.Note(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note != "headwind both ways" {
+		t.Errorf("got note %q after sync, want it kept", note)
+	}
+
+	if err := db.SetNote(ctx, 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if note, err := db.Note(ctx, 1); err != nil || note != "" {
+		t.Errorf("got note %q, %v after clearing, want none", note, err)
+	}
+}
+
+func TestDBSnappedPositions(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := db.Sync(ctx, "user", testWorkout(1, day)); err != nil {
+		t.Fatal(err)
+	}
+	snapped := []mapmyride.WorkoutPosition{
+		{Elapsed: 0, Lat: 44.6001, Lng: -63.5001, Elevation: 10},
+		{Elapsed: time.Minute, Lat: 44.6101, Lng: -63.5101, Elevation: 20},
+	}
+	if err := db.SetSnappedPositions(ctx, 1, snapped); err != nil {
+		t.Fatal(err)
+	}
+
+	// Syncing again with the same series keeps them.
+	w := testWorkout(1, day)
+	w.Name = "renamed"
+	if _, err := db.Sync(ctx, "user", w); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.SnappedPositions(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff(snapped, got); d != "" {
+		t.Errorf("snapped positions after sync mismatch (-want +got):\n%s", d)
+	}
+
+	// But new positions need snapping again.
+	w.Positions = append(w.Positions, mapmyride.WorkoutPosition{Elapsed: 2 * time.Minute, Lat: 44.62, Lng: -63.52, Elevation: 15})
+	if _, err := db.Sync(ctx, "user", w); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.SnappedPositions(ctx, 1); err != nil || len(got) > 0 {
+		t.Errorf("got %d snapped positions, %v after positions changed, want none", len(got), err)
+	}
+}
+
+func TestDBPlaces(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := db.Sync(ctx, "user", testWorkout(1, day)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := db.Place(ctx, 1); err != nil || ok {
+		t.Fatalf("got a place, %v before geocoding, want none", err)
+	}
+
+	want := Place{Country: "Canada", Region: "Nova Scotia", City: "Halifax"}
+	if err := db.SetPlace(ctx, 1, Place{Country: "Canada"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetPlace(ctx, 1, want); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Sync(ctx, "user", testWorkout(1, day)); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := db.Place(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || got != want {
+		t.Errorf("got place %+v, %v after sync, want %+v", got, ok, want)
+	}
+}
+
+func TestDBRoutes(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	created := time.Date(2021, 5, 2, 18, 21, 9, 0, time.UTC)
+	r := mapmyride.Route{
+		ID: 5, Name: "loop", Distance: 2000, Ascent: 20, Descent: 19, CreatedAt: created, UpdatedAt: created,
+		Points: []mapmyride.RoutePoint{{Lat: 44.6, Lng: -63.5, Elevation: 10}, {Lat: 44.61, Lng: -63.51, Elevation: 20, Distance: 1000}},
+	}
+	if err := db.SaveRoute(ctx, "user", r); err != nil {
+		t.Fatal(err)
+	}
+
+	// Saving it again as listed, without points, keeps them.
+	listed := r
+	listed.Name = "renamed loop"
+	listed.Points = nil
+	if err := db.SaveRoute(ctx, "user", listed); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.LoadRoute(ctx, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := r
+	want.Name = "renamed loop"
+	if d := cmp.Diff(want, got); d != "" {
+		t.Errorf("route mismatch (-want +got):\n%s", d)
+	}
+
+	w := testWorkout(1, created)
+	w.RouteID = 5
+	if _, err := db.Sync(ctx, "user", w); err != nil {
+		t.Fatal(err)
+	}
+	lw, err := db.LoadWorkout(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lw.RouteID != 5 {
+		t.Errorf("got route id %d for loaded workout, want 5", lw.RouteID)
+	}
+}
+
+func TestDBStarred(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := db.Sync(ctx, "user", testWorkout(1, day)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetStarred(ctx, 1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetStarred(ctx, 2, true); err == nil {
+		t.Error("got no error starring missing workout")
+	}
+
+	starred := func() bool {
+		t.Helper()
+		var b bool
+		if err := db.SQL().QueryRow("select starred from workouts where id=1").Scan(&b); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	// Syncing again keeps the star.
+	w := testWorkout(1, day)
+	w.Name = "renamed"
+	if _, err := db.Sync(ctx, "user", w); err != nil {
+		t.Fatal(err)
+	}
+	if !starred() {
+		t.Error("got workout unstarred after sync, want star kept")
+	}
+
+	if err := db.SetStarred(ctx, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if starred() {
+		t.Error("got workout starred after unstarring")
+	}
+}
+
+func TestDBRemoveExtraManyIDs(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	var fetched []mapmyride.Workout
+	for id := 1; id <= 3; id++ {
+		w := testWorkout(id, day.Add(time.Duration(id)*time.Hour))
+		if _, err := db.Sync(ctx, "user", w); err != nil {
+			t.Fatal(err)
+		}
+		if id != 2 {
+			fetched = append(fetched, w)
+		}
+	}
+	// More IDs than SQLite allows as bound parameters in one statement.
+	for id := 1000; id < 40000; id++ {
+		fetched = append(fetched, mapmyride.Workout{ID: id})
+	}
+
+	removed, err := db.RemoveExtra(ctx, "user", day, day.AddDate(0, 0, 1), fetched, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff([]int{2}, removed); d != "" {
+		t.Errorf("removed mismatch (-want +got):\n%s", d)
+	}
+
+	// The temporary table doesn't outlive the call.
+	if _, err := db.RemoveExtra(ctx, "user", day, day.AddDate(0, 0, 1), fetched, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDBRemoveExtraLocation(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	halifax, err := time.LoadLocation("America/Halifax")
+	if err != nil {
+		t.Fatal(err)
+	}
+	begin := time.Date(2021, 6, 1, 0, 0, 0, 0, halifax)
+	end := begin.AddDate(0, 0, 1).Add(-time.Nanosecond)
+
+	// Start times come from the site in UTC. The first is 22:00 the day
+	// before begin in Halifax but on begin's day in UTC, and the second
+	// 22:00 on begin's day in Halifax but the day after in UTC.
+	before := testWorkout(1, time.Date(2021, 5, 31, 22, 0, 0, 0, halifax).UTC())
+	during := testWorkout(2, time.Date(2021, 6, 1, 22, 0, 0, 0, halifax).UTC())
+	for _, w := range []mapmyride.Workout{before, during} {
+		if _, err := db.Sync(ctx, "user", w); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := db.RemoveExtra(ctx, "user", begin, end, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := cmp.Diff([]int{2}, removed); d != "" {
+		t.Errorf("removed mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestOpenOptions(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.db")
+
+	db, err := Open(path, WithMaxOpenConns(2), WithBusyTimeout(2500*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL().Close()
+
+	if got := db.SQL().Stats().MaxOpenConnections; got != 2 {
+		t.Errorf("got max open connections %d, want 2", got)
+	}
+	var busyTimeout int
+	if err := db.SQL().QueryRowContext(ctx, "pragma busy_timeout").Scan(&busyTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if busyTimeout != 2500 {
+		t.Errorf("got busy timeout %d, want 2500", busyTimeout)
+	}
+
+	short, err := Open(path, WithTimeout(time.Nanosecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer short.SQL().Close()
+	if _, err := short.Sync(ctx, "user", testWorkout(1, time.Now())); err == nil {
+		t.Error("got no error syncing with an expired timeout")
+	}
+}
+
+func TestOpenReadOnly(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.db")
+
+	if _, err := Open(path, WithReadOnly()); err == nil {
+		t.Error("got no error opening missing database read-only")
+	}
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL().Close()
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := db.Sync(ctx, "user", testWorkout(1, day)); err != nil {
+		t.Fatal(err)
+	}
+
+	ro, err := Open(path, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.SQL().Close()
+	if _, err := ro.LoadWorkout(ctx, 1); err != nil {
+		t.Errorf("loading workout read-only: %v", err)
+	}
+	if _, err := ro.Sync(ctx, "user", testWorkout(2, day)); err == nil {
+		t.Error("got no error syncing to read-only database")
+	}
+}
+
+func TestOpenEscapedFilename(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "rides?mode=memory#1 50%.db")
+
+	db, err := Open(path, WithBusyTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL().Close()
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := db.Sync(ctx, "user", testWorkout(1, day)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("database not created at its filename: %v", err)
+	}
+	var busyTimeout int
+	if err := db.SQL().QueryRowContext(ctx, "pragma busy_timeout").Scan(&busyTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if busyTimeout != 1000 {
+		t.Errorf("got busy timeout %d, want 1000", busyTimeout)
+	}
+
+	ro, err := Open(path, WithReadOnly(), WithBusyTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.SQL().Close()
+	if _, err := ro.LoadWorkout(ctx, 1); err != nil {
+		t.Errorf("loading workout read-only: %v", err)
+	}
+	if _, err := ro.Sync(ctx, "user", testWorkout(2, day)); err == nil {
+		t.Error("got no error syncing to read-only database")
+	}
+}
+
+func TestDataSourceName(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "rides?#1.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SQL().Close()
+
+	dsn, err := DataSourceName(path, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdb, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdb.Close()
+	var version int
+	if err := sdb.QueryRowContext(ctx, "pragma user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != SchemaVersion() {
+		t.Errorf("got schema version %d, want %d", version, SchemaVersion())
+	}
+	if _, err := sdb.ExecContext(ctx, "create table t (x)"); err == nil {
+		t.Error("got no error writing through read-only data source name")
+	}
+
+	if dsn, err := DataSourceName(MemoryFilename); err != nil || dsn != MemoryFilename {
+		t.Errorf("got %q, %v for memory, want %q", dsn, err, MemoryFilename)
+	}
+}
+
+func TestOpenMemory(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := Open(MemoryFilename, WithReadOnly()); err == nil {
+		t.Error("got no error opening in-memory database read-only")
+	}
+
+	db, err := Open(MemoryFilename, WithMaxOpenConns(4), WithBusyTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL().Close()
+	if got := db.SQL().Stats().MaxOpenConnections; got != 1 {
+		t.Errorf("got %d max open connections, want 1", got)
+	}
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i := 1; i <= 3; i++ {
+		if _, err := db.Sync(ctx, "user", testWorkout(i, day.AddDate(0, 0, i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i <= 3; i++ {
+		if _, err := db.LoadWorkout(ctx, i); err != nil {
+			t.Errorf("loading workout %d: %v", i, err)
+		}
+	}
+}
+
+func TestDBBackups(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.db")
+	backups := filepath.Join(dir, "backups")
+
+	// A database from before any migrations, with a workout in it.
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{
+		"create table workouts (id integer primary key, user_name text not null, name text not null, kind text not null, activity_type text, kcal integer, distance_m numeric, speed_mps numeric, duration_s integer, step_count bigint, gain_m numeric, started_at datetime, created_at datetime, updated_at datetime)",
+		"insert into workouts (id, user_name, name, kind) values (1, 'user', 'ride', 'ride')",
+	} {
+		if _, err := old.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old.Close()
+
+	db, err := Open(path, WithBackups(backups, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL().Close()
+
+	entries, err := os.ReadDir(backups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), "-migration-0-to-"+strconv.Itoa(SchemaVersion())+".db") {
+		t.Fatalf("got backups %v, want one from before migrating", entries)
+	}
+	backup, err := sql.Open("sqlite", filepath.Join(backups, entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	var version, n int
+	if err := backup.QueryRow("pragma user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if err := backup.QueryRow("select count(*) from workouts").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if version != 0 || n != 1 {
+		t.Errorf("got backup at version %d with %d workouts, want version 0 with 1", version, n)
+	}
+
+	// Only the newest two are kept.
+	var names []string
+	for i := 0; i < 3; i++ {
+		name, err := db.Backup(ctx, "manual")
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, filepath.Base(name))
+		time.Sleep(2 * time.Millisecond)
+	}
+	entries, err = os.ReadDir(backups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if d := cmp.Diff(names[1:], got); d != "" {
+		t.Errorf("backups mismatch (-want +got):\n%s", d)
+	}
+}
+
+func TestDBMigratesSeries(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.db")
+
+	// A database from before any migrations with a workout with series,
+	// migrated up to where heart rates were added so it can gain some
+	// before the rest are applied.
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+	for _, q := range []string{
+		"create table workouts (id integer primary key, user_name text not null, name text not null, kind text not null, activity_type text, kcal integer, distance_m numeric, speed_mps numeric, duration_s integer, step_count bigint, gain_m numeric, started_at datetime, created_at datetime, updated_at datetime)",
+		"create table workout_distances (workout_id integer references workouts (id), elapsed_seconds numeric, total_meters numeric)",
+		"create table workout_positions (workout_id integer references workouts (id), elapsed_seconds numeric, elevation numeric, lat numeric, lng numeric)",
+		"create table workout_speeds (workout_id integer references workouts (id), elapsed_seconds numeric, meters_per_second numeric)",
+		"create table workout_steps (workout_id integer references workouts (id), elapsed_seconds numeric, steps numeric)",
+		"insert into workouts (id, user_name, name, kind, distance_m, duration_s, started_at, created_at, updated_at) values (1, 'user', 'ride', 'ride', 40, 20, '2021-06-01 12:00:00+00:00', '2021-06-01 12:00:00+00:00', '2021-06-01 12:00:00+00:00')",
+		"insert into workout_positions values (1, 0, 10, 44.6488, -63.5752), (1, 10, 12, 44.6489, -63.5753), (1, 20, 15, 44.6490, -63.5754)",
+		"insert into workout_speeds values (1, 0, 2), (1, 10, 2), (1, 20, 2)",
+		"insert into workout_distances values (1, 0, 0), (1, 10, 20), (1, 20, 40)",
+		"insert into workout_steps values (1, 0, 4), (1, 10, 15), (1, 20, 16)",
+	} {
+		if _, err := old.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hrMigration := -1
+	for i, m := range migrations {
+		for _, q := range m.stmts {
+			if strings.HasPrefix(q, "create table workout_heart_rates ") {
+				hrMigration = i
+			}
+		}
+	}
+	if hrMigration < 0 {
+		t.Fatal("no migration creates workout_heart_rates")
+	}
+	for i := 0; i <= hrMigration; i++ {
+		tx, err := old.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, q := range migrations[i].stmts {
+			if _, err := tx.ExecContext(ctx, q); err != nil {
+				t.Fatalf("applying migration %d: %v", i+1, err)
+			}
+		}
+		if fn := migrations[i].fn; fn != nil {
+			if err := fn(ctx, tx); err != nil {
+				t.Fatalf("applying migration %d: %v", i+1, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, q := range []string{
+		"insert into workout_heart_rates values (1, 0, 120), (1, 10, 130), (1, 20, 140)",
+		"update workouts set has_heart_rates=true, heart_rate_points=3 where id=1",
+		"pragma user_version=" + strconv.Itoa(hrMigration+1),
+	} {
+		if _, err := old.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old.Close()
+
+	db, err := Open(path, WithBackups("", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL().Close()
+
+	w, err := db.LoadWorkout(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w.Positions) != 3 || len(w.Speeds) != 3 || len(w.Distances) != 3 || len(w.Steps) != 3 || len(w.HeartRates) != 3 {
+		t.Errorf("got %d positions, %d speeds, %d distances, %d steps and %d heart rates, want 3 of each", len(w.Positions), len(w.Speeds), len(w.Distances), len(w.Steps), len(w.HeartRates))
+	}
+
+	var (
+		avgHR, avgSteps float64
+		maxSpeed        float64
+		checksum        string
+		previewRows     int
+	)
+	err = db.SQL().QueryRow("select avg_heart_rate, avg_steps_per_minute, max_speed_mps, series_checksum, (select count(*) from workout_previews where workout_id=1) from workouts where id=1").Scan(&avgHR, &avgSteps, &maxSpeed, &checksum, &previewRows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Backfilled values match what syncing the workout now would store.
+	if avgHR != w.AverageHeartRate() || avgSteps != w.AverageStepCadence() || maxSpeed != 2 || checksum != seriesChecksum(w) || previewRows != 1 {
+		t.Errorf("got avg_heart_rate %v, avg_steps_per_minute %v, max_speed_mps %v, series_checksum %q and %d previews, want %v, %v, 2, %q and 1", avgHR, avgSteps, maxSpeed, checksum, previewRows, w.AverageHeartRate(), w.AverageStepCadence(), seriesChecksum(w))
+	}
+}
+
+func TestSyncerRetriesFailedWorkouts(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	broken := true
+
+	// A minimal mapmyride listing two workouts on day, where fetching
+	// the details of workout 2 fails while broken is set.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/workouts/dashboard.json", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("month") != "6" {
+			fmt.Fprint(w, `{"workout_data": {"workouts": {}}}`)
+			return
+		}
+		fmt.Fprint(w, `{"workout_data": {"workouts": {"2021-06-01": [
+			{"name": "one", "date": "06/01/2021", "activity_short_name": "ride", "view_url": "/workout/1"},
+			{"name": "two", "date": "06/01/2021", "activity_short_name": "ride", "view_url": "/workout/2"}
+		]}}}`)
+	})
+	mux.HandleFunc("/vxproxy/v7.0/workout/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/2/") && broken {
+			w.WriteHeader(500)
+			return
+		}
+		fmt.Fprintf(w, `{"start_datetime": %q, "time_series": {}}`, day.Add(10*time.Hour).Format(time.RFC3339))
+	})
+	mux.HandleFunc("/workout/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html></html>")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := mapmyride.NewClient(mapmyride.StaticTokenSource("secret"))
+	client.HTTPDo = func(req *http.Request) (*http.Response, error) {
+		req.URL.Scheme, req.URL.Host = "http", strings.TrimPrefix(srv.URL, "http://")
+		return http.DefaultClient.Do(req)
+	}
+
+	run, err := New(client, db).Sync(ctx, "user", day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := run.Summary(), "1 added, 0 changed, 0 unchanged, 0 removed, 1 failed"; got != want {
+		t.Errorf("got summary %q, want %q", got, want)
+	}
+	retries, err := db.Retries(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retries) != 1 || retries[0].WorkoutID != 2 || !retries[0].Day.Equal(day) {
+		t.Fatalf("got retries %+v, want workout 2 on %v", retries, day)
+	}
+
+	// A later sync that doesn't cover day still picks up workout 2.
+	broken = false
+	later := day.AddDate(0, 1, 0)
+	run, err = New(client, db).Sync(ctx, "user", later, later.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := run.Changes[2]; got != Added {
+		t.Errorf("got change %q for retried workout, want %q", got, Added)
+	}
+	if retries, err := db.Retries(ctx, "user"); err != nil || len(retries) != 0 {
+		t.Errorf("got retries %+v, %v after success, want none", retries, err)
+	}
+}
+
+// fakeGetClient is a fakeClient that also implements GetWorkoutClient,
+// failing with errs for the IDs in it.
+type fakeGetClient struct {
+	fakeClient
+	errs map[int]error
+}
+
+func (c *fakeGetClient) GetWorkout(ctx context.Context, id int) (mapmyride.Workout, error) {
+	if err := c.errs[id]; err != nil {
+		return mapmyride.Workout{}, err
+	}
+	for _, w := range c.workouts {
+		if w.ID == id {
+			return w, nil
+		}
+	}
+	return mapmyride.Workout{}, fmt.Errorf("workout %d: %w", id, mapmyride.ErrNotFound)
+}
+
+func TestSyncerRetriesByID(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	for id := 1; id <= 3; id++ {
+		if err := db.RecordFailure(ctx, "user", testWorkout(id, day), errors.New("boom")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Workout 1 now starts well away from the day it failed on, 2 is
+	// gone and 3 still fails.
+	client := &fakeGetClient{
+		fakeClient: fakeClient{workouts: []mapmyride.Workout{testWorkout(1, day.AddDate(0, 0, 10))}},
+		errs:       map[int]error{3: errors.New("still broken")},
+	}
+	later := day.AddDate(0, 1, 0)
+	run, err := New(client, db).Sync(ctx, "user", later, later.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := run.Changes[1]; got != Added {
+		t.Errorf("got change %q for moved workout, want %q", got, Added)
+	}
+	if got := run.Changes[3]; got != Failed {
+		t.Errorf("got change %q for still failing workout, want %q", got, Failed)
+	}
+
+	retries, err := db.Retries(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(retries) != 1 || retries[0].WorkoutID != 3 || retries[0].Attempts != 2 || retries[0].LastError != "still broken" {
+		t.Errorf("got retries %+v, want workout 3 on its second attempt", retries)
+	}
+}
+
+func TestDBRecordFailureGivesUp(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	w := testWorkout(1, time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC))
+	for i := 0; i < maxRetryAttempts; i++ {
+		retries, err := db.Retries(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(retries) > 0 && retries[0].Permanent {
+			t.Fatalf("permanent after %d attempts, want %d", retries[0].Attempts, maxRetryAttempts)
+		}
+		if err := db.RecordFailure(ctx, "user", w, fmt.Errorf("attempt %d", i+1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	retries, err := db.Retries(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Retry{WorkoutID: 1, UserName: "user", Day: w.StartedAt, Attempts: maxRetryAttempts, LastError: fmt.Sprintf("attempt %d", maxRetryAttempts), Permanent: true}
+	if d := cmp.Diff([]Retry{want}, retries, cmpopts.IgnoreFields(Retry{}, "LastAttemptAt")); d != "" {
+		t.Errorf("retries mismatch (-want +got):\n%s", d)
+	}
+}
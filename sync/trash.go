@@ -0,0 +1,238 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// trashTables are the tables whose rows are moved to a matching _trash
+// table when a workout is removed, along with the column identifying the
+// workout in each.
+var trashTables = append([][2]string{{"workouts", "id"}}, seriesTrashTables()...)
+
+func seriesTrashTables() [][2]string {
+	out := make([][2]string, 0, len(seriesTables))
+	for _, t := range seriesTables {
+		out = append(out, [2]string{t, "workout_id"})
+	}
+	return out
+}
+
+// initTrash creates any missing trash tables and adds columns that have
+// been added to their source tables since they were created.
+func (s *DB) initTrash() error {
+	for _, tt := range trashTables {
+		table, trash := tt[0], tt[0]+"_trash"
+
+		have, err := tableColumns(s.db, trash)
+		if err != nil {
+			return err
+		}
+		if len(have) == 0 {
+			if _, err := s.db.Exec("create table " + trash + " as select * from " + table + " where 0"); err != nil {
+				return fmt.Errorf("creating %s: %w", trash, err)
+			}
+			if _, err := s.db.Exec("alter table " + trash + " add column removed_at datetime"); err != nil {
+				return fmt.Errorf("creating %s: %w", trash, err)
+			}
+			continue
+		}
+
+		haveSet := make(map[string]bool)
+		for _, c := range have {
+			haveSet[c] = true
+		}
+
+		rows, err := s.db.Query("select name, type from pragma_table_info('" + table + "')")
+		if err != nil {
+			return err
+		}
+		var add []string
+		for rows.Next() {
+			var name, typ string
+			if err := rows.Scan(&name, &typ); err != nil {
+				rows.Close()
+				return err
+			}
+			if !haveSet[name] {
+				add = append(add, name+" "+typ)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, c := range add {
+			if _, err := s.db.Exec("alter table " + trash + " add column " + c); err != nil {
+				return fmt.Errorf("updating %s: %w", trash, err)
+			}
+		}
+	}
+	return nil
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func tableColumns(q queryer, table string) ([]string, error) {
+	rows, err := q.Query("select name from pragma_table_info('" + table + "')")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		cols = append(cols, name)
+	}
+	return cols, rows.Err()
+}
+
+// trash moves workout id and its series into the trash tables.
+func (d *DB) trash(ctx context.Context, tx *sql.Tx, id int, removedAt time.Time) error {
+	for _, tt := range trashTables {
+		table, idCol := tt[0], tt[1]
+
+		cols, err := tableColumns(tx, table)
+		if err != nil {
+			return err
+		}
+		colss := strings.Join(cols, ", ")
+
+		if _, err := tx.ExecContext(ctx, "insert into "+table+"_trash ("+colss+", removed_at) select "+colss+", $1 from "+table+" where "+idCol+"=$2", removedAt.Format(timeFormat), id); err != nil {
+			return fmt.Errorf("trashing workout %d from %s: %w", id, table, err)
+		}
+		if _, err := tx.ExecContext(ctx, "delete from "+table+" where "+idCol+"=$1", id); err != nil {
+			return err
+		}
+	}
+
+	if d.spatialIndex {
+		if _, err := tx.ExecContext(ctx, "delete from workout_bounds where workout_id=$1", id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Remove moves workout id to the trash tables, as RemoveExtra does for
+// workouts that no longer exist. It is not an error if there is no such
+// workout.
+func (d *DB) Remove(ctx context.Context, id int) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := d.trash(ctx, tx, id, time.Now()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Restore moves the most recently trashed copy of workout id back out of
+// the trash tables.
+func (d *DB) Restore(ctx context.Context, id int) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var n int
+	if err := tx.QueryRowContext(ctx, "select count(*) from workouts where id=$1", id).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("workout %d already exists, not restoring", id)
+	}
+
+	var removedAt sql.NullString
+	if err := tx.QueryRowContext(ctx, "select max(removed_at) from workouts_trash where id=$1", id).Scan(&removedAt); err != nil {
+		return err
+	}
+	if !removedAt.Valid {
+		return fmt.Errorf("workout %d not found in trash", id)
+	}
+
+	for _, tt := range trashTables {
+		table, idCol := tt[0], tt[1]
+
+		cols, err := tableColumns(tx, table)
+		if err != nil {
+			return err
+		}
+		colss := strings.Join(cols, ", ")
+
+		if _, err := tx.ExecContext(ctx, "insert into "+table+" ("+colss+") select "+colss+" from "+table+"_trash where "+idCol+"=$1 and removed_at=$2", id, removedAt.String); err != nil {
+			return fmt.Errorf("restoring workout %d to %s: %w", id, table, err)
+		}
+		if _, err := tx.ExecContext(ctx, "delete from "+table+"_trash where "+idCol+"=$1 and removed_at=$2", id, removedAt.String); err != nil {
+			return err
+		}
+	}
+
+	if d.spatialIndex {
+		if _, err := tx.ExecContext(ctx, "insert into workout_bounds select workout_id, min(lat), max(lat), min(lng), max(lng) from workout_positions where workout_id=$1 group by workout_id", id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// TrashedWorkout is a workout in the trash.
+type TrashedWorkout struct {
+	ID        int
+	UserName  string
+	Name      string
+	StartedAt time.Time
+	RemovedAt time.Time
+}
+
+// Trashed returns the workouts in the trash, oldest removal first.
+func (d *DB) Trashed(ctx context.Context) ([]TrashedWorkout, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := d.db.QueryContext(ctx, "select id, user_name, name, started_at, removed_at from workouts_trash order by removed_at, started_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TrashedWorkout
+	for rows.Next() {
+		var (
+			t       TrashedWorkout
+			started string
+		)
+		if err := rows.Scan(&t.ID, &t.UserName, &t.Name, &started, &t.RemovedAt); err != nil {
+			return nil, err
+		}
+		// The trash tables are created from a select, so the copied
+		// started_at loses its datetime type and is read back as text.
+		if t.StartedAt, err = time.Parse(timeFormat, started); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,93 @@
+package sync
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/danp/mapmyride"
+)
+
+// heartRateZones is the zones.kind and workout_zone_times.kind for heart
+// rate zones.
+const heartRateZones = "heart_rate"
+
+// loadZones reads the zones set by SetHeartRateZones, if any.
+func (s *DB) loadZones() error {
+	var bounds string
+	err := s.db.QueryRow("select bounds from zones where kind=$1", heartRateZones).Scan(&bounds)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.hrZones, err = mapmyride.ParseZones(bounds)
+	return err
+}
+
+// HeartRateZones returns the zones set by SetHeartRateZones, or nil if
+// none have been set.
+func (d *DB) HeartRateZones() mapmyride.Zones {
+	return d.hrZones
+}
+
+// SetHeartRateZones sets the heart rate zones that time in zone is
+// computed with. The zones are saved in the database and used by future
+// syncs. If they differ from the zones already set, time in zone is
+// recomputed for all stored workouts.
+func (d *DB) SetHeartRateZones(ctx context.Context, z mapmyride.Zones) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	if z.String() == d.hrZones.String() {
+		return nil
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "insert or replace into zones (kind, bounds) values ($1, $2)", heartRateZones, z.String()); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "delete from workout_zone_times where kind=$1", heartRateZones); err != nil {
+		return err
+	}
+
+	ids, err := queryIDs(ctx, tx, "select id from workouts where has_heart_rates")
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		w, err := loadWorkout(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := insertZoneTimes(ctx, tx, heartRateZones, id, w.HeartRateZoneTimes(z)); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	d.hrZones = z
+	return nil
+}
+
+func insertZoneTimes(ctx context.Context, tx *sql.Tx, kind string, workoutID int, times []time.Duration) error {
+	for i, t := range times {
+		_, err := tx.ExecContext(
+			ctx,
+			"insert into workout_zone_times (workout_id, kind, zone, seconds) values ($1, $2, $3, $4)",
+			workoutID, kind, i+1, t.Seconds(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
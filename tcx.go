@@ -0,0 +1,270 @@
+package mapmyride
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tcx is the subset of Training Center XML v2 written by WriteTCX.
+type tcx struct {
+	XMLName    xml.Name      `xml:"TrainingCenterDatabase"`
+	XMLNS      string        `xml:"xmlns,attr"`
+	XMLNSAX    string        `xml:"xmlns:ax,attr"`
+	Activities tcxActivities `xml:"Activities"`
+}
+
+type tcxActivities struct {
+	Activity tcxActivity `xml:"Activity"`
+}
+
+type tcxActivity struct {
+	Sport string   `xml:"Sport,attr"`
+	ID    string   `xml:"Id"`
+	Laps  []tcxLap `xml:"Lap"`
+	Notes string   `xml:"Notes,omitempty"`
+}
+
+type tcxLap struct {
+	StartTime           string    `xml:"StartTime,attr"`
+	TotalTimeSeconds    string    `xml:"TotalTimeSeconds"`
+	DistanceMeters      string    `xml:"DistanceMeters"`
+	MaximumSpeed        string    `xml:"MaximumSpeed,omitempty"`
+	Calories            int       `xml:"Calories"`
+	AverageHeartRateBpm *tcxValue `xml:"AverageHeartRateBpm,omitempty"`
+	MaximumHeartRateBpm *tcxValue `xml:"MaximumHeartRateBpm,omitempty"`
+	Intensity           string    `xml:"Intensity"`
+	TriggerMethod       string    `xml:"TriggerMethod"`
+	Track               *tcxTrack `xml:"Track,omitempty"`
+}
+
+type tcxValue struct {
+	Value int `xml:"Value"`
+}
+
+type tcxTrack struct {
+	Points []tcxTrackpoint `xml:"Trackpoint"`
+}
+
+type tcxTrackpoint struct {
+	Time           string         `xml:"Time"`
+	Position       *tcxPosition   `xml:"Position,omitempty"`
+	AltitudeMeters string         `xml:"AltitudeMeters,omitempty"`
+	DistanceMeters string         `xml:"DistanceMeters,omitempty"`
+	HeartRateBpm   *tcxValue      `xml:"HeartRateBpm,omitempty"`
+	Cadence        string         `xml:"Cadence,omitempty"`
+	Extensions     *tcxExtensions `xml:"Extensions,omitempty"`
+
+	elapsed   time.Duration
+	speed, hr float64
+	hasSpeed  bool
+	hasHR     bool
+}
+
+type tcxPosition struct {
+	Lat string `xml:"LatitudeDegrees"`
+	Lng string `xml:"LongitudeDegrees"`
+}
+
+type tcxExtensions struct {
+	TPX tcxTPX `xml:"ax:TPX"`
+}
+
+// tcxTPX is Garmin's ActivityExtension v2 trackpoint extension.
+type tcxTPX struct {
+	Speed      string `xml:"ax:Speed,omitempty"`
+	RunCadence string `xml:"ax:RunCadence,omitempty"`
+	Watts      string `xml:"ax:Watts,omitempty"`
+}
+
+// WriteTCX writes w to out as a Training Center XML activity, for
+// importing into Garmin Connect and similar. Each measurement in w's
+// series becomes part of the trackpoint at its time, with speed, step
+// cadence and power in Garmin's ActivityExtension. Laps are split at
+// w.Pauses(), with w's calories, and its distance if it has no distance
+// series, shared between them by time.
+func (w Workout) WriteTCX(out io.Writer) error {
+	doc := tcx{
+		XMLNS:   "http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2",
+		XMLNSAX: "http://www.garmin.com/xmlschemas/ActivityExtension/v2",
+	}
+	act := tcxActivity{
+		Sport: tcxSport(w.Kind),
+		ID:    xmlTime(w.StartedAt),
+		Notes: w.Name,
+	}
+
+	points := w.tcxTrackpoints()
+	if len(points) == 0 {
+		act.Laps = []tcxLap{{
+			StartTime:        xmlTime(w.StartedAt),
+			TotalTimeSeconds: formatSeconds(w.Duration),
+			DistanceMeters:   strconv.FormatFloat(w.Distance, 'f', 1, 64),
+			Calories:         w.Kcal,
+			Intensity:        "Active",
+			TriggerMethod:    "Manual",
+		}}
+		doc.Activities.Activity = act
+		return writeXML(out, doc)
+	}
+
+	// Split points into laps at pauses.
+	var laps [][]tcxTrackpoint
+	pauses := w.Pauses()
+	start := 0
+	for i := 1; i <= len(points); i++ {
+		if i == len(points) || inPause(pauses, points[i-1].elapsed, points[i].elapsed) {
+			laps = append(laps, points[start:i])
+			start = i
+		}
+	}
+
+	var total time.Duration
+	for _, lps := range laps {
+		total += lps[len(lps)-1].elapsed - lps[0].elapsed
+	}
+	var prevEnd time.Duration
+	for _, lps := range laps {
+		first, last := lps[0].elapsed, lps[len(lps)-1].elapsed
+		share := 1 / float64(len(laps))
+		if total > 0 {
+			share = float64(last-first) / float64(total)
+		}
+
+		// Distance covered during a pause goes to the lap after it, so
+		// laps add up to the whole.
+		distance := w.Distance * share
+		if len(w.Distances) > 0 {
+			distance = w.distanceAt(last) - w.distanceAt(prevEnd)
+		}
+		prevEnd = last
+
+		lap := tcxLap{
+			StartTime:        xmlTime(w.StartedAt.Add(first)),
+			TotalTimeSeconds: formatSeconds(last - first),
+			DistanceMeters:   strconv.FormatFloat(distance, 'f', 1, 64),
+			Calories:         int(math.Round(float64(w.Kcal) * share)),
+			Intensity:        "Active",
+			TriggerMethod:    "Manual",
+			Track:            &tcxTrack{Points: lps},
+		}
+
+		var (
+			maxSpeed, hrSum, maxHR float64
+			hrs                    int
+		)
+		for _, p := range lps {
+			if p.hasSpeed {
+				maxSpeed = math.Max(maxSpeed, p.speed)
+			}
+			if p.hasHR {
+				hrSum += p.hr
+				maxHR = math.Max(maxHR, p.hr)
+				hrs++
+			}
+		}
+		if maxSpeed > 0 {
+			lap.MaximumSpeed = strconv.FormatFloat(maxSpeed, 'f', 2, 64)
+		}
+		if hrs > 0 {
+			lap.AverageHeartRateBpm = &tcxValue{int(math.Round(hrSum / float64(hrs)))}
+			lap.MaximumHeartRateBpm = &tcxValue{int(math.Round(maxHR))}
+		}
+		act.Laps = append(act.Laps, lap)
+	}
+
+	doc.Activities.Activity = act
+	return writeXML(out, doc)
+}
+
+// tcxTrackpoints merges w's series into trackpoints, one per distinct
+// elapsed time, in time order.
+func (w Workout) tcxTrackpoints() []tcxTrackpoint {
+	byElapsed := make(map[time.Duration]*tcxTrackpoint)
+	at := func(el time.Duration) *tcxTrackpoint {
+		tp, ok := byElapsed[el]
+		if !ok {
+			tp = &tcxTrackpoint{elapsed: el, Time: xmlTime(w.StartedAt.Add(el))}
+			byElapsed[el] = tp
+		}
+		return tp
+	}
+	tpx := func(tp *tcxTrackpoint) *tcxTPX {
+		if tp.Extensions == nil {
+			tp.Extensions = &tcxExtensions{}
+		}
+		return &tp.Extensions.TPX
+	}
+
+	for _, p := range w.Positions {
+		tp := at(p.Elapsed)
+		tp.Position = &tcxPosition{Lat: formatCoord(p.Lat), Lng: formatCoord(p.Lng)}
+		tp.AltitudeMeters = strconv.FormatFloat(p.Elevation, 'f', 1, 64)
+	}
+	for _, d := range w.Distances {
+		at(d.Elapsed).DistanceMeters = strconv.FormatFloat(d.Total, 'f', 1, 64)
+	}
+	for _, hr := range w.HeartRates {
+		tp := at(hr.Elapsed)
+		tp.HeartRateBpm = &tcxValue{int(math.Round(hr.BeatsPerMinute))}
+		tp.hr, tp.hasHR = hr.BeatsPerMinute, true
+	}
+	for _, c := range w.Cadences {
+		at(c.Elapsed).Cadence = strconv.Itoa(int(math.Round(c.RPM)))
+	}
+	for _, s := range w.Speeds {
+		tp := at(s.Elapsed)
+		tpx(tp).Speed = strconv.FormatFloat(s.MetersPerSecond, 'f', 2, 64)
+		tp.speed, tp.hasSpeed = s.MetersPerSecond, true
+	}
+	for _, c := range w.StepCadences() {
+		// RunCadence counts one foot's steps.
+		tpx(at(c.Elapsed)).RunCadence = strconv.Itoa(int(math.Round(c.StepsPerMinute / 2)))
+	}
+	for _, p := range w.Powers {
+		tpx(at(p.Elapsed)).Watts = strconv.Itoa(int(math.Round(p.Watts)))
+	}
+
+	out := make([]tcxTrackpoint, 0, len(byElapsed))
+	for _, tp := range byElapsed {
+		out = append(out, *tp)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].elapsed < out[j].elapsed })
+	return out
+}
+
+// tcxSport returns the TCX sport for a workout kind: Biking, Running or
+// Other.
+func tcxSport(kind string) string {
+	k := strings.ToLower(kind)
+	switch {
+	case strings.Contains(k, "ride") || strings.Contains(k, "bik") || strings.Contains(k, "cycl"):
+		return "Biking"
+	case strings.Contains(k, "run") || strings.Contains(k, "jog"):
+		return "Running"
+	}
+	return "Other"
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// writeXML writes v to out as an indented XML document.
+func writeXML(out io.Writer, v interface{}) error {
+	if _, err := io.WriteString(out, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("encoding xml: %w", err)
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
@@ -0,0 +1,146 @@
+package mapmyride
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWorkoutWriteTCX(t *testing.T) {
+	w := Workout{
+		Name:      "Lunch Run",
+		Kind:      "run",
+		Kcal:      300,
+		Duration:  20 * time.Second,
+		StartedAt: time.Date(2021, 7, 10, 12, 0, 0, 0, time.UTC),
+		Positions: []WorkoutPosition{
+			{Elapsed: 0, Lat: 44.6488, Lng: -63.5752, Elevation: 10},
+			{Elapsed: 10 * time.Second, Lat: 44.6489, Lng: -63.5753, Elevation: 11},
+			// Paused from 10s to 70s.
+			{Elapsed: 70 * time.Second, Lat: 44.65, Lng: -63.576, Elevation: 12},
+			{Elapsed: 80 * time.Second, Lat: 44.6501, Lng: -63.5761, Elevation: 12},
+		},
+		Distances: []WorkoutDistance{
+			{Elapsed: 10 * time.Second, Total: 30},
+			{Elapsed: 80 * time.Second, Total: 60},
+		},
+		HeartRates: []WorkoutHeartRate{
+			{Elapsed: 10 * time.Second, BeatsPerMinute: 140},
+			{Elapsed: 80 * time.Second, BeatsPerMinute: 150},
+		},
+		Speeds: []WorkoutSpeed{
+			{Elapsed: 10 * time.Second, MetersPerSecond: 3},
+		},
+		Steps: []WorkoutStep{
+			{Elapsed: 10 * time.Second, StepsInPeriod: 30},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := w.WriteTCX(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2" xmlns:ax="http://www.garmin.com/xmlschemas/ActivityExtension/v2">
+  <Activities>
+    <Activity Sport="Running">
+      <Id>2021-07-10T12:00:00Z</Id>
+      <Lap StartTime="2021-07-10T12:00:00Z">
+        <TotalTimeSeconds>10</TotalTimeSeconds>
+        <DistanceMeters>30.0</DistanceMeters>
+        <MaximumSpeed>3.00</MaximumSpeed>
+        <Calories>150</Calories>
+        <AverageHeartRateBpm>
+          <Value>140</Value>
+        </AverageHeartRateBpm>
+        <MaximumHeartRateBpm>
+          <Value>140</Value>
+        </MaximumHeartRateBpm>
+        <Intensity>Active</Intensity>
+        <TriggerMethod>Manual</TriggerMethod>
+        <Track>
+          <Trackpoint>
+            <Time>2021-07-10T12:00:00Z</Time>
+            <Position>
+              <LatitudeDegrees>44.6488000</LatitudeDegrees>
+              <LongitudeDegrees>-63.5752000</LongitudeDegrees>
+            </Position>
+            <AltitudeMeters>10.0</AltitudeMeters>
+          </Trackpoint>
+          <Trackpoint>
+            <Time>2021-07-10T12:00:10Z</Time>
+            <Position>
+              <LatitudeDegrees>44.6489000</LatitudeDegrees>
+              <LongitudeDegrees>-63.5753000</LongitudeDegrees>
+            </Position>
+            <AltitudeMeters>11.0</AltitudeMeters>
+            <DistanceMeters>30.0</DistanceMeters>
+            <HeartRateBpm>
+              <Value>140</Value>
+            </HeartRateBpm>
+            <Extensions>
+              <ax:TPX>
+                <ax:Speed>3.00</ax:Speed>
+                <ax:RunCadence>90</ax:RunCadence>
+              </ax:TPX>
+            </Extensions>
+          </Trackpoint>
+        </Track>
+      </Lap>
+      <Lap StartTime="2021-07-10T12:01:10Z">
+        <TotalTimeSeconds>10</TotalTimeSeconds>
+        <DistanceMeters>30.0</DistanceMeters>
+        <Calories>150</Calories>
+        <AverageHeartRateBpm>
+          <Value>150</Value>
+        </AverageHeartRateBpm>
+        <MaximumHeartRateBpm>
+          <Value>150</Value>
+        </MaximumHeartRateBpm>
+        <Intensity>Active</Intensity>
+        <TriggerMethod>Manual</TriggerMethod>
+        <Track>
+          <Trackpoint>
+            <Time>2021-07-10T12:01:10Z</Time>
+            <Position>
+              <LatitudeDegrees>44.6500000</LatitudeDegrees>
+              <LongitudeDegrees>-63.5760000</LongitudeDegrees>
+            </Position>
+            <AltitudeMeters>12.0</AltitudeMeters>
+          </Trackpoint>
+          <Trackpoint>
+            <Time>2021-07-10T12:01:20Z</Time>
+            <Position>
+              <LatitudeDegrees>44.6501000</LatitudeDegrees>
+              <LongitudeDegrees>-63.5761000</LongitudeDegrees>
+            </Position>
+            <AltitudeMeters>12.0</AltitudeMeters>
+            <DistanceMeters>60.0</DistanceMeters>
+            <HeartRateBpm>
+              <Value>150</Value>
+            </HeartRateBpm>
+          </Trackpoint>
+        </Track>
+      </Lap>
+      <Notes>Lunch Run</Notes>
+    </Activity>
+  </Activities>
+</TrainingCenterDatabase>
+`
+	if d := cmp.Diff(want, buf.String()); d != "" {
+		t.Errorf("tcx mismatch (-want +got):\n%s", d)
+	}
+
+	// Workouts without series get a single lap of their totals.
+	buf.Reset()
+	manual := Workout{Kind: "yoga", Kcal: 100, Duration: time.Hour, StartedAt: w.StartedAt}
+	if err := manual.WriteTCX(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte(`<Activity Sport="Other">`)) || !bytes.Contains(buf.Bytes(), []byte("<TotalTimeSeconds>3600</TotalTimeSeconds>")) {
+		t.Errorf("got unexpected tcx for workout without series:\n%s", buf.String())
+	}
+}
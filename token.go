@@ -0,0 +1,126 @@
+package mapmyride
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CachingTokenSource is a TokenSource that keeps the token from an
+// underlying source in a file, so it is reused across runs, and gets a
+// new one from the source once it expires.
+type CachingTokenSource struct {
+	src  TokenSource
+	path string
+
+	mu  sync.Mutex
+	tok Token // zero until read from path or src
+	// invalid is set by Invalidate until the next token from src, so the
+	// rejected token in the file isn't read back.
+	invalid bool
+	now     func() time.Time
+}
+
+// NewCachingTokenSource returns a CachingTokenSource caching the tokens
+// from src in the file path, which is created if needed.
+func NewCachingTokenSource(src TokenSource, path string) *CachingTokenSource {
+	return &CachingTokenSource{src: src, path: path, now: time.Now}
+}
+
+// tokenFile is the format of a CachingTokenSource's file.
+type tokenFile struct {
+	Token  string    `json:"token"`
+	Expiry time.Time `json:"expiry,omitempty"`
+}
+
+// Token returns the cached token, or a new one from the underlying source
+// if there is none, it has expired or it was invalidated.
+func (s *CachingTokenSource) Token() (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tok.Token == "" && !s.invalid {
+		tok, err := s.read()
+		if err != nil {
+			return Token{}, err
+		}
+		s.tok = tok
+	}
+	if s.tok.Token != "" && !s.tok.Expired(s.now()) {
+		return s.tok, nil
+	}
+
+	tok, err := s.src.Token()
+	if err != nil {
+		return Token{}, err
+	}
+	if err := s.write(tok); err != nil {
+		return Token{}, err
+	}
+	s.tok, s.invalid = tok, false
+	return tok, nil
+}
+
+// Invalidate drops the cached token, such as after it was rejected, so
+// the next call to Token gets a new one from the underlying source. If
+// that is an InvalidatingTokenSource, it is invalidated too.
+func (s *CachingTokenSource) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tok, s.invalid = Token{}, true
+	if is, ok := s.src.(InvalidatingTokenSource); ok {
+		is.Invalidate()
+	}
+}
+
+// read returns the token in the cache file, or a zero Token if there is
+// no file yet.
+func (s *CachingTokenSource) read() (Token, error) {
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return Token{}, nil
+	}
+	if err != nil {
+		return Token{}, err
+	}
+
+	var f tokenFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return Token{}, fmt.Errorf("reading token cache %s: %w", s.path, err)
+	}
+	return Token{Token: f.Token, Expiry: f.Expiry}, nil
+}
+
+// write replaces the cache file with tok, readable only by its owner.
+func (s *CachingTokenSource) write(tok Token) error {
+	b, err := json.Marshal(tokenFile{Token: tok.Token, Expiry: tok.Expiry})
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".token-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), s.path); err != nil {
+		return fmt.Errorf("writing token cache %s: %w", s.path, err)
+	}
+	return nil
+}
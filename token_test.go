@@ -0,0 +1,104 @@
+package mapmyride
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type countingTokenSource struct {
+	n      int
+	expiry time.Time
+}
+
+func (s *countingTokenSource) Token() (Token, error) {
+	s.n++
+	return Token{Token: "token" + strconv.Itoa(s.n), Expiry: s.expiry}, nil
+}
+
+func TestCachingTokenSource(t *testing.T) {
+	now := time.Date(2021, 7, 10, 12, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "cache", "token.json")
+	src := &countingTokenSource{expiry: now.Add(time.Hour)}
+
+	s := NewCachingTokenSource(src, path)
+	s.now = func() time.Time { return now }
+	for i := 0; i < 2; i++ {
+		tok, err := s.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.Token != "token1" || !tok.Expiry.Equal(src.expiry) {
+			t.Errorf("call %d: got %+v, want token1 expiring %v", i, tok, src.expiry)
+		}
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0o600 {
+		t.Errorf("got cache file mode %v, want 0600", perm)
+	}
+
+	// A new source, as in the next run, reads the cached token.
+	s = NewCachingTokenSource(src, path)
+	s.now = func() time.Time { return now.Add(30 * time.Minute) }
+	tok, err := s.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Token != "token1" || src.n != 1 {
+		t.Errorf("got %q after %d source calls, want the cached token1 after 1", tok.Token, src.n)
+	}
+
+	// Once it expires a new token is fetched and cached.
+	src.expiry = now.Add(3 * time.Hour)
+	s.now = func() time.Time { return now.Add(time.Hour) }
+	tok, err = s.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Token != "token2" {
+		t.Errorf("got %q after expiry, want token2", tok.Token)
+	}
+
+	s = NewCachingTokenSource(src, path)
+	s.now = func() time.Time { return now.Add(2 * time.Hour) }
+	if tok, err := s.Token(); err != nil || tok.Token != "token2" {
+		t.Errorf("got %q, %v from cache, want token2", tok.Token, err)
+	}
+}
+
+func TestCachingTokenSourceInvalidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	// Without an expiry, only Invalidate replaces the token.
+	src := &countingTokenSource{}
+
+	s := NewCachingTokenSource(src, path)
+	if tok, err := s.Token(); err != nil || tok.Token != "token1" {
+		t.Fatalf("got %q, %v, want token1", tok.Token, err)
+	}
+	s.Invalidate()
+	if tok, err := s.Token(); err != nil || tok.Token != "token2" {
+		t.Errorf("got %q, %v after invalidating, want token2", tok.Token, err)
+	}
+	if tok, err := s.Token(); err != nil || tok.Token != "token2" || src.n != 2 {
+		t.Errorf("got %q, %v after %d source calls, want the cached token2 after 2", tok.Token, err, src.n)
+	}
+
+	// The replacement is what the next run reads.
+	s = NewCachingTokenSource(src, path)
+	if tok, err := s.Token(); err != nil || tok.Token != "token2" {
+		t.Errorf("got %q, %v from cache, want token2", tok.Token, err)
+	}
+
+	// Invalidating before anything is read doesn't read the file's token.
+	s = NewCachingTokenSource(src, path)
+	s.Invalidate()
+	if tok, err := s.Token(); err != nil || tok.Token != "token3" {
+		t.Errorf("got %q, %v after invalidating a fresh source, want token3", tok.Token, err)
+	}
+}
@@ -0,0 +1,89 @@
+package mapmyride
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// WorkoutUpdate is the changes UpdateWorkout makes to a workout. Fields
+// left zero are not changed.
+type WorkoutUpdate struct {
+	Name           string
+	ActivityTypeID int
+
+	// Notes replaces the workout's notes if it's not nil. Point it at an
+	// empty string to clear them.
+	Notes *string
+}
+
+// UpdateWorkout changes the workout with the given ID as u says, such as
+// to rename it or fix its activity type. If the workout doesn't exist,
+// the error wraps ErrNotFound.
+func (c *Client) UpdateWorkout(ctx context.Context, id int, u WorkoutUpdate) error {
+	fields := make(map[string]interface{})
+	if u.Name != "" {
+		fields["name"] = u.Name
+	}
+	if u.ActivityTypeID != 0 {
+		fields["activity_type"] = "/v7.0/activity_type/" + strconv.Itoa(u.ActivityTypeID) + "/"
+	}
+	if u.Notes != nil {
+		fields["notes"] = *u.Notes
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	if err := c.changeWorkout(ctx, "PUT", id, body); err != nil {
+		return fmt.Errorf("updating workout %d: %w", id, err)
+	}
+	return nil
+}
+
+// DeleteWorkout deletes the workout with the given ID, such as a
+// duplicate. If the workout doesn't exist, the error wraps ErrNotFound.
+func (c *Client) DeleteWorkout(ctx context.Context, id int) error {
+	if err := c.changeWorkout(ctx, "DELETE", id, nil); err != nil {
+		return fmt.Errorf("deleting workout %d: %w", id, err)
+	}
+	return nil
+}
+
+// changeWorkout makes a method request with body, if any, for the
+// workout with the given ID. Unlike creating one, changing a workout
+// twice has the same effect as once, so the request is retried.
+func (c *Client) changeWorkout(ctx context.Context, method string, id int, body []byte) error {
+	req, err := c.newRequest(ctx, method, "/vxproxy/v7.0/workout/"+strconv.Itoa(id)+"/")
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+		req.Body, _ = req.GetBody()
+		req.ContentLength = int64(len(body))
+		req.Header.Set("content-type", "application/json")
+	}
+
+	resp, err := c.httpDo(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return checkResponse(resp)
+}
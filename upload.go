@@ -0,0 +1,88 @@
+package mapmyride
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+)
+
+// FileFormat is the format of a recorded workout file.
+type FileFormat string
+
+const (
+	FormatGPX FileFormat = "gpx"
+	FormatTCX FileFormat = "tcx"
+)
+
+// UploadWorkoutFile imports the workout recorded in r, a GPX or TCX file
+// as format says, with the site's file import and returns the ID of the
+// workout it created.
+//
+// Like CreateWorkout, uploading is never retried, since a request that
+// seemed to fail may still have created the workout.
+func (c *Client) UploadWorkoutFile(ctx context.Context, r io.Reader, format FileFormat) (int, error) {
+	if format != FormatGPX && format != FormatTCX {
+		return 0, fmt.Errorf("unknown file format %q, want gpx or tcx", format)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "workout."+string(format))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(fw, r); err != nil {
+		return 0, err
+	}
+	if err := mw.Close(); err != nil {
+		return 0, err
+	}
+
+	req, err := c.newRequest(ctx, "POST", "/vxproxy/v7.0/file_import/")
+	if err != nil {
+		return 0, err
+	}
+	req.Body = ioutil.NopCloser(&body)
+	req.ContentLength = int64(body.Len())
+	req.Header.Set("content-type", mw.FormDataContentType())
+
+	resp, err := c.httpDoOnce(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		if err := checkResponse(resp); err != nil {
+			return 0, fmt.Errorf("uploading workout file: %w", err)
+		}
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	var rawresp struct {
+		Links map[string][]struct {
+			ID string
+		} `json:"_links"`
+	}
+	if err := json.Unmarshal(b, &rawresp); err != nil {
+		return 0, fmt.Errorf("uploading workout file: %w", err)
+	}
+	workout := rawresp.Links["workout"]
+	if len(workout) != 1 {
+		return 0, fmt.Errorf("uploading workout file: no workout id in response")
+	}
+	id, err := strconv.Atoi(workout[0].ID)
+	if err != nil {
+		return 0, fmt.Errorf("uploading workout file: bad workout id in response: %w", err)
+	}
+	return id, nil
+}